@@ -0,0 +1,130 @@
+// append-style encoding to byte slices, as the standard library, so that
+// callers composing larger frames avoid intermediate Encoder buffers.
+
+package binary
+
+import (
+	"math"
+)
+
+// AppendValue append encoding of x to dst as Encode, and returns the extended
+// buffer. dst is grown only if its capacity is not enough.
+func AppendValue(dst []byte, x interface{}) ([]byte, error) {
+	size := Sizeof(x)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(x, nil) //error of invalid data
+		return dst, err
+	}
+	l := len(dst)
+	if cap(dst)-l < size {
+		b := make([]byte, l, l+size)
+		copy(b, dst)
+		dst = b
+	}
+	encoder := getEncoder(dst[l : l+size])
+	defer putEncoder(encoder)
+	if err := encoder.Value(x); err != nil {
+		return dst, err
+	}
+	return dst[:l+encoder.Len()], nil
+}
+
+// AppendBool append a bool value to dst as a byte.
+func AppendBool(dst []byte, x bool) []byte {
+	if x {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+// AppendInt8 append an int8 value to dst.
+func AppendInt8(dst []byte, x int8) []byte {
+	return append(dst, byte(x))
+}
+
+// AppendUint8 append a uint8 value to dst.
+func AppendUint8(dst []byte, x uint8) []byte {
+	return append(dst, x)
+}
+
+// AppendInt16 append an int16 value to dst in DefaultEndian.
+func AppendInt16(dst []byte, x int16) []byte {
+	return AppendUint16(dst, uint16(x))
+}
+
+// AppendUint16 append a uint16 value to dst in DefaultEndian.
+func AppendUint16(dst []byte, x uint16) []byte {
+	var b [2]byte
+	DefaultEndian.PutUint16(b[:], x)
+	return append(dst, b[:]...)
+}
+
+// AppendInt32 append an int32 value to dst in DefaultEndian.
+func AppendInt32(dst []byte, x int32) []byte {
+	return AppendUint32(dst, uint32(x))
+}
+
+// AppendUint32 append a uint32 value to dst in DefaultEndian.
+func AppendUint32(dst []byte, x uint32) []byte {
+	var b [4]byte
+	DefaultEndian.PutUint32(b[:], x)
+	return append(dst, b[:]...)
+}
+
+// AppendInt64 append an int64 value to dst in DefaultEndian.
+func AppendInt64(dst []byte, x int64) []byte {
+	return AppendUint64(dst, uint64(x))
+}
+
+// AppendUint64 append a uint64 value to dst in DefaultEndian.
+func AppendUint64(dst []byte, x uint64) []byte {
+	var b [8]byte
+	DefaultEndian.PutUint64(b[:], x)
+	return append(dst, b[:]...)
+}
+
+// AppendFloat32 append a float32 value to dst in DefaultEndian.
+func AppendFloat32(dst []byte, x float32) []byte {
+	return AppendUint32(dst, math.Float32bits(x))
+}
+
+// AppendFloat64 append a float64 value to dst in DefaultEndian.
+func AppendFloat64(dst []byte, x float64) []byte {
+	return AppendUint64(dst, math.Float64bits(x))
+}
+
+// AppendInt append an int value to dst as varint, as Encoder.Int.
+func AppendInt(dst []byte, x int) []byte {
+	return AppendVarint(dst, int64(x))
+}
+
+// AppendUint append a uint value to dst as uvarint, as Encoder.Uint.
+func AppendUint(dst []byte, x uint) []byte {
+	return AppendUvarint(dst, uint64(x))
+}
+
+// AppendVarint append an int64 value to dst as zigzag varint(1~10 bytes).
+func AppendVarint(dst []byte, x int64) []byte {
+	return AppendUvarint(dst, ToUvarint(x))
+}
+
+// AppendUvarint append a uint64 value to dst as uvarint(1~10 bytes).
+func AppendUvarint(dst []byte, x uint64) []byte {
+	var b [MaxVarintLen64]byte
+	n := PutUvarint(b[:], x)
+	return append(dst, b[:n]...)
+}
+
+// AppendString append a string value to dst with uvarint length prefix, as
+// Encoder.String.
+func AppendString(dst []byte, x string) []byte {
+	dst = AppendUvarint(dst, uint64(len(x)))
+	return append(dst, x...)
+}
+
+// AppendBytes append a byte slice to dst with uvarint length prefix, as
+// Encoder.Bytes.
+func AppendBytes(dst []byte, x []byte) []byte {
+	dst = AppendUvarint(dst, uint64(len(x)))
+	return append(dst, x...)
+}
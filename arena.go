@@ -0,0 +1,131 @@
+// allocate decoded values from arenas, so that memory of request-scoped
+// decoding is reused at once instead of being collected value by value.
+
+package binary
+
+import (
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// bytes of arena chunks by default
+const defaultArenaChunk = 64 << 10
+
+// Arena allocate memory of decoded strings, byte slices, and slices/structs of
+// types without pointers in large chunks, which are reused after Reset.
+// Slices/structs of types with pointers are allocated as usual, so that they
+// are scanned by GC.
+// Values decoded with an Arena must not be used after it is Reset.
+// It is not safe for concurrent use.
+type Arena struct {
+	chunks [][]uint64 //chunks allocated, which are reused after Reset
+	chunk  int        //index of current chunk
+	off    int        //words used of current chunk
+	words  int        //words of each chunk
+}
+
+// NewArena make a new Arena of chunks of chunkSize bytes, 0 means 64KB.
+// Values larger than a chunk are allocated by their own.
+func NewArena(chunkSize int) *Arena {
+	if chunkSize <= 0 {
+		chunkSize = defaultArenaChunk
+	}
+	return &Arena{words: (chunkSize + 7) / 8}
+}
+
+// Reset free all memory allocated by Arena at once, to reuse it for decoding
+// of the next request.
+func (a *Arena) Reset() {
+	a.chunk, a.off = 0, 0
+}
+
+// alloc returns zeroed memory of size(>0) bytes aligned to 8 bytes.
+func (a *Arena) alloc(size int) []byte {
+	words := (size + 7) / 8
+	var m []uint64
+	if words > a.words { //too large for chunks
+		m = make([]uint64, words)
+	} else {
+		for {
+			if a.chunk == len(a.chunks) {
+				a.chunks = append(a.chunks, make([]uint64, a.words))
+			}
+			if c := a.chunks[a.chunk]; a.off+words <= len(c) {
+				m = c[a.off : a.off+words]
+				a.off += words
+				break
+			}
+			a.chunk, a.off = a.chunk+1, 0
+		}
+		for i := range m {
+			m[i] = 0
+		}
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&m[0])), size)
+}
+
+// SetArena set Arena to allocate decoded strings, byte slices, and
+// slices/structs of types without pointers, nil means allocating as usual.
+// It does not work for strings and byte slices in zero-copy mode, which refer
+// to the decoder buffer.
+func (decoder *Decoder) SetArena(a *Arena) {
+	decoder.arena = a
+}
+
+// arenaBytes returns a copy of b(len(b)>0) allocated by arena.
+func (decoder *Decoder) arenaBytes(b []byte) []byte {
+	m := decoder.arena.alloc(len(b))
+	copy(m, b)
+	return m[:len(b):len(b)]
+}
+
+// makeSlice set slice v to a new slice of length n, which is allocated by
+// arena if elements have no pointers.
+func (decoder *Decoder) makeSlice(v reflect.Value, n int) {
+	t := v.Type()
+	size := n * int(t.Elem().Size())
+	if decoder.arena == nil || size == 0 || hasPointers(t.Elem()) || !v.CanAddr() {
+		v.Set(reflect.MakeSlice(t, n, n))
+		return
+	}
+	m := decoder.arena.alloc(size)
+	*(*[]byte)(v.Addr().UnsafePointer()) = m[:n:n] //header of n elements of the memory
+}
+
+// newValue returns pointer to a new zero value of type t, which is allocated
+// by arena if t has no pointers.
+func (decoder *Decoder) newValue(t reflect.Type) reflect.Value {
+	if decoder.safe { //pointers are counted only by SafeDecoder
+		decoder.alloc(1, int(t.Size()))
+	}
+	if decoder.arena == nil || t.Size() == 0 || hasPointers(t) {
+		return reflect.New(t)
+	}
+	return reflect.NewAt(t, unsafe.Pointer(&decoder.arena.alloc(int(t.Size()))[0]))
+}
+
+var _pointerTypes sync.Map //reflect.Type -> bool, if type has pointers
+
+// hasPointers reports whether values of type t contain pointers.
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return false
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		if has, ok := _pointerTypes.Load(t); ok {
+			return has.(bool)
+		}
+		has := false
+		for i := 0; i < t.NumField() && !has; i++ {
+			has = hasPointers(t.Field(i).Type)
+		}
+		_pointerTypes.Store(t, has)
+		return has
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+// encode/decode batches of values of one type, such as records of database
+// pages and messages of batches, looking up the type once per batch.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// EncodeBatch marshal values of type T to byte array one after another, as
+// appending Encode(&values[i]) of each one, so that each value is decodable
+// by itself.
+// The type is looked up once by Codec of T, and the buffer is allocated once
+// for the batch.
+// nil buffer is aviable, it will create new buffer if necessary.
+func EncodeBatch[T any](values []T, buffer []byte) (b []byte, err error) {
+	c := CodecFor[T]()
+	size := 0
+	for i := range values {
+		s := c.Size(&values[i])
+		if s < 0 {
+			return nil, errorf(ErrUnsupportedType, "binary.EncodeBatch: invalid type %s", c.t.String())
+		}
+		size += s
+	}
+	if len(buffer) < size {
+		buffer = make([]byte, size)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.EncodeBatch")
+		}
+	}()
+	encoder := getEncoder(buffer)
+	defer putEncoder(encoder)
+	v := reflect.ValueOf(values)
+	for i := range values {
+		if c.encode == nil {
+			err = encoder.Value(&values[i])
+		} else {
+			encoder.resetBoolCoder() //bools of each value are in its own bytes
+			err = c.encode(encoder, v.Index(i))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return encoder.Buffer(), nil
+}
+
+// DecodeBatch unmarshal values of type T encoded by EncodeBatch from buffer
+// until it is exhausted, and append them to values.
+// Values decoded before error are returned with it.
+// The type is looked up once by Codec of T.
+func DecodeBatch[T any](buffer []byte, values []T) (s []T, err error) {
+	c := CodecFor[T]()
+	defer func() {
+		if e := recover(); e != nil { //values decoded before error are kept
+			s, err = values[:len(values)-1], panicError(e, "binary.DecodeBatch")
+		}
+	}()
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	var zero T
+	for decoder.pos < len(buffer) {
+		values = append(values, zero)
+		x := &values[len(values)-1]
+		if c.decode == nil {
+			err = decoder.Value(x)
+		} else {
+			decoder.resetBoolCoder()
+			err = c.decode(&decoder, reflect.ValueOf(x).Elem())
+		}
+		if err != nil {
+			return values[:len(values)-1], err
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,161 @@
+package binary
+
+import (
+	"fmt"
+	mbig "math/big" //big is declared by binary_test.go
+	"reflect"
+)
+
+func init() {
+	_builtinCodecs[reflect.TypeOf(mbig.Int{})] = &bigIntCodec
+	_builtinCodecs[reflect.TypeOf(mbig.Float{})] = &bigFloatCodec
+	_builtinCodecs[reflect.TypeOf(mbig.Rat{})] = &bigRatCodec
+}
+
+// sign byte of big numbers
+const (
+	bigPositive = 0
+	bigNegative = 1
+)
+
+func bigSign(neg bool) uint8 {
+	if neg {
+		return bigNegative
+	}
+	return bigPositive
+}
+
+// decodeBigSign decode a sign byte and report whether it is negative.
+func decodeBigSign(decoder *Decoder, t reflect.Type) (bool, error) {
+	switch s := decoder.Uint8(); s {
+	case bigPositive:
+		return false, nil
+	case bigNegative:
+		return true, nil
+	default:
+		return false, fmt.Errorf("binary.Decoder.Value: %s invalid sign byte %d", t.String(), s)
+	}
+}
+
+// sizeofBigAbs returns bytes number of length-prefixed magnitude of x.
+func sizeofBigAbs(x *mbig.Int, field *fieldInfo) int {
+	l := (x.BitLen() + 7) / 8
+	return field.sizeofLen(l) + l
+}
+
+// skipBigAbs skip a length-prefixed magnitude.
+func skipBigAbs(decoder *Decoder, field *fieldInfo) int {
+	size, n := decoder.length(field)
+	decoder.Skip(size)
+	return size + n
+}
+
+// big.Int is encoded as sign byte and length-prefixed big-endian magnitude bytes.
+var bigIntCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		return 1 + sizeofBigAbs(methodValue(v).(*mbig.Int), field)
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		x := methodValue(v).(*mbig.Int)
+		encoder.Uint8(bigSign(x.Sign() < 0))
+		encoder.bytes(x.Bytes(), field)
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		neg, err := decodeBigSign(decoder, v.Type())
+		if err != nil {
+			return err
+		}
+		x := v.Addr().Interface().(*mbig.Int)
+		x.SetBytes(decoder.bytes(field))
+		if neg {
+			x.Neg(x)
+		}
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		decoder.Uint8()
+		return 1 + skipBigAbs(decoder, field)
+	},
+}
+
+// big.Float is encoded as sign byte and length-prefixed gob encoding of its absolute value,
+// which keeps precision, rounding mode and accuracy of the value.
+var bigFloatCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		b, err := bigFloatAbs(v)
+		if err != nil {
+			return -1
+		}
+		return 1 + field.sizeofLen(len(b)) + len(b)
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		b, err := bigFloatAbs(v)
+		if err != nil {
+			return err
+		}
+		encoder.Uint8(bigSign(methodValue(v).(*mbig.Float).Signbit()))
+		encoder.bytes(b, field)
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		neg, err := decodeBigSign(decoder, v.Type())
+		if err != nil {
+			return err
+		}
+		x := v.Addr().Interface().(*mbig.Float)
+		if err := x.GobDecode(decoder.bytes(field)); err != nil {
+			return fmt.Errorf("binary.Decoder.Value: %s %s", v.Type().String(), err.Error())
+		}
+		if neg {
+			x.Neg(x)
+		}
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		decoder.Uint8()
+		return 1 + skipBigAbs(decoder, field)
+	},
+}
+
+// bigFloatAbs returns gob encoding of absolute value of big.Float v.
+func bigFloatAbs(v reflect.Value) ([]byte, error) {
+	x := methodValue(v).(*mbig.Float)
+	return new(mbig.Float).Abs(x).GobEncode()
+}
+
+// big.Rat is encoded as sign byte and length-prefixed big-endian magnitude bytes
+// of its numerator and denominator.
+var bigRatCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		x := methodValue(v).(*mbig.Rat)
+		return 1 + sizeofBigAbs(x.Num(), field) + sizeofBigAbs(x.Denom(), field)
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		x := methodValue(v).(*mbig.Rat)
+		encoder.Uint8(bigSign(x.Sign() < 0))
+		encoder.bytes(x.Num().Bytes(), field)
+		encoder.bytes(x.Denom().Bytes(), field)
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		neg, err := decodeBigSign(decoder, v.Type())
+		if err != nil {
+			return err
+		}
+		num := new(mbig.Int).SetBytes(decoder.bytes(field))
+		denom := new(mbig.Int).SetBytes(decoder.bytes(field))
+		if denom.Sign() == 0 {
+			return fmt.Errorf("binary.Decoder.Value: %s zero denominator", v.Type().String())
+		}
+		if neg {
+			num.Neg(num)
+		}
+		v.Addr().Interface().(*mbig.Rat).SetFrac(num, denom)
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		decoder.Uint8()
+		return 1 + skipBigAbs(decoder, field) + skipBigAbs(decoder, field)
+	},
+}
@@ -351,9 +351,10 @@ func TestReadErrorMsg(t *testing.T) {
 	read(&i, false)
 	s := new(struct{})
 	read(*s, true)
-	read(&s, false)
-	p := &s
-	read(&p, false)
+	pi := &i
+	read(&pi, false)
+	ppi := &pi
+	read(&ppi, false)
 }
 
 func TestReadTruncated(t *testing.T) {
@@ -0,0 +1,73 @@
+// encode/decode int/uint values in N bits for field tag `binary:"bits=N"`.
+// The bits share bytes with bools, so consecutive small fields are packed
+// together, lowest bit first, as C bit-fields of little-endian compilers.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// bitsOf returns bits number of int/uint values of type t of field,
+// or 0 if they are not encoded in bits.
+func (field *fieldInfo) bitsOf(t reflect.Type) int {
+	if field == nil || field.bits == 0 {
+		return 0
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.bits
+	}
+	return 0
+}
+
+// Bits encode the lowest n bits of x to Encoder buffer, which share bytes with bools.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Bits(x uint64, n int) {
+	for i := 0; i < n; i++ {
+		encoder.Bool(x>>uint(i)&1 != 0)
+	}
+}
+
+// Bits decode n bits from Decoder buffer, which share bytes with bools.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) Bits(n int) uint64 {
+	x := uint64(0)
+	for i := 0; i < n; i++ {
+		if decoder.Bool() {
+			x |= 1 << uint(i)
+		}
+	}
+	return x
+}
+
+// bitField encode int/uint value v in n bits.
+// It will panic if v overflows n bits.
+func (encoder *Encoder) bitField(v reflect.Value, n int) {
+	var x uint64
+	overflow := false
+	if isUintKind(v.Kind()) {
+		x = v.Uint()
+		overflow = n < 64 && x>>uint(n) != 0
+	} else {
+		i := v.Int()
+		overflow = n < 64 && (i < -1<<uint(n-1) || i >= 1<<uint(n-1))
+		x = uint64(i)
+	}
+	if overflow {
+		panic(errorf(ErrOverflow, "binary.Encoder.Value: %v overflows %d bits of %s", v.Interface(), n, v.Type().String()))
+	}
+	encoder.Bits(x, n)
+}
+
+// bitField decode int/uint value v in n bits, signed ints are sign extended.
+func (decoder *Decoder) bitField(v reflect.Value, n int) {
+	x := decoder.Bits(n)
+	if isUintKind(v.Kind()) {
+		v.SetUint(x)
+	} else {
+		s := uint(64 - n)
+		v.SetInt(int64(x<<s) >> s)
+	}
+}
@@ -0,0 +1,108 @@
+package binary
+
+import (
+	"reflect"
+)
+
+func init() {
+	_builtinCodecs[reflect.TypeOf(Bitset{})] = &bitsetCodec
+}
+
+// Bitset is a set of bits, which is encoded as compact as []bool,
+// that is length prefix and 1 bit per bool.
+// The zero value is an empty Bitset ready to use.
+type Bitset struct {
+	bits []byte
+	n    int
+}
+
+// NewBitset make a Bitset of n bits of false.
+func NewBitset(n int) *Bitset {
+	return &Bitset{bits: make([]byte, (n+7)/8), n: n}
+}
+
+// Len returns number of bits of the Bitset.
+func (b *Bitset) Len() int {
+	return b.n
+}
+
+// Get returns bit i of the Bitset, false if i is out of range.
+func (b *Bitset) Get(i int) bool {
+	if i < 0 || i >= b.n {
+		return false
+	}
+	return b.bits[i/8]&(1<<uint(i%8)) != 0
+}
+
+// Set set bit i of the Bitset to x, and grows the Bitset if i >= Len.
+// It will panic if i < 0.
+func (b *Bitset) Set(i int, x bool) {
+	if i >= b.n {
+		if i/8 >= len(b.bits) {
+			bits := make([]byte, i/8+1, 2*(i/8+1))
+			copy(bits, b.bits)
+			b.bits = bits
+		}
+		b.n = i + 1
+	}
+	if x {
+		b.bits[i/8] |= 1 << uint(i%8)
+	} else {
+		b.bits[i/8] &^= 1 << uint(i%8)
+	}
+}
+
+// Bitset encode a Bitset value to Encoder buffer as length prefix and bits.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Bitset(x *Bitset) {
+	encoder.bitset(x, nil)
+}
+
+// Bitset decode a Bitset value from Decoder buffer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) Bitset() *Bitset {
+	x := &Bitset{}
+	decoder.bitset(x, nil)
+	return x
+}
+
+// bitset encode Bitset x with length prefix of field.
+func (encoder *Encoder) bitset(x *Bitset, field *fieldInfo) {
+	encoder.length(x.n, field)
+	copy(encoder.reserve((x.n+7)/8), x.bits)
+}
+
+// bitset decode to Bitset x with length prefix of field.
+func (decoder *Decoder) bitset(x *Bitset, field *fieldInfo) {
+	n, _ := decoder.length(field)
+	size := (n + 7) / 8
+	decoder.alloc(size, 1)
+	x.bits = make([]byte, size)
+	copy(x.bits, decoder.reserve(size))
+	x.n = n
+	if n%8 != 0 { //clear bits out of range
+		x.bits[size-1] &= 1<<uint(n%8) - 1
+	}
+}
+
+// Bitset is encoded as []bool.
+var bitsetCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		n := methodValue(v).(*Bitset).n
+		return field.sizeofLen(n) + (n+7)/8
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		encoder.bitset(methodValue(v).(*Bitset), field)
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		decoder.bitset(v.Addr().Interface().(*Bitset), field)
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		n, s := decoder.length(field)
+		size := (n + 7) / 8
+		decoder.Skip(size)
+		return s + size
+	},
+}
@@ -0,0 +1,45 @@
+// write/read bit streams in bit order of bools, for sub-byte protocols such as
+// codecs, compression headers and network flags.
+
+package binary
+
+import (
+	"fmt"
+)
+
+// checkBits panics if n is not a valid bits number of uint64.
+func checkBits(n int) {
+	if n < 0 || n > 64 {
+		panic(fmt.Errorf("binary: invalid bits number %d", n))
+	}
+}
+
+// WriteBits encode the lowest n(0~64) bits of x to Encoder buffer, as Bits.
+// The bits are in the single bit order of bools and Bits, lowest bit first,
+// filling each byte from its lowest bit, so they share bytes with them.
+// Use AlignBits to start the next bits at a new byte.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) WriteBits(x uint64, n int) {
+	checkBits(n)
+	encoder.Bits(x, n)
+}
+
+// ReadBits decode n(0~64) bits from Decoder buffer, lowest bit first, which
+// is encoded by WriteBits or Bits.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) ReadBits(n int) uint64 {
+	checkBits(n)
+	return decoder.Bits(n)
+}
+
+// AlignBits skip the rest bits of the byte shared by bits and bools, so that
+// the next bits or bools start at a new byte.
+func (encoder *Encoder) AlignBits() {
+	encoder.boolBit = 0
+}
+
+// AlignBits skip the rest bits of the byte shared by bits and bools, so that
+// the next bits or bools start at a new byte.
+func (decoder *Decoder) AlignBits() {
+	decoder.boolBit = 0
+}
@@ -0,0 +1,182 @@
+// copy memory of fixed-size number slices/arrays to/from buffer at once,
+// instead of encoding/decoding them element by element.
+
+package binary
+
+import (
+	std "encoding/binary"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// bulkCopyMin is the min bytes of arrays passed by value, which are copied to
+// a temporary array to be copied at once, smaller ones are put one by one
+// without allocation.
+const bulkCopyMin = 256
+
+// bulkWordSize returns bytes of words to swap for elements of type t which can
+// be copied at once, or 0 if they can not.
+// Words of complex numbers are their real and imaginary parts.
+func bulkWordSize(t reflect.Type, field *fieldInfo) int {
+	if queryCodec(t, field) != nil || isDeltaElem(t, field) || isGroupVarintElem(t, field) || field.bitsOf(t) > 0 {
+		return 0
+	}
+	switch t.Kind() {
+	case reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		if !field.isPacked() {
+			return 2
+		}
+	case reflect.Int32, reflect.Uint32:
+		if !field.isPacked() {
+			return 4
+		}
+	case reflect.Int64, reflect.Uint64:
+		if !field.isPacked() {
+			return 8
+		}
+	case reflect.Float32, reflect.Complex64:
+		return 4
+	case reflect.Float64, reflect.Complex128:
+		return 8
+	}
+	return 0
+}
+
+// canBulk reports whether slice/array v with elements of word size can be
+// copied at once by endian.
+func canBulk(v reflect.Value, word int, endian Endian) bool {
+	if word == 0 {
+		return false
+	}
+	endian = bulkEndian(endian)
+	return word == 1 || endian == LittleEndian || endian == BigEndian
+}
+
+// bulkEndian returns LittleEndian/BigEndian for the same byte order of
+// encoding/binary, which are passed to Write/Read as well.
+func bulkEndian(endian Endian) Endian {
+	switch endian {
+	case std.LittleEndian:
+		return LittleEndian
+	case std.BigEndian:
+		return BigEndian
+	}
+	return endian
+}
+
+// memoryOf returns memory of the first n elements of slice/addressable array v.
+func memoryOf(v reflect.Value, n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	p := v.Index(0).Addr().UnsafePointer()
+	return unsafe.Slice((*byte)(p), n*int(v.Type().Elem().Size()))
+}
+
+// swapWords reverse bytes of every word of word size in b.
+func swapWords(b []byte, word int) {
+	for i := 0; i+word <= len(b); i += word {
+		for j, k := i, i+word-1; j < k; j, k = j+1, k-1 {
+			b[j], b[k] = b[k], b[j]
+		}
+	}
+}
+
+// numbers encode length and fixed-size number elements of slice/array v at once.
+// It reports false and encodes nothing if v can not be copied at once,
+// or buffer is not enough, which is left to element path to fill the buffer.
+func (encoder *Encoder) numbers(v reflect.Value, field *fieldInfo) bool {
+	word := bulkWordSize(v.Type().Elem(), field)
+	if !canBulk(v, word, encoder.endian) {
+		return false
+	}
+	l := v.Len()
+	size := l * int(v.Type().Elem().Size())
+	encoder.ensure(field.sizeofLen(l) + size)
+	if encoder.pos+field.sizeofLen(l)+size > encoder.Cap() {
+		return false
+	}
+	encoder.arrayLength(v, field)
+	b := encoder.reserve(size)
+	if !v.CanAddr() && size < bulkCopyMin { //small array passed by value, of which memory can not be read
+		encoder.putNumbers(b, v, word)
+		return true
+	}
+	if !v.CanAddr() { //copy large array passed by value to read its memory
+		a := reflect.New(v.Type()).Elem()
+		a.Set(v)
+		v = a
+	}
+	copy(b, memoryOf(v, l))
+	if word > 1 && bulkEndian(encoder.endian) != NativeEndian {
+		swapWords(b, word)
+	}
+	return true
+}
+
+// putNumbers put fixed-size number elements of array v which is not
+// addressable to b one by one, without dispatching by Encoder.value.
+func (encoder *Encoder) putNumbers(b []byte, v reflect.Value, word int) {
+	for i, n := 0, v.Len(); i < n; i++ {
+		switch e := v.Index(i); e.Kind() {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			b = encoder.putWord(b, uint64(e.Int()), word)
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			b = encoder.putWord(b, e.Uint(), word)
+		case reflect.Float32:
+			b = encoder.putWord(b, uint64(math.Float32bits(float32(e.Float()))), word)
+		case reflect.Float64:
+			b = encoder.putWord(b, math.Float64bits(e.Float()), word)
+		case reflect.Complex64:
+			x := e.Complex()
+			b = encoder.putWord(b, uint64(math.Float32bits(float32(real(x)))), word)
+			b = encoder.putWord(b, uint64(math.Float32bits(float32(imag(x)))), word)
+		case reflect.Complex128:
+			x := e.Complex()
+			b = encoder.putWord(b, math.Float64bits(real(x)), word)
+			b = encoder.putWord(b, math.Float64bits(imag(x)), word)
+		}
+	}
+}
+
+// putWord put x of word size to b by endian of encoder, and returns the rest of b.
+func (encoder *Encoder) putWord(b []byte, x uint64, word int) []byte {
+	switch word {
+	case 1:
+		b[0] = byte(x)
+	case 2:
+		encoder.endian.PutUint16(b, uint16(x))
+	case 4:
+		encoder.endian.PutUint32(b, uint32(x))
+	case 8:
+		encoder.endian.PutUint64(b, x)
+	}
+	return b[word:]
+}
+
+// numbers decode size fixed-size number elements to slice/array v at once,
+// elements out of v are skiped.
+// It reports false and decodes nothing if v can not be copied at once.
+func (decoder *Decoder) numbers(v reflect.Value, size int, field *fieldInfo) bool {
+	word := bulkWordSize(v.Type().Elem(), field)
+	if !canBulk(v, word, decoder.endian) {
+		return false
+	}
+	elemSize := int(v.Type().Elem().Size())
+	if size > maxInt/elemSize {
+		panic(errorf(ErrOverflow, "binary.Decoder.Value: invalid length %d", size))
+	}
+	n := size
+	if l := v.Len(); n > l {
+		n = l
+	}
+	mem := memoryOf(v, n)
+	copy(mem, decoder.reserve(size*elemSize))
+	if word > 1 && bulkEndian(decoder.endian) != NativeEndian {
+		swapWords(mem, word)
+	}
+	return true
+}
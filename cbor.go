@@ -0,0 +1,499 @@
+// encode/decode values in CBOR format (RFC 8949) by Encoder/Decoder with
+// SetCBOR, for IoT and COSE/WebAuthn peers which mandate CBOR.
+
+package binary
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// major types of CBOR
+const (
+	cbUint = iota
+	cbNegInt
+	cbBytes
+	cbText
+	cbArray
+	cbMap
+	cbTag
+	cbSimple
+	cbFloat //not a major type, floats of major type 7
+)
+
+var cbTypeNames = [...]string{"uint", "negative int", "byte string", "text string", "array", "map", "tag", "simple", "float"}
+
+// cborHead is the decoded head of CBOR value.
+type cborHead struct {
+	major int    //major type
+	x     uint64 //argument, bits of float64 of floats, or simple value
+	indef bool   //if indefinite length, or break of major type 7
+}
+
+// SetCBOR set if Encoder encode values in CBOR format.
+// Structs are encoded as maps of field names to field values, or integer keys
+// of field tag `binary:"cbor=N"` as COSE, and field tags of encoding options
+// are ignored.
+// Encoder with SetDeterministic encode maps with keys sorted by their encoding,
+// as core deterministic encoding of CBOR.
+// Use EncodeCBOR to encode a value without knowing its size.
+func (encoder *Encoder) SetCBOR(cbor bool) {
+	encoder.cbor = cbor
+}
+
+// SetCBOR set if Decoder decode values in CBOR format,
+// which is encoded by Encoder with SetCBOR or other CBOR libraries.
+// Indefinite lengths and half floats are supported, tags are ignored,
+// and unknown fields of structs are skipped.
+func (decoder *Decoder) SetCBOR(cbor bool) {
+	decoder.cbor = cbor
+}
+
+// cborValue encode v in CBOR format.
+func (encoder *Encoder) cborValue(v reflect.Value) {
+	b := encoder.appendCBOR(nil, v)
+	copy(encoder.reserve(len(b)), b)
+}
+
+// appendCBOR append v in CBOR format to b.
+func (encoder *Encoder) appendCBOR(b []byte, v reflect.Value) []byte {
+	switch k := v.Kind(); k {
+	case reflect.Invalid: //nil interface
+		return append(b, 0xf6)
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xf5)
+		}
+		return append(b, 0xf4)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if x := v.Int(); x < 0 {
+			return cbAppendHead(b, cbNegInt, uint64(-1-x))
+		}
+		return cbAppendHead(b, cbUint, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cbAppendHead(b, cbUint, v.Uint())
+	case reflect.Float32:
+		return mpAppendBits(append(b, 0xfa), uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		return mpAppendBits(append(b, 0xfb), math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		b = cbAppendHead(b, cbText, uint64(v.Len()))
+		return append(b, v.String()...)
+	case reflect.Slice, reflect.Array:
+		if k == reflect.Slice && v.IsNil() {
+			return append(b, 0xf6)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 { //byte string
+			b = cbAppendHead(b, cbBytes, uint64(v.Len()))
+			for i, n := 0, v.Len(); i < n; i++ {
+				b = append(b, byte(v.Index(i).Uint()))
+			}
+			return b
+		}
+		b = cbAppendHead(b, cbArray, uint64(v.Len()))
+		for i, n := 0, v.Len(); i < n; i++ {
+			b = encoder.appendCBOR(b, v.Index(i))
+		}
+		return b
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xf6)
+		}
+		if !encoder.visitor.enter(v) {
+			panic(encoder.cycleError(v))
+		}
+		defer encoder.visitor.leave(v)
+		keys := v.MapKeys()
+		entries := make([][2][]byte, len(keys))
+		for i, key := range keys {
+			entries[i] = [2][]byte{encoder.appendCBOR(nil, key), encoder.appendCBOR(nil, v.MapIndex(key))}
+		}
+		return encoder.appendCBOREntries(b, entries)
+	case reflect.Struct:
+		t := v.Type()
+		if queryCodec(t, nil) != nil {
+			panic(errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type %s in CBOR", t.String()))
+		}
+		info := queryStruct(t)
+		var entries [][2][]byte
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if info.fieldValid(i, t) {
+				var key []byte
+				if f := info.field(i); f != nil && f.cborKey != nil {
+					key = encoder.appendCBOR(nil, reflect.ValueOf(*f.cborKey))
+				} else {
+					key = encoder.appendCBOR(nil, reflect.ValueOf(t.Field(i).Name))
+				}
+				entries = append(entries, [2][]byte{key, encoder.appendCBOR(nil, v.Field(i))})
+			}
+		}
+		return encoder.appendCBOREntries(b, entries)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return append(b, 0xf6)
+		}
+		if !encoder.visitor.enter(v) {
+			panic(encoder.cycleError(v))
+		}
+		defer encoder.visitor.leave(v)
+		return encoder.appendCBOR(b, v.Elem())
+	case reflect.Interface:
+		return encoder.appendCBOR(b, v.Elem())
+	}
+	panic(errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type %s in CBOR", v.Type().String()))
+}
+
+// appendCBOREntries append map of encoded keys and values to b.
+func (encoder *Encoder) appendCBOREntries(b []byte, entries [][2][]byte) []byte {
+	if encoder.deterministic {
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i][0], entries[j][0]) < 0 })
+	}
+	b = cbAppendHead(b, cbMap, uint64(len(entries)))
+	for _, e := range entries {
+		b = append(append(b, e[0]...), e[1]...)
+	}
+	return b
+}
+
+// cbAppendHead append head of major type with argument x in the shortest form to b.
+func cbAppendHead(b []byte, major int, x uint64) []byte {
+	m := byte(major << 5)
+	switch {
+	case x < 24:
+		return append(b, m|byte(x))
+	case x <= math.MaxUint8:
+		return append(b, m|24, byte(x))
+	case x <= math.MaxUint16:
+		return mpAppendBits(append(b, m|25), x, 2)
+	case x <= math.MaxUint32:
+		return mpAppendBits(append(b, m|26), x, 4)
+	}
+	return mpAppendBits(append(b, m|27), x, 8)
+}
+
+// cborHead decode head of next value, tags are skipped.
+func (decoder *Decoder) cborHead() cborHead {
+	for {
+		c := decoder.Uint8()
+		h := cborHead{major: int(c >> 5)}
+		switch ai := c & 0x1f; {
+		case ai < 24:
+			h.x = uint64(ai)
+		case ai <= 27:
+			h.x = decoder.mpBits(1 << (ai - 24))
+		case ai == 31 && h.major != cbUint && h.major != cbNegInt && h.major != cbTag:
+			h.indef = true
+		default:
+			panic(fmt.Errorf("binary.Decoder.Value: invalid CBOR head 0x%02x", c))
+		}
+		switch {
+		case h.major == cbTag:
+			continue //ignore tags
+		case h.major != cbSimple || h.indef:
+		case c == 0xf9:
+			h.major, h.x = cbFloat, math.Float64bits(float64(Float16frombits(uint16(h.x))))
+		case c == 0xfa:
+			h.major, h.x = cbFloat, math.Float64bits(float64(math.Float32frombits(uint32(h.x))))
+		case c == 0xfb:
+			h.major = cbFloat
+		}
+		return h
+	}
+}
+
+// isNull returns if h is null or undefined.
+func (h cborHead) isNull() bool {
+	return h.major == cbSimple && !h.indef && (h.x == 22 || h.x == 23)
+}
+
+// isBreak returns if h is the break of indefinite length.
+func (h cborHead) isBreak() bool {
+	return h.major == cbSimple && h.indef
+}
+
+// cborLen returns length of array/map h, or -1 if it is indefinite.
+func (decoder *Decoder) cborLen(h cborHead, elemSize int) int {
+	if h.indef {
+		return -1
+	}
+	return decoder.mpLen(h.x, elemSize)
+}
+
+// cborCap returns capacity for array of length l, which is -1 if indefinite.
+func cborCap(l int) int {
+	if l < 0 {
+		return 0
+	}
+	return l
+}
+
+// cborBytes decode content of byte/text string h, of which chunks of indefinite
+// length are concatenated.
+func (decoder *Decoder) cborBytes(h cborHead) []byte {
+	if !h.indef {
+		return decoder.reserve(decoder.mpLen(h.x, 1))
+	}
+	var b []byte
+	for {
+		c := decoder.cborHead()
+		if c.isBreak() {
+			return b
+		}
+		if c.major != h.major || c.indef {
+			panic(fmt.Errorf("binary.Decoder.Value: invalid CBOR chunk of %s", cbTypeNames[h.major]))
+		}
+		b = append(b, decoder.reserve(decoder.mpLen(c.x, 1))...)
+		decoder.checkLen(len(b))
+	}
+}
+
+// cborValue decode v in CBOR format.
+func (decoder *Decoder) cborValue(v reflect.Value) {
+	decoder.cborValueAt(v, decoder.cborHead())
+}
+
+// cborValueAt decode v from CBOR value, whose head is decoded as h.
+func (decoder *Decoder) cborValueAt(v reflect.Value, h cborHead) {
+	if decoder.maxDepth > 0 {
+		decoder.enter()
+		defer decoder.leave()
+	}
+	if h.isNull() {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	t := v.Type()
+	mismatch := func() {
+		panic(fmt.Errorf("binary.Decoder.Value: can not decode CBOR %s to %s", cbTypeNames[h.major], t.String()))
+	}
+	switch k := v.Kind(); k {
+	case reflect.Bool:
+		if h.major != cbSimple || h.indef || (h.x != 20 && h.x != 21) {
+			mismatch()
+		}
+		v.SetBool(h.x == 21)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if (h.major != cbUint && h.major != cbNegInt) || h.x > math.MaxInt64 {
+			mismatch()
+		}
+		x := int64(h.x)
+		if h.major == cbNegInt {
+			x = -1 - x
+		}
+		if v.OverflowInt(x) {
+			mismatch()
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if h.major != cbUint || v.OverflowUint(h.x) {
+			mismatch()
+		}
+		v.SetUint(h.x)
+	case reflect.Float32, reflect.Float64:
+		switch h.major {
+		case cbFloat:
+			v.SetFloat(math.Float64frombits(h.x))
+		case cbUint:
+			v.SetFloat(float64(h.x))
+		case cbNegInt:
+			v.SetFloat(-1 - float64(h.x))
+		default:
+			mismatch()
+		}
+	case reflect.String:
+		if h.major != cbText && h.major != cbBytes {
+			mismatch()
+		}
+		v.SetString(decoder.validString(string(decoder.cborBytes(h))))
+	case reflect.Slice, reflect.Array:
+		et := t.Elem()
+		if (h.major == cbBytes || h.major == cbText) && et.Kind() == reflect.Uint8 {
+			b := decoder.cborBytes(h)
+			if k == reflect.Slice {
+				v.Set(reflect.MakeSlice(t, len(b), len(b)))
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return
+		}
+		if h.major != cbArray {
+			mismatch()
+		}
+		l := decoder.cborLen(h, int(et.Size()))
+		if k == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, 0, cborCap(l)))
+		}
+		for i := 0; l < 0 || i < l; i++ {
+			e := decoder.cborHead()
+			if l < 0 && e.isBreak() {
+				break
+			}
+			switch {
+			case k == reflect.Slice:
+				v.Set(reflect.Append(v, reflect.Zero(et)))
+				decoder.checkLen(v.Len())
+				decoder.cborValueAt(v.Index(i), e)
+			case i < v.Len():
+				decoder.cborValueAt(v.Index(i), e)
+			default:
+				decoder.cborSkip(e) //elements out of array
+			}
+		}
+	case reflect.Map:
+		if h.major != cbMap {
+			mismatch()
+		}
+		l := decoder.cborLen(h, int(t.Key().Size()+t.Elem().Size()))
+		v.Set(reflect.MakeMap(t))
+		for i := 0; l < 0 || i < l; i++ {
+			e := decoder.cborHead()
+			if l < 0 && e.isBreak() {
+				break
+			}
+			key := reflect.New(t.Key()).Elem()
+			value := reflect.New(t.Elem()).Elem()
+			decoder.cborValueAt(key, e)
+			decoder.cborValue(value)
+			v.SetMapIndex(key, value)
+			decoder.checkLen(v.Len())
+		}
+	case reflect.Struct:
+		if h.major != cbMap || queryCodec(t, nil) != nil {
+			mismatch()
+		}
+		info := queryStruct(t)
+		info.setDefaults(v, nil)
+		l := decoder.cborLen(h, 0)
+		for i := 0; l < 0 || i < l; i++ {
+			e := decoder.cborHead()
+			if l < 0 && e.isBreak() {
+				break
+			}
+			if f := decoder.cborField(info, t, e); f >= 0 {
+				decoder.cborValue(v.Field(f))
+			} else {
+				decoder.cborSkip(decoder.cborHead()) //unknown field
+			}
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		decoder.cborValueAt(v.Elem(), h)
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			mismatch()
+		}
+		if a := decoder.cborAny(h); a != nil {
+			v.Set(reflect.ValueOf(a))
+		}
+	default:
+		mismatch()
+	}
+}
+
+// cborField decode key of struct field with head h, and returns index of the
+// field, or -1 if there is no such field.
+func (decoder *Decoder) cborField(info *structInfo, t reflect.Type, h cborHead) int {
+	switch h.major {
+	case cbText:
+		name := string(decoder.cborBytes(h))
+		if f, ok := t.FieldByName(name); ok && len(f.Index) == 1 && info.fieldValid(f.Index[0], t) {
+			if fi := info.field(f.Index[0]); fi == nil || fi.cborKey == nil {
+				return f.Index[0]
+			}
+		}
+	case cbUint, cbNegInt:
+		key := int64(h.x)
+		if h.major == cbNegInt {
+			key = -1 - key
+		}
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if f := info.field(i); f != nil && f.cborKey != nil && *f.cborKey == key && f.isValid(i, t) {
+				return i
+			}
+		}
+	default:
+		decoder.cborSkip(h)
+	}
+	return -1
+}
+
+// cborAny decode CBOR value as nil, bool, int64, uint64 out of int64, float64,
+// string, []byte, []interface{} or map[interface{}]interface{}.
+func (decoder *Decoder) cborAny(h cborHead) interface{} {
+	switch h.major {
+	case cbUint:
+		if h.x > math.MaxInt64 {
+			return h.x
+		}
+		return int64(h.x)
+	case cbNegInt:
+		if h.x > math.MaxInt64 {
+			panic(errorf(ErrOverflow, "binary.Decoder.Value: CBOR negative int -1-%d overflows int64", h.x))
+		}
+		return -1 - int64(h.x)
+	case cbFloat:
+		return math.Float64frombits(h.x)
+	case cbText:
+		return decoder.validString(string(decoder.cborBytes(h)))
+	case cbBytes:
+		return append([]byte{}, decoder.cborBytes(h)...)
+	case cbArray:
+		l := decoder.cborLen(h, 16)
+		a := make([]interface{}, 0, cborCap(l))
+		for i := 0; l < 0 || i < l; i++ {
+			e := decoder.cborHead()
+			if l < 0 && e.isBreak() {
+				break
+			}
+			a = append(a, decoder.cborNext(e))
+			decoder.checkLen(len(a))
+		}
+		return a
+	case cbMap:
+		l := decoder.cborLen(h, 32)
+		m := make(map[interface{}]interface{})
+		for i := 0; l < 0 || i < l; i++ {
+			e := decoder.cborHead()
+			if l < 0 && e.isBreak() {
+				break
+			}
+			key := decoder.cborNext(e)
+			if b, ok := key.([]byte); ok { //unhashable
+				key = string(b)
+			} else if key != nil && !reflect.TypeOf(key).Comparable() {
+				panic(errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported CBOR map key of type %T", key))
+			}
+			m[key] = decoder.cborNext(decoder.cborHead())
+			decoder.checkLen(len(m))
+		}
+		return m
+	case cbSimple:
+		switch {
+		case h.indef:
+			panic(fmt.Errorf("binary.Decoder.Value: unexpected CBOR break"))
+		case h.x == 20 || h.x == 21:
+			return h.x == 21
+		case h.x == 22 || h.x == 23:
+			return nil
+		}
+	}
+	panic(fmt.Errorf("binary.Decoder.Value: unsupported CBOR %s %d", cbTypeNames[h.major], h.x))
+}
+
+// cborNext decode CBOR value of head h by cborAny.
+func (decoder *Decoder) cborNext(h cborHead) interface{} {
+	if decoder.maxDepth > 0 {
+		decoder.enter()
+		defer decoder.leave()
+	}
+	return decoder.cborAny(h)
+}
+
+// cborSkip skip CBOR value of head h.
+func (decoder *Decoder) cborSkip(h cborHead) {
+	decoder.cborNext(h)
+}
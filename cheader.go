@@ -0,0 +1,142 @@
+// generate C header of struct definitions in C layout, to share the encoding
+// format with C/C++ programs without hand-maintaining parallel definitions.
+
+package binary
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// WriteHeader writes C struct definitions of data and the structs they depend on
+// to w, which match the encoding of data by Encoder.SetCLayout(l).
+// Structs are defined with #pragma pack(1) and explicit padding fields, so the
+// layout does not depend on C compilers, and numbers are in byte order of
+// Encoder. Structs must be named types, and register them by RegStruct to
+// enable field tags.
+func (l *CLayout) WriteHeader(w io.Writer, data ...interface{}) error {
+	g := &headerWriter{layout: l, done: make(map[reflect.Type]bool)}
+	g.buf.WriteString("#include <stdint.h>\n\n#pragma pack(push, 1)\n")
+	for _, d := range data {
+		t := reflect.Indirect(reflect.ValueOf(d)).Type()
+		if t.Kind() != reflect.Struct {
+			return fmt.Errorf("binary.CLayout.WriteHeader: %s is not struct", t.String())
+		}
+		if err := g.define(t); err != nil {
+			return err
+		}
+	}
+	g.buf.WriteString("\n#pragma pack(pop)\n")
+	_, err := w.Write(g.buf.Bytes())
+	return err
+}
+
+// headerWriter writes C struct definitions.
+type headerWriter struct {
+	layout *CLayout
+	done   map[reflect.Type]bool
+	buf    bytes.Buffer
+}
+
+// define writes C definition of struct t after the structs it depends on.
+func (g *headerWriter) define(t reflect.Type) error {
+	if g.done[t] {
+		return nil
+	}
+	size, _ := g.layout.layoutOf(t)
+	if size < 0 {
+		return cLayoutError(t)
+	}
+	if t.Name() == "" {
+		return fmt.Errorf("binary.CLayout.WriteHeader: unnamed struct %s", t.String())
+	}
+	g.done[t] = true
+
+	info := queryStruct(t)
+	for i, n := 0, t.NumField(); i < n; i++ {
+		if ft := cElem(t.Field(i).Type); ft.Kind() == reflect.Struct && info.field(i).isValid(i, t) {
+			if err := g.define(ft); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Fprintf(&g.buf, "\ntypedef struct %s {\n", t.Name())
+	offset, end, pads := 0, 0, 0 //end is end of last declared field
+	pad := func(n int) {
+		if n > 0 {
+			fmt.Fprintf(&g.buf, "\tuint8_t _pad%d[%d];\n", pads, n)
+			pads++
+		}
+	}
+	for i, n := 0, t.NumField(); i < n; i++ {
+		f := t.Field(i)
+		fsize, align := g.layout.layoutOf(f.Type)
+		o := cFieldOffset(offset, align, info.field(i))
+		offset = o + fsize
+		if info.field(i).isValid(i, t) { //ignored fields are padding
+			pad(o - end)
+			fmt.Fprintf(&g.buf, "\t%s;\n", g.declare(f.Type, f.Name))
+			end = offset
+		}
+	}
+	pad(size - end)
+	fmt.Fprintf(&g.buf, "} %s;\n", t.Name())
+	return nil
+}
+
+// declare returns C declaration of field name with type t.
+func (g *headerWriter) declare(t reflect.Type, name string) string {
+	switch t.Kind() {
+	case reflect.Array:
+		return g.declare(t.Elem(), fmt.Sprintf("%s[%d]", name, t.Len()))
+	case reflect.Complex64:
+		return fmt.Sprintf("float %s[2]", name)
+	case reflect.Complex128:
+		return fmt.Sprintf("double %s[2]", name)
+	case reflect.Struct:
+		return fmt.Sprintf("%s %s", t.Name(), name)
+	}
+	return fmt.Sprintf("%s %s", g.cType(t.Kind()), name)
+}
+
+// cType returns C type of number kind k.
+func (g *headerWriter) cType(k reflect.Kind) string {
+	switch k {
+	case reflect.Bool, reflect.Uint8:
+		return "uint8_t"
+	case reflect.Int8:
+		return "int8_t"
+	case reflect.Int16:
+		return "int16_t"
+	case reflect.Uint16:
+		return "uint16_t"
+	case reflect.Int32:
+		return "int32_t"
+	case reflect.Uint32:
+		return "uint32_t"
+	case reflect.Int64:
+		return "int64_t"
+	case reflect.Uint64:
+		return "uint64_t"
+	case reflect.Float32:
+		return "float"
+	case reflect.Float64:
+		return "double"
+	case reflect.Int:
+		return fmt.Sprintf("int%d_t", g.layout.PtrSize*8)
+	case reflect.Uint, reflect.Uintptr:
+		return fmt.Sprintf("uint%d_t", g.layout.PtrSize*8)
+	}
+	return ""
+}
+
+// cElem returns element type of array type t.
+func cElem(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
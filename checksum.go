@@ -0,0 +1,206 @@
+// checksum trailers appended after encoded messages, to detect corrupted
+// storage or transport at decode time.
+
+package binary
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+)
+
+// Checksum is algorithm of checksum trailer.
+// The trailer is the checksum of message bytes before it, in BigEndian.
+type Checksum uint8
+
+const (
+	// NoChecksum means no checksum trailer.
+	NoChecksum Checksum = iota
+	// CRC32 is CRC-32 checksum of IEEE polynomial, trailer of 4 bytes.
+	CRC32
+	// XXHash64 is xxHash64 checksum of seed 0, trailer of 8 bytes.
+	XXHash64
+)
+
+// Size returns bytes number of checksum trailer.
+func (c Checksum) Size() int {
+	switch c {
+	case CRC32:
+		return 4
+	case XXHash64:
+		return 8
+	}
+	return 0
+}
+
+// Sum returns checksum of b.
+func (c Checksum) Sum(b []byte) uint64 {
+	switch c {
+	case CRC32:
+		return uint64(crc32.ChecksumIEEE(b))
+	case XXHash64:
+		return xxHash64(b)
+	}
+	return 0
+}
+
+func (c Checksum) valid() bool {
+	return c <= XXHash64
+}
+
+// AppendChecksum append checksum trailer of b to b.
+func AppendChecksum(b []byte, c Checksum) []byte {
+	var buf [8]byte
+	sum := c.Sum(b)
+	switch c.Size() {
+	case 4:
+		BigEndian.PutUint32(buf[:], uint32(sum))
+	case 8:
+		BigEndian.PutUint64(buf[:], sum)
+	}
+	return append(b, buf[:c.Size()]...)
+}
+
+// VerifyChecksum verify checksum trailer at the end of b, and returns bytes
+// before the trailer.
+// It returns ErrChecksum if the trailer mismatch.
+func VerifyChecksum(b []byte, c Checksum) ([]byte, error) {
+	if !c.valid() {
+		return nil, fmt.Errorf("binary.VerifyChecksum: invalid checksum %d", c)
+	}
+	size := c.Size()
+	if len(b) < size {
+		return nil, errorf(ErrChecksum, "binary.VerifyChecksum: %d bytes shorter than %d bytes trailer", len(b), size)
+	}
+	msg, trailer := b[:len(b)-size], b[len(b)-size:]
+	var sum uint64
+	switch size {
+	case 4:
+		sum = uint64(BigEndian.Uint32(trailer))
+	case 8:
+		sum = BigEndian.Uint64(trailer)
+	}
+	if got := c.Sum(msg); sum != got {
+		return nil, errorf(ErrChecksum, "binary.VerifyChecksum: checksum mismatch, trailer %#x, message %#x", sum, got)
+	}
+	return msg, nil
+}
+
+// EncodeChecksum encode data as Encode, and append checksum trailer.
+func EncodeChecksum(data interface{}, c Checksum) ([]byte, error) {
+	if !c.valid() {
+		return nil, fmt.Errorf("binary.EncodeChecksum: invalid checksum %d", c)
+	}
+	size := Sizeof(data)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(data, nil) //error of invalid data
+		return nil, err
+	}
+	encoder := NewEncoderBuffer(make([]byte, size, size+c.Size()))
+	if err := encoder.Value(data); err != nil {
+		return nil, err
+	}
+	return AppendChecksum(encoder.Buffer(), c), nil
+}
+
+// DecodeChecksum verify checksum trailer of buffer, and decode bytes before
+// the trailer to data as Decode.
+// data is not modified if the trailer mismatch.
+func DecodeChecksum(buffer []byte, data interface{}, c Checksum) error {
+	msg, err := VerifyChecksum(buffer, c)
+	if err != nil {
+		return err
+	}
+	return Decode(msg, data)
+}
+
+// WriteMessageChecksum is like WriteMessage, but append checksum trailer of
+// the encoded bytes after the message. The length prefix excludes the trailer.
+func WriteMessageChecksum(w io.Writer, data interface{}, c Checksum) error {
+	if !c.valid() {
+		return fmt.Errorf("binary.WriteMessageChecksum: invalid checksum %d", c)
+	}
+	size := Sizeof(data)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(data, nil) //error of invalid data
+		return err
+	}
+	buf := make([]byte, MaxVarintLen64+size, MaxVarintLen64+size+c.Size())
+	encoder := NewEncoderBuffer(buf[MaxVarintLen64:])
+	if err := encoder.Value(data); err != nil {
+		return err
+	}
+	l := encoder.Len()
+	start := MaxVarintLen64 - SizeofUvarint(uint64(l))
+	PutUvarint(buf[start:], uint64(l))
+	msg := AppendChecksum(buf[MaxVarintLen64:MaxVarintLen64+l], c) //in place of buf
+	_, err := w.Write(buf[start : MaxVarintLen64+len(msg)])
+	return err
+}
+
+// ReadMessageChecksum read a message written by WriteMessageChecksum from r,
+// verify its checksum trailer, and decode it to data as ReadMessage.
+// It returns ErrChecksum if the trailer mismatch.
+func ReadMessageChecksum(r io.Reader, data interface{}, c Checksum) error {
+	if !c.valid() {
+		return fmt.Errorf("binary.ReadMessageChecksum: invalid checksum %d", c)
+	}
+	buf, err := readMessage(r, c.Size())
+	if err != nil {
+		return err
+	}
+	return DecodeChecksum(buf, data, c)
+}
+
+// xxHash64 returns xxHash64 checksum of b with seed 0.
+func xxHash64(b []byte) uint64 {
+	const (
+		prime1 uint64 = 11400714785074694791
+		prime2 uint64 = 14029467366897019727
+		prime3 uint64 = 1609587929392839161
+		prime4 uint64 = 9650029242287828579
+		prime5 uint64 = 2870177450012600261
+	)
+	round := func(acc, input uint64) uint64 {
+		return bits.RotateLeft64(acc+input*prime2, 31) * prime1
+	}
+	merge := func(acc, v uint64) uint64 {
+		return (acc^round(0, v))*prime1 + prime4
+	}
+
+	n := len(b)
+	var h, seed uint64
+	if n >= 32 {
+		v1, v2, v3, v4 := seed+prime1+prime2, seed+prime2, seed, seed-prime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = round(v1, LittleEndian.Uint64(b))
+			v2 = round(v2, LittleEndian.Uint64(b[8:]))
+			v3 = round(v3, LittleEndian.Uint64(b[16:]))
+			v4 = round(v4, LittleEndian.Uint64(b[24:]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = merge(merge(merge(merge(h, v1), v2), v3), v4)
+	} else {
+		h = seed + prime5
+	}
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h = bits.RotateLeft64(h^round(0, LittleEndian.Uint64(b)), 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		h = bits.RotateLeft64(h^uint64(LittleEndian.Uint32(b))*prime1, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h = bits.RotateLeft64(h^uint64(c)*prime5, 11) * prime1
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
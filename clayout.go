@@ -0,0 +1,293 @@
+// encode/decode structs in memory layout of C structs, with alignment and
+// padding of fields, to exchange buffers with C programs and memory-mapped
+// device structures.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// CLayout is the ABI of C structs for Encoder/Decoder.SetCLayout.
+// Fields of structs are encoded at their offsets of C structs with zero padding,
+// and structs are padded to multiple of their alignment.
+// Bools are encoded as 1 byte, ints/uints/uintptrs as PtrSize bytes, and
+// arrays/structs of these types are supported.
+// Ignored fields and blank fields such as `_ [4]byte` are encoded as padding.
+// Field tag `binary:"offset=N"` places a field at offset N instead of its aligned offset.
+type CLayout struct {
+	PtrSize    int //bytes of pointers, which is also size of Go int/uint/uintptr
+	Int64Align int //alignment of 8 bytes numbers, 0 means 8
+	MaxAlign   int //max alignment of fields as #pragma pack(n), 0 means no limit
+}
+
+var (
+	// CLayout64 is the common ABI of 64-bits C compilers.
+	CLayout64 = CLayout{PtrSize: 8}
+	// CLayout32 is the ABI of 32-bits C compilers with 8 bytes alignment of 8 bytes numbers.
+	CLayout32 = CLayout{PtrSize: 4}
+	// CLayout386 is the ABI of i386 System V C compilers.
+	CLayout386 = CLayout{PtrSize: 4, Int64Align: 4}
+)
+
+// SetCLayout set Encoder to encode structs in C layout, nil means not.
+func (encoder *Encoder) SetCLayout(layout *CLayout) {
+	encoder.cLayout = layout
+}
+
+// SetCLayout set Decoder to decode structs in C layout, nil means not.
+func (decoder *Decoder) SetCLayout(layout *CLayout) {
+	decoder.cLayout = layout
+}
+
+// Sizeof returns bytes of data in C layout, or -1 if data is not supported.
+func (l *CLayout) Sizeof(data interface{}) int {
+	t := reflect.Indirect(reflect.ValueOf(data)).Type()
+	size, _ := l.layoutOf(t)
+	return size
+}
+
+// layoutOf returns size and alignment of type t, or -1 if t is not supported.
+func (l *CLayout) layoutOf(t reflect.Type) (size, align int) {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1, 1
+	case reflect.Int16, reflect.Uint16:
+		return l.aligned(2, 2)
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return l.aligned(4, 4)
+	case reflect.Complex64:
+		return l.aligned(8, 4)
+	case reflect.Int64, reflect.Uint64, reflect.Float64:
+		return l.aligned(8, l.int64Align())
+	case reflect.Complex128:
+		return l.aligned(16, l.int64Align())
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		return l.aligned(l.PtrSize, l.PtrSize)
+	case reflect.Array:
+		size, align := l.layoutOf(t.Elem())
+		if size < 0 {
+			return -1, 0
+		}
+		return size * t.Len(), align
+	case reflect.Struct:
+		info := queryStruct(t)
+		offset, align := 0, 1
+		for i, n := 0, t.NumField(); i < n; i++ {
+			size, a := l.layoutOf(t.Field(i).Type)
+			o := cFieldOffset(offset, a, info.field(i))
+			if size < 0 || o < offset { //unsupported or overlapped
+				return -1, 0
+			}
+			offset = o + size
+			if a > align {
+				align = a
+			}
+		}
+		return alignUp(offset, align), align
+	}
+	return -1, 0
+}
+
+func (l *CLayout) int64Align() int {
+	if l.Int64Align > 0 {
+		return l.Int64Align
+	}
+	return 8
+}
+
+// aligned returns size and alignment limited by MaxAlign.
+func (l *CLayout) aligned(size, align int) (int, int) {
+	if l.MaxAlign > 0 && align > l.MaxAlign {
+		align = l.MaxAlign
+	}
+	return size, align
+}
+
+func alignUp(offset, align int) int {
+	return (offset + align - 1) / align * align
+}
+
+// cFieldOffset returns offset of field following previous fields ending at offset,
+// which is aligned or specified by field tag `binary:"offset=N"`.
+func cFieldOffset(offset, align int, field *fieldInfo) int {
+	if o := field.offsetOf(); o >= 0 {
+		return o
+	}
+	return alignUp(offset, align)
+}
+
+// cLayoutError returns error of unsupported type t in C layout.
+func cLayoutError(t reflect.Type) error {
+	return errorf(ErrUnsupportedType, "binary: unsupported type %s in C layout", t.String())
+}
+
+// cValue encode v in C layout.
+func (encoder *Encoder) cValue(v reflect.Value, field *fieldInfo) error {
+	l := encoder.cLayout
+	switch k := v.Kind(); k {
+	case reflect.Bool:
+		if v.Bool() {
+			encoder.Uint8(1)
+		} else {
+			encoder.Uint8(0)
+		}
+	case reflect.Int8:
+		encoder.Int8(int8(v.Int()))
+	case reflect.Uint8:
+		encoder.Uint8(uint8(v.Uint()))
+	case reflect.Int16, reflect.Uint16:
+		encoder.Uint16(uint16(cBits(v)), false)
+	case reflect.Int32, reflect.Uint32:
+		encoder.Uint32(uint32(cBits(v)), false)
+	case reflect.Int64, reflect.Uint64:
+		encoder.Uint64(cBits(v), false)
+	case reflect.Int, reflect.Uint, reflect.Uintptr:
+		if l.PtrSize == 4 {
+			encoder.Uint32(uint32(cBits(v)), false)
+		} else {
+			encoder.Uint64(cBits(v), false)
+		}
+	case reflect.Float32:
+		encoder.Float32(float32(v.Float()))
+	case reflect.Float64:
+		encoder.Float64(v.Float())
+	case reflect.Complex64:
+		encoder.Complex64(complex64(v.Complex()))
+	case reflect.Complex128:
+		encoder.Complex128(v.Complex())
+	case reflect.Array:
+		for i, n := 0, v.Len(); i < n; i++ {
+			if err := encoder.cValue(v.Index(i), field); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		size, _ := l.layoutOf(t)
+		if size < 0 {
+			return cLayoutError(t)
+		}
+		info := queryStruct(t)
+		offset := 0
+		for i, n := 0, t.NumField(); i < n; i++ {
+			fsize, align := l.layoutOf(t.Field(i).Type)
+			finfo := info.field(i)
+			o := cFieldOffset(offset, align, finfo)
+			encoder.zeros(o - offset) //padding
+			if finfo.isValid(i, t) {
+				endian := encoder.endian
+				encoder.endian = finfo.endianOf(endian)
+				err := encoder.cValue(v.Field(i), finfo)
+				encoder.endian = endian
+				if err != nil {
+					return err
+				}
+			} else {
+				encoder.zeros(fsize)
+			}
+			offset = o + fsize
+		}
+		encoder.zeros(size - offset) //padding
+	default:
+		return cLayoutError(v.Type())
+	}
+	return nil
+}
+
+// zeros encode n bytes of zero.
+func (encoder *Encoder) zeros(n int) {
+	b := encoder.reserve(n)
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// cBits returns bits of int/uint value v.
+func cBits(v reflect.Value) uint64 {
+	if isUintKind(v.Kind()) || v.Kind() == reflect.Uintptr {
+		return v.Uint()
+	}
+	return uint64(v.Int())
+}
+
+// cValue decode v in C layout.
+func (decoder *Decoder) cValue(v reflect.Value, field *fieldInfo) error {
+	l := decoder.cLayout
+	switch k := v.Kind(); k {
+	case reflect.Bool:
+		v.SetBool(decoder.Uint8() != 0)
+	case reflect.Int8:
+		v.SetInt(int64(decoder.Int8()))
+	case reflect.Uint8:
+		v.SetUint(uint64(decoder.Uint8()))
+	case reflect.Int16:
+		v.SetInt(int64(decoder.Int16(false)))
+	case reflect.Uint16:
+		v.SetUint(uint64(decoder.Uint16(false)))
+	case reflect.Int32:
+		v.SetInt(int64(decoder.Int32(false)))
+	case reflect.Uint32:
+		v.SetUint(uint64(decoder.Uint32(false)))
+	case reflect.Int64:
+		v.SetInt(decoder.Int64(false))
+	case reflect.Uint64:
+		v.SetUint(decoder.Uint64(false))
+	case reflect.Int:
+		if l.PtrSize == 4 {
+			v.SetInt(int64(decoder.Int32(false)))
+		} else {
+			v.SetInt(decoder.Int64(false))
+		}
+	case reflect.Uint, reflect.Uintptr:
+		if l.PtrSize == 4 {
+			v.SetUint(uint64(decoder.Uint32(false)))
+		} else {
+			v.SetUint(decoder.Uint64(false))
+		}
+	case reflect.Float32:
+		v.SetFloat(float64(decoder.Float32()))
+	case reflect.Float64:
+		v.SetFloat(decoder.Float64())
+	case reflect.Complex64:
+		v.SetComplex(complex128(decoder.Complex64()))
+	case reflect.Complex128:
+		v.SetComplex(decoder.Complex128())
+	case reflect.Array:
+		for i, n := 0, v.Len(); i < n; i++ {
+			if err := decoder.cValue(v.Index(i), field); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		size, _ := l.layoutOf(t)
+		if size < 0 {
+			return cLayoutError(t)
+		}
+		info := queryStruct(t)
+		offset := 0
+		for i, n := 0, t.NumField(); i < n; i++ {
+			fsize, align := l.layoutOf(t.Field(i).Type)
+			finfo := info.field(i)
+			o := cFieldOffset(offset, align, finfo)
+			decoder.reserve(o - offset) //padding
+			if finfo.isValid(i, t) {
+				endian := decoder.endian
+				decoder.endian = finfo.endianOf(endian)
+				err := decoder.cValue(v.Field(i), finfo)
+				decoder.endian = endian
+				if err != nil {
+					return err
+				}
+			} else {
+				decoder.reserve(fsize)
+			}
+			offset = o + fsize
+		}
+		decoder.reserve(size - offset) //padding
+	default:
+		return cLayoutError(v.Type())
+	}
+	return nil
+}
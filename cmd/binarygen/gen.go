@@ -0,0 +1,653 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// annotation of structs to generate methods
+const annotation = "//binary:gen"
+
+// generator generate methods of annotated structs of a package.
+type generator struct {
+	buf     bytes.Buffer
+	types   map[string]ast.Expr //underlying type expressions of named types of the package
+	structs map[string]bool     //annotated structs of the package
+}
+
+// tagOpts are options of field tag `binary:"opt1,opt2"`.
+type tagOpts struct {
+	packed  bool //ints are encoded as varint/uvarint
+	fixed   bool //int/uint are encoded as fixed 8 bytes
+	nilable bool //slices/maps encode a bool bit to keep nil
+}
+
+// structField is a field of struct to encode.
+type structField struct {
+	name string
+	typ  ast.Expr
+	opts tagOpts
+}
+
+// generate returns formated source of methods of annotated structs in file,
+// nil if there is no annotated struct.
+func generate(file string) ([]byte, error) {
+	fset := token.NewFileSet()
+	target, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		types:   make(map[string]ast.Expr),
+		structs: make(map[string]bool),
+	}
+	files, err := packageFiles(fset, file, target.Name.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range append(files, target) {
+		g.collect(f)
+	}
+
+	var names []string
+	var specs []*ast.StructType
+	forEachType(target, func(spec *ast.TypeSpec, annotated bool) {
+		if st, ok := spec.Type.(*ast.StructType); ok && annotated {
+			names = append(names, spec.Name.Name)
+			specs = append(specs, st)
+		}
+	})
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	fmt.Fprintf(&g.buf, "// Code generated by binarygen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&g.buf, "package %s\n\n", target.Name.Name)
+	fmt.Fprintf(&g.buf, "import (\n\"fmt\"\n\n\"github.com/vipally/binary\"\n)\n")
+	for i, name := range names {
+		fields, err := structFields(specs[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		if err := g.genStruct(name, fields); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %s", err.Error())
+	}
+	return src, nil
+}
+
+// packageFiles parse the other files of package pkg in the directory of file,
+// to find types declared by them.
+func packageFiles(fset *token.FileSet, file, pkg string) ([]*ast.File, error) {
+	dir := filepath.Dir(file)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") ||
+			strings.HasSuffix(name, "_binary.go") || name == filepath.Base(file) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if f.Name.Name == pkg {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// collect named types and annotated structs of file.
+func (g *generator) collect(file *ast.File) {
+	forEachType(file, func(spec *ast.TypeSpec, annotated bool) {
+		g.types[spec.Name.Name] = spec.Type
+		if _, ok := spec.Type.(*ast.StructType); ok && annotated {
+			g.structs[spec.Name.Name] = true
+		}
+	})
+}
+
+// forEachType call fn with every type declared at top level of file,
+// and whether it is annotated.
+func forEachType(file *ast.File, fn func(spec *ast.TypeSpec, annotated bool)) {
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range gd.Specs {
+			spec := s.(*ast.TypeSpec)
+			annotated := hasAnnotation(spec.Doc)
+			if len(gd.Specs) == 1 {
+				annotated = annotated || hasAnnotation(gd.Doc)
+			}
+			fn(spec, annotated)
+		}
+	}
+}
+
+func hasAnnotation(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+// genMethods are names of methods generated for structs, which must not be
+// names of their fields.
+var genMethods = map[string]bool{
+	"Size": true, "Encode": true, "Decode": true,
+	"binaryBits": true, "binaryEncode": true, "binaryDecode": true,
+}
+
+// structFields returns the fields of struct st to encode, in order.
+// Unexported fields and fields with tag option ignore are skiped.
+// Fields of names of generated methods are reported as error.
+func structFields(st *ast.StructType) ([]structField, error) {
+	var fields []structField
+	for _, f := range st.Fields.List {
+		for _, name := range f.Names {
+			if genMethods[name.Name] {
+				return nil, fmt.Errorf("field %s conflicts with generated method", name.Name)
+			}
+		}
+		var opts tagOpts
+		if f.Tag != nil {
+			tag, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			ignore := false
+			for _, opt := range strings.Split(reflect.StructTag(tag).Get("binary"), ",") {
+				name := opt
+				if i := strings.IndexByte(opt, '='); i >= 0 {
+					name = opt[:i]
+				}
+				switch name {
+				case "ignore":
+					ignore = true
+				case "packed":
+					opts.packed = true
+				case "fixed":
+					opts.fixed = true
+				case "nilable":
+					opts.nilable = true
+				case "text", "unixnano", "big", "little", "lenprefix", "columnar", "delta", "float16", "nozigzag", "groupvarint", "runes", "nolen", "bits", "offset", "version", "tagged", "id", "flatten", "unexported":
+					return nil, fmt.Errorf("unsupported tag option %s", opt)
+				}
+			}
+			if ignore {
+				continue
+			}
+		}
+
+		names := f.Names
+		if len(names) == 0 { //embedded field
+			t := f.Type
+			if star, ok := t.(*ast.StarExpr); ok {
+				t = star.X
+			}
+			id, ok := t.(*ast.Ident)
+			if !ok {
+				return nil, fmt.Errorf("unsupported embedded field %s", types.ExprString(f.Type))
+			}
+			if genMethods[id.Name] {
+				return nil, fmt.Errorf("field %s conflicts with generated method", id.Name)
+			}
+			names = []*ast.Ident{id}
+		}
+		for _, name := range names {
+			if ast.IsExported(name.Name) {
+				fields = append(fields, structField{name: name.Name, typ: f.Type, opts: opts})
+			}
+		}
+	}
+	return fields, nil
+}
+
+// genStruct generate methods of struct name.
+func (g *generator) genStruct(name string, fields []structField) error {
+	w := &g.buf
+
+	fmt.Fprintf(w, "\n// Size returns bytes number of x encoded by binary.\n")
+	fmt.Fprintf(w, "func (x *%s) Size() int {\n", name)
+	fmt.Fprintf(w, "return (x.binaryBits() + 7) / 8\n")
+	fmt.Fprintf(w, "}\n")
+
+	fmt.Fprintf(w, "\n// Encode encode x to buffer, nil buffer is aviable.\n")
+	fmt.Fprintf(w, "func (x *%s) Encode(buffer []byte) ([]byte, error) {\n", name)
+	fmt.Fprintf(w, "buff, err := binary.MakeEncodeBuffer(x, buffer)\n")
+	fmt.Fprintf(w, "if err != nil {\nreturn nil, err\n}\n")
+	fmt.Fprintf(w, "encoder := binary.NewEncoderBuffer(buff)\n")
+	fmt.Fprintf(w, "x.binaryEncode(encoder)\n")
+	fmt.Fprintf(w, "return encoder.Buffer(), nil\n")
+	fmt.Fprintf(w, "}\n")
+
+	fmt.Fprintf(w, "\n// Decode decode x from buffer.\n")
+	fmt.Fprintf(w, "func (x *%s) Decode(buffer []byte) (err error) {\n", name)
+	fmt.Fprintf(w, "defer func() {\nif info := recover(); info != nil {\nvar ok bool\nif err, ok = info.(error); !ok {\nerr = fmt.Errorf(\"%s.Decode: %%v\", info)\n}\n}\n}()\n", name)
+	fmt.Fprintf(w, "x.binaryDecode(binary.NewDecoder(buffer))\n")
+	fmt.Fprintf(w, "return nil\n")
+	fmt.Fprintf(w, "}\n")
+
+	fmt.Fprintf(w, "\n// binaryBits returns bits number of encoded x, bools are encoded as bits.\n")
+	fmt.Fprintf(w, "func (x *%s) binaryBits() int {\n", name)
+	fmt.Fprintf(w, "n := 0\n")
+	for _, f := range fields {
+		if err := g.size(f.typ, "x."+f.name, f.opts, 0); err != nil {
+			return fmt.Errorf("field %s: %s", f.name, err.Error())
+		}
+	}
+	fmt.Fprintf(w, "return n\n")
+	fmt.Fprintf(w, "}\n")
+
+	fmt.Fprintf(w, "\nfunc (x *%s) binaryEncode(encoder *binary.Encoder) {\n", name)
+	for _, f := range fields {
+		if err := g.encode(f.typ, "x."+f.name, f.opts, 0); err != nil {
+			return fmt.Errorf("field %s: %s", f.name, err.Error())
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+
+	fmt.Fprintf(w, "\nfunc (x *%s) binaryDecode(decoder *binary.Decoder) {\n", name)
+	for _, f := range fields {
+		if err := g.decode(f.typ, "x."+f.name, f.opts, 0); err != nil {
+			return fmt.Errorf("field %s: %s", f.name, err.Error())
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+	return nil
+}
+
+type kind int
+
+const (
+	kindBasic kind = iota
+	kindStruct
+	kindPtr
+	kindSlice
+	kindArray
+	kindMap
+)
+
+// typeInfo is resolved information of a type expression.
+type typeInfo struct {
+	kind  kind
+	name  string   //name of basic type or struct
+	named bool     //if basic type is named by the package
+	elem  ast.Expr //element type of pointer/slice/array/map
+	key   ast.Expr //key type of map
+}
+
+var basicTypes = map[string]string{
+	"bool": "bool", "string": "string",
+	"int": "int", "int8": "int8", "int16": "int16", "int32": "int32", "int64": "int64",
+	"uint": "uint", "uint8": "uint8", "uint16": "uint16", "uint32": "uint32", "uint64": "uint64",
+	"byte": "uint8", "rune": "int32",
+	"float32": "float32", "float64": "float64", "complex64": "complex64", "complex128": "complex128",
+}
+
+// resolve returns information of type expression t.
+func (g *generator) resolve(t ast.Expr) (typeInfo, error) {
+	switch t := t.(type) {
+	case *ast.Ident:
+		if g.structs[t.Name] {
+			return typeInfo{kind: kindStruct, name: t.Name}, nil
+		}
+		if u, ok := g.types[t.Name]; ok {
+			if _, ok := u.(*ast.StructType); ok {
+				return typeInfo{}, fmt.Errorf("struct %s is not annotated by %s", t.Name, annotation)
+			}
+			info, err := g.resolve(u)
+			info.named = info.named || info.kind == kindBasic
+			return info, err
+		}
+		if name, ok := basicTypes[t.Name]; ok {
+			return typeInfo{kind: kindBasic, name: name}, nil
+		}
+	case *ast.ParenExpr:
+		return g.resolve(t.X)
+	case *ast.StarExpr:
+		return typeInfo{kind: kindPtr, elem: t.X}, nil
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return typeInfo{kind: kindSlice, elem: t.Elt}, nil
+		}
+		return typeInfo{kind: kindArray, elem: t.Elt}, nil
+	case *ast.MapType:
+		return typeInfo{kind: kindMap, key: t.Key, elem: t.Value}, nil
+	}
+	return typeInfo{}, fmt.Errorf("unsupported type %s", types.ExprString(t))
+}
+
+// isBasic reports whether type expression t is basic type name.
+func (g *generator) isBasic(t ast.Expr, name string) bool {
+	info, err := g.resolve(t)
+	return err == nil && info.kind == kindBasic && info.name == name
+}
+
+// fixedBits returns bits number of values of basic type t if it is fixed, or "".
+func (g *generator) fixedBits(t ast.Expr, opts tagOpts) string {
+	info, err := g.resolve(t)
+	if err != nil || info.kind != kindBasic {
+		return ""
+	}
+	size, _, _ := basicCode(info.name, "", opts)
+	if _, err := strconv.Atoi(size); err != nil {
+		return ""
+	}
+	return size
+}
+
+// basicCode returns expressions of bits number, encoding and decoding of value v of basic type name.
+// Named types are converted to their basic types by caller.
+func basicCode(name, v string, opts tagOpts) (size, enc, dec string) {
+	switch name {
+	case "bool":
+		return "1", "encoder.Bool(%s)", "decoder.Bool()"
+	case "int8", "uint8":
+		Name := exported(name)
+		return "8", "encoder." + Name + "(%s)", "decoder." + Name + "()"
+	case "int16", "int32", "int64":
+		Name := exported(name)
+		size = name[3:]
+		if opts.packed {
+			size = fmt.Sprintf("binary.SizeofVarint(int64(%s)) * 8", v)
+		}
+		p := strconv.FormatBool(opts.packed)
+		return size, "encoder." + Name + "(%s, " + p + ")", "decoder." + Name + "(" + p + ")"
+	case "uint16", "uint32", "uint64":
+		Name := exported(name)
+		size = name[4:]
+		if opts.packed {
+			size = fmt.Sprintf("binary.SizeofUvarint(uint64(%s)) * 8", v)
+		}
+		p := strconv.FormatBool(opts.packed)
+		return size, "encoder." + Name + "(%s, " + p + ")", "decoder." + Name + "(" + p + ")"
+	case "int":
+		if opts.fixed {
+			return "64", "encoder.Int64(int64(%s), false)", "int(decoder.Int64(false))"
+		}
+		return fmt.Sprintf("binary.SizeofVarint(int64(%s)) * 8", v), "encoder.Int(%s)", "decoder.Int()"
+	case "uint":
+		if opts.fixed {
+			return "64", "encoder.Uint64(uint64(%s), false)", "uint(decoder.Uint64(false))"
+		}
+		return fmt.Sprintf("binary.SizeofUvarint(uint64(%s)) * 8", v), "encoder.Uint(%s)", "decoder.Uint()"
+	case "float32":
+		return "32", "encoder.Float32(%s)", "decoder.Float32()"
+	case "float64":
+		return "64", "encoder.Float64(%s)", "decoder.Float64()"
+	case "complex64":
+		return "64", "encoder.Complex64(%s)", "decoder.Complex64()"
+	case "complex128":
+		return "128", "encoder.Complex128(%s)", "decoder.Complex128()"
+	case "string":
+		return fmt.Sprintf("(binary.SizeofUvarint(uint64(len(%s))) + len(%s)) * 8", v, v), "encoder.String(%s)", "decoder.String()"
+	}
+	panic("binarygen: unknown basic type " + name)
+}
+
+// exported returns name with upper case first letter.
+func exported(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// paren returns v in parentheses if it is a dereference, to select or index it.
+func paren(v string) string {
+	if strings.HasPrefix(v, "*") {
+		return "(" + v + ")"
+	}
+	return v
+}
+
+// size generate code to add bits number of encoded v of type t to n.
+func (g *generator) size(t ast.Expr, v string, opts tagOpts, depth int) error {
+	info, err := g.resolve(t)
+	if err != nil {
+		return err
+	}
+	w := &g.buf
+	i := fmt.Sprintf("i%d", depth)
+	switch info.kind {
+	case kindBasic:
+		if size, _, _ := basicCode(info.name, v, opts); size == "1" {
+			fmt.Fprintf(w, "n++\n")
+		} else {
+			fmt.Fprintf(w, "n += %s\n", size)
+		}
+	case kindStruct:
+		fmt.Fprintf(w, "n += %s.binaryBits()\n", paren(v))
+	case kindPtr:
+		fmt.Fprintf(w, "n++\n")
+		fmt.Fprintf(w, "if %s != nil {\n", v)
+		if err := g.size(info.elem, "*"+v, opts, depth+1); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "}\n")
+	case kindSlice, kindArray, kindMap:
+		if opts.nilable && info.kind != kindArray {
+			fmt.Fprintf(w, "n++\n")
+			fmt.Fprintf(w, "if %s != nil {\n", v)
+			defer fmt.Fprintf(w, "}\n")
+		}
+		fmt.Fprintf(w, "n += binary.SizeofUvarint(uint64(len(%s))) * 8\n", v)
+		switch {
+		case info.kind == kindMap:
+			k, e := fmt.Sprintf("k%d", depth), fmt.Sprintf("e%d", depth)
+			fmt.Fprintf(w, "for %s, %s := range %s {\n", k, e, v)
+			if err := g.size(info.key, k, opts, depth+1); err != nil {
+				return err
+			}
+			if err := g.size(info.elem, e, opts, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "}\n")
+		case g.isBasic(info.elem, "bool"):
+			fmt.Fprintf(w, "n += (len(%s) + 7) / 8 * 8\n", v)
+		case g.fixedBits(info.elem, opts) != "":
+			fmt.Fprintf(w, "n += len(%s) * %s\n", v, g.fixedBits(info.elem, opts))
+		default:
+			fmt.Fprintf(w, "for %s := range %s {\n", i, v)
+			if err := g.size(info.elem, fmt.Sprintf("%s[%s]", paren(v), i), opts, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "}\n")
+		}
+	}
+	return nil
+}
+
+// encode generate code to encode v of type t.
+func (g *generator) encode(t ast.Expr, v string, opts tagOpts, depth int) error {
+	info, err := g.resolve(t)
+	if err != nil {
+		return err
+	}
+	w := &g.buf
+	i := fmt.Sprintf("i%d", depth)
+	switch info.kind {
+	case kindBasic:
+		_, enc, _ := basicCode(info.name, v, opts)
+		x := v
+		if info.named {
+			x = fmt.Sprintf("%s(%s)", info.name, v)
+		}
+		fmt.Fprintf(w, enc+"\n", x)
+	case kindStruct:
+		fmt.Fprintf(w, "%s.binaryEncode(encoder)\n", paren(v))
+	case kindPtr:
+		fmt.Fprintf(w, "encoder.Bool(%s != nil)\n", v)
+		fmt.Fprintf(w, "if %s != nil {\n", v)
+		if err := g.encode(info.elem, "*"+v, opts, depth+1); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "}\n")
+	case kindSlice, kindArray, kindMap:
+		if opts.nilable && info.kind != kindArray {
+			fmt.Fprintf(w, "encoder.Bool(%s != nil)\n", v)
+			fmt.Fprintf(w, "if %s != nil {\n", v)
+			defer fmt.Fprintf(w, "}\n")
+		}
+		switch {
+		case info.kind == kindMap:
+			k, e := fmt.Sprintf("k%d", depth), fmt.Sprintf("e%d", depth)
+			fmt.Fprintf(w, "encoder.Uvarint(uint64(len(%s)))\n", v)
+			fmt.Fprintf(w, "for %s, %s := range %s {\n", k, e, v)
+			if err := g.encode(info.key, k, opts, depth+1); err != nil {
+				return err
+			}
+			if err := g.encode(info.elem, e, opts, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "}\n")
+		case g.isBasic(info.elem, "bool"): //bool array is encoded as bits of bytes
+			b, j := fmt.Sprintf("b%d", depth), fmt.Sprintf("j%d", depth)
+			fmt.Fprintf(w, "encoder.Uvarint(uint64(len(%s)))\n", v)
+			fmt.Fprintf(w, "for %s := 0; %s < len(%s); %s += 8 {\n", i, i, v, i)
+			fmt.Fprintf(w, "var %s uint8\n", b)
+			fmt.Fprintf(w, "for %s := %s; %s < %s+8 && %s < len(%s); %s++ {\n", j, i, j, i, j, v, j)
+			fmt.Fprintf(w, "if %s[%s] {\n%s |= 1 << uint(%s-%s)\n}\n", paren(v), j, b, j, i)
+			fmt.Fprintf(w, "}\n")
+			fmt.Fprintf(w, "encoder.Uint8(%s)\n", b)
+			fmt.Fprintf(w, "}\n")
+		case isBytes(info):
+			fmt.Fprintf(w, "encoder.Bytes(%s)\n", v)
+		default:
+			fmt.Fprintf(w, "encoder.Uvarint(uint64(len(%s)))\n", v)
+			fmt.Fprintf(w, "for %s := range %s {\n", i, v)
+			if err := g.encode(info.elem, fmt.Sprintf("%s[%s]", paren(v), i), opts, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "}\n")
+		}
+	}
+	return nil
+}
+
+// decode generate code to decode v of type t, v must be addressable.
+func (g *generator) decode(t ast.Expr, v string, opts tagOpts, depth int) error {
+	info, err := g.resolve(t)
+	if err != nil {
+		return err
+	}
+	w := &g.buf
+	i, l := fmt.Sprintf("i%d", depth), fmt.Sprintf("l%d", depth)
+	switch info.kind {
+	case kindBasic:
+		_, _, dec := basicCode(info.name, v, opts)
+		if info.named {
+			dec = fmt.Sprintf("%s(%s)", types.ExprString(t), dec)
+		}
+		fmt.Fprintf(w, "%s = %s\n", v, dec)
+	case kindStruct:
+		fmt.Fprintf(w, "%s.binaryDecode(decoder)\n", paren(v))
+	case kindPtr:
+		fmt.Fprintf(w, "if decoder.Bool() {\n")
+		fmt.Fprintf(w, "if %s == nil {\n%s = new(%s)\n}\n", v, v, types.ExprString(info.elem))
+		if err := g.decode(info.elem, "*"+v, opts, depth+1); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "} else {\n%s = nil\n}\n", v)
+	case kindSlice, kindArray, kindMap:
+		nilable := opts.nilable && info.kind != kindArray
+		if nilable {
+			fmt.Fprintf(w, "if !decoder.Bool() {\n%s = nil\n} else {\n", v)
+			defer fmt.Fprintf(w, "}\n")
+		}
+		if isBytes(info) { //keep empty slice nil if it is not nilable
+			b := fmt.Sprintf("b%d", depth)
+			if nilable {
+				fmt.Fprintf(w, "%s = decoder.Bytes()\n", v)
+			} else {
+				fmt.Fprintf(w, "if %s := decoder.Bytes(); len(%s) > 0 {\n%s = %s\n}\n", b, b, v, b)
+			}
+			return nil
+		}
+		if info.kind == kindMap {
+			fmt.Fprintf(w, "if %s == nil {\n%s = make(%s)\n}\n", v, v, types.ExprString(t))
+		}
+		if nilable { //make a new slice if it is not empty or nilable
+			fmt.Fprintf(w, "%s := decoder.Length()\n", l)
+		} else {
+			fmt.Fprintf(w, "if %s := decoder.Length(); %s > 0 {\n", l, l)
+			defer fmt.Fprintf(w, "}\n")
+		}
+		if info.kind == kindSlice {
+			fmt.Fprintf(w, "%s = make(%s, %s)\n", v, types.ExprString(t), l)
+		}
+
+		switch {
+		case info.kind == kindMap:
+			k, e := fmt.Sprintf("k%d", depth), fmt.Sprintf("e%d", depth)
+			fmt.Fprintf(w, "for %s := 0; %s < %s; %s++ {\n", i, i, l, i)
+			fmt.Fprintf(w, "var %s %s\n", k, types.ExprString(info.key))
+			fmt.Fprintf(w, "var %s %s\n", e, types.ExprString(info.elem))
+			if err := g.decode(info.key, k, opts, depth+1); err != nil {
+				return err
+			}
+			if err := g.decode(info.elem, e, opts, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s[%s] = %s\n", paren(v), k, e)
+			fmt.Fprintf(w, "}\n")
+		case g.isBasic(info.elem, "bool"): //bool array is decoded from bits of bytes
+			b, j := fmt.Sprintf("b%d", depth), fmt.Sprintf("j%d", depth)
+			fmt.Fprintf(w, "for %s := 0; %s < %s; %s += 8 {\n", i, i, l, i)
+			fmt.Fprintf(w, "%s := decoder.Uint8()\n", b)
+			fmt.Fprintf(w, "for %s := %s; %s < %s+8 && %s < %s && %s < len(%s); %s++ {\n", j, i, j, i, j, l, j, v, j)
+			fmt.Fprintf(w, "%s[%s] = %s&(1<<uint(%s-%s)) != 0\n", paren(v), j, b, j, i)
+			fmt.Fprintf(w, "}\n")
+			fmt.Fprintf(w, "}\n")
+		default: //elements out of array are decoded to a temporary value and dropped
+			e, p := fmt.Sprintf("e%d", depth), fmt.Sprintf("p%d", depth)
+			fmt.Fprintf(w, "for %s := 0; %s < %s; %s++ {\n", i, i, l, i)
+			if info.kind == kindArray {
+				fmt.Fprintf(w, "var %s %s\n", e, types.ExprString(info.elem))
+				fmt.Fprintf(w, "%s := &%s\n", p, e)
+				fmt.Fprintf(w, "if %s < len(%s) {\n%s = &%s[%s]\n}\n", i, v, p, paren(v), i)
+				if err := g.decode(info.elem, "*"+p, opts, depth+1); err != nil {
+					return err
+				}
+			} else if err := g.decode(info.elem, fmt.Sprintf("%s[%s]", paren(v), i), opts, depth+1); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "}\n")
+		}
+	}
+	return nil
+}
+
+// isBytes reports whether info is type []byte, which is encoded by Encoder.Bytes.
+func isBytes(info typeInfo) bool {
+	if id, ok := info.elem.(*ast.Ident); ok && info.kind == kindSlice {
+		return id.Name == "byte" || id.Name == "uint8"
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	const file = "internal/gentest/types.go"
+	src, err := generate(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(outputName(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("generate %s is out of date, run go generate", file)
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	testCases := []struct {
+		src string
+		err string
+	}{
+		{"//binary:gen\ntype T struct{ A chan int }", "unsupported type chan int"},
+		{"//binary:gen\ntype T struct{ A U }\ntype U struct{}", "struct U is not annotated"},
+		{"//binary:gen\ntype T struct{ A int `binary:\"big\"` }", "unsupported tag option big"},
+		{"//binary:gen\ntype T struct{ U `binary:\"flatten\"` }\ntype U struct{}", "unsupported tag option flatten"},
+		{"//binary:gen\ntype T struct {\n_ struct{} `binary:\"unexported\"`\na int\n}", "unsupported tag option unexported"},
+		{"//binary:gen\ntype T struct{ A, Size int }", "field Size conflicts with generated method"},
+		{"//binary:gen\ntype T struct{ Encode []byte `binary:\"ignore\"` }", "field Encode conflicts with generated method"},
+		{"//binary:gen\ntype T struct{ *Decode }\ntype Decode struct{}", "field Decode conflicts with generated method"},
+	}
+	for _, c := range testCases {
+		dir := t.TempDir()
+		file := dir + "/t.go"
+		if err := os.WriteFile(file, []byte("package t\n"+c.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := generate(file); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("generate %q got error %v\nneed %s\n", c.src, err, c.err)
+		}
+	}
+
+	dir := t.TempDir()
+	file := dir + "/t.go"
+	if err := os.WriteFile(file, []byte("package t\ntype T struct{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if src, err := generate(file); src != nil || err != nil {
+		t.Errorf("generate without annotation got %s %v\nneed nil\n", src, err)
+	}
+}
@@ -0,0 +1,69 @@
+// Package gentest has structs to test code generated by binarygen.
+package gentest
+
+//go:generate go run github.com/vipally/binary/cmd/binarygen $GOFILE
+
+// Color is a named basic type.
+type Color uint8
+
+// IDs is a named slice type.
+type IDs []int
+
+//binary:gen
+type Inner struct {
+	Ok    bool
+	Color Color
+	Name  string
+}
+
+//binary:gen
+type Basic struct {
+	Bool       bool
+	Int        int
+	Int8       int8
+	Int16      int16
+	Int32      int32
+	Int64      int64
+	Uint       uint
+	Uint8      uint8
+	Uint16     uint16
+	Uint32     uint32
+	Uint64     uint64
+	Float32    float32
+	Float64    float64
+	Complex64  complex64
+	Complex128 complex128
+	String     string
+	Byte       byte
+	Rune       rune
+	Packed     int32  `binary:"packed"`
+	UPacked    uint64 `binary:"packed"`
+	Fixed      int    `binary:"fixed"`
+	UFixed     uint   `binary:"fixed"`
+	Ignored    int    `binary:"ignore"`
+	unexported int
+	_          int
+}
+
+//binary:gen
+type Composite struct {
+	Inner
+	Ptr       *Inner
+	PtrInt    *int
+	PtrPtr    **string
+	Bools     []bool
+	BoolArray [3]bool
+	Bytes     []byte
+	Array     [2]int16
+	Slice     []Inner
+	IDs       IDs
+	Matrix    [][]uint32
+	Map       map[string]Inner
+	MapPtr    map[int]*int
+	Nilable   []int          `binary:"nilable"`
+	NilMap    map[int]string `binary:"nilable"`
+	NilBytes  []byte         `binary:"nilable"`
+	Colors    []Color
+	Basic     Basic
+	Flag      bool
+}
@@ -0,0 +1,531 @@
+// Code generated by binarygen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"fmt"
+
+	"github.com/vipally/binary"
+)
+
+// Size returns bytes number of x encoded by binary.
+func (x *Inner) Size() int {
+	return (x.binaryBits() + 7) / 8
+}
+
+// Encode encode x to buffer, nil buffer is aviable.
+func (x *Inner) Encode(buffer []byte) ([]byte, error) {
+	buff, err := binary.MakeEncodeBuffer(x, buffer)
+	if err != nil {
+		return nil, err
+	}
+	encoder := binary.NewEncoderBuffer(buff)
+	x.binaryEncode(encoder)
+	return encoder.Buffer(), nil
+}
+
+// Decode decode x from buffer.
+func (x *Inner) Decode(buffer []byte) (err error) {
+	defer func() {
+		if info := recover(); info != nil {
+			var ok bool
+			if err, ok = info.(error); !ok {
+				err = fmt.Errorf("Inner.Decode: %v", info)
+			}
+		}
+	}()
+	x.binaryDecode(binary.NewDecoder(buffer))
+	return nil
+}
+
+// binaryBits returns bits number of encoded x, bools are encoded as bits.
+func (x *Inner) binaryBits() int {
+	n := 0
+	n++
+	n += 8
+	n += (binary.SizeofUvarint(uint64(len(x.Name))) + len(x.Name)) * 8
+	return n
+}
+
+func (x *Inner) binaryEncode(encoder *binary.Encoder) {
+	encoder.Bool(x.Ok)
+	encoder.Uint8(uint8(x.Color))
+	encoder.String(x.Name)
+}
+
+func (x *Inner) binaryDecode(decoder *binary.Decoder) {
+	x.Ok = decoder.Bool()
+	x.Color = Color(decoder.Uint8())
+	x.Name = decoder.String()
+}
+
+// Size returns bytes number of x encoded by binary.
+func (x *Basic) Size() int {
+	return (x.binaryBits() + 7) / 8
+}
+
+// Encode encode x to buffer, nil buffer is aviable.
+func (x *Basic) Encode(buffer []byte) ([]byte, error) {
+	buff, err := binary.MakeEncodeBuffer(x, buffer)
+	if err != nil {
+		return nil, err
+	}
+	encoder := binary.NewEncoderBuffer(buff)
+	x.binaryEncode(encoder)
+	return encoder.Buffer(), nil
+}
+
+// Decode decode x from buffer.
+func (x *Basic) Decode(buffer []byte) (err error) {
+	defer func() {
+		if info := recover(); info != nil {
+			var ok bool
+			if err, ok = info.(error); !ok {
+				err = fmt.Errorf("Basic.Decode: %v", info)
+			}
+		}
+	}()
+	x.binaryDecode(binary.NewDecoder(buffer))
+	return nil
+}
+
+// binaryBits returns bits number of encoded x, bools are encoded as bits.
+func (x *Basic) binaryBits() int {
+	n := 0
+	n++
+	n += binary.SizeofVarint(int64(x.Int)) * 8
+	n += 8
+	n += 16
+	n += 32
+	n += 64
+	n += binary.SizeofUvarint(uint64(x.Uint)) * 8
+	n += 8
+	n += 16
+	n += 32
+	n += 64
+	n += 32
+	n += 64
+	n += 64
+	n += 128
+	n += (binary.SizeofUvarint(uint64(len(x.String))) + len(x.String)) * 8
+	n += 8
+	n += 32
+	n += binary.SizeofVarint(int64(x.Packed)) * 8
+	n += binary.SizeofUvarint(uint64(x.UPacked)) * 8
+	n += 64
+	n += 64
+	return n
+}
+
+func (x *Basic) binaryEncode(encoder *binary.Encoder) {
+	encoder.Bool(x.Bool)
+	encoder.Int(x.Int)
+	encoder.Int8(x.Int8)
+	encoder.Int16(x.Int16, false)
+	encoder.Int32(x.Int32, false)
+	encoder.Int64(x.Int64, false)
+	encoder.Uint(x.Uint)
+	encoder.Uint8(x.Uint8)
+	encoder.Uint16(x.Uint16, false)
+	encoder.Uint32(x.Uint32, false)
+	encoder.Uint64(x.Uint64, false)
+	encoder.Float32(x.Float32)
+	encoder.Float64(x.Float64)
+	encoder.Complex64(x.Complex64)
+	encoder.Complex128(x.Complex128)
+	encoder.String(x.String)
+	encoder.Uint8(x.Byte)
+	encoder.Int32(x.Rune, false)
+	encoder.Int32(x.Packed, true)
+	encoder.Uint64(x.UPacked, true)
+	encoder.Int64(int64(x.Fixed), false)
+	encoder.Uint64(uint64(x.UFixed), false)
+}
+
+func (x *Basic) binaryDecode(decoder *binary.Decoder) {
+	x.Bool = decoder.Bool()
+	x.Int = decoder.Int()
+	x.Int8 = decoder.Int8()
+	x.Int16 = decoder.Int16(false)
+	x.Int32 = decoder.Int32(false)
+	x.Int64 = decoder.Int64(false)
+	x.Uint = decoder.Uint()
+	x.Uint8 = decoder.Uint8()
+	x.Uint16 = decoder.Uint16(false)
+	x.Uint32 = decoder.Uint32(false)
+	x.Uint64 = decoder.Uint64(false)
+	x.Float32 = decoder.Float32()
+	x.Float64 = decoder.Float64()
+	x.Complex64 = decoder.Complex64()
+	x.Complex128 = decoder.Complex128()
+	x.String = decoder.String()
+	x.Byte = decoder.Uint8()
+	x.Rune = decoder.Int32(false)
+	x.Packed = decoder.Int32(true)
+	x.UPacked = decoder.Uint64(true)
+	x.Fixed = int(decoder.Int64(false))
+	x.UFixed = uint(decoder.Uint64(false))
+}
+
+// Size returns bytes number of x encoded by binary.
+func (x *Composite) Size() int {
+	return (x.binaryBits() + 7) / 8
+}
+
+// Encode encode x to buffer, nil buffer is aviable.
+func (x *Composite) Encode(buffer []byte) ([]byte, error) {
+	buff, err := binary.MakeEncodeBuffer(x, buffer)
+	if err != nil {
+		return nil, err
+	}
+	encoder := binary.NewEncoderBuffer(buff)
+	x.binaryEncode(encoder)
+	return encoder.Buffer(), nil
+}
+
+// Decode decode x from buffer.
+func (x *Composite) Decode(buffer []byte) (err error) {
+	defer func() {
+		if info := recover(); info != nil {
+			var ok bool
+			if err, ok = info.(error); !ok {
+				err = fmt.Errorf("Composite.Decode: %v", info)
+			}
+		}
+	}()
+	x.binaryDecode(binary.NewDecoder(buffer))
+	return nil
+}
+
+// binaryBits returns bits number of encoded x, bools are encoded as bits.
+func (x *Composite) binaryBits() int {
+	n := 0
+	n += x.Inner.binaryBits()
+	n++
+	if x.Ptr != nil {
+		n += (*x.Ptr).binaryBits()
+	}
+	n++
+	if x.PtrInt != nil {
+		n += binary.SizeofVarint(int64(*x.PtrInt)) * 8
+	}
+	n++
+	if x.PtrPtr != nil {
+		n++
+		if *x.PtrPtr != nil {
+			n += (binary.SizeofUvarint(uint64(len(**x.PtrPtr))) + len(**x.PtrPtr)) * 8
+		}
+	}
+	n += binary.SizeofUvarint(uint64(len(x.Bools))) * 8
+	n += (len(x.Bools) + 7) / 8 * 8
+	n += binary.SizeofUvarint(uint64(len(x.BoolArray))) * 8
+	n += (len(x.BoolArray) + 7) / 8 * 8
+	n += binary.SizeofUvarint(uint64(len(x.Bytes))) * 8
+	n += len(x.Bytes) * 8
+	n += binary.SizeofUvarint(uint64(len(x.Array))) * 8
+	n += len(x.Array) * 16
+	n += binary.SizeofUvarint(uint64(len(x.Slice))) * 8
+	for i0 := range x.Slice {
+		n += x.Slice[i0].binaryBits()
+	}
+	n += binary.SizeofUvarint(uint64(len(x.IDs))) * 8
+	for i0 := range x.IDs {
+		n += binary.SizeofVarint(int64(x.IDs[i0])) * 8
+	}
+	n += binary.SizeofUvarint(uint64(len(x.Matrix))) * 8
+	for i0 := range x.Matrix {
+		n += binary.SizeofUvarint(uint64(len(x.Matrix[i0]))) * 8
+		n += len(x.Matrix[i0]) * 32
+	}
+	n += binary.SizeofUvarint(uint64(len(x.Map))) * 8
+	for k0, e0 := range x.Map {
+		n += (binary.SizeofUvarint(uint64(len(k0))) + len(k0)) * 8
+		n += e0.binaryBits()
+	}
+	n += binary.SizeofUvarint(uint64(len(x.MapPtr))) * 8
+	for k0, e0 := range x.MapPtr {
+		n += binary.SizeofVarint(int64(k0)) * 8
+		n++
+		if e0 != nil {
+			n += binary.SizeofVarint(int64(*e0)) * 8
+		}
+	}
+	n++
+	if x.Nilable != nil {
+		n += binary.SizeofUvarint(uint64(len(x.Nilable))) * 8
+		for i0 := range x.Nilable {
+			n += binary.SizeofVarint(int64(x.Nilable[i0])) * 8
+		}
+	}
+	n++
+	if x.NilMap != nil {
+		n += binary.SizeofUvarint(uint64(len(x.NilMap))) * 8
+		for k0, e0 := range x.NilMap {
+			n += binary.SizeofVarint(int64(k0)) * 8
+			n += (binary.SizeofUvarint(uint64(len(e0))) + len(e0)) * 8
+		}
+	}
+	n++
+	if x.NilBytes != nil {
+		n += binary.SizeofUvarint(uint64(len(x.NilBytes))) * 8
+		n += len(x.NilBytes) * 8
+	}
+	n += binary.SizeofUvarint(uint64(len(x.Colors))) * 8
+	n += len(x.Colors) * 8
+	n += x.Basic.binaryBits()
+	n++
+	return n
+}
+
+func (x *Composite) binaryEncode(encoder *binary.Encoder) {
+	x.Inner.binaryEncode(encoder)
+	encoder.Bool(x.Ptr != nil)
+	if x.Ptr != nil {
+		(*x.Ptr).binaryEncode(encoder)
+	}
+	encoder.Bool(x.PtrInt != nil)
+	if x.PtrInt != nil {
+		encoder.Int(*x.PtrInt)
+	}
+	encoder.Bool(x.PtrPtr != nil)
+	if x.PtrPtr != nil {
+		encoder.Bool(*x.PtrPtr != nil)
+		if *x.PtrPtr != nil {
+			encoder.String(**x.PtrPtr)
+		}
+	}
+	encoder.Uvarint(uint64(len(x.Bools)))
+	for i0 := 0; i0 < len(x.Bools); i0 += 8 {
+		var b0 uint8
+		for j0 := i0; j0 < i0+8 && j0 < len(x.Bools); j0++ {
+			if x.Bools[j0] {
+				b0 |= 1 << uint(j0-i0)
+			}
+		}
+		encoder.Uint8(b0)
+	}
+	encoder.Uvarint(uint64(len(x.BoolArray)))
+	for i0 := 0; i0 < len(x.BoolArray); i0 += 8 {
+		var b0 uint8
+		for j0 := i0; j0 < i0+8 && j0 < len(x.BoolArray); j0++ {
+			if x.BoolArray[j0] {
+				b0 |= 1 << uint(j0-i0)
+			}
+		}
+		encoder.Uint8(b0)
+	}
+	encoder.Bytes(x.Bytes)
+	encoder.Uvarint(uint64(len(x.Array)))
+	for i0 := range x.Array {
+		encoder.Int16(x.Array[i0], false)
+	}
+	encoder.Uvarint(uint64(len(x.Slice)))
+	for i0 := range x.Slice {
+		x.Slice[i0].binaryEncode(encoder)
+	}
+	encoder.Uvarint(uint64(len(x.IDs)))
+	for i0 := range x.IDs {
+		encoder.Int(x.IDs[i0])
+	}
+	encoder.Uvarint(uint64(len(x.Matrix)))
+	for i0 := range x.Matrix {
+		encoder.Uvarint(uint64(len(x.Matrix[i0])))
+		for i1 := range x.Matrix[i0] {
+			encoder.Uint32(x.Matrix[i0][i1], false)
+		}
+	}
+	encoder.Uvarint(uint64(len(x.Map)))
+	for k0, e0 := range x.Map {
+		encoder.String(k0)
+		e0.binaryEncode(encoder)
+	}
+	encoder.Uvarint(uint64(len(x.MapPtr)))
+	for k0, e0 := range x.MapPtr {
+		encoder.Int(k0)
+		encoder.Bool(e0 != nil)
+		if e0 != nil {
+			encoder.Int(*e0)
+		}
+	}
+	encoder.Bool(x.Nilable != nil)
+	if x.Nilable != nil {
+		encoder.Uvarint(uint64(len(x.Nilable)))
+		for i0 := range x.Nilable {
+			encoder.Int(x.Nilable[i0])
+		}
+	}
+	encoder.Bool(x.NilMap != nil)
+	if x.NilMap != nil {
+		encoder.Uvarint(uint64(len(x.NilMap)))
+		for k0, e0 := range x.NilMap {
+			encoder.Int(k0)
+			encoder.String(e0)
+		}
+	}
+	encoder.Bool(x.NilBytes != nil)
+	if x.NilBytes != nil {
+		encoder.Bytes(x.NilBytes)
+	}
+	encoder.Uvarint(uint64(len(x.Colors)))
+	for i0 := range x.Colors {
+		encoder.Uint8(uint8(x.Colors[i0]))
+	}
+	x.Basic.binaryEncode(encoder)
+	encoder.Bool(x.Flag)
+}
+
+func (x *Composite) binaryDecode(decoder *binary.Decoder) {
+	x.Inner.binaryDecode(decoder)
+	if decoder.Bool() {
+		if x.Ptr == nil {
+			x.Ptr = new(Inner)
+		}
+		(*x.Ptr).binaryDecode(decoder)
+	} else {
+		x.Ptr = nil
+	}
+	if decoder.Bool() {
+		if x.PtrInt == nil {
+			x.PtrInt = new(int)
+		}
+		*x.PtrInt = decoder.Int()
+	} else {
+		x.PtrInt = nil
+	}
+	if decoder.Bool() {
+		if x.PtrPtr == nil {
+			x.PtrPtr = new(*string)
+		}
+		if decoder.Bool() {
+			if *x.PtrPtr == nil {
+				*x.PtrPtr = new(string)
+			}
+			**x.PtrPtr = decoder.String()
+		} else {
+			*x.PtrPtr = nil
+		}
+	} else {
+		x.PtrPtr = nil
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		x.Bools = make([]bool, l0)
+		for i0 := 0; i0 < l0; i0 += 8 {
+			b0 := decoder.Uint8()
+			for j0 := i0; j0 < i0+8 && j0 < l0 && j0 < len(x.Bools); j0++ {
+				x.Bools[j0] = b0&(1<<uint(j0-i0)) != 0
+			}
+		}
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		for i0 := 0; i0 < l0; i0 += 8 {
+			b0 := decoder.Uint8()
+			for j0 := i0; j0 < i0+8 && j0 < l0 && j0 < len(x.BoolArray); j0++ {
+				x.BoolArray[j0] = b0&(1<<uint(j0-i0)) != 0
+			}
+		}
+	}
+	if b0 := decoder.Bytes(); len(b0) > 0 {
+		x.Bytes = b0
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		for i0 := 0; i0 < l0; i0++ {
+			var e0 int16
+			p0 := &e0
+			if i0 < len(x.Array) {
+				p0 = &x.Array[i0]
+			}
+			*p0 = decoder.Int16(false)
+		}
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		x.Slice = make([]Inner, l0)
+		for i0 := 0; i0 < l0; i0++ {
+			x.Slice[i0].binaryDecode(decoder)
+		}
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		x.IDs = make(IDs, l0)
+		for i0 := 0; i0 < l0; i0++ {
+			x.IDs[i0] = decoder.Int()
+		}
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		x.Matrix = make([][]uint32, l0)
+		for i0 := 0; i0 < l0; i0++ {
+			if l1 := decoder.Length(); l1 > 0 {
+				x.Matrix[i0] = make([]uint32, l1)
+				for i1 := 0; i1 < l1; i1++ {
+					x.Matrix[i0][i1] = decoder.Uint32(false)
+				}
+			}
+		}
+	}
+	if x.Map == nil {
+		x.Map = make(map[string]Inner)
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		for i0 := 0; i0 < l0; i0++ {
+			var k0 string
+			var e0 Inner
+			k0 = decoder.String()
+			e0.binaryDecode(decoder)
+			x.Map[k0] = e0
+		}
+	}
+	if x.MapPtr == nil {
+		x.MapPtr = make(map[int]*int)
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		for i0 := 0; i0 < l0; i0++ {
+			var k0 int
+			var e0 *int
+			k0 = decoder.Int()
+			if decoder.Bool() {
+				if e0 == nil {
+					e0 = new(int)
+				}
+				*e0 = decoder.Int()
+			} else {
+				e0 = nil
+			}
+			x.MapPtr[k0] = e0
+		}
+	}
+	if !decoder.Bool() {
+		x.Nilable = nil
+	} else {
+		l0 := decoder.Length()
+		x.Nilable = make([]int, l0)
+		for i0 := 0; i0 < l0; i0++ {
+			x.Nilable[i0] = decoder.Int()
+		}
+	}
+	if !decoder.Bool() {
+		x.NilMap = nil
+	} else {
+		if x.NilMap == nil {
+			x.NilMap = make(map[int]string)
+		}
+		l0 := decoder.Length()
+		for i0 := 0; i0 < l0; i0++ {
+			var k0 int
+			var e0 string
+			k0 = decoder.Int()
+			e0 = decoder.String()
+			x.NilMap[k0] = e0
+		}
+	}
+	if !decoder.Bool() {
+		x.NilBytes = nil
+	} else {
+		x.NilBytes = decoder.Bytes()
+	}
+	if l0 := decoder.Length(); l0 > 0 {
+		x.Colors = make([]Color, l0)
+		for i0 := 0; i0 < l0; i0++ {
+			x.Colors[i0] = Color(decoder.Uint8())
+		}
+	}
+	x.Basic.binaryDecode(decoder)
+	x.Flag = decoder.Bool()
+}
@@ -0,0 +1,90 @@
+package gentest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vipally/binary"
+)
+
+// plainComposite has no generated methods, so that it is encoded by reflection.
+type plainComposite Composite
+
+func init() {
+	binary.RegStruct((*plainComposite)(nil)) //field tags work for registed structs only
+}
+
+func newComposite() Composite {
+	s := "ptr"
+	ps := &s
+	i := 7
+	return Composite{
+		Inner:     Inner{Ok: true, Color: 3, Name: "inner"},
+		Ptr:       &Inner{Name: "ptr"},
+		PtrInt:    &i,
+		PtrPtr:    &ps,
+		Bools:     []bool{true, false, true, true, false, false, true, false, true},
+		BoolArray: [3]bool{false, true, true},
+		Bytes:     []byte("bytes"),
+		Array:     [2]int16{-1, 2},
+		Slice:     []Inner{{Ok: true}, {Color: 1}},
+		IDs:       IDs{1, -200, 30000},
+		Matrix:    [][]uint32{{1, 2}, nil, {3}},
+		Map:       map[string]Inner{"a": {Name: "b"}},
+		MapPtr:    map[int]*int{-1: &i},
+		Nilable:   []int{},
+		NilMap:    nil,
+		NilBytes:  []byte{},
+		Colors:    []Color{1, 2},
+		Basic: Basic{
+			Bool: true, Int: -300, Int8: -8, Int16: -16, Int32: -32, Int64: -64,
+			Uint: 300, Uint8: 8, Uint16: 16, Uint32: 32, Uint64: 64,
+			Float32: 1.5, Float64: -2.5, Complex64: 1 + 2i, Complex128: 3 - 4i,
+			String: "string", Byte: 'b', Rune: '中',
+			Packed: -1000, UPacked: 1 << 40, Fixed: -1, UFixed: 1,
+		},
+		Flag: true,
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	v := newComposite()
+	plain := plainComposite(v)
+
+	b, err := v.Encode(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := binary.Encode(plain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("Encode got %x\nneed %x\n", b, want)
+	}
+	if size, want := v.Size(), binary.Sizeof(plain); size != want {
+		t.Errorf("Size got %d\nneed %d\n", size, want)
+	}
+
+	var d Composite
+	if err := d.Decode(want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, v) {
+		t.Errorf("Decode got %+v\nneed %+v\n", d, v)
+	}
+
+	var p struct{ C plainComposite } //*plainComposite has promoted methods of embedded Inner
+	if err := binary.Decode(b, &p); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(Composite(p.C), v) {
+		t.Errorf("Decode got %+v\nneed %+v\n", p.C, v)
+	}
+
+	var e Composite
+	if err := e.Decode(b[:len(b)-1]); err == nil {
+		t.Errorf("Decode got nil error\nneed none-nil error\n")
+	}
+}
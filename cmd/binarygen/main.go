@@ -0,0 +1,79 @@
+// Binarygen generates reflection-free Size/Encode/Decode methods of structs,
+// which are compatible with the wire format of package github.com/vipally/binary.
+//
+// Annotate a struct with comment "//binary:gen" in its doc comment:
+//
+//	//binary:gen
+//	type Message struct {
+//		ID   uint32 `binary:"packed"`
+//		Body []byte
+//	}
+//
+// and run binarygen with the source file, or by go generate:
+//
+//	//go:generate binarygen $GOFILE
+//
+// It writes methods of the annotated structs in file.go to file_binary.go,
+// which makes the structs implement interface binary.BinarySerializer.
+//
+// Fields may be bool, ints, uints, floats, complexes, string, and pointers,
+// slices, arrays and maps of them, or annotated structs of the same package.
+// Field tag options ignore, packed, fixed and nilable are supported, as what they
+// mean to structs registed by binary.RegStruct.
+// Keys of maps are encoded in the order of map iteration.
+// Fields must not be named Size, Encode or Decode, as the generated methods.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: binarygen [file.go ...]\n")
+	fmt.Fprintf(os.Stderr, "generates methods of annotated structs in file.go to file_binary.go.\n")
+	fmt.Fprintf(os.Stderr, "file.go is $GOFILE by default.\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		if f := os.Getenv("GOFILE"); f != "" {
+			files = []string{f}
+		} else {
+			usage()
+			os.Exit(2)
+		}
+	}
+
+	for _, file := range files {
+		if err := generateFile(file); err != nil {
+			fmt.Fprintf(os.Stderr, "binarygen: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+// generateFile generate methods of annotated structs in file to file_binary.go.
+func generateFile(file string) error {
+	src, err := generate(file)
+	if err != nil {
+		return err
+	}
+	if src == nil { //no annotated structs
+		return nil
+	}
+	return os.WriteFile(outputName(file), src, 0644)
+}
+
+// outputName returns name of generated file of source file.
+func outputName(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + "_binary.go"
+}
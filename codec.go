@@ -0,0 +1,292 @@
+// cache codec of special types which are not encoded/decoded by the reflect path,
+// such as types that implement encoding.BinaryMarshaler.
+
+package binary
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	tBinaryEncoder     = reflect.TypeOf((*BinaryEncoder)(nil)).Elem()
+	tBinaryMarshaler   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	tBinaryUnmarshaler = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	tTextMarshaler     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	tTextUnmarshaler   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+var _codecMgr codecMgr
+
+// builtin codecs of special types, which are registed by init of their files.
+var _builtinCodecs = make(map[reflect.Type]*typeCodec)
+
+// typeCodec encode/decode a special type.
+// Lengths of encoded values should use length prefix of field.
+type typeCodec struct {
+	size   func(v reflect.Value, field *fieldInfo) int //bytes of encoded v, -1 if v is invalid
+	encode func(encoder *Encoder, v reflect.Value, field *fieldInfo) error
+	decode func(decoder *Decoder, v reflect.Value, field *fieldInfo) error //v must be settable
+	skip   func(decoder *Decoder, field *fieldInfo) int                    //optional, bytes skiped
+}
+
+// skipByType skip the next value of type t.
+// It decodes a temporary value if codec has no skip function.
+func (codec *typeCodec) skipByType(decoder *Decoder, t reflect.Type, field *fieldInfo) int {
+	if codec.skip != nil {
+		return codec.skip(decoder, field)
+	}
+	v := reflect.New(t).Elem()
+	if err := codec.decode(decoder, v, field); err != nil {
+		panic(err)
+	}
+	return codec.size(v, field)
+}
+
+type codecMgr struct {
+	cache     sync.Map //reflect.Type -> *typeCodec, nil for types without codec
+	textCache sync.Map //reflect.Type -> bool, if type implements TextMarshaler/TextUnmarshaler
+	userReg   sync.Map //reflect.Type -> *typeCodec, registed by RegisterCodec
+}
+
+// RegisterCodec register custom encoding of the type of t by functions, for
+// types which cannot define methods of BinarySerializer, such as types of
+// other packages. t is value or pointer of the type, which must be a named
+// type other than pointer and interface.
+// enc encode value x of the type, dec decode to x which is pointer of the
+// type, and size returns bytes number of value x encoded by enc, or -1 if x is
+// invalid. Values encoded by enc must be decodable without their sizes, such
+// as length-prefixed bytes.
+// It replaces the codecs of the type by BinaryMarshaler and builtin codecs.
+// Register before encoding/decoding the type and RegStruct of structs contain it.
+func RegisterCodec(t interface{}, enc func(encoder *Encoder, x interface{}) error,
+	dec func(decoder *Decoder, x interface{}) error, size func(x interface{}) int) error {
+	rt := reflect.TypeOf(t)
+	if rt != nil && rt.Kind() == reflect.Ptr && rt.Name() == "" {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.Kind() == reflect.Ptr || rt.Kind() == reflect.Interface || rt.PkgPath() == "" {
+		return errorf(ErrUnsupportedType, "binary.RegisterCodec: unsupported type %T", t)
+	}
+	if enc == nil || dec == nil || size == nil {
+		return fmt.Errorf("binary.RegisterCodec: nil functions of %s", rt.String())
+	}
+	_codecMgr.userReg.Store(rt, funcCodec(enc, dec, size))
+	_codecMgr.cache.Delete(rt)
+	return nil
+}
+
+// funcCodec returns codec of functions of RegisterCodec.
+func funcCodec(enc func(encoder *Encoder, x interface{}) error,
+	dec func(decoder *Decoder, x interface{}) error, size func(x interface{}) int) *typeCodec {
+	return &typeCodec{
+		size: func(v reflect.Value, field *fieldInfo) int {
+			return size(v.Interface())
+		},
+		encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+			return enc(encoder, v.Interface())
+		},
+		decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+			return dec(decoder, v.Addr().Interface())
+		},
+	}
+}
+
+func (mgr *codecMgr) query(t reflect.Type) *typeCodec {
+	if c, ok := mgr.cache.Load(t); ok {
+		return c.(*typeCodec)
+	}
+	c := mgr.find(t)
+	mgr.cache.Store(t, c)
+	return c
+}
+
+// isText reports whether type t can be encoded by encoding.TextMarshaler/TextUnmarshaler.
+func (mgr *codecMgr) isText(t reflect.Type) bool {
+	if ok, cached := mgr.textCache.Load(t); cached {
+		return ok.(bool)
+	}
+	pt := reflect.PtrTo(t)
+	ok := (t.Implements(tTextMarshaler) || pt.Implements(tTextMarshaler)) &&
+		pt.Implements(tTextUnmarshaler)
+	mgr.textCache.Store(t, ok)
+	return ok
+}
+
+// find the codec of type t from builtin codecs or by the interfaces it implements.
+func (mgr *codecMgr) find(t reflect.Type) *typeCodec {
+	if c, ok := mgr.userReg.Load(t); ok {
+		return c.(*typeCodec)
+	}
+	if c, ok := _builtinCodecs[t]; ok {
+		return c
+	}
+	if t.Kind() == reflect.Struct && t.Implements(tOptional) {
+		return &optionCodec
+	}
+	pt := reflect.PtrTo(t)
+	if t.Implements(tBinaryEncoder) || pt.Implements(tBinaryEncoder) { //BinarySerializer first
+		return nil
+	}
+	if (t.Implements(tBinaryMarshaler) || pt.Implements(tBinaryMarshaler)) &&
+		pt.Implements(tBinaryUnmarshaler) {
+		return &binaryMarshalerCodec
+	}
+	return nil
+}
+
+// queryCodec returns codec of special type t, or nil if t is not special.
+// Codecs of the type of a field of registed struct and its elements are
+// looked up once by parse of the struct, so that encoding its values pays no
+// lookup of the cache.
+func queryCodec(t reflect.Type, field *fieldInfo) *typeCodec {
+	if field != nil {
+		for i := range field.codecs {
+			if c := &field.codecs[i]; c.t == t {
+				return c.codec
+			}
+		}
+	}
+	return lookupCodec(t, field)
+}
+
+// maxFieldCodecs is max number of types of a field and its elements of which
+// codecs are looked up by parse of the struct.
+const maxFieldCodecs = 4
+
+// fieldCodec is codec of a type of values of a field.
+type fieldCodec struct {
+	t     reflect.Type
+	codec *typeCodec //nil if t is not special
+}
+
+// lookupCodecs look up codecs of type t of field and types of its elements,
+// pointed values, map keys and map values, until a struct or maxFieldCodecs.
+func (field *fieldInfo) lookupCodecs(t reflect.Type) {
+	if len(field.codecs) >= maxFieldCodecs {
+		return
+	}
+	field.codecs = append(field.codecs, fieldCodec{t: t, codec: lookupCodec(t, field)})
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		field.lookupCodecs(t.Elem())
+	case reflect.Map:
+		field.lookupCodecs(t.Key())
+		field.lookupCodecs(t.Elem())
+	}
+}
+
+// lookupCodec returns codec of special type t by field tag options and the
+// cache of types.
+// Pointers and interfaces are always dealed by the reflect path.
+func lookupCodec(t reflect.Type, field *fieldInfo) *typeCodec {
+	k := t.Kind()
+	if k == reflect.Ptr || k == reflect.Interface {
+		return nil
+	}
+	if field.isFloat16() && (k == reflect.Float32 || k == reflect.Float64) { //opt-in by field tag `binary:"float16"`
+		return &float16Codec
+	}
+	if field.isPlainVarint(k) { //opt-in by field tag `binary:"nozigzag"`
+		return &plainVarintCodec
+	}
+	if field.isText() && _codecMgr.isText(t) { //opt-in by field tag `binary:"text"`
+		return &textMarshalerCodec
+	}
+	if k != reflect.Struct && t.PkgPath() == "" { //unnamed and predeclared types have no methods or codecs
+		return nil
+	}
+	return _codecMgr.query(t)
+}
+
+// methodValue returns v or its address that is able to call methods of pointer receiver.
+func methodValue(v reflect.Value) interface{} {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface()
+}
+
+// encoding.BinaryMarshaler/BinaryUnmarshaler are encoded as length-prefixed bytes.
+var binaryMarshalerCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		b, err := methodValue(v).(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return -1
+		}
+		return field.sizeofLen(len(b)) + len(b)
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		b, err := methodValue(v).(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		encoder.bytes(b, field)
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		b := decoder.bytes(field)
+		if err := v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b); err != nil {
+			return fmt.Errorf("binary.Decoder.Value: %s %s", v.Type().String(), err.Error())
+		}
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		size, n := decoder.length(field)
+		decoder.Skip(size)
+		return size + n
+	},
+}
+
+// encoding.TextMarshaler/TextUnmarshaler are encoded as length-prefixed text.
+var textMarshalerCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		b, err := methodValue(v).(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return -1
+		}
+		return field.sizeofLen(len(b)) + len(b)
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		b, err := methodValue(v).(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		encoder.bytes(b, field)
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		b := decoder.bytes(field)
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(b); err != nil {
+			return fmt.Errorf("binary.Decoder.Value: %s %s", v.Type().String(), err.Error())
+		}
+		return nil
+	},
+	skip: binaryMarshalerCodec.skip,
+}
+
+// signed varints are encoded as plain two's complement uvarint (LEB128) instead
+// of zigzag, to match external formats such as int32/int64 of protobuf.
+// Negative values take 10 bytes.
+var plainVarintCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		return SizeofUvarint(uint64(v.Int()))
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		encoder.Uvarint(uint64(v.Int()))
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		x, _ := decoder.Uvarint()
+		v.SetInt(int64(x)) //truncated to size of v as protobuf
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		_, n := decoder.Uvarint()
+		return n
+	},
+}
@@ -9,8 +9,52 @@ import (
 var (
 	// ErrNotEnoughSpace buffer not enough
 	ErrNotEnoughSpace = errors.New("not enough space")
+	// ErrTrailingBytes bytes remain after decoding in strict mode
+	ErrTrailingBytes = errors.New("binary.Decoder.Value: trailing bytes after value")
+	// ErrTruncated data ends before value decoded. It is io.ErrUnexpectedEOF as
+	// decoding from readers returns
+	ErrTruncated = io.ErrUnexpectedEOF
+	// ErrOverflow value overflows its type or encoding, such as varints over 64 bits
+	ErrOverflow = errors.New("binary: value overflows")
+	// ErrUnsupportedType type is not supported to encode/decode
+	ErrUnsupportedType = errors.New("binary: unsupported type")
+	// ErrLimitExceeded decoding exceeds limits such as max depth, length,
+	// allocation or message size
+	ErrLimitExceeded = errors.New("binary: limit exceeded")
+	// ErrChecksum checksum trailer mismatch the message
+	ErrChecksum = errors.New("binary: checksum mismatch")
 )
 
+// kindError is error of kind such as ErrOverflow, which matches the kind by
+// errors.Is and keeps its own message.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns kind of the error.
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
+
+// errorf returns error of kind formatted by format and a.
+func errorf(kind error, format string, a ...interface{}) error {
+	return &kindError{kind: kind, msg: fmt.Sprintf(format, a...)}
+}
+
+// panicError returns error of panic info recovered by function where.
+// Panics of reflect or user codecs may be not errors.
+func panicError(info interface{}, where string) error {
+	if err, ok := info.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%s: %v", where, info)
+}
+
 type coder struct {
 	buff []byte
 	pos  int
@@ -76,7 +120,7 @@ func (cder *coder) resetBoolCoder() {
 func (cder *coder) reserve(size int) []byte {
 	newPos := cder.pos + size
 	if newPos > cder.Cap() {
-		panic(fmt.Errorf("binary.Coder:buffer overflow pos=%d cap=%d require=%d, not enough space", cder.pos, cder.Cap(), size))
+		panic(errorf(ErrNotEnoughSpace, "binary.Coder:buffer overflow pos=%d cap=%d require=%d, not enough space", cder.pos, cder.Cap(), size))
 	}
 	if size > 0 && newPos <= cder.Cap() {
 		b := cder.buff[cder.pos:newPos]
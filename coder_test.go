@@ -1,15 +1,37 @@
 package binary
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	std "encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
+	"net/netip"
+	"os"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 	"unsafe"
+
+	stdbinary "encoding/binary"
+	mbig "math/big"
+	mrand "math/rand"
 )
 
 type TDoNotSupport struct {
-	DeepPointer   **uint32
+	DeepPointer   **uintptr
 	Uintptr       uintptr
 	UnsafePointer unsafe.Pointer
 	Ch            chan bool
@@ -717,7 +739,7 @@ func TestEncodeDonotSupportedType(t *testing.T) {
 			//fmt.Printf("Decode error: %#v\n%s\n", tv.Field(i).Addr().Type().String(), err.Error())
 		}
 
-		if err := decoder.value(tv.Field(i), true, false); err == nil {
+		if err := decoder.value(tv.Field(i), true, nil); err == nil {
 			t.Errorf("EncodeDonotSupportedType.%v: have err == nil, want non-nil", tv.Field(i).Type())
 		} else {
 			//fmt.Println(err)
@@ -736,7 +758,7 @@ func TestDecoder(t *testing.T) {
 	if got != -1 {
 		t.Errorf("Decoder: have %d, want %d", got, -1)
 	}
-	n := decoder.skipByType(reflect.TypeOf(uintptr(0)), false)
+	n := decoder.skipByType(reflect.TypeOf(uintptr(0)), nil)
 	if n != -1 {
 		t.Errorf("Decoder: have %d, want %d", n, -1)
 	}
@@ -1095,3 +1117,5464 @@ func TestBools(t *testing.T) {
 		t.Errorf("EncodeBools got %+v\nneed %+v\n", dataDecode, data)
 	}
 }
+
+func TestLenPrefix(t *testing.T) {
+	type lenPrefix struct {
+		A string   `binary:"lenprefix=uint8"`
+		B []uint16 `binary:"lenprefix=uint16"`
+		C []bool   `binary:"lenprefix=uint32"`
+		D string
+	}
+	var data = lenPrefix{"ab", []uint16{1, 2}, []bool{true, false, true}, "c"}
+	RegStruct((*lenPrefix)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("LenPrefix got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0x2, 0x61, 0x62, 0x2, 0x0, 0x1, 0x0, 0x2, 0x0, 0x3, 0x0, 0x0, 0x0, 0x5, 0x1, 0x63}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("LenPrefix %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode lenPrefix
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("LenPrefix got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	type lenPrefixOverflow struct {
+		A []uint8 `binary:"lenprefix=uint8"`
+	}
+	RegStruct((*lenPrefixOverflow)(nil))
+	if _, err := Encode(lenPrefixOverflow{make([]uint8, 256)}, nil); err == nil {
+		t.Errorf("LenPrefix: have err == nil, want non-nil")
+	}
+
+	type lenPrefixInvalid struct {
+		A string `binary:"lenprefix=int8"`
+	}
+	if err := RegStruct((*lenPrefixInvalid)(nil)); err == nil {
+		t.Errorf("LenPrefix: have err == nil, want non-nil")
+	}
+}
+
+func TestFieldEndian(t *testing.T) {
+	type fieldEndian struct {
+		A uint16
+		B uint16   `binary:"big"`
+		C []uint32 `binary:"big,lenprefix=uint16"`
+		D uint16   `binary:"little"`
+	}
+	var data = fieldEndian{0x0102, 0x0304, []uint32{0x05060708}, 0x090a}
+	RegStruct((*fieldEndian)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x2, 0x1, 0x3, 0x4, 0x0, 0x1, 0x5, 0x6, 0x7, 0x8, 0xa, 0x9}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("FieldEndian %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode fieldEndian
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("FieldEndian got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	encoder := NewEncoderEndian(Sizeof(data), BigEndian)
+	if err := encoder.Value(data); err != nil {
+		t.Error(err)
+	}
+	check = []byte{0x1, 0x2, 0x3, 0x4, 0x0, 0x1, 0x5, 0x6, 0x7, 0x8, 0xa, 0x9}
+	if b := encoder.Buffer(); !reflect.DeepEqual(b, check) {
+		t.Errorf("FieldEndian %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+}
+
+func TestFixedInts(t *testing.T) {
+	type fixedInts struct {
+		A int   `binary:"fixed"`
+		B uint  `binary:"fixed"`
+		C []int `binary:"fixed"`
+		D int
+	}
+	var data = fixedInts{-1, 2, []int{3}, -5}
+	RegStruct((*fixedInts)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("FixedInts got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x2, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+		0x1, 0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0,
+		0x9,
+	}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("FixedInts %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode fixedInts
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("FixedInts got %+v\nneed %+v\n", dataDecode, data)
+	}
+}
+
+type binaryMarshaler struct {
+	a uint8
+	b string
+}
+
+func (m binaryMarshaler) MarshalBinary() ([]byte, error) {
+	return append([]byte{m.a}, m.b...), nil
+}
+
+func (m *binaryMarshaler) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("empty data")
+	}
+	m.a, m.b = data[0], string(data[1:])
+	return nil
+}
+
+func TestBinaryMarshaler(t *testing.T) {
+	type marshalers struct {
+		A binaryMarshaler
+		B *binaryMarshaler
+		C []binaryMarshaler
+		D map[string]binaryMarshaler
+		E uint8
+	}
+	var data = marshalers{
+		A: binaryMarshaler{1, "a"},
+		B: &binaryMarshaler{2, "bc"},
+		C: []binaryMarshaler{{3, ""}},
+		D: map[string]binaryMarshaler{"d": {4, "d"}},
+		E: 5,
+	}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("BinaryMarshaler got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0x2, 0x1, 0x61, 0x1, 0x3, 0x2, 0x62, 0x63, 0x1, 0x1, 0x3, 0x1, 0x1, 0x64, 0x2, 0x4, 0x64, 0x5}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("BinaryMarshaler %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode marshalers
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("BinaryMarshaler got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	decoder := NewDecoder(b)
+	if n := decoder.skipByType(reflect.TypeOf(data), nil); n != len(b) {
+		t.Errorf("BinaryMarshaler skip got %d need %d", n, len(b))
+	}
+
+	if err := Decode([]byte{0x0}, &dataDecode.A); err == nil {
+		t.Errorf("BinaryMarshaler: have err == nil, want non-nil")
+	}
+
+	tm := time.Date(2017, 3, 4, 5, 6, 7, 8, time.UTC)
+	var tmDecode time.Time
+	if b, err := Encode(tm, nil); err != nil {
+		t.Error(err)
+	} else if err := Decode(b, &tmDecode); err != nil {
+		t.Error(err)
+	} else if !tm.Equal(tmDecode) {
+		t.Errorf("BinaryMarshaler got %v need %v", tmDecode, tm)
+	}
+}
+
+type textMarshaler uint8
+
+func (m textMarshaler) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("T%d", m)), nil
+}
+
+func (m *textMarshaler) UnmarshalText(data []byte) error {
+	_, err := fmt.Sscanf(string(data), "T%d", (*uint8)(m))
+	return err
+}
+
+func TestTextMarshaler(t *testing.T) {
+	type textMarshalers struct {
+		A textMarshaler   `binary:"text"`
+		B []textMarshaler `binary:"text,lenprefix=uint8"`
+		C textMarshaler
+	}
+	var data = textMarshalers{1, []textMarshaler{23}, 4}
+	RegStruct((*textMarshalers)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("TextMarshaler got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0x2, 0x54, 0x31, 0x1, 0x3, 0x54, 0x32, 0x33, 0x4}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("TextMarshaler %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode textMarshalers
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("TextMarshaler got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	if err := Decode([]byte{0x1, 0x58, 0x0, 0x0}, &dataDecode); err == nil {
+		t.Errorf("TextMarshaler: have err == nil, want non-nil")
+	}
+}
+
+func TestTime(t *testing.T) {
+	type times struct {
+		A time.Time
+		B time.Time `binary:"unixnano"`
+		C *time.Time
+		D []time.Time
+	}
+	tm := time.Date(2017, 3, 4, 5, 6, 7, 8, time.UTC)
+	tz := time.Date(2017, 3, 4, 5, 6, 7, 8, time.FixedZone("", 8*3600))
+	var data = times{tm, tm, &tz, []time.Time{tm}}
+	RegStruct((*times)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("Time got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+
+	var dataDecode times
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("Time got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if _, offset := dataDecode.C.Zone(); offset != 8*3600 {
+		t.Errorf("Time got zone offset %d need %d", offset, 8*3600)
+	}
+
+	b, err = Encode(tm, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x1, 0x3f, 0x4b, 0xba, 0x58, 0x0, 0x0, 0x0, 0x0, 0x8, 0x0, 0x0, 0x0}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("Time %v\n got %#v\nneed %#v\n", tm, b, check)
+	}
+	var tmDecode time.Time
+	if err := Decode(b, &tmDecode); err != nil {
+		t.Error(err)
+	}
+	if tmDecode != tm {
+		t.Errorf("Time got %v need %v", tmDecode, tm)
+	}
+
+	//zone offset in seconds, decoded in a fixed zone
+	tz = time.Date(2017, 3, 4, 5, 6, 7, 8, time.FixedZone("LMT", 5*3600+30*60+17))
+	b, err = Encode(tz, nil)
+	if err != nil || len(b) != 17 || Sizeof(tz) != 17 {
+		t.Errorf("Time %v got % x %v", tz, b, err)
+	}
+	if err := Decode(b, &tmDecode); err != nil || !tmDecode.Equal(tz) {
+		t.Errorf("Time got %v %v need %v", tmDecode, err, tz)
+	}
+	if name, offset := tmDecode.Zone(); name != "" || offset != 5*3600+30*60+17 {
+		t.Errorf("Time got zone %s %d need offset %d", name, offset, 5*3600+30*60+17)
+	}
+	local := time.Date(2017, 3, 4, 5, 6, 7, 8, time.Local)
+	b, _ = Encode(local, nil)
+	if err := Decode(b, &tmDecode); err != nil || !tmDecode.Equal(local) || tmDecode.Location() == time.Local {
+		t.Errorf("Time got %v %v need %v in fixed zone", tmDecode, err, local)
+	}
+
+	type zoned struct {
+		A, B time.Time
+		C    uint8
+	}
+	RegStruct((*zoned)(nil))
+	b, err = Encode(zoned{tz, tm, 7}, nil)
+	var z zoned
+	if err != nil || DecodeFields(b, &z, "C") != nil || z.C != 7 {
+		t.Errorf("Time skip got %+v %v", z, err)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	type durations struct {
+		A time.Duration
+		B time.Duration `binary:"fixed"`
+		C []time.Duration
+	}
+	var data = durations{-time.Nanosecond, time.Nanosecond, []time.Duration{64, 1}}
+	RegStruct((*durations)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("Duration got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0x1, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x2, 0x80, 0x1, 0x2}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("Duration %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode durations
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("Duration got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	for _, v := range []interface{}{time.Second, []time.Duration{time.Hour, -time.Minute}} {
+		b, err := Encode(v, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if s := Sizeof(v); s != len(b) {
+			t.Errorf("Duration got %+v %+v\nneed %+v\n", len(b), b, s)
+		}
+		r := reflect.New(reflect.TypeOf(v))
+		if err := Decode(b, r.Interface()); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(r.Elem().Interface(), v) {
+			t.Errorf("Duration got %+v\nneed %+v\n", r.Elem().Interface(), v)
+		}
+	}
+}
+
+func TestBig(t *testing.T) {
+	type bigs struct {
+		A mbig.Int
+		B *mbig.Int
+		C *mbig.Float
+		D *mbig.Rat
+		E *mbig.Int
+		F []mbig.Int
+	}
+	var data = bigs{
+		A: *mbig.NewInt(-258),
+		B: mbig.NewInt(1),
+		C: mbig.NewFloat(-1.5),
+		D: mbig.NewRat(-3, 4),
+		F: []mbig.Int{*mbig.NewInt(0), *mbig.NewInt(256)},
+	}
+	RegStruct((*bigs)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("Big got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0x1, 0x2, 0x1, 0x2, 0x7, 0x0, 0x1, 0x1}
+	if !reflect.DeepEqual(b[:len(check)], check) {
+		t.Errorf("Big %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode bigs
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if dataDecode.A.Cmp(&data.A) != 0 || dataDecode.B.Cmp(data.B) != 0 ||
+		dataDecode.C.Cmp(data.C) != 0 || dataDecode.D.Cmp(data.D) != 0 ||
+		dataDecode.E != nil || len(dataDecode.F) != 2 ||
+		dataDecode.F[0].Cmp(&data.F[0]) != 0 || dataDecode.F[1].Cmp(&data.F[1]) != 0 {
+		t.Errorf("Big got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if dataDecode.C.Prec() != data.C.Prec() {
+		t.Errorf("Big got precision %d\nneed %d\n", dataDecode.C.Prec(), data.C.Prec())
+	}
+}
+
+func TestIP(t *testing.T) {
+	type ips struct {
+		A net.IP
+		B net.IP
+		C net.IP
+		D netip.Addr
+		E netip.Addr
+		F netip.AddrPort
+		G []netip.Addr
+	}
+	var data = ips{
+		A: net.IPv4(1, 2, 3, 4).To4(),
+		B: net.ParseIP("::1"),
+		D: netip.MustParseAddr("fe80::1%eth0"),
+		F: netip.MustParseAddrPort("10.0.0.1:80"),
+		G: []netip.Addr{netip.MustParseAddr("::ffff:1.2.3.4")},
+	}
+	RegStruct((*ips)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("IP got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0x4, 0x1, 0x2, 0x3, 0x4, 0x10}
+	if !reflect.DeepEqual(b[:len(check)], check) {
+		t.Errorf("IP %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode ips
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("IP got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	if _, err := Encode(net.IP{1, 2}, nil); err == nil {
+		t.Errorf("IP got nil error for invalid IP length\n")
+	}
+}
+
+type ifaceShape interface {
+	Area() int
+}
+
+type ifaceRect struct {
+	W, H int
+}
+
+func (r ifaceRect) Area() int { return r.W * r.H }
+
+type ifaceSquare int
+
+func (s *ifaceSquare) Area() int { return int(*s) * int(*s) }
+
+func TestInterface(t *testing.T) {
+	type shapes struct {
+		A ifaceShape
+		B ifaceShape
+		C ifaceShape
+		D []ifaceShape
+		E interface{}
+		F bool
+	}
+	if err := RegType(ifaceRect{}); err != nil {
+		t.Error(err)
+	}
+	if err := RegType((*ifaceSquare)(nil)); err != nil {
+		t.Error(err)
+	}
+	if err := RegType(ifaceRect{}); err == nil {
+		t.Errorf("RegType got nil error for duplicate type\n")
+	}
+	sq := ifaceSquare(3)
+	var data = shapes{
+		A: ifaceRect{2, 3},
+		C: &sq,
+		D: []ifaceShape{nil, ifaceRect{1, 1}},
+		E: ifaceRect{4, 5},
+		F: true,
+	}
+	RegStruct((*shapes)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("Interface got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+
+	var dataDecode shapes
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("Interface got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if a := dataDecode.C.Area(); a != 9 {
+		t.Errorf("Interface got area %d\nneed %d\n", a, 9)
+	}
+
+	type unregisted struct{}
+	if _, err := Encode(shapes{E: unregisted{}}, nil); err == nil {
+		t.Errorf("Interface got nil error for unregisted type\n")
+	}
+	var dataUnregisted struct{ A ifaceShape }
+	if err := Decode([]byte{0x7f}, &dataUnregisted); err == nil {
+		t.Errorf("Interface got nil error for unregisted type ID\n")
+	}
+}
+
+func TestTypeID(t *testing.T) {
+	type named struct{ A int }
+	if s := typeName(reflect.TypeOf((*named)(nil))); s != "*github.com/vipally/binary.named" {
+		t.Errorf("TypeID got name %s\nneed %s\n", s, "*github.com/vipally/binary.named")
+	}
+	if s := typeName(reflect.TypeOf([]int{})); s != "[]int" {
+		t.Errorf("TypeID got name %s\nneed %s\n", s, "[]int")
+	}
+	if id := typeID("binary.named"); id != 0x14cd8443 {
+		t.Errorf("TypeID got %#x\nneed %#x\n", id, 0x14cd8443)
+	}
+
+	if err := RegTypeName("binary.named", named{}); err != nil {
+		t.Error(err)
+	}
+	if err := RegTypeName("binary.named", ifaceSquare(0)); err == nil {
+		t.Errorf("TypeID got nil error for conflict type ID\n")
+	}
+	var data struct{ A interface{} }
+	data.A = named{5}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if id, _ := Uvarint(b); id != typeID("binary.named") {
+		t.Errorf("TypeID got %#x\nneed %#x\n", id, typeID("binary.named"))
+	}
+	var dataDecode struct{ A interface{} }
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("TypeID got %+v\nneed %+v\n", dataDecode, data)
+	}
+}
+
+func TestMultiLevelPointer(t *testing.T) {
+	type pointers struct {
+		A **uint32
+		B ***string
+		C **uint32
+		D **struct{ A *int }
+	}
+	u, s, i := uint32(5), "ab", 7
+	pu, ps, pi := &u, &s, &i
+	pps := &ps
+	pd := &struct{ A *int }{pi}
+	var data = pointers{A: &pu, B: &pps, C: new(*uint32), D: &pd}
+	RegStruct((*pointers)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("MultiLevelPointer got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0xbf, 0x5, 0x0, 0x0, 0x0, 0x2, 0x61, 0x62, 0x3, 0xe}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("MultiLevelPointer %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode pointers
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("MultiLevelPointer got %+v\nneed %+v\n", dataDecode, data)
+	}
+}
+
+func TestNilable(t *testing.T) {
+	type nilables struct {
+		A []int          `binary:"nilable"`
+		B []int          `binary:"nilable"`
+		C map[int]string `binary:"nilable"`
+		D map[int]string `binary:"nilable"`
+		E []bool         `binary:"nilable"`
+		F [][]uint8      `binary:"nilable"`
+		G []int
+	}
+	var data = nilables{
+		B: []int{},
+		D: map[int]string{},
+		E: []bool{},
+		F: [][]uint8{nil, {}},
+	}
+	RegStruct((*nilables)(nil))
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("Nilable got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0xba, 0x0, 0x0, 0x0, 0x2, 0x0, 0x0}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("Nilable %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode nilables
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("Nilable got %#v\nneed %#v\n", dataDecode, data)
+	}
+
+	decoder := NewDecoder(b)
+	decoder.skipByType(reflect.TypeOf(nilables{}), nil)
+	if n := decoder.Len(); n != len(b) {
+		t.Errorf("Nilable skip got %d\nneed %d\n", n, len(b))
+	}
+}
+
+type cyclePointer struct {
+	A int
+	B interface{}
+}
+
+func TestCycle(t *testing.T) {
+	if err := RegType((*cyclePointer)(nil)); err != nil {
+		t.Error(err)
+	}
+	if err := RegType([]interface{}{}); err != nil {
+		t.Error(err)
+	}
+
+	p := &cyclePointer{A: 1}
+	p.B = &cyclePointer{A: 2, B: p}
+	s := []interface{}{1}
+	s[0] = s
+	want := []string{
+		"binary: encountered a cycle via *binary.cyclePointer",
+		"binary: encountered a cycle via []interface {}",
+	}
+	for i, v := range []interface{}{p, s} {
+		if size := Sizeof(v); size >= 0 {
+			t.Errorf("Cycle got size %d\nneed -1\n", size)
+		}
+		if _, err := Encode(v, nil); err == nil || err.Error() != want[i] {
+			t.Errorf("Cycle got %v\nneed %s\n", err, want[i])
+		}
+		encoder := NewEncoder(1 << 16)
+		if err := encoder.Value(v); err == nil || !strings.Contains(err.Error(), "encountered a cycle") {
+			t.Errorf("Cycle got %v\nneed cycle error\n", err)
+		}
+	}
+
+	shared := &cyclePointer{A: 3} //shared pointers are not cycles
+	dag := []*cyclePointer{shared, shared}
+	if _, err := Encode(dag, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+type recursiveNode struct {
+	Value    int
+	Next     *recursiveNode
+	Children []recursiveNode
+}
+
+func TestRecursiveType(t *testing.T) {
+	if err := RegStruct((*recursiveNode)(nil)); err != nil {
+		t.Error(err)
+	}
+	var data = recursiveNode{
+		Value: 1,
+		Next:  &recursiveNode{Value: 2, Next: &recursiveNode{Value: 3}},
+		Children: []recursiveNode{
+			{Value: 4},
+			{Value: 5, Children: []recursiveNode{{Value: 6}}},
+		},
+	}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if s := Sizeof(data); s != len(b) {
+		t.Errorf("RecursiveType got %+v %+v\nneed %+v\n", len(b), b, s)
+	}
+	check := []byte{0x2, 0x3, 0x4, 0x6, 0x0, 0x0, 0x2, 0x8, 0x0, 0xa, 0x1, 0xc, 0x0}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("RecursiveType %#v\n got %+v\nneed %+v\n", data, b, check)
+	}
+
+	var dataDecode recursiveNode
+	err = Decode(b, &dataDecode)
+	if err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("RecursiveType got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	type unregisted struct {
+		Next *unregisted
+		A    []unregisted
+	}
+	if !validUserType(reflect.TypeOf(unregisted{})) {
+		t.Errorf("RecursiveType got invalid type %T\n", unregisted{})
+	}
+	type invalid struct {
+		Next *invalid
+		A    uintptr
+	}
+	if validUserType(reflect.TypeOf(invalid{})) {
+		t.Errorf("RecursiveType got valid type %T\n", invalid{})
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	type keyStruct struct {
+		A int
+		B string
+	}
+	RegType(int(0))
+	RegType("")
+	RegType(uint8(0))
+	var datas = []interface{}{
+		map[int]string{3: "c", -1: "a", 2: "b", 10: "d", 0: "z"},
+		map[string]int{"b": 2, "a": 1, "c": 3, "": 0, "ab": 4},
+		map[float64]bool{1.5: true, -2: false, 0: true},
+		map[keyStruct]int{{1, "a"}: 1, {0, "b"}: 2, {1, ""}: 3, {2, "a"}: 4},
+		map[interface{}]int{nil: 0, 1: 1, "a": 2, uint8(1): 3},
+		map[[2]int]map[string]int{{1, 2}: {"x": 1, "y": 2}, {0, 5}: {"z": 3, "w": 4}},
+	}
+	for _, data := range datas {
+		var first []byte
+		for i := 0; i < 20; i++ {
+			encoder := NewEncoder(Sizeof(data))
+			encoder.SetDeterministic(true)
+			if err := encoder.Value(data); err != nil {
+				t.Error(err)
+			}
+			if b := encoder.Buffer(); i == 0 {
+				first = append(first, b...)
+			} else if !reflect.DeepEqual(b, first) {
+				t.Errorf("Deterministic %#v\n got %+v\nneed %+v\n", data, b, first)
+				break
+			}
+		}
+	}
+
+	encoder := NewEncoder(Sizeof(datas[0]))
+	encoder.SetDeterministic(true)
+	if err := encoder.Value(datas[0]); err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x5, 0x1, 0x1, 0x61, 0x0, 0x1, 0x7a, 0x4, 0x1, 0x62, 0x6, 0x1, 0x63, 0x14, 0x1, 0x64}
+	if b := encoder.Buffer(); !reflect.DeepEqual(b, check) {
+		t.Errorf("Deterministic got %+v\nneed %+v\n", b, check)
+	}
+
+	type unexportedKeys struct {
+		_ struct{} `binary:"unexported"`
+		m map[keyStruct]int8
+		n map[interface{}]int8
+	}
+	RegStruct((*unexportedKeys)(nil))
+	RegType(keyStruct{})
+	keys := unexportedKeys{m: map[keyStruct]int8{{1, "a"}: 1, {0, "b"}: 2, {1, ""}: 3},
+		n: map[interface{}]int8{keyStruct{2, "c"}: 1, 3: 2, nil: 3}}
+	var first []byte
+	for i := 0; i < 20; i++ {
+		encoder := NewEncoder(Sizeof(keys))
+		encoder.SetDeterministic(true)
+		if err := encoder.Value(keys); err != nil { //keys reached through unexported fields
+			t.Fatal(err)
+		}
+		if b := encoder.Buffer(); i == 0 {
+			first = b
+		} else if !reflect.DeepEqual(b, first) {
+			t.Errorf("Deterministic unexported got %+v\nneed %+v\n", b, first)
+			break
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	RegStruct((*recursiveNode)(nil))
+	var data recursiveNode
+	for i, p := 0, &data; i < 10; i++ {
+		p.Next = &recursiveNode{Value: i}
+		p = p.Next
+	}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var dataDecode recursiveNode
+	decoder := NewDecoder(b)
+	decoder.SetMaxDepth(40)
+	if err := decoder.Value(&dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("MaxDepth got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	decoder = NewDecoder(b)
+	decoder.SetMaxDepth(20)
+	want := "binary.Decoder.Value: exceeded max depth 20"
+	if err := decoder.Value(&recursiveNode{}); err == nil || decodeCause(err).Error() != want {
+		t.Errorf("MaxDepth got %v\nneed %s\n", err, want)
+	}
+
+	var skipped [0]recursiveNode
+	decoder = NewDecoder(append([]byte{0x1}, b...))
+	decoder.SetMaxDepth(20)
+	if err := decoder.Value(&skipped); err == nil || decodeCause(err).Error() != want {
+		t.Errorf("MaxDepth got %v\nneed %s\n", err, want)
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	type limits struct {
+		A []int32
+		B map[string]int
+		C string
+	}
+	var data = limits{
+		A: []int32{1, 2, 3},
+		B: map[string]int{"a": 1, "b": 2},
+		C: "abcd",
+	}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var dataDecode limits
+	decoder := NewDecoder(b)
+	decoder.SetMaxLen(4)
+	decoder.SetMaxAlloc(256)
+	if err := decoder.Value(&dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("DecodeLimits got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	decoder = NewDecoder(b)
+	decoder.SetMaxLen(3)
+	want := "binary.Decoder.Value: length 4 exceeds max length 3"
+	if err := decoder.Value(&limits{}); err == nil || decodeCause(err).Error() != want {
+		t.Errorf("DecodeLimits got %v\nneed %s\n", err, want)
+	}
+
+	decoder = NewDecoder(b)
+	decoder.SetMaxAlloc(16)
+	want = "binary.Decoder.Value: allocation exceeds max allocation 16 bytes"
+	if err := decoder.Value(&limits{}); err == nil || decodeCause(err).Error() != want {
+		t.Errorf("DecodeLimits got %v\nneed %s\n", err, want)
+	}
+
+	forged := []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x40} //2^62 elements
+	for _, v := range []interface{}{&[]int64{}, &[]string{}, &limits{}} {
+		decoder = NewDecoder(forged)
+		decoder.SetMaxAlloc(1 << 20)
+		want = "binary.Decoder.Value: allocation exceeds max allocation 1048576 bytes"
+		if err := decoder.Value(v); err == nil || decodeCause(err).Error() != want {
+			t.Errorf("DecodeLimits %T got %v\nneed %s\n", v, err, want)
+		}
+	}
+	forged = []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x1} //2^63 elements
+	if err := Decode(forged, &[]int64{}); err == nil {
+		t.Errorf("DecodeLimits got nil error for invalid length\n")
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	type strict struct {
+		A uint16
+		B string
+	}
+	var data = strict{A: 1, B: "ab"}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var dataDecode strict
+	if err := DecodeStrict(b, &dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("DecodeStrict got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if err := DecodeStrict(append(b, 0), &strict{}); err != ErrTrailingBytes {
+		t.Errorf("DecodeStrict got %v\nneed %v\n", err, ErrTrailingBytes)
+	}
+	if err := Decode(append(b, 0), &strict{}); err != nil {
+		t.Error(err)
+	}
+
+	var x uint32
+	decoder := NewDecoder([]byte{1, 0, 0, 0, 2, 0, 0, 0})
+	decoder.SetStrict(true)
+	if err := decoder.Value(&x); err != ErrTrailingBytes {
+		t.Errorf("DecodeStrict got %v\nneed %v\n", err, ErrTrailingBytes)
+	}
+	if err := decoder.Value(&x); err != nil || x != 2 {
+		t.Errorf("DecodeStrict got %v %d\nneed %v %d\n", err, x, nil, 2)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	b := []byte{0x2, 0x1, 0x0, 0x0, 0x0, 0x80, 0x1, 0x3}
+	decoder := NewDecoder(b)
+	if x := decoder.PeekUint8(); x != 2 {
+		t.Errorf("Peek got %d\nneed %d\n", x, 2)
+	}
+	if x, n := decoder.PeekVarint(); x != 1 || n != 1 {
+		t.Errorf("Peek got %d %d\nneed %d %d\n", x, n, 1, 1)
+	}
+	if x := decoder.PeekBytes(2); !reflect.DeepEqual(x, b[:2]) {
+		t.Errorf("Peek got %+v\nneed %+v\n", x, b[:2])
+	}
+	if x := decoder.PeekUint16(false); x != 0x102 {
+		t.Errorf("Peek got %#x\nneed %#x\n", x, 0x102)
+	}
+	if decoder.Len() != 0 {
+		t.Errorf("Peek got pos %d\nneed %d\n", decoder.Len(), 0)
+	}
+	decoder.Skip(1)
+	if x := decoder.PeekUint32(false); x != 1 {
+		t.Errorf("Peek got %d\nneed %d\n", x, 1)
+	}
+	decoder.Skip(4)
+	if x, n := decoder.PeekUvarint(); x != 0x80 || n != 2 {
+		t.Errorf("Peek got %d %d\nneed %d %d\n", x, n, 0x80, 2)
+	}
+	if x, _ := decoder.Uvarint(); x != 0x80 {
+		t.Errorf("Peek got %d\nneed %d\n", x, 0x80)
+	}
+	if x := decoder.Uint8(); x != 3 {
+		t.Errorf("Peek got %d\nneed %d\n", x, 3)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Peek got no panic for not enough buffer\n")
+			}
+			if decoder.Len() != len(b) {
+				t.Errorf("Peek got pos %d\nneed %d\n", decoder.Len(), len(b))
+			}
+		}()
+		decoder.PeekUint64(false)
+	}()
+}
+
+func TestSkipValue(t *testing.T) {
+	type skipped struct {
+		A []string
+		B bool
+		C *uint32
+		D map[int]bool
+	}
+	RegStruct((*skipped)(nil))
+	c := uint32(3)
+	var data = skipped{A: []string{"a", "bc"}, B: true, C: &c, D: map[int]bool{1: true}}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	b = append(b, 0x7)
+
+	for _, typ := range []reflect.Type{reflect.TypeOf(data), reflect.TypeOf(&data)} {
+		decoder := NewDecoder(b)
+		n, err := decoder.SkipValue(typ)
+		if err != nil {
+			t.Error(err)
+		}
+		if n != len(b)-1 {
+			t.Errorf("SkipValue got %d\nneed %d\n", n, len(b)-1)
+		}
+		if x := decoder.Uint8(); x != 0x7 {
+			t.Errorf("SkipValue got %d\nneed %d\n", x, 0x7)
+		}
+	}
+
+	decoder := NewDecoder(b[:3])
+	if _, err := decoder.SkipValue(reflect.TypeOf(data)); err == nil {
+		t.Errorf("SkipValue got nil error for not enough buffer\n")
+	}
+	if _, err := decoder.SkipValue(reflect.TypeOf(uintptr(0))); err == nil {
+		t.Errorf("SkipValue got nil error for unsupported type\n")
+	}
+}
+
+func TestDecodeFields(t *testing.T) {
+	type record struct {
+		ID    uint32
+		Name  string
+		Tags  []string `binary:"lenprefix=uint8"`
+		Flag  bool
+		Score int64 `binary:"big"`
+		Extra map[string]int
+	}
+	var data = record{ID: 7, Name: "abc", Tags: []string{"x", "y"}, Flag: true, Score: -2, Extra: map[string]int{"a": 1}}
+	check := record{Name: "abc", Score: -2}
+
+	for _, reg := range []bool{false, true} {
+		if reg {
+			RegStruct((*record)(nil))
+		}
+		b, err := Encode(data, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		var dataDecode record
+		if err := DecodeFields(b, &dataDecode, "Name", "Score"); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(dataDecode, check) {
+			t.Errorf("DecodeFields got %+v\nneed %+v\n", dataDecode, check)
+		}
+		if err := DecodeFields(b, &dataDecode, "Name", "Missing"); err == nil {
+			t.Errorf("DecodeFields got nil error for missing field\n")
+		}
+	}
+	if err := DecodeFields(nil, record{}, "Name"); err == nil {
+		t.Errorf("DecodeFields got nil error for non-pointer\n")
+	}
+}
+
+func TestLazyStruct(t *testing.T) {
+	type lazyRecord struct {
+		A bool
+		B string
+		C []int32 `binary:"lenprefix=uint16"`
+		D bool
+		E uint32 `binary:"big"`
+		F *string
+		G bool
+		H string `binary:"ignore"`
+		I map[int]bool
+	}
+	RegStruct((*lazyRecord)(nil))
+	f := "f"
+	var data = lazyRecord{A: true, B: "bb", C: []int32{1, 2}, D: false, E: 0x01020304, F: &f, G: true, I: map[int]bool{3: true}}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	lazy, err := NewLazyStruct(b, (*lazyRecord)(nil))
+	if err != nil {
+		t.Error(err)
+	}
+	var (
+		e uint32
+		g bool
+		c []int32
+		i map[int]bool
+		p *string
+	)
+	if err := lazy.Field("E", &e); err != nil || e != data.E {
+		t.Errorf("LazyStruct got %v %#x\nneed %#x\n", err, e, data.E)
+	}
+	if err := lazy.Field("G", &g); err != nil || g != data.G {
+		t.Errorf("LazyStruct got %v %v\nneed %v\n", err, g, data.G)
+	}
+	if err := lazy.Field("C", &c); err != nil || !reflect.DeepEqual(c, data.C) {
+		t.Errorf("LazyStruct got %v %v\nneed %v\n", err, c, data.C)
+	}
+	if err := lazy.Field("I", &i); err != nil || !reflect.DeepEqual(i, data.I) {
+		t.Errorf("LazyStruct got %v %v\nneed %v\n", err, i, data.I)
+	}
+	if err := lazy.Field("F", &p); err != nil || *p != f {
+		t.Errorf("LazyStruct got %v %v\nneed %v\n", err, p, f)
+	}
+	if s := lazy.Size(); s != len(b) {
+		t.Errorf("LazyStruct got size %d\nneed %d\n", s, len(b))
+	}
+
+	if err := lazy.Field("H", new(string)); err == nil {
+		t.Errorf("LazyStruct got nil error for ignored field\n")
+	}
+	if err := lazy.Field("E", new(int)); err == nil {
+		t.Errorf("LazyStruct got nil error for wrong field type\n")
+	}
+	if _, err := NewLazyStruct(b, 1); err == nil {
+		t.Errorf("LazyStruct got nil error for non-struct type\n")
+	}
+	lazy, _ = NewLazyStruct(b[:3], lazyRecord{})
+	if err := lazy.Field("I", &i); err == nil {
+		t.Errorf("LazyStruct got nil error for not enough buffer\n")
+	}
+}
+
+func TestZeroCopy(t *testing.T) {
+	type zeroCopy struct {
+		A string
+		B []string
+		C map[string]int
+	}
+	var data = zeroCopy{A: "abc", B: []string{"d", "ef"}, C: map[string]int{"g": 1}}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var dataDecode zeroCopy
+	decoder := NewDecoder(b)
+	decoder.SetZeroCopy(true)
+	if err := decoder.Value(&dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("ZeroCopy got %+v\nneed %+v\n", dataDecode, data)
+	}
+	b[1] = 'x' //strings refer to the buffer
+	if dataDecode.A != "xbc" {
+		t.Errorf("ZeroCopy got %s\nneed %s\n", dataDecode.A, "xbc")
+	}
+
+	var s []string
+	decoder = NewDecoder([]byte{0x1, 0x2, 'h', 'i'})
+	decoder.SetZeroCopy(true)
+	if err := decoder.Value(&s); err != nil || !reflect.DeepEqual(s, []string{"hi"}) {
+		t.Errorf("ZeroCopy got %v %v\nneed %v\n", err, s, []string{"hi"})
+	}
+}
+
+func TestZeroCopyBytes(t *testing.T) {
+	type zeroCopyBytes struct {
+		A []byte
+		B [][]byte
+		C [2]byte
+	}
+	var data = zeroCopyBytes{A: []byte("abc"), B: [][]byte{[]byte("d"), []byte("ef")}, C: [2]byte{1, 2}}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	var dataDecode zeroCopyBytes
+	decoder := NewDecoder(b)
+	decoder.SetZeroCopy(true)
+	if err := decoder.Value(&dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("ZeroCopyBytes got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if cap(dataDecode.A) != len(dataDecode.A) {
+		t.Errorf("ZeroCopyBytes got cap %d\nneed %d\n", cap(dataDecode.A), len(dataDecode.A))
+	}
+	b[1] = 'x' //byte slices refer to the buffer
+	if string(dataDecode.A) != "xbc" {
+		t.Errorf("ZeroCopyBytes got %s\nneed %s\n", dataDecode.A, "xbc")
+	}
+
+	var bs []byte
+	buff := []byte{0x2, 'h', 'i'}
+	decoder = NewDecoder(buff)
+	decoder.SetZeroCopy(true)
+	if err := decoder.Value(&bs); err != nil || string(bs) != "hi" {
+		t.Errorf("ZeroCopyBytes got %v %v\nneed %v\n", err, bs, "hi")
+	}
+	buff[1] = 'x'
+	if string(bs) != "xi" {
+		t.Errorf("ZeroCopyBytes got %s\nneed %s\n", bs, "xi")
+	}
+}
+
+type compiledInner struct {
+	A int16 `binary:"packed"`
+	B string
+}
+
+type compiledStruct struct {
+	Int    int `binary:"fixed"`
+	Uint   uint
+	Bool   bool
+	Int32  int32  `binary:"packed"`
+	Uint64 uint64 `binary:"big"`
+	Float  float32
+	String string
+	Inner  compiledInner
+	Time   time.Time
+	Slice  []int
+	Ignore int `binary:"ignore"`
+}
+
+func TestCompiledFields(t *testing.T) {
+	if err := RegStruct((*compiledStruct)(nil)); err != nil {
+		t.Fatal(err)
+	}
+	info := queryStruct(reflect.TypeOf(compiledStruct{}))
+	for i, compiled := range []bool{true, true, true, true, true, true, true, true, true, true, false} {
+		f := info.field(i)
+		if (f.encode != nil) != compiled || (f.decode != nil) != compiled {
+			t.Errorf("compiled field %s got %t\nneed %t\n", f.field.Name, f.encode != nil, compiled)
+		}
+		if sized := compiled && f.field.Type.Kind() != reflect.Slice; (f.size != nil) != sized { //varints of slice are sized by value
+			t.Errorf("compiled size of field %s got %t\nneed %t\n", f.field.Name, f.size != nil, sized)
+		}
+	}
+
+	var data = compiledStruct{-1, 2, true, -3, 4, 5.5, "6", compiledInner{-7, "8"}, time.Unix(9, 0).UTC(), []int{10}, 0}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := Sizeof(data); size != len(b) {
+		t.Errorf("Sizeof compiledStruct got %d need %d", size, len(b))
+	}
+	check := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x2, 0x1, 0x5, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x4}
+	if !reflect.DeepEqual(b[:len(check)], check) {
+		t.Errorf("CompiledFields got %#v\nneed %#v\n", b[:len(check)], check)
+	}
+	for _, maxDepth := range []int{0, 10} { //reflect path to check depth
+		var dataDecode compiledStruct
+		decoder := NewDecoder(b)
+		decoder.SetMaxDepth(maxDepth)
+		if err := decoder.Value(&dataDecode); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(dataDecode, data) {
+			t.Errorf("CompiledFields got %+v\nneed %+v\n", dataDecode, data)
+		}
+	}
+}
+
+type compiledTree []compiledTree
+
+type compiledElements struct {
+	Ptr     *int32
+	PPtr    **string
+	Nil     *compiledInner
+	Array   [2]int16
+	Nested  [][]string
+	Structs []compiledInner `binary:"nilable"`
+	Map     map[string][]uint
+	Time    *time.Time
+}
+
+func TestCompiledElements(t *testing.T) {
+	if err := RegStruct((*compiledElements)(nil)); err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range queryStruct(reflect.TypeOf(compiledElements{})).fields {
+		if f.encode == nil || f.decode == nil {
+			t.Errorf("field %d of compiledElements is not compiled", i)
+		}
+	}
+
+	i, s, tm := int32(-1), "s", time.Unix(1, 2).UTC()
+	ps := &s
+	data := compiledElements{
+		Ptr:     &i,
+		PPtr:    &ps,
+		Array:   [2]int16{3, -4},
+		Nested:  [][]string{{"a"}, nil, {"b", "c"}},
+		Structs: []compiledInner{{5, "d"}},
+		Map:     map[string][]uint{"e": {6, 7}},
+		Time:    &tm,
+	}
+	b, err := Encode(&data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := Sizeof(&data); size != len(b) {
+		t.Errorf("Sizeof compiledElements got %d need %d", size, len(b))
+	}
+	for _, maxDepth := range []int{0, 20} { //reflect path to check depth
+		var got compiledElements
+		decoder := NewDecoder(b)
+		decoder.SetMaxDepth(maxDepth)
+		if err := decoder.Value(&got); err != nil || !reflect.DeepEqual(got, data) {
+			t.Errorf("Decode compiledElements got %+v %v\nneed %+v", got, err, data)
+		}
+	}
+
+	tree := compiledTree{nil, {nil, {{{{{{{{{{nil}}}}}}}}}}}} //deeper than compiled levels
+	if b, err := Marshal(tree); err != nil {
+		t.Error(err)
+	} else if got, err := Unmarshal[compiledTree](b); err != nil || !reflect.DeepEqual(got, tree) {
+		t.Errorf("Unmarshal compiledTree got %v %v\nneed %v", got, err, tree)
+	}
+}
+
+func TestBulkNumbers(t *testing.T) {
+	type bulkNumbers struct {
+		A []int16
+		B [3]float64
+		C []complex64
+		D []uint64
+		E []int8
+	}
+	var data = bulkNumbers{
+		A: []int16{-1, 2, 0x1234},
+		B: [3]float64{1.5, -2.5, 3},
+		C: []complex64{1 + 2i},
+		D: []uint64{0x0102030405060708},
+		E: []int8{-1, 1},
+	}
+	for _, endian := range []Endian{LittleEndian, BigEndian} {
+		need := NewEncoderEndian(Sizeof(data), endian) //element by element
+		need.Uvarint(3)
+		for _, x := range data.A {
+			need.Int16(x, false)
+		}
+		need.Uvarint(3)
+		for _, x := range data.B {
+			need.Float64(x)
+		}
+		need.Uvarint(1)
+		need.Complex64(data.C[0])
+		need.Uvarint(1)
+		need.Uint64(data.D[0], false)
+		need.Uvarint(2)
+		need.Int8(-1)
+		need.Int8(1)
+
+		encoder := NewEncoderEndian(Sizeof(data), endian)
+		if err := encoder.Value(&data); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(encoder.Buffer(), need.Buffer()) {
+			t.Errorf("BulkNumbers %s got %#v\nneed %#v\n", endian, encoder.Buffer(), need.Buffer())
+		}
+
+		var dataDecode bulkNumbers
+		decoder := NewDecoderEndian(encoder.Buffer(), endian)
+		if err := decoder.Value(&dataDecode); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(dataDecode, data) {
+			t.Errorf("BulkNumbers %s got %+v\nneed %+v\n", endian, dataDecode, data)
+		}
+
+		var a []int16
+		decoder = NewDecoderEndian(need.Buffer(), endian)
+		if err := decoder.Value(&a); err != nil || !reflect.DeepEqual(a, data.A) {
+			t.Errorf("BulkNumbers %s got %v %v\nneed %v\n", endian, err, a, data.A)
+		}
+
+		encoder = NewEncoderEndian(Sizeof(data.B), endian) //array passed by value
+		if err := encoder.Value(data.B); err != nil || !reflect.DeepEqual(encoder.Buffer(), need.Buffer()[7:32]) {
+			t.Errorf("BulkNumbers %s got %v %#v\nneed %#v\n", endian, err, encoder.Buffer(), need.Buffer()[7:32])
+		}
+
+		var large [bulkCopyMin]uint16 //copied at once
+		for i := range large {
+			large[i] = uint16(i * 7)
+		}
+		byValue, byPointer := NewEncoderEndian(Sizeof(large), endian), NewEncoderEndian(Sizeof(large), endian)
+		if err := byValue.Value(large); err != nil || byPointer.Value(&large) != nil || !bytes.Equal(byValue.Buffer(), byPointer.Buffer()) {
+			t.Errorf("BulkNumbers %s got %v % x\nneed % x\n", endian, err, byValue.Buffer()[:8], byPointer.Buffer()[:8])
+		}
+
+		var w bytes.Buffer //byte order of encoding/binary
+		stdEndian := map[Endian]std.ByteOrder{LittleEndian: std.LittleEndian, BigEndian: std.BigEndian}[endian]
+		if err := Write(&w, stdEndian, data.B); err != nil || !bytes.Equal(w.Bytes(), need.Buffer()[7:32]) {
+			t.Errorf("BulkNumbers %s got %v %#v\nneed %#v\n", stdEndian, err, w.Bytes(), need.Buffer()[7:32])
+		}
+	}
+
+	var short struct { //elements out of array are skiped
+		A [2]uint16
+		B uint8
+	}
+	b := []byte{0x3, 0x1, 0x0, 0x2, 0x0, 0x3, 0x0, 0x4}
+	if err := Decode(b, &short); err != nil || short.A != [2]uint16{1, 2} || short.B != 4 {
+		t.Errorf("BulkNumbers got %v %+v\nneed %+v\n", err, short, [2]uint16{1, 2})
+	}
+}
+
+func TestFastMap(t *testing.T) {
+	testCases := []interface{}{
+		map[string]string{"a": "b", "": "c"},
+		map[string]int{"a": -1, "b": 300},
+		map[string]int64{"a": -1},
+		map[string]struct{}{"a": {}, "b": {}},
+		map[int]int{-1: 1, 2: -2},
+		map[int]string{-1: "a"},
+		map[int64]int64{1 << 40: -1},
+		map[int64]string{-1: "a", 2: ""},
+		map[int64]struct{}{-1: {}},
+		map[string]string{},
+	}
+	for _, data := range testCases {
+		b, err := Encode(data, nil)
+		if err != nil {
+			t.Error(err)
+		}
+		if size := len(b); size != sizeofMapValue(data) || Sizeof(data) != size {
+			t.Errorf("FastMap %T size got %d %d\nneed %d\n", data, Sizeof(data), size, sizeofMapValue(data))
+		}
+
+		encoder := NewEncoder(len(b)) //reflect path
+		encoder.SetDeterministic(true)
+		if err := encoder.Value(data); err != nil {
+			t.Error(err)
+		}
+		if v := reflect.ValueOf(data); v.Len() <= 1 && !reflect.DeepEqual(b, encoder.Buffer()) {
+			t.Errorf("FastMap %T got %#v\nneed %#v\n", data, b, encoder.Buffer())
+		}
+
+		p := reflect.New(reflect.TypeOf(data))
+		if err := Decode(encoder.Buffer(), p.Interface()); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(p.Elem().Interface(), data) {
+			t.Errorf("FastMap got %#v\nneed %#v\n", p.Elem().Interface(), data)
+		}
+	}
+}
+
+// sizeofMapValue returns size of map data by the reflect path.
+func sizeofMapValue(data interface{}) int {
+	return (bitsOfValue(reflect.ValueOf(data), true, nil, &ptrVisitor{}) + 7) / 8
+}
+
+type structElem struct {
+	A int
+	B string `binary:"lenprefix=uint8"`
+	C bool
+}
+
+func TestStructSlice(t *testing.T) {
+	RegStruct((*structElem)(nil))
+	var data = struct {
+		S []structElem
+		A [2]structElem
+	}{
+		S: []structElem{{1, "a", true}, {-2, "bc", false}},
+		A: [2]structElem{{3, "", true}},
+	}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x2, 0x2, 0x1, 0x61, 0x5, 0x3, 0x2, 0x62, 0x63, 0x2, 0x6, 0x0, 0x0, 0x0}
+	if !reflect.DeepEqual(b, check) || Sizeof(data) != len(check) {
+		t.Errorf("StructSlice got %d %#v\nneed %#v\n", Sizeof(data), b, check)
+	}
+
+	for _, maxDepth := range []int{0, 10} {
+		var dataDecode struct {
+			S []structElem
+			A [1]structElem //elements out of array are skiped
+		}
+		decoder := NewDecoder(b)
+		decoder.SetMaxDepth(maxDepth)
+		if err := decoder.Value(&dataDecode); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(dataDecode.S, data.S) || dataDecode.A[0] != data.A[0] || decoder.Len() != len(b) {
+			t.Errorf("StructSlice got %+v\nneed %+v\n", dataDecode, data)
+		}
+	}
+}
+
+type columnarStruct struct {
+	S []structElem    `binary:"columnar"`
+	A [2]structElem   `binary:"columnar"`
+	P []columnarPoint `binary:"columnar"`
+}
+
+type columnarShort struct {
+	S []structElem    `binary:"columnar"`
+	A [1]structElem   `binary:"columnar"` //elements out of array are skiped
+	P []columnarPoint `binary:"columnar"`
+}
+
+type columnarPoint struct {
+	X, Y int16
+}
+
+func TestColumnar(t *testing.T) {
+	RegStruct((*structElem)(nil))
+	RegStruct((*columnarStruct)(nil))
+	data := columnarStruct{
+		S: []structElem{{1, "a", true}, {-2, "bc", false}},
+		A: [2]structElem{{3, "", true}},
+		P: []columnarPoint{{1, 2}, {3, 4}},
+	}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x2, 0x2, 0x3, 0x1, 0x61, 0x2, 0x62, 0x63, 0x5, 0x2, 0x6, 0x0, 0x0, 0x0,
+		0x2, 0x1, 0x0, 0x3, 0x0, 0x2, 0x0, 0x4, 0x0}
+	if !reflect.DeepEqual(b, check) || Sizeof(data) != len(check) {
+		t.Errorf("Columnar got %d %#v\nneed %#v\n", Sizeof(data), b, check)
+	}
+
+	for _, maxDepth := range []int{0, 10} {
+		var dataDecode columnarStruct
+		decoder := NewDecoder(b)
+		decoder.SetMaxDepth(maxDepth)
+		if err := decoder.Value(&dataDecode); err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(dataDecode, data) || decoder.Len() != len(b) {
+			t.Errorf("Columnar got %+v\nneed %+v\n", dataDecode, data)
+		}
+	}
+
+	RegStruct((*columnarShort)(nil))
+	var short columnarShort
+	if err := Decode(b, &short); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(short.S, data.S) || short.A[0] != data.A[0] || !reflect.DeepEqual(short.P, data.P) {
+		t.Errorf("Columnar got %+v\nneed %+v\n", short, data)
+	}
+
+	if n, err := NewDecoder(b).SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("Columnar skip got %d %v, need %d\n", n, err, len(b))
+	}
+}
+
+type deltaStruct struct {
+	Times []int64  `binary:"delta"`
+	IDs   []uint32 `binary:"delta"`
+	A     [3]int8  `binary:"delta"`
+}
+
+type deltaShort struct {
+	Times []int64  `binary:"delta"`
+	IDs   []uint32 `binary:"delta"`
+	A     [2]int8  `binary:"delta"` //elements out of array are skiped
+}
+
+func TestDelta(t *testing.T) {
+	RegStruct((*deltaStruct)(nil))
+	data := deltaStruct{
+		Times: []int64{1000000, 1000001, 1000003, 999999},
+		IDs:   []uint32{5, 6, 7, 0},
+		A:     [3]int8{-128, 127, 0},
+	}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x4, 0x80, 0x89, 0x7a, 0x2, 0x4, 0x7, 0x4, 0xa, 0x2, 0x2, 0xd, 0x3, 0xff, 0x1, 0xfe, 0x3, 0xfd, 0x1}
+	if !reflect.DeepEqual(b, check) || Sizeof(data) != len(check) {
+		t.Errorf("Delta got %d %#v\nneed %#v\n", Sizeof(data), b, check)
+	}
+
+	var dataDecode deltaStruct
+	if err := Decode(b, &dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("Delta got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	RegStruct((*deltaShort)(nil))
+	var short deltaShort
+	decoder := NewDecoder(b)
+	if err := decoder.Value(&short); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(short.IDs, data.IDs) || short.A != [2]int8{-128, 127} || decoder.Len() != len(b) {
+		t.Errorf("Delta got %+v\nneed %+v\n", short, data)
+	}
+
+	if n, err := NewDecoder(b).SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("Delta skip got %d %v, need %d\n", n, err, len(b))
+	}
+}
+
+func TestStringTable(t *testing.T) {
+	type event struct {
+		Level string
+		Msg   string
+		Tags  map[string]string
+		Addr  netip.Addr
+	}
+	data := []event{
+		{"info", "start", map[string]string{"host": "a"}, netip.MustParseAddr("fe80::1%eth0")},
+		{"info", "stop", map[string]string{"host": "a", "user": "info"}, netip.Addr{}},
+		{"error", "stop", map[string]string{}, netip.Addr{}},
+	}
+	b, err := EncodeStringTable(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(b) != SizeofStringTable(data) || len(b) >= Sizeof(data) {
+		t.Errorf("StringTable got size %d, need %d < %d\n", len(b), SizeofStringTable(data), Sizeof(data))
+	}
+	check := []byte{0x8, 0x4, 0x69, 0x6e, 0x66, 0x6f, 0x1, 0x61, 0x4, 0x68, 0x6f, 0x73, 0x74, 0x4, 0x73, 0x74, 0x6f, 0x70}
+	if !reflect.DeepEqual(b[:len(check)], check) { //strings more frequent first
+		t.Errorf("StringTable got %#v\nneed %#v\n", b[:len(check)], check)
+	}
+
+	var dataDecode []event
+	if err := DecodeStringTable(b, &dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("StringTable got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	decoder := NewDecoder(b)
+	decoder.SetStringTable(true)
+	if n, err := decoder.SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("StringTable skip got %d %v, need %d\n", n, err, len(b))
+	}
+
+	encoder := NewEncoder(len(b))
+	encoder.SetStringTable(true)
+	encoder.SetDeterministic(true)
+	if err := encoder.Value("info"); err != nil || !reflect.DeepEqual(encoder.Buffer(), []byte{0x1, 0x4, 0x69, 0x6e, 0x66, 0x6f, 0x0}) {
+		t.Errorf("StringTable got %#v %v\n", encoder.Buffer(), err)
+	}
+
+	var str string
+	if err := DecodeStringTable([]byte{0x1, 0x4, 0x69, 0x6e, 0x66, 0x6f, 0x1}, &str); err == nil { //invalid index
+		t.Error("StringTable need error of invalid index")
+	}
+}
+
+type float16Struct struct {
+	A float32    `binary:"float16"`
+	B float64    `binary:"float16"`
+	C []float32  `binary:"float16"`
+	D [2]float32 `binary:"float16"`
+	E float32
+}
+
+func TestFloat16(t *testing.T) {
+	testCases := []struct {
+		f float32
+		h uint16
+	}{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.1, 0x2e66},
+		{65504, 0x7bff},
+		{65520, 0x7c00},                    //overflow
+		{float32(math.Inf(-1)), 0xfc00},    //-infinity
+		{1.0 / (1 << 24), 0x0001},          //min subnormal
+		{1.0 / (1 << 25), 0x0000},          //half of min subnormal, rounded to even
+		{1.5 / (1 << 24), 0x0002},          //rounded to even
+		{float32(6.097555e-05), 0x03ff},    //max subnormal
+		{float32(1 + 1.0/(1<<11)), 0x3c00}, //rounded to even
+		{float32(1 + 3.0/(1<<11)), 0x3c02}, //rounded to even
+		{float32(math.NaN()), 0x7e00},
+	}
+	for _, c := range testCases {
+		if h := Float16bits(c.f); h != c.h {
+			t.Errorf("Float16bits(%v) got %#04x, need %#04x\n", c.f, h, c.h)
+		}
+		if f := Float16frombits(c.h); c.h != 0x7e00 && f != Float16frombits(Float16bits(f)) {
+			t.Errorf("Float16frombits(%#04x) got %v\n", c.h, f)
+		}
+	}
+	if f := Float16frombits(0x7e00); !math.IsNaN(float64(f)) {
+		t.Errorf("Float16frombits(0x7e00) got %v, need NaN\n", f)
+	}
+	for h := 0; h < 0x7c00; h++ { //all finite values are exact
+		if f := Float16frombits(uint16(h)); Float16bits(f) != uint16(h) || Float16bits(-f) != uint16(h)|0x8000 {
+			t.Fatalf("Float16 round trip %#04x got %v\n", h, f)
+		}
+	}
+
+	RegStruct((*float16Struct)(nil))
+	data := float16Struct{1, -2, []float32{0.5, 65504}, [2]float32{0.25}, 1}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x0, 0x3c, 0x0, 0xc0, 0x2, 0x0, 0x38, 0xff, 0x7b, 0x2, 0x0, 0x34, 0x0, 0x0, 0x0, 0x0, 0x80, 0x3f}
+	if !reflect.DeepEqual(b, check) || Sizeof(data) != len(check) {
+		t.Errorf("Float16 got %d %#v\nneed %#v\n", Sizeof(data), b, check)
+	}
+	var dataDecode float16Struct
+	if err := Decode(b, &dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("Float16 got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if n, err := NewDecoder(b).SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("Float16 skip got %d %v, need %d\n", n, err, len(b))
+	}
+
+	encoder := NewEncoder(2)
+	encoder.Float16(0.1)
+	if x := NewDecoder(encoder.Buffer()).Float16(); x != Float16frombits(0x2e66) {
+		t.Errorf("Float16 got %v\n", x)
+	}
+}
+
+type noZigzagStruct struct {
+	A int     `binary:"nozigzag"`
+	B int32   `binary:"packed,nozigzag"`
+	C []int64 `binary:"packed,nozigzag"`
+	D int16   `binary:"nozigzag"` //fixed size
+	E int
+}
+
+func TestNoZigzag(t *testing.T) {
+	RegStruct((*noZigzagStruct)(nil))
+	data := noZigzagStruct{-1, 150, []int64{1, -2}, -1, -1}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x1,
+		0x96, 0x1,
+		0x2, 0x1, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x1,
+		0xff, 0xff,
+		0x1}
+	if !reflect.DeepEqual(b, check) || Sizeof(data) != len(check) {
+		t.Errorf("NoZigzag got %d %#v\nneed %#v\n", Sizeof(data), b, check)
+	}
+	var dataDecode noZigzagStruct
+	if err := Decode(b, &dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("NoZigzag got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if n, err := NewDecoder(b).SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("NoZigzag skip got %d %v, need %d\n", n, err, len(b))
+	}
+}
+
+func TestVarintFormat(t *testing.T) {
+	testCases := []struct {
+		format VarintFormat
+		x      uint64
+		b      []byte
+	}{
+		{VarintSQLite, 0, []byte{0x0}},
+		{VarintSQLite, 127, []byte{0x7f}},
+		{VarintSQLite, 128, []byte{0x81, 0x0}},
+		{VarintSQLite, 0x3fff, []byte{0xff, 0x7f}},
+		{VarintSQLite, 1<<56 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{VarintSQLite, 1 << 56, []byte{0x80, 0xc0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x0}},
+		{VarintSQLite, math.MaxUint64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{VarintGit, 0, []byte{0x0}},
+		{VarintGit, 127, []byte{0x7f}},
+		{VarintGit, 128, []byte{0x80, 0x0}},
+		{VarintGit, 16511, []byte{0xff, 0x7f}},
+		{VarintGit, 16512, []byte{0x80, 0x80, 0x0}},
+		{VarintGit, math.MaxUint64, []byte{0x80, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0x7f}},
+		{VarintLEB128, 300, []byte{0xac, 0x2}},
+	}
+	for _, c := range testCases {
+		encoder := NewEncoder(MaxVarintLen64)
+		encoder.SetVarintFormat(c.format)
+		if n := encoder.Uvarint(c.x); n != len(c.b) || !reflect.DeepEqual(encoder.Buffer(), c.b) {
+			t.Errorf("%s Uvarint(%d) got %d %#v\nneed %#v\n", c.format, c.x, n, encoder.Buffer(), c.b)
+		}
+		decoder := NewDecoder(c.b)
+		decoder.SetVarintFormat(c.format)
+		if x, n := decoder.Uvarint(); x != c.x || n != len(c.b) {
+			t.Errorf("%s Uvarint(%#v) got %d %d, need %d\n", c.format, c.b, x, n, c.x)
+		}
+	}
+
+	decoder := NewDecoder([]byte{0x80, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xfe, 0xff, 0x0})
+	decoder.SetVarintFormat(VarintGit)
+	if err := decoder.Value(new(uint)); err == nil {
+		t.Error("VarintGit need error of overflow")
+	}
+
+	data := struct {
+		A int
+		B []string
+		C uint64 `binary:"packed"`
+	}{-1000, []string{"a", "bc"}, 1 << 60}
+	for _, format := range []VarintFormat{VarintLEB128, VarintSQLite, VarintGit} {
+		encoder := NewEncoder(Sizeof(data))
+		encoder.SetVarintFormat(format)
+		if err := encoder.Value(data); err != nil {
+			t.Error(err)
+		}
+		dataDecode := data
+		dataDecode.B = nil
+		decoder := NewDecoder(encoder.Buffer())
+		decoder.SetVarintFormat(format)
+		if err := decoder.Value(&dataDecode); err != nil || !reflect.DeepEqual(dataDecode, data) || decoder.Len() != len(encoder.Buffer()) {
+			t.Errorf("%s got %+v %v\nneed %+v\n", format, dataDecode, err, data)
+		}
+	}
+}
+
+type groupVarintStruct struct {
+	A []uint32  `binary:"groupvarint"`
+	B []int32   `binary:"groupvarint"`
+	C [5]uint32 `binary:"groupvarint"`
+}
+
+type groupVarintShort struct {
+	A []uint32  `binary:"groupvarint"`
+	B []int32   `binary:"groupvarint"`
+	C [2]uint32 `binary:"groupvarint"` //elements out of array are skiped
+}
+
+func TestGroupVarint(t *testing.T) {
+	RegStruct((*groupVarintStruct)(nil))
+	data := groupVarintStruct{
+		A: []uint32{1, 256, 65536, 16777216, 0xffffffff},
+		B: []int32{-1, 1, math.MinInt32},
+		C: [5]uint32{300},
+	}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{
+		0x5, 0xe4, 0x1, 0x0, 0x1, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0, 0x1, 0x3, 0xff, 0xff, 0xff, 0xff,
+		0x3, 0x30, 0x1, 0x2, 0xff, 0xff, 0xff, 0xff,
+		0x5, 0x1, 0x2c, 0x1, 0x0, 0x0, 0x0, 0x0, 0x0,
+	}
+	if !reflect.DeepEqual(b, check) || Sizeof(data) != len(check) {
+		t.Errorf("GroupVarint got %d %#v\nneed %#v\n", Sizeof(data), b, check)
+	}
+
+	var dataDecode groupVarintStruct
+	if err := Decode(b, &dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("GroupVarint got %+v\nneed %+v\n", dataDecode, data)
+	}
+
+	RegStruct((*groupVarintShort)(nil))
+	var short groupVarintShort
+	decoder := NewDecoder(b)
+	if err := decoder.Value(&short); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(short.B, data.B) || short.C != [2]uint32{300} || decoder.Len() != len(b) {
+		t.Errorf("GroupVarint got %+v\nneed %+v\n", short, data)
+	}
+
+	if n, err := NewDecoder(b).SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("GroupVarint skip got %d %v, need %d\n", n, err, len(b))
+	}
+}
+
+type bitFieldStruct struct {
+	Version uint8 `binary:"bits=4"`
+	IHL     uint8 `binary:"bits=4"`
+	Flag    bool
+	Offset  int16 `binary:"bits=13"`
+	ID      uint16
+	Codes   []uint8 `binary:"bits=2"`
+}
+
+func TestBitField(t *testing.T) {
+	RegStruct((*bitFieldStruct)(nil))
+	data := bitFieldStruct{4, 5, true, -2, 0x1234, []uint8{1, 2, 3}}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x54, 0xfd, 0x7f, 0x34, 0x12, 0x3, 0xe}
+	if !reflect.DeepEqual(b, check) || Sizeof(data) != len(check) {
+		t.Errorf("BitField got %d %#v\nneed %#v\n", Sizeof(data), b, check)
+	}
+	var dataDecode bitFieldStruct
+	if err := Decode(b, &dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("BitField got %+v\nneed %+v\n", dataDecode, data)
+	}
+	decoder := NewDecoder(b)
+	decoder.SetMaxDepth(8) //decoded by the reflect path
+	if dataDecode = (bitFieldStruct{}); decoder.Value(&dataDecode) != nil || !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("BitField reflect path got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if n, err := NewDecoder(b).SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("BitField skip got %d %v, need %d\n", n, err, len(b))
+	}
+
+	data.Version = 16
+	if _, err := Encode(data, nil); err == nil {
+		t.Error("BitField need error of overflow")
+	}
+	data.Version, data.Offset = 4, -4097
+	if _, err := Encode(data, nil); err == nil {
+		t.Error("BitField need error of overflow")
+	}
+
+	type invalidBits struct {
+		A int `binary:"bits=65"`
+	}
+	if err := RegStruct((*invalidBits)(nil)); err == nil {
+		t.Error("BitField need error of invalid bits")
+	}
+}
+
+func TestBitset(t *testing.T) {
+	var b Bitset
+	b.Set(1, true)
+	b.Set(9, true)
+	b.Set(3, true)
+	b.Set(3, false)
+	if b.Len() != 10 || !b.Get(1) || !b.Get(9) || b.Get(3) || b.Get(10) || b.Get(-1) {
+		t.Errorf("Bitset got %+v\n", b)
+	}
+
+	data := struct {
+		A Bitset
+		B *Bitset
+		C []bool
+	}{b, NewBitset(3), []bool{false, true, false, false, false, false, false, false, false, true}}
+	buf, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0xa, 0x2, 0x2, 0x1, 0x3, 0x0, 0xa, 0x2, 0x2}
+	if !reflect.DeepEqual(buf, check) || Sizeof(data) != len(check) {
+		t.Errorf("Bitset got %d %#v\nneed %#v\n", Sizeof(data), buf, check)
+	}
+	var dataDecode struct {
+		A Bitset
+		B *Bitset
+		C Bitset //the same as []bool
+	}
+	if err := Decode(buf, &dataDecode); err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(dataDecode.A, b) || dataDecode.B.Len() != 3 || !reflect.DeepEqual(dataDecode.C, b) {
+		t.Errorf("Bitset got %+v\nneed %+v\n", dataDecode, data)
+	}
+	if n, err := NewDecoder(buf).SkipValue(reflect.TypeOf(dataDecode)); err != nil || n != len(buf) {
+		t.Errorf("Bitset skip got %d %v, need %d\n", n, err, len(buf))
+	}
+
+	encoder := NewEncoder(3)
+	encoder.Bitset(&b)
+	if x := NewDecoder(encoder.Buffer()).Bitset(); !reflect.DeepEqual(*x, b) {
+		t.Errorf("Bitset got %+v\nneed %+v\n", *x, b)
+	}
+}
+
+type cInner struct {
+	A uint8
+	B uint32
+}
+
+type cHeader struct {
+	Flag  bool
+	Value int32
+	Small uint16 `binary:"big"`
+	Big   float64
+	_     [2]byte
+	N     int
+	Arr   [3]uint8
+	In    cInner
+}
+
+func TestCLayout(t *testing.T) {
+	RegStruct((*cHeader)(nil))
+	data := cHeader{true, -2, 0x1234, 1.5, [2]byte{}, 7, [3]uint8{1, 2, 3}, cInner{9, 10}}
+	for _, c := range []struct {
+		layout CLayout
+		size   int
+	}{
+		{CLayout64, 56},
+		{CLayout32, 48},
+		{CLayout386, 40},
+		{CLayout{PtrSize: 8, MaxAlign: 1}, 33},
+	} {
+		layout := c.layout
+		if s := layout.Sizeof(&data); s != c.size {
+			t.Errorf("CLayout %+v Sizeof got %d, need %d\n", layout, s, c.size)
+		}
+		encoder := NewEncoderEndian(c.size, LittleEndian)
+		encoder.SetCLayout(&layout)
+		if err := encoder.Value(&data); err != nil || encoder.Len() != c.size {
+			t.Errorf("CLayout %+v got %d %v\n", layout, encoder.Len(), err)
+		}
+		if layout == CLayout64 && unsafe.Sizeof(uintptr(0)) == 8 && NativeEndian == LittleEndian { //the same as memory of Go struct
+			mem := unsafe.Slice((*byte)(unsafe.Pointer(&data)), unsafe.Sizeof(data))
+			b := append([]byte{}, encoder.Buffer()...)
+			b[8], b[9] = b[9], b[8] //big endian field
+			if !reflect.DeepEqual(b, mem) {
+				t.Errorf("CLayout got %#v\nneed %#v\n", b, mem)
+			}
+		}
+
+		var dataDecode []cHeader
+		buf := append(append([]byte{0x2}, encoder.Buffer()...), encoder.Buffer()...)
+		decoder := NewDecoderEndian(buf, LittleEndian)
+		decoder.SetCLayout(&layout)
+		if err := decoder.Value(&dataDecode); err != nil || !reflect.DeepEqual(dataDecode, []cHeader{data, data}) || decoder.Len() != len(buf) {
+			t.Errorf("CLayout %+v got %+v %v\nneed %+v\n", layout, dataDecode, err, data)
+		}
+		decoder = NewDecoderEndian(buf, LittleEndian)
+		decoder.SetCLayout(&layout)
+		if n, err := decoder.SkipValue(reflect.TypeOf(dataDecode)); err != nil || n != len(buf) {
+			t.Errorf("CLayout skip got %d %v, need %d\n", n, err, len(buf))
+		}
+	}
+
+	encoder := NewEncoder(100)
+	encoder.SetCLayout(&CLayout64)
+	if err := encoder.Value(struct{ S string }{"a"}); err == nil {
+		t.Error("CLayout need error of unsupported type")
+	}
+}
+
+type offsetHeader struct {
+	Magic   [4]byte
+	Version uint16
+	Flag    bool
+	Size    uint32 `binary:"offset=12"`
+	Name    string `binary:"offset=16"`
+	Ok      bool
+}
+
+type offsetOverlap struct {
+	A uint32
+	B uint8 `binary:"offset=2"`
+}
+
+func TestFieldOffset(t *testing.T) {
+	RegStruct((*offsetHeader)(nil))
+	data := offsetHeader{[4]byte{'B', 'I', 'N', 0}, 2, true, 0x100, "ab", true}
+	b, err := Encode(data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x4, 'B', 'I', 'N', 0x0, 0x2, 0x0, 0x3, 0x0, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x0, 0x2, 'a', 'b'}
+	if !reflect.DeepEqual(b, check) || Sizeof(data) < len(check) {
+		t.Errorf("FieldOffset got %d %#v\nneed %#v\n", Sizeof(data), b, check)
+	}
+
+	var dataDecode offsetHeader
+	if err := Decode(b, &dataDecode); err != nil || !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("FieldOffset got %+v %v\nneed %+v\n", dataDecode, err, data)
+	}
+	if n, err := NewDecoder(b).SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("FieldOffset skip got %d %v, need %d\n", n, err, len(b))
+	}
+	var name string
+	if lazy, err := NewLazyStruct(b, (*offsetHeader)(nil)); err != nil || lazy.Field("Name", &name) != nil || name != "ab" {
+		t.Errorf("FieldOffset lazy got %q %v\n", name, err)
+	}
+
+	encoder := NewEncoderEndian(32, LittleEndian)
+	layout := CLayout64
+	encoder.SetCLayout(&layout)
+	if err := encoder.Value(struct{ H offsetHeader }{}); err == nil {
+		t.Error("FieldOffset need error of string in C layout")
+	}
+
+	RegStruct((*offsetOverlap)(nil))
+	if _, err := Encode(offsetOverlap{1, 2}, nil); err == nil {
+		t.Error("FieldOffset need error of overlap")
+	}
+	if s := CLayout64.Sizeof(offsetOverlap{}); s != -1 {
+		t.Errorf("FieldOffset C layout got size %d, need -1\n", s)
+	}
+}
+
+func TestCLayoutHeader(t *testing.T) {
+	RegStruct((*cHeader)(nil))
+	var b bytes.Buffer
+	if err := CLayout64.WriteHeader(&b, &cHeader{}); err != nil {
+		t.Error(err)
+	}
+	check := `#include <stdint.h>
+
+#pragma pack(push, 1)
+
+typedef struct cInner {
+	uint8_t A;
+	uint8_t _pad0[3];
+	uint32_t B;
+} cInner;
+
+typedef struct cHeader {
+	uint8_t Flag;
+	uint8_t _pad0[3];
+	int32_t Value;
+	uint16_t Small;
+	uint8_t _pad1[6];
+	double Big;
+	uint8_t _pad2[8];
+	int64_t N;
+	uint8_t Arr[3];
+	uint8_t _pad3[1];
+	cInner In;
+	uint8_t _pad4[4];
+} cHeader;
+
+#pragma pack(pop)
+`
+	if got := b.String(); got != check {
+		t.Errorf("CLayoutHeader got\n%s\nneed\n%s\n", got, check)
+	}
+	if err := CLayout64.WriteHeader(&b, struct{ A int8 }{}); err == nil {
+		t.Error("CLayoutHeader need error of unnamed struct")
+	}
+	if err := CLayout64.WriteHeader(&b, offsetHeader{}); err == nil {
+		t.Error("CLayoutHeader need error of string field")
+	}
+}
+
+type pbInner struct {
+	Name string `binary:"pb=1"`
+	Id   int32  `binary:"pb=2"`
+}
+
+type pbMessage struct {
+	I32  int32            `binary:"pb=1"`
+	S64  int64            `binary:"pb=2,zigzag"`
+	U    uint32           `binary:"pb=3,fixed"`
+	F    float64          `binary:"pb=4"`
+	B    bool             `binary:"pb=5"`
+	Str  string           `binary:"pb=6"`
+	Data []byte           `binary:"pb=7"`
+	Ints []int32          `binary:"pb=8"`
+	In   pbInner          `binary:"pb=9"`
+	Ins  []pbInner        `binary:"pb=10"`
+	Map  map[string]int32 `binary:"pb=11"`
+	Opt  *int32           `binary:"pb=12"`
+	Skip int
+	Arr  [2]string `binary:"pb=13"`
+}
+
+func TestProtobuf(t *testing.T) {
+	RegStruct((*pbInner)(nil))
+	RegStruct((*pbMessage)(nil))
+	opt := int32(0)
+	data := pbMessage{-1, -2, 1, 0, true, "hi", []byte{1, 2}, []int32{1, 300}, pbInner{"a", 0},
+		[]pbInner{{"", 5}}, map[string]int32{"k": 0}, &opt, 7, [2]string{"x", ""}}
+	b, err := EncodeProtobuf(&data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+		0x10, 0x03,
+		0x1d, 0x01, 0x00, 0x00, 0x00,
+		0x28, 0x01,
+		0x32, 0x02, 'h', 'i',
+		0x3a, 0x02, 0x01, 0x02,
+		0x42, 0x03, 0x01, 0xac, 0x02,
+		0x4a, 0x03, 0x0a, 0x01, 'a',
+		0x52, 0x02, 0x10, 0x05,
+		0x5a, 0x05, 0x0a, 0x01, 'k', 0x10, 0x00,
+		0x60, 0x00,
+		0x6a, 0x01, 'x', 0x6a, 0x00}
+	if !reflect.DeepEqual(b, check) {
+		t.Errorf("Protobuf got %#v\nneed %#v\n", b, check)
+	}
+
+	b = append(b, 0xa0, 0x1f, 0x01, 0xa2, 0x1f, 0x01, 0x00) //unknown fields
+	var dataDecode pbMessage
+	data.Skip = 0
+	if err := DecodeProtobuf(b, &dataDecode); err != nil || !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("Protobuf got %+v %v\nneed %+v\n", dataDecode, err, data)
+	}
+	if err := DecodeProtobuf([]byte{0x32, 0x05, 'h'}, &dataDecode); err == nil {
+		t.Error("Protobuf need error of truncated buffer")
+	}
+	if err := DecodeProtobuf([]byte{0x30, 0x01}, &dataDecode); err == nil {
+		t.Error("Protobuf need error of wire type")
+	}
+	if _, err := EncodeProtobuf(struct{ A int }{}, nil); err == nil {
+		t.Error("Protobuf need error of unregistered struct")
+	}
+}
+
+type mpInner struct {
+	Name string
+	Tags []string
+}
+
+type mpStruct struct {
+	I     int
+	N     int8
+	U     uint16
+	F     float32
+	B     bool
+	S     string
+	Data  []byte
+	Arr   [2]int64
+	Map   map[string]uint64
+	In    *mpInner
+	Nil   *mpInner
+	Any   interface{}
+	Skip  int `binary:"ignore"`
+	Items []mpInner
+}
+
+func TestMsgpack(t *testing.T) {
+	RegStruct((*mpStruct)(nil))
+	data := mpStruct{-100, 5, 300, 1.5, true, "hi", []byte{1, 2}, [2]int64{-1, 1 << 40},
+		map[string]uint64{"a": 1}, &mpInner{"in", []string{"x"}}, nil, "any", 7, nil}
+
+	encoder := NewEncoder(256)
+	encoder.SetMsgpack(true)
+	encoder.SetDeterministic(true)
+	if err := encoder.Value(&mpInner{"ab", nil}); err != nil {
+		t.Error(err)
+	}
+	check := []byte{0x82, 0xa4, 'N', 'a', 'm', 'e', 0xa2, 'a', 'b', 0xa4, 'T', 'a', 'g', 's', 0xc0}
+	if b := encoder.Buffer(); !reflect.DeepEqual(b, check) {
+		t.Errorf("Msgpack got %#v\nneed %#v\n", b, check)
+	}
+
+	b, err := EncodeMsgpack(&data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	var dataDecode mpStruct
+	data.Skip = 0
+	if err := DecodeMsgpack(b, &dataDecode); err != nil || !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("Msgpack got %+v %v\nneed %+v\n", dataDecode, err, data)
+	}
+	decoder := NewDecoder(b)
+	decoder.SetMsgpack(true)
+	if n, err := decoder.SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("Msgpack skip got %d %v, need %d\n", n, err, len(b))
+	}
+
+	for _, c := range []struct {
+		value interface{}
+		b     []byte
+	}{
+		{int64(-33), []byte{0xd0, 0xdf}},
+		{uint32(1 << 16), []byte{0xce, 0x00, 0x01, 0x00, 0x00}},
+		{-1.0, []byte{0xcb, 0xbf, 0xf0, 0, 0, 0, 0, 0, 0}},
+		{[]interface{}{nil, false}, []byte{0x92, 0xc0, 0xc2}},
+	} {
+		if b, err := EncodeMsgpack(c.value, nil); err != nil || !reflect.DeepEqual(b, c.b) {
+			t.Errorf("Msgpack %v got %#v %v\nneed %#v\n", c.value, b, err, c.b)
+		}
+	}
+
+	var a interface{}
+	if err := DecodeMsgpack([]byte{0x81, 0xa1, 'k', 0x92, 0xd1, 0xff, 0x00, 0xc4, 0x01, 0x05}, &a); err != nil ||
+		!reflect.DeepEqual(a, map[interface{}]interface{}{"k": []interface{}{int64(-256), []byte{5}}}) {
+		t.Errorf("Msgpack got %#v %v\n", a, err)
+	}
+	var n int8
+	if err := DecodeMsgpack([]byte{0xcc, 0xff}, &n); err == nil {
+		t.Error("Msgpack need error of overflow")
+	}
+	if _, err := EncodeMsgpack(complex(1, 2), nil); err == nil {
+		t.Error("Msgpack need error of unsupported type")
+	}
+}
+
+type cborKeyed struct {
+	Alg  int    `binary:"cbor=1"`
+	Kid  []byte `binary:"cbor=4"`
+	Crv  int    `binary:"cbor=-1"`
+	Name string
+}
+
+func TestCBOR(t *testing.T) {
+	RegStruct((*cborKeyed)(nil))
+	encoder := NewEncoder(32)
+	encoder.SetCBOR(true)
+	encoder.SetDeterministic(true)
+	keyed := cborKeyed{-7, []byte{0xab}, 1, "k"}
+	if err := encoder.Value(&keyed); err != nil {
+		t.Error(err)
+	}
+	check := []byte{0xa4, 0x01, 0x26, 0x04, 0x41, 0xab, 0x20, 0x01, 0x64, 'N', 'a', 'm', 'e', 0x61, 'k'}
+	if b := encoder.Buffer(); !reflect.DeepEqual(b, check) {
+		t.Errorf("CBOR got %#v\nneed %#v\n", b, check)
+	}
+	var keyedDecode cborKeyed
+	if err := DecodeCBOR(check, &keyedDecode); err != nil || !reflect.DeepEqual(keyedDecode, keyed) {
+		t.Errorf("CBOR got %+v %v\nneed %+v\n", keyedDecode, err, keyed)
+	}
+
+	RegStruct((*mpStruct)(nil))
+	data := mpStruct{-100, 5, 300, 1.5, true, "hi", []byte{1, 2}, [2]int64{-1, 1 << 40},
+		map[string]uint64{"a": 1}, &mpInner{"in", []string{"x"}}, nil, "any", 7, nil}
+	b, err := EncodeCBOR(&data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	var dataDecode mpStruct
+	data.Skip = 0
+	if err := DecodeCBOR(b, &dataDecode); err != nil || !reflect.DeepEqual(dataDecode, data) {
+		t.Errorf("CBOR got %+v %v\nneed %+v\n", dataDecode, err, data)
+	}
+	decoder := NewDecoder(b)
+	decoder.SetCBOR(true)
+	if n, err := decoder.SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("CBOR skip got %d %v, need %d\n", n, err, len(b))
+	}
+
+	var a interface{}
+	if err := DecodeCBOR([]byte{0x9f, 0x01, 0x5f, 0x41, 'a', 0x41, 'b', 0xff, 0xf6, 0xff}, &a); err != nil ||
+		!reflect.DeepEqual(a, []interface{}{int64(1), []byte("ab"), nil}) {
+		t.Errorf("CBOR got %#v %v\n", a, err)
+	}
+	var f float32
+	if err := DecodeCBOR([]byte{0xf9, 0x3c, 0x00}, &f); err != nil || f != 1 {
+		t.Errorf("CBOR got %v %v\n", f, err)
+	}
+	var epoch int64
+	if err := DecodeCBOR([]byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}, &epoch); err != nil || epoch != 1363896240 {
+		t.Errorf("CBOR got %v %v\n", epoch, err)
+	}
+	var u uint8
+	if err := DecodeCBOR([]byte{0x20}, &u); err == nil {
+		t.Error("CBOR need error of negative to uint")
+	}
+	if _, err := EncodeCBOR(complex(1, 2), nil); err == nil {
+		t.Error("CBOR need error of unsupported type")
+	}
+}
+
+type jsonDump struct {
+	I    int16
+	F    float32
+	S    string `binary:"lenprefix=uint8"`
+	Data []byte
+	Map  map[uint8]bool
+	P    *jsonDump
+	Skip int `binary:"ignore"`
+	T    time.Time
+	Nan  float64
+	List []string
+}
+
+func TestDumpJSON(t *testing.T) {
+	RegStruct((*jsonDump)(nil))
+	data := jsonDump{-3, 1.5, "a\"b", []byte{0xab, 0x01}, map[uint8]bool{2: true, 1: false},
+		&jsonDump{I: 1}, 7, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), math.Inf(1), nil}
+	b, err := Encode(&data, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	s, err := DumpJSON(b, reflect.TypeOf(data))
+	check := `{"I":-3,"F":1.5,"S":"a\"b","Data":"ab01","Map":{"1":false,"2":true},` +
+		`"P":{"I":1,"F":0,"S":"","Data":null,"Map":{},"P":null,"T":"0001-01-01T00:00:00Z","Nan":0,"List":null},` +
+		`"T":"2020-01-02T03:04:05Z","Nan":"+Inf","List":null}`
+	if err != nil || s != check {
+		t.Errorf("DumpJSON got %s %v\nneed %s\n", s, err, check)
+	}
+	if _, err := DumpJSON(b[:5], reflect.TypeOf(data)); err == nil {
+		t.Error("DumpJSON need error of short buffer")
+	}
+
+	type bigDump struct {
+		P *mbig.Int
+		V mbig.Int
+	}
+	n, _ := new(mbig.Int).SetString("123456789012345678901234567890", 10)
+	b, err = Encode(&bigDump{n, *mbig.NewInt(-7)}, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	s, err = DumpJSON(b, reflect.TypeOf(bigDump{}))
+	if check := `{"P":123456789012345678901234567890,"V":-7}`; err != nil || s != check {
+		t.Errorf("DumpJSON got %s %v\nneed %s\n", s, err, check)
+	}
+}
+
+type streamItem struct {
+	Name string
+	Qty  uint8
+}
+
+type streamOrder struct {
+	Id    int64
+	Items []streamItem
+	Tags  map[string]int16
+	At    time.Time
+	Next  *streamOrder
+	Note  interface{}
+	Raw   []byte
+	Skip  int `binary:"ignore"`
+	Price float32
+}
+
+// streamOrderV2 is a later version of streamOrder, without some fields and with a new one.
+type streamOrderV2 struct {
+	Id    int32
+	Items []streamItem
+	Next  *streamOrderV2
+	Extra string
+}
+
+func TestStream(t *testing.T) {
+	RegStruct((*streamOrder)(nil))
+	at := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	orders := []streamOrder{
+		{1, []streamItem{{"a", 2}}, map[string]int16{"x": -1}, at, &streamOrder{Id: 2, At: at}, "note", []byte{7}, 9, 1.5},
+		{3, nil, nil, at, nil, []interface{}{uint8(1), "s"}, nil, 0, 0},
+	}
+	var buf bytes.Buffer
+	encoder := NewStreamEncoder(&buf)
+	for i := range orders {
+		if err := encoder.Encode(&orders[i]); err != nil {
+			t.Error(err)
+		}
+	}
+	sizes := []int{0, 0}
+	b := buf.Bytes()
+	for i := range sizes {
+		size, n := Uvarint(b)
+		sizes[i], b = int(size), b[n+int(size):]
+	}
+	if sizes[1] >= sizes[0]/2 { //schema is sent once
+		t.Errorf("Stream message sizes %v\n", sizes)
+	}
+
+	decoder := NewStreamDecoder(bytes.NewReader(buf.Bytes()))
+	for i := range orders {
+		var order streamOrder
+		if err := decoder.Decode(&order); err != nil {
+			t.Error(err)
+		}
+		need := orders[i]
+		need.Skip = 0
+		if i == 0 {
+			need.Note = "note"
+		} else {
+			need.Note = []interface{}{uint64(1), "s"}
+		}
+		if !reflect.DeepEqual(order, need) {
+			t.Errorf("Stream got %+v\nneed %+v\n", order, need)
+		}
+	}
+	var order streamOrder
+	if err := decoder.Decode(&order); err != io.EOF {
+		t.Errorf("Stream got %v, need EOF\n", err)
+	}
+
+	decoder = NewStreamDecoder(bytes.NewReader(buf.Bytes()))
+	var v2 streamOrderV2
+	if err := decoder.Decode(&v2); err != nil || v2.Id != 1 || v2.Next == nil || v2.Next.Id != 2 || len(v2.Items) != 1 {
+		t.Errorf("Stream got %+v %v\n", v2, err)
+	}
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		t.Error(err)
+	}
+	if m, ok := generic.(map[string]interface{}); !ok || m["Id"] != int64(3) || m["At"] != "2021-02-03T04:05:06Z" || m["Next"] != nil {
+		t.Errorf("Stream got %#v\n", generic)
+	}
+
+	if err := encoder.Encode(make(chan int)); err == nil {
+		t.Error("Stream need error of unsupported type")
+	}
+	if err := NewStreamDecoder(bytes.NewReader([]byte{0x02, 0x00, 0x40})).Decode(&generic); err == nil {
+		t.Error("Stream need error of undefined type")
+	}
+}
+
+func TestWriteSchema(t *testing.T) {
+	RegStruct((*cHeader)(nil))
+	RegStruct((*offsetOverlap)(nil))
+	var b bytes.Buffer
+	if err := WriteSchema(&b); err != nil {
+		t.Error(err)
+	}
+	s := b.String()
+	for _, check := range []string{`struct binary.cHeader {
+	Flag bool
+	Value int32
+	Small uint16 ` + "`big`" + `
+	Big float64
+	_ [2]uint8 // ignored
+	N int
+	Arr [3]uint8
+	In binary.cInner
+}
+`, `struct binary.cInner {
+	A uint8
+	B uint32
+}
+`, `struct binary.offsetOverlap {
+	A uint32
+	B uint8 ` + "`offset=2`" + `
+}
+`} {
+		if !strings.Contains(s, check) {
+			t.Errorf("WriteSchema got\n%s\nneed\n%s\n", s, check)
+		}
+	}
+	if i, j := strings.Index(s, "struct binary.cHeader"), strings.Index(s, "struct binary.cInner"); i < 0 || i > j {
+		t.Error("WriteSchema need structs sorted by names")
+	}
+}
+
+type schemaKind uint8
+
+type schemaItem struct {
+	ID   uint16 `binary:"big"`
+	Tags []string
+}
+
+type schemaMessage struct {
+	Kind   schemaKind
+	Name   string
+	Data   []byte
+	Items  []schemaItem
+	Attrs  map[string]int32
+	Next   *schemaItem
+	When   time.Duration
+	hidden int
+}
+
+func TestSchemaDecode(t *testing.T) {
+	RegStruct((*schemaMessage)(nil))
+	var b bytes.Buffer
+	if err := WriteSchema(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "\tKind uint8\n") {
+		t.Errorf("WriteSchema need underlying type of named type, got\n%s", b.String())
+	}
+	schema, err := ParseSchema(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := schemaMessage{Kind: 3, Name: "msg", Data: []byte{1, 2},
+		Items: []schemaItem{{ID: 0x102, Tags: []string{"a"}}},
+		Attrs: map[string]int32{"x": -1}, When: time.Second, hidden: 5}
+	buffer, err := Encode(&m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := schema.Decode(buffer, "binary.schemaMessage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"Kind":  uint8(3),
+		"Name":  "msg",
+		"Data":  []byte{1, 2},
+		"Items": []interface{}{map[string]interface{}{"ID": uint16(0x102), "Tags": []interface{}{"a"}}},
+		"Attrs": map[string]interface{}{"x": int32(-1)},
+		"Next":  nil,
+		"When":  time.Second,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Schema.Decode got %#v\nneed %#v", got, want)
+	}
+
+	type schemaKey struct {
+		X int32
+		Y [2]int8
+	}
+	type schemaKeyed struct {
+		M map[schemaKey]int32
+		A map[[2]int8]bool
+	}
+	RegStruct((*schemaKey)(nil))
+	RegStruct((*schemaKeyed)(nil))
+	b.Reset()
+	if err := WriteSchema(&b); err != nil {
+		t.Fatal(err)
+	}
+	if schema, err = ParseSchema(&b); err != nil {
+		t.Fatal(err)
+	}
+	buffer, err = Encode(&schemaKeyed{M: map[schemaKey]int32{{5, [2]int8{1, 2}}: 7}, A: map[[2]int8]bool{{3, 4}: true}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = schema.Decode(buffer, "binary.schemaKeyed"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got["M"].(map[interface{}]interface{})) != 1 || len(got["A"].(map[interface{}]interface{})) != 1 {
+		t.Fatalf("Schema.Decode got %#v", got)
+	}
+	for key, value := range got["M"].(map[interface{}]interface{}) {
+		if k := reflect.ValueOf(key); k.Field(0).Int() != 5 || k.Field(1).Index(1).Int() != 2 || value != int32(7) {
+			t.Errorf("Schema.Decode got struct key %#v: %#v", key, value)
+		}
+	}
+	for key, value := range got["A"].(map[interface{}]interface{}) {
+		if k := reflect.ValueOf(key); k.Index(0).Int() != 3 || value != true {
+			t.Errorf("Schema.Decode got array key %#v: %#v", key, value)
+		}
+	}
+
+	if _, err := schema.Decode(buffer, "binary.noSuchStruct"); err == nil {
+		t.Error("Schema.Decode need error of undefined struct")
+	}
+	if s, err := ParseSchema(strings.NewReader("struct a.B {\n\tX chan int\n}\n")); err != nil {
+		t.Error(err)
+	} else if _, err := s.Decode(nil, "a.B"); err == nil {
+		t.Error("Schema.Decode need error of unsupported type")
+	}
+	if _, err := ParseSchema(strings.NewReader("struct a.B {\n\tX int\n")); err == nil {
+		t.Error("ParseSchema need error of unclosed struct")
+	}
+}
+
+type versionV1 struct {
+	_    struct{} `binary:"version=1"`
+	Name string
+}
+
+type versionV2 struct {
+	_    struct{} `binary:"version=2"`
+	Name string
+	Age  uint8
+}
+
+type versionV3 struct {
+	_     struct{} `binary:"version=3"`
+	Name  string
+	Age   uint8
+	Email string
+}
+
+type versionPairOld struct {
+	A    versionV1
+	B    *versionV3
+	Tail uint16
+}
+
+type versionPair struct {
+	A    versionV3
+	B    *versionV3
+	Tail uint16
+}
+
+func TestVersionMigration(t *testing.T) {
+	if err := RegMigration(func(old *versionV1, new *versionV2) error {
+		new.Name, new.Age = old.Name, 18
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegMigration(func(old *versionV2, new *versionV3) error {
+		new.Name, new.Age, new.Email = old.Name, old.Age, old.Name+"@example.com"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegMigration(func(old *versionV2, new *versionV3) error { return nil }); err == nil {
+		t.Error("RegMigration need error of duplicate migration")
+	}
+	if err := RegMigration(func(old *versionV3, new *versionV2) error { return nil }); err == nil {
+		t.Error("RegMigration need error of migration to old version")
+	}
+	if err := RegMigration(func(old *versionV1) error { return nil }); err == nil {
+		t.Error("RegMigration need error of invalid function")
+	}
+	RegStruct((*versionPair)(nil))
+
+	b, err := Encode(&versionV1{Name: "bob"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != 1 {
+		t.Errorf("versioned struct need version prefix, got % x", b)
+	}
+	var v3 versionV3
+	if err := Decode(b, &v3); err != nil {
+		t.Fatal(err)
+	}
+	if want := (versionV3{Name: "bob", Age: 18, Email: "bob@example.com"}); v3 != want {
+		t.Errorf("Decode migrated got %+v need %+v", v3, want)
+	}
+
+	//nested versioned structs and skip of them
+	old := versionPairOld{A: versionV1{Name: "a"}, B: &versionV3{Name: "b", Age: 4, Email: "e"}, Tail: 7}
+	b, err = Encode(&old, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pair versionPair
+	if err := Decode(b, &pair); err != nil {
+		t.Fatal(err)
+	}
+	want := versionPair{A: versionV3{Name: "a", Age: 18, Email: "a@example.com"}, B: old.B, Tail: 7}
+	if !reflect.DeepEqual(pair, want) {
+		t.Errorf("Decode migrated got %+v need %+v", pair, want)
+	}
+	d := NewDecoder(b)
+	if n := d.skipByType(reflect.TypeOf(pair), nil); n != len(b) {
+		t.Errorf("skip versioned structs got %d need %d", n, len(b))
+	}
+	if b, _ := Encode(&want, nil); Sizeof(&want) != len(b) {
+		t.Errorf("Sizeof versioned structs got %d need %d", Sizeof(&want), len(b))
+	}
+
+	b, _ = Encode(&versionV1{Name: "bob"}, nil)
+	b[0] = 9
+	if err := Decode(b, &v3); err == nil {
+		t.Error("Decode need error of unknown version")
+	}
+	b, _ = Encode(&versionV3{Name: "x"}, nil)
+	if _, err := NewLazyStruct(b, (*versionV3)(nil)); err != nil {
+		t.Error(err)
+	}
+	b, _ = Encode(&versionV2{Name: "x"}, nil)
+	if _, err := NewLazyStruct(b, (*versionV3)(nil)); err == nil {
+		t.Error("NewLazyStruct need error of old version")
+	}
+}
+
+type taggedV1 struct {
+	_     struct{} `binary:"tagged"`
+	Name  string   `binary:"id=1"`
+	Flag  bool     `binary:"id=2"`
+	Count uint32   `binary:"id=3,big"`
+}
+
+type taggedV2 struct {
+	_     struct{}      `binary:"tagged"`
+	Name  string        `binary:"id=1"`
+	Extra []taggedExtra `binary:"id=4"`
+	Flag  bool          `binary:"id=2"`
+	Count uint32        `binary:"id=3,big"`
+	More  bool          `binary:"id=5"`
+}
+
+type taggedExtra struct {
+	A bool
+	B int8
+}
+
+type taggedOuter struct {
+	Before bool
+	In     taggedV2
+	After  bool
+	Tail   uint8
+}
+
+type taggedDup struct {
+	_ struct{} `binary:"tagged"`
+	A int      `binary:"id=3"`
+	B int
+}
+
+func TestTaggedStruct(t *testing.T) {
+	RegStruct((*taggedV1)(nil))
+	RegStruct((*taggedOuter)(nil))
+	if err := RegStruct((*taggedDup)(nil)); err == nil {
+		t.Error("RegStruct need error of duplicate field id")
+	}
+
+	v2 := taggedV2{Name: "n", Extra: []taggedExtra{{true, -1}, {false, 2}}, Flag: true, Count: 0x01020304, More: true}
+	b, err := Encode(&v2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := Sizeof(&v2); s != len(b) {
+		t.Errorf("Sizeof tagged struct got %d need %d", s, len(b))
+	}
+
+	//old definition skips unknown fields
+	var v1 taggedV1
+	if err := DecodeStrict(b, &v1); err != nil {
+		t.Fatal(err)
+	}
+	if want := (taggedV1{Name: "n", Flag: true, Count: 0x01020304}); v1 != want {
+		t.Errorf("Decode tagged got %+v need %+v", v1, want)
+	}
+
+	//new definition leaves missing fields
+	b, _ = Encode(&v1, nil)
+	var got taggedV2
+	if err := Decode(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (taggedV2{Name: "n", Flag: true, Count: 0x01020304}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode tagged got %+v need %+v", got, want)
+	}
+
+	//bools around tagged struct
+	outer := taggedOuter{Before: true, In: v2, After: true, Tail: 9}
+	b, err = Encode(&outer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := Sizeof(&outer); s != len(b) {
+		t.Errorf("Sizeof tagged struct got %d need %d", s, len(b))
+	}
+	var outer2 taggedOuter
+	if err := DecodeStrict(b, &outer2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(outer, outer2) {
+		t.Errorf("Decode tagged got %+v need %+v", outer2, outer)
+	}
+	if err := DecodeFields(b, &outer2, "Tail"); err != nil {
+		t.Error(err)
+	}
+	b2, _ := Encode(&v2, nil)
+	d := NewDecoder(b2)
+	if n := d.skipByType(reflect.TypeOf(v2), nil); n != len(b2) {
+		t.Errorf("skip tagged struct got %d need %d", n, len(b2))
+	}
+	var outer3 taggedOuter
+	if err := Read(bytes.NewReader(b), DefaultEndian, &outer3); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(outer, outer3) {
+		t.Errorf("Read tagged got %+v need %+v", outer3, outer)
+	}
+	if _, err := NewLazyStruct(b, (*taggedV2)(nil)); err == nil {
+		t.Error("NewLazyStruct need error of tagged struct")
+	}
+}
+
+type fieldIDV1 struct {
+	A uint8  `binary:"id=1"`
+	B string `binary:"id=2"`
+	C uint16 `binary:"id=3"`
+}
+
+type fieldIDV2 struct { //reordered in source
+	C uint16 `binary:"id=3"`
+	A uint8  `binary:"id=1"`
+	x int
+	B string `binary:"id=2"`
+}
+
+type fieldIDMissing struct {
+	A uint8 `binary:"id=1"`
+	B uint8
+}
+
+type fieldIDTagged struct { //B removed
+	_ struct{} `binary:"tagged"`
+	C uint16   `binary:"id=3"`
+	A uint8    `binary:"id=1"`
+}
+
+func TestFieldID(t *testing.T) {
+	RegStruct((*fieldIDV1)(nil))
+	RegStruct((*fieldIDV2)(nil))
+	RegStruct((*fieldIDTagged)(nil))
+	if err := RegStruct((*fieldIDMissing)(nil)); err == nil {
+		t.Error("RegStruct need error of field without id")
+	}
+
+	b, err := Encode(&fieldIDV2{C: 0x0201, A: 3, B: "b"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{3, 1, 'b', 1, 2}; !bytes.Equal(b, want) {
+		t.Errorf("Encode by ids got % x need % x", b, want)
+	}
+	var v1 fieldIDV1
+	if err := DecodeStrict(b, &v1); err != nil {
+		t.Fatal(err)
+	}
+	if want := (fieldIDV1{A: 3, B: "b", C: 0x0201}); v1 != want {
+		t.Errorf("Decode by ids got %+v need %+v", v1, want)
+	}
+	lazy, err := NewLazyStruct(b, (*fieldIDV2)(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c uint16
+	if err := lazy.Field("C", &c); err != nil || c != 0x0201 || lazy.Size() != len(b) {
+		t.Errorf("LazyStruct by ids got %x %v size %d", c, err, lazy.Size())
+	}
+
+	//fields removed from tagged struct are skiped
+	type taggedFull struct {
+		_ struct{} `binary:"tagged"`
+		A uint8    `binary:"id=1"`
+		B string   `binary:"id=2"`
+		C uint16   `binary:"id=3"`
+	}
+	RegStruct((*taggedFull)(nil))
+	b, _ = Encode(&taggedFull{A: 1, B: "x", C: 2}, nil)
+	var tagged fieldIDTagged
+	if err := DecodeStrict(b, &tagged); err != nil {
+		t.Fatal(err)
+	}
+	if tagged.A != 1 || tagged.C != 2 {
+		t.Errorf("Decode tagged by ids got %+v", tagged)
+	}
+}
+
+type defaultV1 struct {
+	_    struct{} `binary:"tagged"`
+	Name string   `binary:"id=1"`
+}
+
+type defaultV2 struct {
+	_     struct{} `binary:"tagged"`
+	Name  string   `binary:"id=1,default=anon"`
+	Port  uint16   `binary:"id=2,default=0x1f90"`
+	Ratio float32  `binary:"id=3,default=0.5"`
+	On    bool     `binary:"id=4,default=true"`
+	Delta int8     `binary:"id=5,default=-3"`
+}
+
+type defaultBad struct {
+	A []int `binary:"default=1"`
+}
+
+type defaultInvalid struct {
+	A uint8 `binary:"default=300"`
+}
+
+func TestDefaultValue(t *testing.T) {
+	RegStruct((*defaultV1)(nil))
+	RegStruct((*defaultV2)(nil))
+	if err := RegStruct((*defaultBad)(nil)); err == nil {
+		t.Error("RegStruct need error of default value of slice")
+	}
+	if err := RegStruct((*defaultInvalid)(nil)); err == nil {
+		t.Error("RegStruct need error of default value out of range")
+	}
+
+	b, _ := Encode(&defaultV1{Name: "bob"}, nil)
+	var v2 defaultV2
+	if err := Decode(b, &v2); err != nil {
+		t.Fatal(err)
+	}
+	want := defaultV2{Name: "bob", Port: 8080, Ratio: 0.5, On: true, Delta: -3}
+	if v2 != want {
+		t.Errorf("Decode defaults got %+v need %+v", v2, want)
+	}
+
+	//present zero values are kept
+	b, _ = Encode(&defaultV2{}, nil)
+	v2 = want
+	if err := Decode(b, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if (v2 != defaultV2{}) {
+		t.Errorf("Decode zero values got %+v", v2)
+	}
+
+	b, _ = EncodeMsgpack(&struct{ Name string }{"x"}, nil)
+	v2 = defaultV2{}
+	if err := DecodeMsgpack(b, &v2); err != nil {
+		t.Fatal(err)
+	}
+	if want.Name = "x"; v2 != want {
+		t.Errorf("DecodeMsgpack defaults got %+v need %+v", v2, want)
+	}
+}
+
+type optionInner struct {
+	A bool
+	B uint16
+}
+
+type optionStruct struct {
+	Flag  bool
+	Port  Option[uint16]
+	Name  Option[string]
+	Inner Option[optionInner]
+	Count Option[uint32] `binary:"packed"`
+	Last  bool
+}
+
+func TestOption(t *testing.T) {
+	RegStruct((*optionStruct)(nil))
+	o := Some(uint16(80))
+	if x, ok := o.Get(); !ok || x != 80 {
+		t.Errorf("Option.Get got %d %v", x, ok)
+	}
+	if o.Reset(); o.Valid || o.GetOr(1) != 1 {
+		t.Errorf("Option.Reset got %+v", o)
+	}
+
+	v := optionStruct{Flag: true, Port: Some(uint16(0x1234)), Inner: Some(optionInner{true, 7}),
+		Count: Some(uint32(5)), Last: true}
+	b, err := Encode(&v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := Sizeof(&v); s != len(b) {
+		t.Errorf("Sizeof Option got %d need %d", s, len(b))
+	}
+	if want := []byte{0x3, 1, 0x34, 0x12, 0, 1, 1, 7, 0, 1, 5}; !bytes.Equal(b, want) {
+		t.Errorf("Encode Option got % x need % x", b, want)
+	}
+	var got optionStruct
+	got.Name.Set("stale")
+	if err := DecodeStrict(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("Decode Option got %+v need %+v", got, v)
+	}
+	b[1] = 2
+	if err := Decode(b, &got); err == nil {
+		t.Error("Decode need error of invalid presence byte")
+	}
+}
+
+type genericItem struct {
+	ID    uint32 `binary:"big"`
+	Name  string
+	On    bool
+	Tags  []string
+	Score float64
+}
+
+func TestGenericCodec(t *testing.T) {
+	if CodecFor[genericItem]() != CodecFor[genericItem]() {
+		t.Error("CodecFor need cached Codec")
+	}
+	item := genericItem{ID: 1, Name: "a", On: true, Tags: []string{"x", "y"}, Score: 1.5}
+	b, err := Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := Encode(&item, nil); !bytes.Equal(b, want) {
+		t.Errorf("Marshal got % x need % x", b, want)
+	}
+	got, err := Unmarshal[genericItem](b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, item) {
+		t.Errorf("Unmarshal got %+v need %+v", got, item)
+	}
+	if _, err := Unmarshal[genericItem](b[:3]); err == nil {
+		t.Error("Unmarshal need error of short buffer")
+	}
+
+	c := CodecFor[uint32]()
+	x := uint32(0x01020304)
+	if b, err := c.Encode(&x, nil); err != nil || c.Size(&x) != 4 || !bytes.Equal(b, []byte{4, 3, 2, 1}) {
+		t.Errorf("Codec[uint32].Encode got % x %v", b, err)
+	}
+	m := map[string]int{"a": 1}
+	b, err = Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2, err := Unmarshal[map[string]int](b); err != nil || !reflect.DeepEqual(m, m2) {
+		t.Errorf("Unmarshal map got %v %v", m2, err)
+	}
+}
+
+func TestGenericSlice(t *testing.T) {
+	items := []genericItem{{ID: 1, Name: "a", On: true}, {ID: 2, Tags: []string{"t"}, Score: -1}}
+	for _, s := range []interface{}{items, []uint16{1, 2, 0x300}, []bool{true, false, true}, []string{"x", ""}} {
+		want, err := Encode(s, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b []byte
+		var got interface{}
+		switch x := s.(type) {
+		case []genericItem:
+			b, err = EncodeSlice(x, nil)
+			got, _ = DecodeSlice[genericItem](b)
+		case []uint16:
+			b, err = EncodeSlice(x, nil)
+			got, _ = DecodeSlice[uint16](b)
+		case []bool:
+			b, err = EncodeSlice(x, nil)
+			got, _ = DecodeSlice[bool](b)
+		case []string:
+			b, err = EncodeSlice(x, nil)
+			got, _ = DecodeSlice[string](b)
+		}
+		if err != nil || !bytes.Equal(b, want) {
+			t.Errorf("EncodeSlice %T got % x %v need % x", s, b, err, want)
+		}
+		if !reflect.DeepEqual(got, s) {
+			t.Errorf("DecodeSlice %T got %v need %v", s, got, s)
+		}
+	}
+	b, _ := EncodeSlice(items, nil)
+	if _, err := DecodeSlice[genericItem](b[:len(b)-1]); err == nil {
+		t.Error("DecodeSlice need error of short buffer")
+	}
+}
+
+func TestWriteToReadFrom(t *testing.T) {
+	var _ io.WriterTo = (*Encoder)(nil)
+	var _ io.ReaderFrom = (*Decoder)(nil)
+
+	encoder := NewEncoder(16)
+	encoder.Uint32(7, false)
+	encoder.String("ab")
+	var buf bytes.Buffer
+	if n, err := encoder.WriteTo(&buf); err != nil || n != 7 {
+		t.Errorf("Encoder.WriteTo got %d %v", n, err)
+	}
+
+	decoder := NewDecoder(nil)
+	if n, err := decoder.ReadFrom(bytes.NewReader(buf.Bytes()[:5])); err != nil || n != 5 {
+		t.Errorf("Decoder.ReadFrom got %d %v", n, err)
+	}
+	if x := decoder.Uint32(false); x != 7 {
+		t.Errorf("Decoder.ReadFrom got %d", x)
+	}
+	if _, err := decoder.ReadFrom(bytes.NewReader(buf.Bytes()[5:])); err != nil {
+		t.Error(err)
+	}
+	if s := decoder.String(); s != "ab" {
+		t.Errorf("Decoder.ReadFrom got %q", s)
+	}
+}
+
+// oneByteReader returns one byte for each Read, to simulate partial reads.
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return r.r.Read(p[:1])
+}
+
+func TestMessage(t *testing.T) {
+	var buf bytes.Buffer
+	items := []genericItem{{ID: 1, Name: "a"}, {ID: 2, Tags: make([]string, 100)}}
+	for i := range items {
+		if err := WriteMessage(&buf, &items[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := buf.Bytes()
+	r := oneByteReader{bytes.NewReader(b)}
+	for i := range items {
+		var got genericItem
+		if err := ReadMessage(r, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, items[i]) {
+			t.Errorf("ReadMessage got %+v need %+v", got, items[i])
+		}
+	}
+	var got genericItem
+	if err := ReadMessage(r, &got); err != io.EOF {
+		t.Errorf("ReadMessage need io.EOF, got %v", err)
+	}
+	if err := ReadMessage(bytes.NewReader(b[:5]), &got); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadMessage need io.ErrUnexpectedEOF, got %v", err)
+	}
+	if err := ReadMessage(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x7f}), &got); err == nil {
+		t.Error("ReadMessage need error of huge message")
+	}
+	if err := WriteMessage(&buf, make(chan int)); err == nil {
+		t.Error("WriteMessage need error of invalid type")
+	}
+}
+
+func TestTLV(t *testing.T) {
+	var w TLVWriter
+	w.Append(1, []byte("name"))
+	item := genericItem{ID: 9, Name: "x"}
+	if err := w.AppendValue(300, &item); err != nil {
+		t.Fatal(err)
+	}
+	w.Append(2, nil)
+	b := w.Bytes()
+
+	encoder := NewEncoder(len(b))
+	encoder.TLV(1, []byte("name"))
+	encoder.TLV(300, b[SizeofTLV(1, 4)+3:SizeofTLV(1, 4)+3+Sizeof(&item)])
+	encoder.TLV(2, nil)
+	if !bytes.Equal(encoder.Buffer(), b) {
+		t.Errorf("Encoder.TLV got % x need % x", encoder.Buffer(), b)
+	}
+
+	var tags []uint64
+	r := NewTLVReader(b)
+	for r.Next() {
+		tags = append(tags, r.Tag())
+		switch r.Tag() {
+		case 1:
+			if string(r.Value()) != "name" {
+				t.Errorf("TLVReader got value %q", r.Value())
+			}
+		case 300:
+			var got genericItem
+			if err := r.Decode(&got); err != nil || !reflect.DeepEqual(got, item) {
+				t.Errorf("TLVReader.Decode got %+v %v", got, err)
+			}
+		}
+	}
+	if r.Err() != nil || !reflect.DeepEqual(tags, []uint64{1, 300, 2}) {
+		t.Errorf("TLVReader got tags %v %v", tags, r.Err())
+	}
+
+	r = NewTLVReader(b[:len(b)-3])
+	for r.Next() {
+	}
+	if r.Err() == nil {
+		t.Error("TLVReader need error of truncated record")
+	}
+	if w.Reset(); len(w.Bytes()) != 0 {
+		t.Error("TLVWriter.Reset need empty records")
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	e := Envelope{Magic: 0x42494E31, Version: 2, Flags: EnvelopeBigEndian | 0x0100}
+	item := genericItem{ID: 0x0102, Name: "x"}
+	b, err := e.Encode(&item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:4]) != "BIN1" || len(b) != EnvelopeHeaderSize+Sizeof(&item) {
+		t.Errorf("Envelope.Encode got % x", b)
+	}
+	var got genericItem
+	if h, err := e.Decode(b, &got); err != nil || h != e || !reflect.DeepEqual(got, item) {
+		t.Errorf("Envelope.Decode got %+v %+v %v", h, got, err)
+	}
+	if h, err := (Envelope{Magic: e.Magic, Version: 3}).Decode(b, &got); err != nil || h.Endian() != BigEndian {
+		t.Errorf("Envelope.Decode of lower version got %+v %v", h, err)
+	}
+
+	invalids := map[string][]byte{
+		"magic":     append([]byte("BIN2"), b[4:]...),
+		"version":   append(append([]byte{}, b[:5]...), append([]byte{3}, b[6:]...)...),
+		"flags":     append(append([]byte{}, b[:7]...), append([]byte{3}, b[8:]...)...),
+		"truncated": b[:len(b)-1],
+		"header":    b[:EnvelopeHeaderSize-1],
+	}
+	for name, buf := range invalids {
+		if _, err := e.Decode(buf, &got); err == nil {
+			t.Errorf("Envelope.Decode need error of %s", name)
+		}
+	}
+
+	var w bytes.Buffer
+	if err := e.Write(&w, &item); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(b[:3])
+	got = genericItem{}
+	if _, err := e.Read(&w, &got); err != nil || !reflect.DeepEqual(got, item) {
+		t.Errorf("Envelope.Read got %+v %v", got, err)
+	}
+	if _, err := e.Read(&w, &got); err != io.ErrUnexpectedEOF {
+		t.Errorf("Envelope.Read need io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := e.Read(&w, &got); err != io.EOF {
+		t.Errorf("Envelope.Read need io.EOF, got %v", err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	sums := []struct {
+		s   string
+		sum uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+	for _, v := range sums {
+		if got := XXHash64.Sum([]byte(v.s)); got != v.sum {
+			t.Errorf("XXHash64 of %q got %#x need %#x", v.s, got, v.sum)
+		}
+	}
+	if got := CRC32.Sum([]byte("123456789")); got != 0xcbf43926 {
+		t.Errorf("CRC32 got %#x", got)
+	}
+
+	item := genericItem{ID: 7, Name: "checksum"}
+	for _, c := range []Checksum{NoChecksum, CRC32, XXHash64} {
+		b, err := EncodeChecksum(&item, c)
+		if err != nil || len(b) != Sizeof(&item)+c.Size() {
+			t.Fatalf("EncodeChecksum %d got % x %v", c, b, err)
+		}
+		var got genericItem
+		if err := DecodeChecksum(b, &got, c); err != nil || !reflect.DeepEqual(got, item) {
+			t.Errorf("DecodeChecksum %d got %+v %v", c, got, err)
+		}
+		if c != NoChecksum {
+			b[1] ^= 0x10
+			if err := DecodeChecksum(b, &got, c); !errors.Is(err, ErrChecksum) {
+				t.Errorf("DecodeChecksum %d need ErrChecksum, got %v", c, err)
+			}
+		}
+
+		var w bytes.Buffer
+		if err := WriteMessageChecksum(&w, &item, c); err != nil {
+			t.Fatal(err)
+		}
+		got = genericItem{}
+		if err := ReadMessageChecksum(&w, &got, c); err != nil || !reflect.DeepEqual(got, item) || w.Len() != 0 {
+			t.Errorf("ReadMessageChecksum %d got %+v %v", c, got, err)
+		}
+
+		e := Envelope{Magic: 1, Flags: [...]uint16{0, EnvelopeCRC32, EnvelopeXXHash64}[c]}
+		if b, err = e.Encode(&item); err != nil || len(b) != EnvelopeHeaderSize+Sizeof(&item)+c.Size() {
+			t.Fatalf("Envelope.Encode %d got % x %v", c, b, err)
+		}
+		got = genericItem{}
+		if h, err := e.Decode(b, &got); err != nil || h.Checksum() != c || !reflect.DeepEqual(got, item) {
+			t.Errorf("Envelope.Decode %d got %+v %v", c, got, err)
+		}
+		if c != NoChecksum {
+			b[EnvelopeHeaderSize] ^= 1
+			if _, err := e.Decode(b, &got); !errors.Is(err, ErrChecksum) {
+				t.Errorf("Envelope.Decode %d need ErrChecksum, got %v", c, err)
+			}
+		}
+	}
+}
+
+func TestCompressedStream(t *testing.T) {
+	items := make([]genericItem, 100)
+	for i := range items {
+		items[i] = genericItem{ID: uint32(i), Name: "compressed stream"}
+	}
+	for _, c := range []Compression{NoCompression, Gzip} {
+		var w bytes.Buffer
+		enc, err := NewCompressedEncoder(&w, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range items {
+			if err := enc.Encode(&items[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		raw, compressed := enc.Stats()
+		if compressed != int64(w.Len()) || (c == Gzip) != (compressed < raw) {
+			t.Errorf("CompressedEncoder %s got stats %d %d, written %d", c, raw, compressed, w.Len())
+		}
+
+		dec := NewCompressedDecoder(&w)
+		for i := range items {
+			var got genericItem
+			if err := dec.Decode(&got); err != nil || !reflect.DeepEqual(got, items[i]) {
+				t.Fatalf("CompressedDecoder %s got %+v %v", c, got, err)
+			}
+		}
+		var got genericItem
+		if err := dec.Decode(&got); err != io.EOF || dec.Compression() != c || dec.Stats() != raw {
+			t.Errorf("CompressedDecoder %s need io.EOF, got %v %s %d", c, err, dec.Compression(), dec.Stats())
+		}
+		dec.Close()
+	}
+	if _, err := NewCompressedEncoder(io.Discard, Zstd); err == nil {
+		t.Error("NewCompressedEncoder need error of unregistered compression")
+	}
+}
+
+func TestEncryptedCodec(t *testing.T) {
+	if _, err := NewAESGCMCodec(make([]byte, 10)); err == nil {
+		t.Error("NewAESGCMCodec need error of invalid key")
+	}
+	c, err := NewAESGCMCodec([]byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := genericItem{ID: 3, Name: "secret", Tags: []string{"a"}}
+	b, err := c.Encode(&item, []byte("ad"))
+	if err != nil || len(b) != Sizeof(&item)+c.Overhead() {
+		t.Fatalf("EncryptedCodec.Encode got % x %v", b, err)
+	}
+	if bytes.Contains(b, []byte("secret")) {
+		t.Error("EncryptedCodec.Encode got plain text")
+	}
+	if b2, _ := c.Encode(&item, []byte("ad")); bytes.Equal(b, b2) {
+		t.Error("EncryptedCodec.Encode need different nonces")
+	}
+	var got genericItem
+	if err := c.Decode(b, &got, []byte("ad")); err != nil || !reflect.DeepEqual(got, item) {
+		t.Errorf("EncryptedCodec.Decode got %+v %v", got, err)
+	}
+	if err := c.Decode(b, &got, nil); err != ErrAuthentication {
+		t.Errorf("EncryptedCodec.Decode need ErrAuthentication of additional data, got %v", err)
+	}
+	b[len(b)-1] ^= 1
+	if err := c.Decode(b, &got, []byte("ad")); err != ErrAuthentication {
+		t.Errorf("EncryptedCodec.Decode need ErrAuthentication, got %v", err)
+	}
+	if err := c.Decode(b[:5], &got, nil); err != ErrAuthentication {
+		t.Errorf("EncryptedCodec.Decode need ErrAuthentication of short message, got %v", err)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	type signed struct {
+		ID    uint32
+		Attrs map[string]int
+	}
+	data := &signed{ID: 1, Attrs: map[string]int{"a": 1, "b": 2, "c": 3, "d": 4}}
+	d1, err := Digest(sha256.New(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if d2, _ := Digest(sha256.New(), &signed{ID: 1, Attrs: map[string]int{"d": 4, "c": 3, "b": 2, "a": 1}}); !bytes.Equal(d1, d2) {
+			t.Fatal("Digest need canonical encoding of maps")
+		}
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	cases := []struct {
+		signer crypto.Signer
+		pub    crypto.PublicKey
+		opts   crypto.SignerOpts
+	}{
+		{ecKey, &ecKey.PublicKey, crypto.SHA256},
+		{rsaKey, &rsaKey.PublicKey, crypto.SHA256},
+		{rsaKey, &rsaKey.PublicKey, &rsa.PSSOptions{Hash: crypto.SHA256}},
+		{edKey, edPub, crypto.Hash(0)},
+		{edKey, edPub, &ed25519.Options{Hash: crypto.SHA512}},
+	}
+	for i, c := range cases {
+		sig, err := Sign(c.signer, data, c.opts)
+		if err != nil {
+			t.Fatalf("%d Sign got %v", i, err)
+		}
+		if err := Verify(c.pub, data, sig, c.opts); err != nil {
+			t.Errorf("%d Verify got %v", i, err)
+		}
+		if err := Verify(c.pub, &signed{ID: 2, Attrs: data.Attrs}, sig, c.opts); err != ErrSignature {
+			t.Errorf("%d Verify need ErrSignature, got %v", i, err)
+		}
+	}
+	if err := Verify("key", data, nil, crypto.SHA256); err == nil {
+		t.Error("Verify need error of unsupported key")
+	}
+}
+
+func TestLog(t *testing.T) {
+	dir := t.TempDir()
+	lw, err := OpenLogWriter(dir, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := lw.Append(&genericItem{ID: uint32(i), Name: "event"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if segs, _ := logSegments(dir); len(segs) < 2 {
+		t.Errorf("LogWriter need rotating segments, got %v", segs)
+	}
+
+	replay := func() []uint32 {
+		lr, err := OpenLogReader(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lr.Close()
+		var ids []uint32
+		for lr.Next() {
+			var got genericItem
+			if err := lr.Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, got.ID)
+		}
+		if err := lr.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+	if ids := replay(); len(ids) != 20 || ids[0] != 0 || ids[19] != 19 {
+		t.Errorf("LogReader got %v", ids)
+	}
+
+	segs, _ := logSegments(dir)
+	last := logSegmentPath(dir, segs[len(segs)-1])
+	f, _ := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{10, 1, 2}) //torn record
+	f.Close()
+	if ids := replay(); len(ids) != 20 {
+		t.Errorf("LogReader of torn tail got %v", ids)
+	}
+	if lw, err = OpenLogWriter(dir, 64); err != nil {
+		t.Fatal(err)
+	}
+	lw.Append(&genericItem{ID: 20})
+	lw.Close()
+	if ids := replay(); len(ids) != 21 || ids[20] != 20 {
+		t.Errorf("LogWriter need truncating torn tail, got %v", ids)
+	}
+
+	b, _ := os.ReadFile(logSegmentPath(dir, segs[0]))
+	b[len(b)-1] ^= 1
+	os.WriteFile(logSegmentPath(dir, segs[0]), b, 0644)
+	lr, _ := OpenLogReader(dir)
+	for lr.Next() {
+	}
+	if lr.Err() == nil {
+		t.Error("LogReader need error of corrupted record")
+	}
+	lr.Close()
+}
+
+func TestSliceIndex(t *testing.T) {
+	items := make([]genericItem, 50)
+	for i := range items {
+		items[i] = genericItem{ID: uint32(i), Name: strings.Repeat("x", i%7), On: i%3 == 0}
+		if i%2 == 1 {
+			items[i].Tags = []string{"t"}
+		}
+	}
+	b, err := Encode(items, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := NewSliceIndex(b, (*[]genericItem)(nil))
+	if err != nil || ix.Len() != len(items) {
+		t.Fatalf("NewSliceIndex got %v", err)
+	}
+	for _, i := range []int{37, 3, 49, 0, 20} {
+		var got genericItem
+		if err := ix.Element(i, &got); err != nil || !reflect.DeepEqual(got, items[i]) {
+			t.Errorf("SliceIndex.Element(%d) got %+v %v", i, got, err)
+		}
+	}
+	if end, err := ix.Offset(ix.Len()); err != nil || end != len(b) {
+		t.Errorf("SliceIndex.Offset of end got %d %v need %d", end, err, len(b))
+	}
+	if err := ix.Element(50, new(genericItem)); err == nil {
+		t.Error("SliceIndex.Element need error of out of range")
+	}
+	if err := ix.Element(1, new(int)); err == nil {
+		t.Error("SliceIndex.Element need error of element type")
+	}
+
+	nums := []uint16{1, 2, 3, 4}
+	b, _ = Encode(nums, nil)
+	ix, err = NewSliceIndex(b, nums)
+	var x uint16
+	if err != nil || ix.Element(2, &x) != nil || x != 3 {
+		t.Errorf("SliceIndex of numbers got %d %v", x, err)
+	}
+	if offsets, err := ix.Offsets(); err != nil || !reflect.DeepEqual(offsets, []int{1, 3, 5, 7}) {
+		t.Errorf("SliceIndex.Offsets got %v %v", offsets, err)
+	}
+	if _, err := NewSliceIndex(b[:5], nums); err == nil {
+		t.Error("NewSliceIndex need error of short buffer")
+	}
+	if _, err := NewSliceIndex(b, []bool{}); err == nil {
+		t.Error("NewSliceIndex need error of bools")
+	}
+}
+
+func TestMappedFile(t *testing.T) {
+	path := t.TempDir() + "/items.bin"
+	items := []genericItem{{ID: 1, Name: "mapped"}, {ID: 2, Tags: []string{"a", "b"}}}
+	b, _ := Encode(items, nil)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := OpenMapped(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.Len() != len(b) || !bytes.Equal(m.Bytes(), b) {
+		t.Errorf("MappedFile got % x need % x", m.Bytes(), b)
+	}
+	var got []genericItem
+	if err := m.Decoder().Value(&got); err != nil || !reflect.DeepEqual(got, items) {
+		t.Errorf("MappedFile.Decoder got %+v %v", got, err)
+	}
+	ix, err := NewSliceIndex(m.Bytes(), got)
+	var item genericItem
+	if err != nil || ix.Element(1, &item) != nil || !reflect.DeepEqual(item, items[1]) {
+		t.Errorf("SliceIndex of MappedFile got %+v %v", item, err)
+	}
+	if err := m.Close(); err != nil || m.Len() != 0 {
+		t.Errorf("MappedFile.Close got %v", err)
+	}
+
+	os.WriteFile(path, nil, 0644)
+	if m, err := OpenMapped(path); err != nil || m.Len() != 0 || m.Close() != nil {
+		t.Errorf("OpenMapped of empty file got %v", err)
+	}
+	if _, err := OpenMapped(path + ".none"); err == nil {
+		t.Error("OpenMapped need error of missing file")
+	}
+}
+
+func TestDecoderAt(t *testing.T) {
+	var buf []byte
+	offsets := make([]int64, 20)
+	for i := range offsets {
+		offsets[i] = int64(len(buf))
+		b, _ := Encode(&genericItem{ID: uint32(i), Name: strings.Repeat("a", i), On: i%2 == 0, Tags: []string{"x"}}, nil)
+		buf = append(buf, b...)
+	}
+	r := bytes.NewReader(buf)
+
+	decoder := NewDecoderAt(r, 0)
+	for i := range offsets {
+		if decoder.Offset() != offsets[i] {
+			t.Fatalf("Decoder.Offset got %d need %d", decoder.Offset(), offsets[i])
+		}
+		var got genericItem
+		if err := decoder.Value(&got); err != nil || got.ID != uint32(i) {
+			t.Fatalf("Decoder of ReaderAt got %+v %v", got, err)
+		}
+	}
+	if decoder.Offset() != int64(len(buf)) || NewDecoder(buf).Offset() != -1 {
+		t.Errorf("Decoder.Offset got %d need %d", decoder.Offset(), len(buf))
+	}
+
+	errs := make(chan error, len(offsets))
+	for i := range offsets {
+		go func(i int) {
+			var got genericItem
+			next, err := DecodeAt(r, offsets[i], &got)
+			if err == nil && (got.ID != uint32(i) || got.On != (i%2 == 0) || len(got.Name) != i ||
+				(i+1 < len(offsets) && next != offsets[i+1])) {
+				err = fmt.Errorf("DecodeAt(%d) got %+v next %d", offsets[i], got, next)
+			}
+			errs <- err
+		}(i)
+	}
+	for range offsets {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := DecodeAt(r, int64(len(buf))-1, new(genericItem)); err == nil {
+		t.Error("DecodeAt need error of truncated value")
+	}
+}
+
+func TestDump(t *testing.T) {
+	type dumpInner struct {
+		A uint16
+		B bool
+		C bool
+	}
+	type dumpOuter struct {
+		ID    uint32
+		Name  string
+		Inner []dumpInner
+		Blob  []byte
+	}
+	x := dumpOuter{ID: 7, Name: "abc", Inner: []dumpInner{{1, true, false}}, Blob: make([]byte, 20)}
+	b, _ := Encode(&x, nil)
+	got := Dump(append(b, 0xEE), &x)
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	need := []string{
+		"000000" + strings.Repeat(" ", 52) + "binary.dumpOuter",
+		"000000  07 00 00 00" + strings.Repeat(" ", 39) + "  ID uint32",
+		"000004  03 61 62 63" + strings.Repeat(" ", 39) + "  Name string",
+		"000008  01" + strings.Repeat(" ", 48) + "  Inner []binary.dumpInner len=1",
+		"000009" + strings.Repeat(" ", 52) + "    [0] binary.dumpInner",
+		"000009  01 00" + strings.Repeat(" ", 45) + "      A uint16",
+		"00000b  01" + strings.Repeat(" ", 48) + "      B bool",
+		"00000c" + strings.Repeat(" ", 52) + "      C bool (bit)",
+		"00000c  14 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00" + strings.Repeat(" ", 3) + "  Blob []uint8",
+		"00001c  00 00 00 00 00",
+		"000021  ee" + strings.Repeat(" ", 48) + "(trailing bytes)",
+	}
+	if !reflect.DeepEqual(lines, need) {
+		t.Errorf("Dump got\n%s\nneed\n%s", got, strings.Join(need, "\n"))
+	}
+	if got := Dump(b[:6], &x); !strings.Contains(got, "error: ") {
+		t.Errorf("Dump need error of short buffer, got\n%s", got)
+	}
+}
+
+type traceRecorder []TraceField
+
+func (r *traceRecorder) TraceField(f TraceField) {
+	*r = append(*r, f)
+}
+
+func TestTracer(t *testing.T) {
+	type traceInner struct {
+		A uint16
+		B bool
+	}
+	type traceOuter struct {
+		ID    uint32
+		Inner traceInner
+		Name  string
+		C     bool
+	}
+	x := traceOuter{ID: 1, Inner: traceInner{2, true}, Name: "abc", C: true}
+	var enc traceRecorder
+	encoder := NewEncoder(Sizeof(&x))
+	encoder.SetTracer(&enc)
+	if err := encoder.Value(&x); err != nil {
+		t.Fatal(err)
+	}
+	type traced struct {
+		name         string
+		offset, size int
+	}
+	need := []traced{{"ID", 0, 4}, {"A", 4, 2}, {"B", 6, 1}, {"Inner", 4, 3}, {"Name", 7, 4}, {"C", 11, 0}}
+	check := func(fs traceRecorder, decode bool) {
+		got := make([]traced, len(fs))
+		for i, f := range fs {
+			got[i] = traced{f.Name, f.Offset, f.Size}
+			if f.Decode != decode {
+				t.Errorf("TraceField %s got Decode %v", f.Name, f.Decode)
+			}
+		}
+		if !reflect.DeepEqual(got, need) {
+			t.Errorf("Tracer got %v need %v", got, need)
+		}
+	}
+	check(enc, false)
+	if enc[3].Struct != reflect.TypeOf(x) || enc[3].Type != reflect.TypeOf(x.Inner) {
+		t.Errorf("TraceField got %+v", enc[3])
+	}
+
+	var dec traceRecorder
+	decoder := NewDecoder(encoder.Buffer())
+	decoder.SetTracer(&dec)
+	var got traceOuter
+	if err := decoder.Value(&got); err != nil || got != x {
+		t.Fatalf("Decoder with tracer got %+v %v", got, err)
+	}
+	check(dec, true)
+
+	RegStruct((*taggedV1)(nil))
+	enc = nil
+	encoder = NewEncoder(Sizeof(&taggedV1{Name: "ab", Flag: true, Count: 5}))
+	encoder.SetTracer(&enc)
+	encoder.Value(&taggedV1{Name: "ab", Flag: true, Count: 5})
+	need = []traced{{"Name", 3, 3}, {"Flag", 8, 1}, {"Count", 11, 4}}
+	check(enc, false)
+}
+
+type hookedItem struct {
+	Name  string
+	Upper string //derived from Name
+	Count uint8
+}
+
+func (h *hookedItem) BeforeEncode() error {
+	if h.Count > 100 {
+		return fmt.Errorf("hookedItem: count %d overflows", h.Count)
+	}
+	h.Upper = strings.ToUpper(h.Name)
+	return nil
+}
+
+func (h *hookedItem) AfterDecode() error {
+	if h.Upper != strings.ToUpper(h.Name) {
+		return fmt.Errorf("hookedItem: invalid upper %q", h.Upper)
+	}
+	return nil
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	x := []hookedItem{{Name: "abc"}, {Name: "hooks", Count: 3}}
+	b, err := Encode(x, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x[0].Upper != "ABC" || x[1].Upper != "HOOKS" || len(b) != Sizeof(x) {
+		t.Errorf("BeforeEncode got %+v, size %d need %d", x, len(b), Sizeof(x))
+	}
+	var got []hookedItem
+	if err := Decode(b, &got); err != nil || !reflect.DeepEqual(got, x) {
+		t.Errorf("Decode got %+v %v", got, err)
+	}
+
+	x[1].Count = 200
+	if _, err := Encode(x, nil); err == nil || !strings.Contains(err.Error(), "overflows") {
+		t.Errorf("Encode need error of BeforeEncode, got %v", err)
+	}
+	b, _ = Encode(struct {
+		Name, Upper string
+		Count       uint8
+	}{"abc", "abc", 0}, nil)
+	var h hookedItem
+	if err := Decode(b, &h); err == nil || !strings.Contains(err.Error(), "invalid upper") {
+		t.Errorf("Decode need error of AfterDecode, got %v", err)
+	}
+}
+
+type regCodecPoint struct {
+	X, Y int32
+}
+
+type regCodecShape struct {
+	Name   string
+	Points []regCodecPoint
+	Tail   uint8
+}
+
+func TestRegisterCodec(t *testing.T) {
+	err := RegisterCodec(regCodecPoint{},
+		func(encoder *Encoder, x interface{}) error {
+			p := x.(regCodecPoint)
+			encoder.Varint(int64(p.X))
+			encoder.Varint(int64(p.Y))
+			return nil
+		},
+		func(decoder *Decoder, x interface{}) error {
+			p := x.(*regCodecPoint)
+			x1, _ := decoder.Varint()
+			y1, _ := decoder.Varint()
+			p.X, p.Y = int32(x1), int32(y1)
+			return nil
+		},
+		func(x interface{}) int {
+			p := x.(regCodecPoint)
+			return SizeofVarint(int64(p.X)) + SizeofVarint(int64(p.Y))
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := regCodecShape{Name: "s", Points: []regCodecPoint{{1, -1}, {100, 2}}, Tail: 9}
+	b, err := Encode(&s, nil)
+	if err != nil || len(b) != Sizeof(&s) || len(b) != 2+1+2+3+1 {
+		t.Fatalf("Encode with RegisterCodec got % x %v", b, err)
+	}
+	var got regCodecShape
+	if err := Decode(b, &got); err != nil || !reflect.DeepEqual(got, s) {
+		t.Errorf("Decode with RegisterCodec got %+v %v", got, err)
+	}
+	got = regCodecShape{}
+	if err := DecodeFields(b, &got, "Tail"); err != nil || got.Tail != 9 {
+		t.Errorf("DecodeFields skip RegisterCodec got %+v %v", got, err)
+	}
+
+	if err := RegisterCodec(0, nil, nil, nil); err == nil {
+		t.Error("RegisterCodec need error of unnamed type")
+	}
+	if err := RegisterCodec((*regCodecPoint)(nil), nil, nil, nil); err == nil {
+		t.Error("RegisterCodec need error of nil functions")
+	}
+
+	//panics of user codecs which are not errors
+	err = RegisterCodec(regCodecBoom{},
+		func(encoder *Encoder, x interface{}) error { panic("boom") },
+		func(decoder *Decoder, x interface{}) error { panic("boom") },
+		func(x interface{}) int { return 1 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Encode(regCodecBoom{}, make([]byte, 8)); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Encode with panic of codec got %v", err)
+	}
+	if _, err := EncodeSlice([]regCodecBoom{{}}, make([]byte, 8)); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("EncodeSlice with panic of codec got %v", err)
+	}
+	var boom regCodecBoom
+	if err := Decode([]byte{1}, &boom); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Decode with panic of codec got %v", err)
+	}
+	if err := CodecFor[regCodecBoom]().Decode([]byte{1}, &boom); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Codec.Decode with panic of codec got %v", err)
+	}
+}
+
+type regCodecBoom struct {
+	X int8
+}
+
+type overridePoint struct {
+	X, Y int32
+}
+
+type overrideEvent struct {
+	At     time.Time
+	Times  []time.Time
+	Point  overridePoint
+	Points []overridePoint
+}
+
+func TestCodecsOverride(t *testing.T) {
+	RegStruct((*overrideEvent)(nil))
+	cs := NewCodecs()
+	err := cs.Override(time.Time{},
+		func(encoder *Encoder, x interface{}) error {
+			encoder.Uint32(uint32(x.(time.Time).Unix()), false)
+			return nil
+		},
+		func(decoder *Decoder, x interface{}) error {
+			*x.(*time.Time) = time.Unix(int64(decoder.Uint32(false)), 0).UTC()
+			return nil
+		},
+		func(x interface{}) int { return 4 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cs.Override((*overridePoint)(nil),
+		func(encoder *Encoder, x interface{}) error {
+			p := x.(overridePoint)
+			encoder.Int16(int16(p.X), false)
+			encoder.Int16(int16(p.Y), false)
+			return nil
+		},
+		func(decoder *Decoder, x interface{}) error {
+			p := x.(*overridePoint)
+			p.X, p.Y = int32(decoder.Int16(false)), int32(decoder.Int16(false))
+			return nil
+		},
+		func(x interface{}) int { return 4 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Override(0, nil, nil, nil); err == nil {
+		t.Error("Codecs.Override need error of unsupported type")
+	}
+
+	at := time.Unix(1700000000, 0).UTC()
+	x := overrideEvent{At: at, Times: []time.Time{at, at.Add(time.Hour)}, Point: overridePoint{1, 2},
+		Points: []overridePoint{{3, 4}}}
+	size := cs.Sizeof(&x)
+	if size != 4+1+8+4+1+4 {
+		t.Errorf("Codecs.Sizeof got %d", size)
+	}
+	encoder := NewEncoder(size)
+	encoder.SetCodecs(cs)
+	if err := encoder.Value(&x); err != nil || encoder.Len() != size {
+		t.Fatalf("Encoder with Codecs got %d %v", encoder.Len(), err)
+	}
+	var got overrideEvent
+	decoder := NewDecoder(encoder.Buffer())
+	decoder.SetCodecs(cs)
+	if err := decoder.Value(&got); err != nil || !reflect.DeepEqual(got, x) {
+		t.Errorf("Decoder with Codecs got %+v %v", got, err)
+	}
+	if n, err := decoder.SkipValue(reflect.TypeOf(x)); err == nil || n != 0 {
+		t.Errorf("Decoder.SkipValue need error of end, got %d", n)
+	}
+	decoder = NewDecoder(encoder.Buffer())
+	decoder.SetCodecs(cs)
+	if n, err := decoder.SkipValue(reflect.TypeOf(x)); err != nil || n != size {
+		t.Errorf("Decoder.SkipValue with Codecs got %d %v", n, err)
+	}
+
+	encoder = NewEncoder(size)
+	encoder.SetCodecs(cs)
+	if err := encoder.Value(at); err != nil || encoder.Len() != 4 {
+		t.Errorf("Encoder with Codecs of top-level time got %d %v", encoder.Len(), err)
+	}
+	if b, _ := Encode(&x, nil); len(b) == size || Sizeof(&x) != len(b) {
+		t.Errorf("Encode without Codecs got %d bytes", len(b))
+	}
+}
+
+func TestEncoderResetBuffer(t *testing.T) {
+	item := genericItem{ID: 5, Name: "pool", On: true, Tags: []string{"a"}}
+	need, _ := Encode(&item, nil)
+	encoder := NewEncoder(0)
+	encoder.SetDeterministic(true)
+	for i := 0; i < 2; i++ {
+		buf := bytes.Repeat([]byte{0xFF}, 64) //dirty pooled buffer
+		encoder.ResetBuffer(buf)
+		if err := encoder.Value(&item); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:encoder.Len()], need) || &encoder.Buffer()[0] != &buf[0] {
+			t.Errorf("Encoder.ResetBuffer got % x need % x", buf[:encoder.Len()], need)
+		}
+	}
+	encoder.ResetBuffer(make([]byte, 3))
+	if err := encoder.Value(&item); err == nil {
+		t.Error("Encoder.ResetBuffer need error of short buffer")
+	}
+}
+
+func TestAppendValue(t *testing.T) {
+	item := genericItem{ID: 1, Name: "append", On: true}
+	prefix := []byte{0xAA, 0xBB}
+	b, err := AppendValue(prefix[:2:2], &item)
+	need, _ := Encode(&item, nil)
+	if err != nil || !bytes.Equal(b, append([]byte{0xAA, 0xBB}, need...)) {
+		t.Errorf("AppendValue got % x %v", b, err)
+	}
+	buf := make([]byte, 1, 64)
+	if b, _ := AppendValue(buf, &item); &b[0] != &buf[0] || len(b) != 1+len(need) {
+		t.Error("AppendValue need appending in place of capacity")
+	}
+	if _, err := AppendValue(nil, make(chan int)); err == nil {
+		t.Error("AppendValue need error of invalid value")
+	}
+
+	b = AppendBool(nil, true)
+	b = AppendInt8(b, -1)
+	b = AppendUint16(b, 0x0102)
+	b = AppendInt32(b, -2)
+	b = AppendUint64(b, 3)
+	b = AppendFloat32(b, 1.5)
+	b = AppendFloat64(b, -2.5)
+	b = AppendInt(b, -300)
+	b = AppendUint(b, 300)
+	b = AppendString(b, "str")
+	b = AppendBytes(b, []byte{9})
+	type appended struct {
+		A bool
+		B int8
+		C uint16
+		D int32
+		E uint64
+		F float32
+		G float64
+		H int
+		I uint
+		J string
+		K []byte
+	}
+	need, _ = Encode(&appended{true, -1, 0x0102, -2, 3, 1.5, -2.5, -300, 300, "str", []byte{9}}, nil)
+	if !bytes.Equal(b, need) {
+		t.Errorf("Append functions got % x need % x", b, need)
+	}
+}
+
+func TestDecoderResetBuffer(t *testing.T) {
+	items := []genericItem{{ID: 1, Name: "a", On: true}, {ID: 2, Tags: []string{"b"}}}
+	decoder := NewDecoder(nil)
+	decoder.SetStrict(true)
+	for _, item := range items {
+		b, _ := Encode(&item, nil)
+		decoder.ResetBuffer(b)
+		var got genericItem
+		if err := decoder.Value(&got); err != nil || !reflect.DeepEqual(got, item) {
+			t.Errorf("Decoder.ResetBuffer got %+v %v", got, err)
+		}
+		decoder.ResetBuffer(append(b, 0))
+		if err := decoder.Value(&got); err != ErrTrailingBytes {
+			t.Errorf("Decoder.ResetBuffer need keeping strict option, got %v", err)
+		}
+	}
+
+	encoder := NewEncoderEndian(4, BigEndian)
+	encoder.Uint32(0x01020304, false)
+	decoder.ResetWithEndian(encoder.Buffer(), BigEndian)
+	if x := decoder.Uint32(false); x != 0x01020304 {
+		t.Errorf("Decoder.ResetWithEndian got %#x", x)
+	}
+}
+
+type pathOrder struct {
+	ID    uint32
+	Items []pathItem
+}
+
+type pathItem struct {
+	Name  string
+	Price int32
+}
+
+// decodeCause returns the underlying error of DecodeError.
+func decodeCause(err error) error {
+	if e, ok := err.(*DecodeError); ok {
+		return e.Err
+	}
+	return err
+}
+
+func TestDecodeError(t *testing.T) {
+	order := pathOrder{ID: 1}
+	for i := 0; i < 5; i++ {
+		order.Items = append(order.Items, pathItem{Name: "ab", Price: int32(i)})
+	}
+	b, _ := Encode(&order, nil)
+	var got pathOrder
+	err := Decode(b[:31], &got) //truncated in Items[3].Price
+	e, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("DecodeError got %T %v", err, err)
+	}
+	if e.Path != "pathOrder.Items[3].Price" || e.Offset != 29 || e.Type != reflect.TypeOf(int32(0)) || e.Err == nil {
+		t.Errorf("DecodeError got %s %d %v %v", e.Path, e.Offset, e.Type, e.Err)
+	}
+	if want := e.Err.Error() + " (pathOrder.Items[3].Price at offset 29)"; e.Error() != want {
+		t.Errorf("DecodeError got %q need %q", e.Error(), want)
+	}
+
+	order.Items[2].Name = "abcdef"
+	b, _ = Encode(&order, nil)
+	decoder := NewDecoder(b)
+	decoder.SetMaxLen(5)
+	if err := decoder.Value(&got); err == nil || err.(*DecodeError).Path != "pathOrder.Items[2].Name" {
+		t.Errorf("DecodeError got %v", err)
+	}
+	if err := Decode(b[:2], new(uint32)); err == nil {
+		t.Errorf("DecodeError need error")
+	} else if _, ok := err.(*DecodeError); ok {
+		t.Errorf("DecodeError need no path of top level value, got %v", err)
+	}
+	if err := Read(bytes.NewReader(b[:31]), DefaultEndian, &got); err != io.ErrUnexpectedEOF {
+		t.Errorf("DecodeError need io.ErrUnexpectedEOF from reader, got %v", err)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	order := pathOrder{ID: 1, Items: []pathItem{{"ab", 1}, {"abcdef", 2}}}
+	b, _ := Encode(&order, nil)
+	var got pathOrder
+	if err := Decode(b[:10], &got); !errors.Is(err, ErrTruncated) {
+		t.Errorf("need ErrTruncated, got %v", err)
+	}
+	if err := Read(bytes.NewReader(b[:10]), DefaultEndian, &got); !errors.Is(err, ErrTruncated) {
+		t.Errorf("need ErrTruncated from reader, got %v", err)
+	}
+	var de *DecodeError
+	if err := Decode(b[:10], &got); !errors.As(err, &de) || de.Path != "pathOrder.Items[0].Price" {
+		t.Errorf("need DecodeError, got %v", err)
+	}
+
+	decoder := NewDecoder(b)
+	decoder.SetMaxLen(5)
+	if err := decoder.Value(&got); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("need ErrLimitExceeded, got %v", err)
+	}
+	if err := Decode([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, new(uint64)); err != nil {
+		t.Errorf("need no error of uint64, got %v", err)
+	}
+	var v struct{ A []int8 }
+	if err := Decode([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}, &v); !errors.Is(err, ErrOverflow) {
+		t.Errorf("need ErrOverflow, got %v", err)
+	}
+	if _, err := ReadUvarint(bytes.NewReader([]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x2})); !errors.Is(err, ErrOverflow) {
+		t.Errorf("need ErrOverflow from ReadUvarint, got %v", err)
+	}
+	if _, err := Encode(make(chan int), nil); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("need ErrUnsupportedType, got %v", err)
+	}
+	if err := Decode(b, new(func())); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("need ErrUnsupportedType of decoding, got %v", err)
+	}
+	if err := NewEncoderBuffer(make([]byte, 2)).Value(uint32(1)); !errors.Is(err, ErrNotEnoughSpace) {
+		t.Errorf("need ErrNotEnoughSpace, got %v", err)
+	}
+	if _, err := VerifyChecksum([]byte{1, 2}, CRC32); !errors.Is(err, ErrChecksum) {
+		t.Errorf("need ErrChecksum, got %v", err)
+	}
+}
+
+func TestVarintOverflow(t *testing.T) {
+	long := bytes.Repeat([]byte{0x80}, 20)
+	for _, b := range [][]byte{
+		append(bytes.Repeat([]byte{0xff}, 9), 0x02),    //over 64 bits
+		append(bytes.Repeat([]byte{0x80}, 10), 0x00),   //non-terminating in 10 bytes
+		append(append([]byte{}, long...), 0x01),        //long continuation
+		append(bytes.Repeat([]byte{0xff}, 9), 0x7f, 0), //malformed last byte
+	} {
+		if x, n := Uvarint(b); x != 0 || n >= 0 {
+			t.Errorf("Uvarint % x got %d %d", b, x, n)
+		}
+		if _, err := ReadUvarint(bytes.NewReader(b)); !errors.Is(err, ErrOverflow) {
+			t.Errorf("ReadUvarint % x got %v", b, err)
+		}
+		decoder := NewDecoder(b)
+		var x uint64
+		if err := decoder.Value(&x); err != nil { //fixed size
+			t.Errorf("Decoder uint64 % x got %v", b, err)
+		}
+		var s []byte
+		if err := Decode(b, &s); !errors.Is(err, ErrOverflow) {
+			t.Errorf("Decoder length % x got %v", b, err)
+		}
+	}
+	if _, err := ReadUvarint(bytes.NewReader(long)); !errors.Is(err, ErrOverflow) {
+		t.Errorf("ReadUvarint need stop reading after %d bytes, got %v", MaxVarintLen64, err)
+	}
+	if x, n := Uvarint(append(bytes.Repeat([]byte{0xff}, 9), 0x01)); x != math.MaxUint64 || n != MaxVarintLen64 {
+		t.Errorf("Uvarint max got %d %d", x, n)
+	}
+	if x, n := Uvarint([]byte{0x80, 0x80}); x != 0 || n != 0 {
+		t.Errorf("Uvarint truncated got %d %d", x, n)
+	}
+}
+
+func TestUTF8Mode(t *testing.T) {
+	type text struct {
+		A string
+		B []string
+	}
+	data := text{A: "ok", B: []string{"中文", "a\xffb\xfe"}}
+	b, _ := Encode(&data, nil)
+	var got text
+	if err := Decode(b, &got); err != nil || !reflect.DeepEqual(got, data) {
+		t.Errorf("UTF8Unchecked got %q %v", got, err)
+	}
+	decoder := NewDecoder(b)
+	decoder.SetUTF8Mode(UTF8Error)
+	if err := decoder.Value(&got); !errors.Is(err, ErrInvalidUTF8) || !strings.Contains(err.Error(), "text.B[1]") {
+		t.Errorf("UTF8Error got %v", err)
+	}
+	decoder = NewDecoder(b)
+	decoder.SetUTF8Mode(UTF8Replace)
+	decoder.SetZeroCopy(true)
+	if err := decoder.Value(&got); err != nil || got.B[0] != "中文" || got.B[1] != "a�b�" {
+		t.Errorf("UTF8Replace got %q %v", got, err)
+	}
+
+	s, _ := Encode("\xc0\xaf", nil)
+	decoder = NewDecoder(s)
+	decoder.SetUTF8Mode(UTF8Error)
+	var str string
+	if err := decoder.Value(&str); err != ErrInvalidUTF8 {
+		t.Errorf("UTF8Error of string got %v", err)
+	}
+
+	encoder := NewEncoder(16)
+	encoder.SetMsgpack(true)
+	encoder.Value("x\xff")
+	decoder = NewDecoder(encoder.Buffer())
+	decoder.SetMsgpack(true)
+	decoder.SetUTF8Mode(UTF8Replace)
+	if err := decoder.Value(&str); err != nil || str != "x�" {
+		t.Errorf("UTF8Replace of MessagePack got %q %v", str, err)
+	}
+}
+
+type runesText struct {
+	A []rune  `binary:"runes"`
+	B [3]rune `binary:"runes"`
+	C []int32
+	D []rune `binary:"runes,nilable"`
+	E uint8
+}
+
+type runesShort struct {
+	A [2]rune `binary:"runes"`
+}
+
+func TestRunes(t *testing.T) {
+	RegStruct((*runesText)(nil))
+	RegStruct((*runesShort)(nil))
+	data := runesText{A: []rune("héllo, 世界"), B: [3]rune{'a', 'ü'}, C: []int32{1, 2}, E: 7}
+	b, err := Encode(&data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	need := append([]byte{byte(len("héllo, 世界"))}, "héllo, 世界"...)
+	need = append(need, 4, 'a', 0xc3, 0xbc, 0)
+	if !bytes.HasPrefix(b, need) || len(b) != Sizeof(&data) {
+		t.Errorf("Runes got % x need prefix % x, size %d", b, need, Sizeof(&data))
+	}
+	var got runesText
+	if err := Decode(b, &got); err != nil || !reflect.DeepEqual(got, data) {
+		t.Errorf("Runes got %+v %v\nneed %+v", got, err, data)
+	}
+
+	decoder := NewDecoder(b)
+	if n, err := decoder.SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("Runes skip got %d %v need %d", n, err, len(b))
+	}
+	var short runesShort
+	if err := Decode(b[:need[0]+1], &short); err != nil || short.A != [2]rune{'h', 'é'} {
+		t.Errorf("Runes of short array got %q %v", short.A, err)
+	}
+	invalid := runesText{A: []rune{0xd800, 'x'}}
+	b, _ = Encode(&invalid, nil)
+	if err := Decode(b, &got); err != nil || string(got.A) != "�x" {
+		t.Errorf("Runes of invalid rune got %q %v", got.A, err)
+	}
+}
+
+func TestFixedArrays(t *testing.T) {
+	type fixed struct {
+		A [3]uint16
+		B [2]bool
+		C [2]string
+		D []uint8
+		E [0]int32
+		F [2][2]int8
+	}
+	data := fixed{A: [3]uint16{1, 2, 3}, B: [2]bool{true, false}, C: [2]string{"a", "bc"}, D: []uint8{9}, F: [2][2]int8{{1, 2}, {3, 4}}}
+	encoder := NewEncoder(Sizeof(&data))
+	encoder.SetFixedArrays(true)
+	if err := encoder.Value(&data); err != nil {
+		t.Fatal(err)
+	}
+	b := encoder.Buffer()
+	need := []byte{1, 0, 2, 0, 3, 0, 0x1, 1, 'a', 2, 'b', 'c', 1, 9, 1, 2, 3, 4}
+	if !bytes.Equal(b, need) {
+		t.Errorf("FixedArrays got % x\nneed % x", b, need)
+	}
+	var got fixed
+	decoder := NewDecoder(b)
+	decoder.SetFixedArrays(true)
+	decoder.SetStrict(true)
+	if err := decoder.Value(&got); err != nil || !reflect.DeepEqual(got, data) {
+		t.Errorf("FixedArrays got %+v %v\nneed %+v", got, err, data)
+	}
+	decoder = NewDecoder(b)
+	decoder.SetFixedArrays(true)
+	if n, err := decoder.SkipValue(reflect.TypeOf(data)); err != nil || n != len(b) {
+		t.Errorf("FixedArrays skip got %d %v need %d", n, err, len(b))
+	}
+	encoder.Reset()
+	if err := encoder.Value([2]uint32{1, 2}); err != nil || encoder.Len() != 8 {
+		t.Errorf("FixedArrays of top level array got % x %v", encoder.Buffer(), err)
+	}
+}
+
+type noLenPacket struct {
+	Kind    uint8
+	Payload []byte `binary:"nolen"`
+}
+
+type noLenRecords struct {
+	N     uint16
+	Names []string `binary:"nolen"`
+}
+
+type noLenText struct {
+	ID   uint8
+	Text string `binary:"nolen"`
+}
+
+func TestNoLen(t *testing.T) {
+	RegStruct((*noLenPacket)(nil))
+	RegStruct((*noLenRecords)(nil))
+	RegStruct((*noLenText)(nil))
+	for _, c := range []struct {
+		data, got interface{}
+		need      []byte
+	}{
+		{&noLenPacket{1, []byte{2, 3, 4}}, &noLenPacket{}, []byte{1, 2, 3, 4}},
+		{&noLenRecords{2, []string{"a", "bc"}}, &noLenRecords{}, []byte{2, 0, 1, 'a', 2, 'b', 'c'}},
+		{&noLenText{7, "hello"}, &noLenText{}, []byte{7, 'h', 'e', 'l', 'l', 'o'}},
+	} {
+		b, err := Encode(c.data, nil)
+		if err != nil || !bytes.Equal(b, c.need) || Sizeof(c.data) != len(b) {
+			t.Errorf("NoLen %T got % x %v need % x", c.data, b, err, c.need)
+		}
+		if err := Decode(b, c.got); err != nil || !reflect.DeepEqual(c.got, c.data) {
+			t.Errorf("NoLen %T got %+v %v need %+v", c.data, c.got, err, c.data)
+		}
+	}
+	var got noLenPacket
+	if err := Read(bytes.NewReader([]byte{1, 2}), DefaultEndian, &got); err == nil {
+		t.Errorf("NoLen need error from reader")
+	}
+	type badNoLen struct {
+		M map[int]int `binary:"nolen"`
+	}
+	if err := RegStruct((*badNoLen)(nil)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("NoLen of map need error, got %v", err)
+	}
+}
+
+func TestStdLayout(t *testing.T) {
+	type header struct {
+		Magic uint32
+		On    bool
+		_     [3]byte
+		Ver   int16
+		Ratio float32
+		C     complex64
+		Pairs [2][2]uint8
+	}
+	data := header{Magic: 0xcafebabe, On: true, Ver: -2, Ratio: 1.5, C: complex(1, -1), Pairs: [2][2]uint8{{1, 2}, {3, 4}}}
+	for _, endian := range []Endian{LittleEndian, BigEndian} {
+		var order stdbinary.ByteOrder = stdbinary.LittleEndian
+		if endian == Endian(BigEndian) {
+			order = stdbinary.BigEndian
+		}
+		var need, got bytes.Buffer
+		stdbinary.Write(&need, order, &data)
+		if err := WriteStd(&got, endian, &data); err != nil || !bytes.Equal(got.Bytes(), need.Bytes()) {
+			t.Errorf("WriteStd %s got % x %v\nneed % x", endian, got.Bytes(), err, need.Bytes())
+		}
+		if SizeofStd(&data) != stdbinary.Size(&data) || SizeofStd([]int32{1, 2}) != 8 || SizeofStd([]int{1}) != -1 {
+			t.Errorf("SizeofStd got %d need %d", SizeofStd(&data), stdbinary.Size(&data))
+		}
+		var decoded header
+		if err := ReadStd(bytes.NewReader(need.Bytes()), endian, &decoded); err != nil || decoded != data {
+			t.Errorf("ReadStd %s got %+v %v", endian, decoded, err)
+		}
+		s := make([]uint16, 3)
+		need.Reset()
+		stdbinary.Write(&need, order, []uint16{1, 2, 3})
+		decoder := NewDecoderEndian(need.Bytes(), endian)
+		decoder.SetStdLayout(true)
+		if err := decoder.Value(s); err != nil || !reflect.DeepEqual(s, []uint16{1, 2, 3}) {
+			t.Errorf("Decoder.SetStdLayout of slice got %v %v", s, err)
+		}
+	}
+	var decoded header
+	if err := ReadStd(bytes.NewReader(nil), LittleEndian, &decoded); err != io.EOF {
+		t.Errorf("ReadStd need io.EOF, got %v", err)
+	}
+	if err := ReadStd(bytes.NewReader([]byte{1}), LittleEndian, &decoded); err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadStd need io.ErrUnexpectedEOF, got %v", err)
+	}
+	if err := WriteStd(io.Discard, LittleEndian, "str"); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("WriteStd need ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestEndianMarker(t *testing.T) {
+	x := uint16(0x0102)
+	if b := (*[2]byte)(unsafe.Pointer(&x)); NativeEndian.Uint16(b[:]) != x {
+		t.Errorf("NativeEndian %s got %#x", NativeEndian, NativeEndian.Uint16(b[:]))
+	}
+	data := []uint32{1, 0x01020304}
+	for _, endian := range []Endian{NativeEndian, LittleEndian, BigEndian} {
+		var w bytes.Buffer
+		if err := WriteMessageEndian(&w, endian, data); err != nil {
+			t.Fatal(err)
+		}
+		b := w.Bytes()
+		payload, _ := Encode(data, nil)
+		if endian == Endian(BigEndian) {
+			payload = []byte{2, 0, 0, 0, 1, 1, 2, 3, 4}
+		}
+		if need := append([]byte{byte(1 + len(payload)), EndianMarker(endian)}, payload...); !bytes.Equal(b, need) {
+			t.Errorf("WriteMessageEndian %s got % x need % x", endian, b, need)
+		}
+		var got []uint32
+		if e, err := ReadMessageEndian(&w, &got); err != nil || e != endian || !reflect.DeepEqual(got, data) {
+			t.Errorf("ReadMessageEndian got %v %v %v", got, e, err)
+		}
+	}
+	if _, err := MarkerEndian('x'); err == nil {
+		t.Errorf("MarkerEndian need error")
+	}
+	if _, err := ReadMessageEndian(bytes.NewReader([]byte{1, 'x'}), new(uint8)); err == nil {
+		t.Errorf("ReadMessageEndian need error of invalid marker")
+	}
+}
+
+func TestBitStream(t *testing.T) {
+	encoder := NewEncoder(4)
+	encoder.WriteBits(5, 3)
+	encoder.WriteBits(0x1ff, 9)
+	encoder.AlignBits()
+	encoder.WriteBits(1, 1)
+	encoder.WriteBits(0, 0)
+	b := encoder.Buffer()
+	if need := []byte{0xfd, 0x0f, 0x01}; !bytes.Equal(b[:encoder.Len()], need) {
+		t.Errorf("WriteBits got % x need % x", b[:encoder.Len()], need)
+	}
+
+	decoder := NewDecoder(b)
+	if x := decoder.ReadBits(3); x != 5 {
+		t.Errorf("ReadBits got %d need 5", x)
+	}
+	if x := decoder.ReadBits(9); x != 0x1ff {
+		t.Errorf("ReadBits got %#x need 0x1ff", x)
+	}
+	decoder.AlignBits()
+	if x := decoder.ReadBits(1); x != 1 {
+		t.Errorf("ReadBits got %d need 1", x)
+	}
+
+	x := uint64(0x0123456789abcdef)
+	encoder = NewEncoder(9)
+	encoder.WriteBits(1, 1)
+	encoder.WriteBits(x, 64)
+	decoder = NewDecoder(encoder.Buffer())
+	if y, z := decoder.ReadBits(1), decoder.ReadBits(64); y != 1 || z != x {
+		t.Errorf("ReadBits got %d %#x need 1 %#x", y, z, x)
+	}
+
+	encoder = NewEncoder(2) //bits share bytes with bools and Bits in one order
+	encoder.Bool(true)
+	encoder.WriteBits(0x1a, 5)
+	encoder.Bits(3, 2)
+	encoder.WriteBits(0xf, 4)
+	if b := encoder.Buffer(); !bytes.Equal(b, []byte{0xf5, 0x0f}) {
+		t.Errorf("WriteBits with bools got % x need f5 0f", b)
+	}
+	decoder = NewDecoder(encoder.Buffer())
+	if y, z, w := decoder.Bool(), decoder.Bits(5), decoder.ReadBits(2); !y || z != 0x1a || w != 3 {
+		t.Errorf("ReadBits with bools got %v %#x %d", y, z, w)
+	}
+	if x := decoder.ReadBits(4); x != 0xf {
+		t.Errorf("ReadBits got %#x need 0xf", x)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("WriteBits need panic of invalid bits number")
+		}
+	}()
+	encoder.WriteBits(0, 65)
+}
+
+type int128Key struct {
+	Addr  Uint128
+	Delta Int128  `binary:"packed"`
+	Hash  Uint128 `binary:"big"`
+}
+
+func TestInt128(t *testing.T) {
+	us := []Uint128{{}, {Lo: 0x7f}, {Lo: 0x80}, {Lo: ^uint64(0)}, {Hi: 1}, {Hi: ^uint64(0), Lo: ^uint64(0)}}
+	is := []Int128{{}, {Hi: -1, Lo: ^uint64(0)}, {Hi: 0, Lo: 1 << 63}, {Hi: -1 << 63}, {Hi: 1<<63 - 1, Lo: ^uint64(0)}}
+	for _, endian := range []Endian{LittleEndian, BigEndian} {
+		for _, packed := range []bool{false, true} {
+			encoder := NewEncoderEndian(MaxVarintLen128*2, endian)
+			for _, x := range us {
+				encoder.Uint128(x, packed)
+				decoder := NewDecoderEndian(encoder.Buffer(), endian)
+				if y := decoder.Uint128(packed); y != x {
+					t.Errorf("Uint128 %s %v got %v need %v", endian, packed, y, x)
+				}
+				if packed && encoder.Len() != SizeofUvarint128(x) {
+					t.Errorf("SizeofUvarint128 %v got %d need %d", x, SizeofUvarint128(x), encoder.Len())
+				}
+				encoder.Reset()
+			}
+			for _, x := range is {
+				encoder.Int128(x, packed)
+				decoder := NewDecoderEndian(encoder.Buffer(), endian)
+				if y := decoder.Int128(packed); y != x {
+					t.Errorf("Int128 %s %v got %v need %v", endian, packed, y, x)
+				}
+				encoder.Reset()
+			}
+		}
+	}
+
+	encoder := NewEncoderEndian(16, BigEndian)
+	encoder.Uint128(Uint128{Hi: 0x0102030405060708, Lo: 0x090a0b0c0d0e0f10}, false)
+	if b := encoder.Buffer(); b[0] != 1 || b[15] != 0x10 {
+		t.Errorf("Uint128 BigEndian got % x", b)
+	}
+	if b, _ := Encode(Int128{Hi: -1, Lo: ^uint64(0)}, nil); len(b) != 16 || b[0] != 0xff {
+		t.Errorf("Encode Int128 got % x", b)
+	}
+
+	RegStruct((*int128Key)(nil))
+	k := int128Key{Addr: Uint128{Hi: 0x20010db8 << 32, Lo: 1}, Delta: Int128{Hi: -1, Lo: ^uint64(1)}, Hash: Uint128{Hi: 3, Lo: 4}}
+	b, err := Encode(&k, nil)
+	if err != nil || len(b) != 16+1+16 || len(b) != Sizeof(&k) {
+		t.Fatalf("Encode int128Key got % x %v", b, err)
+	}
+	if b[17] != 0 || b[24] != 3 {
+		t.Errorf("Encode int128Key big Hash got % x", b[17:])
+	}
+	var got int128Key
+	if err := Decode(b, &got); err != nil || got != k {
+		t.Errorf("Decode int128Key got %v %v need %v", got, err, k)
+	}
+
+	over := bytes.Repeat([]byte{0xff}, MaxVarintLen128)
+	if err := NewDecoder(over).Value(new(int128Key)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Decode int128Key need ErrTruncated got %v", err)
+	}
+	over = append(bytes.Repeat([]byte{0}, 16), over...)
+	if err := Decode(over, new(int128Key)); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Decode int128Key need ErrOverflow got %v", err)
+	}
+}
+
+type decimalPrice struct {
+	Price Decimal
+	Qty   uint32
+}
+
+func TestDecimal(t *testing.T) {
+	cases := []struct {
+		s    string
+		d    Decimal
+		text string
+	}{
+		{"123.45", Decimal{12345, 2}, "123.45"},
+		{"-0.05", Decimal{-5, 2}, "-0.05"},
+		{"+7", Decimal{7, 0}, "7"},
+		{".5", Decimal{5, 1}, "0.5"},
+		{"10.", Decimal{10, 0}, "10"},
+		{"0.000", Decimal{0, 3}, "0.000"},
+	}
+	for _, c := range cases {
+		d, err := ParseDecimal(c.s)
+		if err != nil || d != c.d || d.String() != c.text {
+			t.Errorf("ParseDecimal %q got %v %s %v need %v %s", c.s, d, d.String(), err, c.d, c.text)
+		}
+	}
+	if s := (Decimal{Mantissa: -12, Scale: -2}).String(); s != "-1200" {
+		t.Errorf("Decimal.String got %s need -1200", s)
+	}
+	for _, s := range []string{"", "-", ".", "1.2.3", "+-1", "1e3", "12a"} {
+		if _, err := ParseDecimal(s); err == nil {
+			t.Errorf("ParseDecimal %q need error", s)
+		}
+	}
+	if _, err := ParseDecimal("99999999999999999999.9"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("ParseDecimal need ErrOverflow got %v", err)
+	}
+
+	RegStruct((*decimalPrice)(nil))
+	p := decimalPrice{Price: Decimal{Mantissa: 1999, Scale: 2}, Qty: 3}
+	b, err := Encode(&p, nil)
+	if need := []byte{4, 0x9e, 0x1f, 3, 0, 0, 0}; err != nil || !bytes.Equal(b, need) || Sizeof(&p) != len(b) {
+		t.Errorf("Encode decimalPrice got % x %v need % x", b, err, need)
+	}
+	var got decimalPrice
+	if err := Decode(b, &got); err != nil || got != p {
+		t.Errorf("Decode decimalPrice got %v %v need %v", got, err, p)
+	}
+	if err := Decode([]byte{0x80, 0x80, 0x80, 0x80, 0x10, 0}, new(Decimal)); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Decode Decimal need ErrOverflow got %v", err)
+	}
+}
+
+type mapKey struct {
+	X, Y int16
+}
+
+type mapEntry struct {
+	Name string
+	Tags []string
+}
+
+type mapHolder struct {
+	M map[mapKey]mapEntry
+	S map[string]mapEntry
+	N map[mapKey]int32 `binary:"nilable"`
+}
+
+func TestStructKeyedMap(t *testing.T) {
+	RegStruct((*mapKey)(nil))
+	RegStruct((*mapEntry)(nil))
+	RegStruct((*mapHolder)(nil))
+	for i, f := range queryStruct(reflect.TypeOf(mapHolder{})).fields {
+		if f.encode == nil || f.decode == nil {
+			t.Errorf("map field %d of mapHolder is not compiled", i)
+		}
+	}
+
+	h := mapHolder{
+		M: map[mapKey]mapEntry{{1, 2}: {"a", []string{"x"}}, {-3, 4}: {"b", nil}, {0, 0}: {}},
+		S: map[string]mapEntry{"k": {"c", []string{"y", "z"}}},
+	}
+	encoder := NewEncoder(Sizeof(&h))
+	encoder.SetDeterministic(true)
+	if err := encoder.Value(&h); err != nil {
+		t.Fatal(err)
+	}
+	b := encoder.Buffer()
+	var got mapHolder
+	if err := Decode(b, &got); err != nil || !reflect.DeepEqual(got, h) {
+		t.Errorf("Decode mapHolder got %v %v need %v", got, err, h)
+	}
+
+	reflected := NewEncoder(Sizeof(h.M))
+	reflected.SetDeterministic(true)
+	if err := reflected.Value(h.M); err != nil {
+		t.Fatal(err)
+	}
+	if need := reflected.Buffer(); !bytes.Equal(b[:len(need)], need) {
+		t.Errorf("compiled map got % x need % x", b[:len(need)], need)
+	}
+
+	if err := Decode(b[:len(b)-1], &got); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Decode mapHolder need ErrTruncated got %v", err)
+	}
+}
+
+type valueSerializer uint16
+
+func (x *valueSerializer) Size() int { return 2 }
+func (x *valueSerializer) Encode(buffer []byte) ([]byte, error) {
+	b := append(buffer[:0], byte(*x>>8), byte(*x))
+	return b, nil
+}
+func (x *valueSerializer) Decode(buffer []byte) error {
+	*x = valueSerializer(buffer[0])<<8 | valueSerializer(buffer[1])
+	return nil
+}
+
+func TestEncodeValue(t *testing.T) {
+	s := mapEntry{Name: "row", Tags: []string{"a", "b"}}
+	v := reflect.ValueOf(&s).Elem()
+	b, err := EncodeValue(v, nil)
+	need, _ := Encode(&s, nil)
+	if err != nil || !bytes.Equal(b, need) || SizeofValue(v) != len(need) {
+		t.Errorf("EncodeValue got % x %v need % x", b, err, need)
+	}
+
+	var got mapEntry
+	if err := DecodeValue(b, reflect.ValueOf(&got).Elem()); err != nil || !reflect.DeepEqual(got, s) {
+		t.Errorf("DecodeValue got %v %v need %v", got, err, s)
+	}
+	got = mapEntry{}
+	if err := DecodeValue(b, reflect.ValueOf(&got)); err != nil || !reflect.DeepEqual(got, s) {
+		t.Errorf("DecodeValue pointer got %v %v need %v", got, err, s)
+	}
+	if err := DecodeValue(b, reflect.ValueOf(got)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("DecodeValue unaddressable need ErrUnsupportedType got %v", err)
+	}
+	if err := DecodeValue(b[:3], reflect.ValueOf(&got)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("DecodeValue need ErrTruncated got %v", err)
+	}
+
+	ser := valueSerializer(0x0102)
+	if b, err := EncodeValue(reflect.ValueOf(&ser), nil); err != nil || !bytes.Equal(b, []byte{1, 2}) {
+		t.Errorf("EncodeValue BinarySerializer got % x %v", b, err)
+	}
+	if err := DecodeValue([]byte{3, 4}, reflect.ValueOf(&ser).Elem()); err != nil || ser != 0x0304 {
+		t.Errorf("DecodeValue BinarySerializer got %#x %v", ser, err)
+	}
+	if _, err := EncodeValue(reflect.Value{}, nil); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("EncodeValue invalid need ErrUnsupportedType got %v", err)
+	}
+}
+
+func TestDecoderMore(t *testing.T) {
+	var w bytes.Buffer
+	items := []mapEntry{{"a", nil}, {"b", []string{"x"}}, {"", []string{"y", "z"}}}
+	for i := range items {
+		b, _ := Encode(&items[i], nil)
+		w.Write(b)
+	}
+	stream := w.Bytes()
+
+	decoders := map[string]*Decoder{
+		"buffer":   NewDecoder(stream),
+		"reader":   NewDecoderReader(iotest.OneByteReader(bytes.NewReader(stream)), DefaultEndian),
+		"readerat": NewDecoderAt(bytes.NewReader(stream), 0),
+	}
+	for name, decoder := range decoders {
+		var got []mapEntry
+		for decoder.More() {
+			var x mapEntry
+			if err := decoder.Decode(&x); err != nil {
+				t.Fatalf("%s Decode %v", name, err)
+			}
+			got = append(got, x)
+		}
+		if !reflect.DeepEqual(got, items) {
+			t.Errorf("%s Decode got %v need %v", name, got, items)
+		}
+		if err := decoder.Decode(new(mapEntry)); err != io.EOF {
+			t.Errorf("%s Decode need io.EOF got %v", name, err)
+		}
+	}
+
+	decoder := NewDecoderReader(bytes.NewReader(stream[:len(stream)-1]), DefaultEndian)
+	var err error
+	for decoder.More() && err == nil {
+		err = decoder.Decode(new(mapEntry))
+	}
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Decode truncated need io.ErrUnexpectedEOF got %v", err)
+	}
+}
+
+type tokenItem struct {
+	SKU   string
+	Price float64
+}
+
+type tokenOrder struct {
+	ID    int
+	Items []tokenItem
+	Tags  map[string]uint8
+	Note  *string
+	Any   interface{}
+	Data  []byte
+}
+
+func TestStreamTokens(t *testing.T) {
+	var w bytes.Buffer
+	enc := NewStreamEncoder(&w)
+	orders := []tokenOrder{
+		{ID: -7, Items: []tokenItem{{"a", 1.5}, {"b", 2}}, Tags: map[string]uint8{"x": 1}, Any: uint16(3), Data: []byte{9, 8}},
+		{ID: 8},
+	}
+	for i := range orders {
+		if err := enc.Encode(&orders[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Encode(42); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewStreamDecoder(bytes.NewReader(w.Bytes()))
+	next := func(need reflect.Kind) {
+		t.Helper()
+		if k, err := dec.NextKind(); err != nil || k != need {
+			t.Fatalf("NextKind got %s %v need %s", k, err, need)
+		}
+	}
+	read := func(need interface{}) {
+		t.Helper()
+		if x, err := dec.ReadPrimitive(); err != nil || !reflect.DeepEqual(x, need) {
+			t.Fatalf("ReadPrimitive got %#v %v need %#v", x, err, need)
+		}
+	}
+
+	next(reflect.Struct)
+	fields, err := dec.EnterStruct()
+	if need := []string{"ID", "Items", "Tags", "Note", "Any", "Data"}; err != nil || !reflect.DeepEqual(fields, need) {
+		t.Fatalf("EnterStruct got %v %v need %v", fields, err, need)
+	}
+	next(reflect.Int64)
+	read(int64(-7))
+	next(reflect.Slice)
+	if l, err := dec.ReadLength(); err != nil || l != 2 {
+		t.Fatalf("ReadLength got %d %v", l, err)
+	}
+	sum := 0.0
+	for i := 0; i < 2; i++ {
+		if _, err := dec.EnterStruct(); err != nil {
+			t.Fatal(err)
+		}
+		if err := dec.Skip(); err != nil { //SKU
+			t.Fatal(err)
+		}
+		x, _ := dec.ReadPrimitive()
+		sum += x.(float64)
+		if err := dec.Leave(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sum != 3.5 {
+		t.Errorf("sum of prices got %v need 3.5", sum)
+	}
+	if err := dec.Leave(); err != nil { //Items
+		t.Fatal(err)
+	}
+	next(reflect.Map)
+	if l, err := dec.ReadLength(); err != nil || l != 1 {
+		t.Fatalf("ReadLength of map got %d %v", l, err)
+	}
+	read("x")
+	read(uint64(1))
+	if err := dec.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	next(reflect.Invalid) //nil Note
+	read(nil)
+	next(reflect.Uint64) //Any
+	read(uint64(3))
+	next(reflect.Slice)
+	read([]byte{9, 8})
+	if _, err := dec.NextKind(); err == nil {
+		t.Errorf("NextKind need error at end of struct")
+	}
+	if _, err := dec.ReadPrimitive(); err == nil {
+		t.Errorf("ReadPrimitive need error at end of struct")
+	}
+	if err := dec.Leave(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dec.EnterStruct(); err != nil { //second order, left at once
+		t.Fatal(err)
+	}
+	if err := dec.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dec.ReadLength(); err == nil {
+		t.Errorf("ReadLength need error of int")
+	}
+	read(int64(42))
+	if _, err := dec.NextKind(); err != io.EOF {
+		t.Errorf("NextKind need io.EOF got %v", err)
+	}
+}
+
+type parallelPoint struct {
+	X, Y  float32
+	ID    uint64 `binary:"big"`
+	Color [3]uint8
+	N     int `binary:"fixed"`
+}
+
+type parallelFlag struct {
+	ID uint32
+	On bool
+}
+
+func TestParallel(t *testing.T) {
+	RegStruct((*parallelPoint)(nil))
+	RegStruct((*parallelFlag)(nil))
+	if s := NewEncoder(0).fixedEncodedSize(reflect.TypeOf(parallelPoint{}), nil); s != 4+4+8+1+3+8 {
+		t.Errorf("fixedEncodedSize got %d", s)
+	}
+	if s := NewEncoder(0).fixedEncodedSize(reflect.TypeOf(parallelFlag{}), nil); s != -1 {
+		t.Errorf("fixedEncodedSize of bools got %d need -1", s)
+	}
+
+	points := make([]parallelPoint, 10*parallelMinLen+7)
+	flags := make([]parallelFlag, len(points))
+	for i := range points {
+		points[i] = parallelPoint{float32(i), -float32(i), uint64(i) << 20, [3]uint8{uint8(i), 1, 2}, -i}
+		flags[i] = parallelFlag{uint32(i), i%3 == 0}
+	}
+	for _, data := range []interface{}{points, flags} {
+		need, err := Encode(data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, goroutines := range []int{2, 4, 64} {
+			encoder := NewEncoder(len(need))
+			encoder.SetParallel(goroutines)
+			if err := encoder.Value(data); err != nil || !bytes.Equal(encoder.Buffer(), need) {
+				t.Errorf("SetParallel(%d) %T got %d bytes %v need %d bytes", goroutines, data, encoder.Len(), err, len(need))
+			}
+		}
+	}
+
+	encoder := NewEncoder(100)
+	encoder.SetParallel(4)
+	if err := encoder.Value(points); !errors.Is(err, ErrNotEnoughSpace) {
+		t.Errorf("SetParallel need ErrNotEnoughSpace got %v", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	RegStruct((*parallelFlag)(nil))
+	flags := []parallelFlag{{1, true}, {2, false}, {300, true}}
+	b, err := EncodeBatch(flags, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var need []byte
+	for i := range flags {
+		e, _ := Encode(&flags[i], nil)
+		need = append(need, e...)
+	}
+	if !bytes.Equal(b, need) {
+		t.Errorf("EncodeBatch got % x need % x", b, need)
+	}
+	got, err := DecodeBatch(b, []parallelFlag{{9, false}})
+	if err != nil || !reflect.DeepEqual(got, append([]parallelFlag{{9, false}}, flags...)) {
+		t.Errorf("DecodeBatch got %v %v", got, err)
+	}
+
+	sers := []valueSerializer{1, 0x0203}
+	if b, err := EncodeBatch(sers, nil); err != nil || !bytes.Equal(b, []byte{0, 1, 2, 3}) {
+		t.Errorf("EncodeBatch BinarySerializer got % x %v", b, err)
+	}
+	if got, err := DecodeBatch[valueSerializer]([]byte{0, 1, 2, 3}, nil); err != nil || !reflect.DeepEqual(got, sers) {
+		t.Errorf("DecodeBatch BinarySerializer got %v %v", got, err)
+	}
+	if got, err := DecodeBatch[string]([]byte{1, 'a', 3, 'b'}, nil); !errors.Is(err, ErrTruncated) || len(got) != 1 || got[0] != "a" {
+		t.Errorf("DecodeBatch need ErrTruncated got %v %v", got, err)
+	}
+	if _, err := EncodeBatch([]chan int{nil}, nil); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("EncodeBatch need ErrUnsupportedType got %v", err)
+	}
+}
+
+type arenaPoint struct {
+	X, Y int32
+}
+
+type arenaRequest struct {
+	Name  string
+	Data  []byte
+	Nums  []int32
+	Point *arenaPoint
+	Tags  []string
+	Flags []bool
+}
+
+func TestArena(t *testing.T) {
+	RegStruct((*arenaPoint)(nil))
+	RegStruct((*arenaRequest)(nil))
+	req := arenaRequest{Name: "order", Data: []byte{1, 2, 3}, Nums: []int32{-1, 7}, Point: &arenaPoint{3, 4},
+		Tags: []string{"a", "b"}, Flags: []bool{true, false, true}}
+	b, err := Encode(&req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arena := NewArena(256)
+	inArena := func(p unsafe.Pointer) bool {
+		for _, c := range arena.chunks {
+			start := uintptr(unsafe.Pointer(&c[0]))
+			if u := uintptr(p); u >= start && u < start+uintptr(len(c)*8) {
+				return true
+			}
+		}
+		return false
+	}
+	decoder := NewDecoder(b)
+	decoder.SetArena(arena)
+	var got arenaRequest
+	if err := decoder.Value(&got); err != nil || !reflect.DeepEqual(got, req) {
+		t.Fatalf("Decode with arena got %v %v need %v", got, err, req)
+	}
+	if !inArena(unsafe.Pointer(unsafe.StringData(got.Name))) || !inArena(unsafe.Pointer(&got.Data[0])) ||
+		!inArena(unsafe.Pointer(&got.Nums[0])) || !inArena(unsafe.Pointer(got.Point)) || !inArena(unsafe.Pointer(&got.Flags[0])) {
+		t.Errorf("Decode with arena got values out of arena")
+	}
+	if inArena(unsafe.Pointer(&got.Tags[0])) || !inArena(unsafe.Pointer(unsafe.StringData(got.Tags[0]))) {
+		t.Errorf("Decode with arena got []string in arena or its strings out of arena")
+	}
+	if len(arena.chunks) != 1 {
+		t.Errorf("Decode with arena got %d chunks need 1", len(arena.chunks))
+	}
+
+	name := unsafe.StringData(got.Name)
+	arena.Reset()
+	decoder.ResetBuffer(b)
+	var again arenaRequest
+	if err := decoder.Value(&again); err != nil || !reflect.DeepEqual(again, req) || unsafe.StringData(again.Name) != name {
+		t.Errorf("Decode after Reset got %v %v, memory reused %v", again, err, unsafe.StringData(again.Name) == name)
+	}
+
+	large := bytes.Repeat([]byte{'x'}, 1000)
+	b, _ = Encode(large, nil)
+	decoder.ResetBuffer(b)
+	var gotLarge []byte
+	if err := decoder.Value(&gotLarge); err != nil || !bytes.Equal(gotLarge, large) || inArena(unsafe.Pointer(&gotLarge[0])) {
+		t.Errorf("Decode large bytes with arena got %d bytes %v", len(gotLarge), err)
+	}
+}
+
+func TestPooledBuffer(t *testing.T) {
+	pool := NewBufferPool()
+	encoder := NewEncoder(16)
+	encoder.SetBufferPool(pool)
+	encoder.Uint32(0x01020304, false)
+	b := encoder.TakeBuffer()
+	if got, want := b.Bytes(), []byte{4, 3, 2, 1}; string(got) != string(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if encoder.Len() != 0 || len(encoder.buff) != 16 {
+		t.Fatalf("encoder not reset: len %d, buffer %d", encoder.Len(), len(encoder.buff))
+	}
+	encoder.Bool(true)
+	if got := encoder.Buffer(); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("encode after TakeBuffer: %v", got)
+	}
+
+	b.Retain()
+	b.Release()
+	if b.Len() != 4 {
+		t.Fatalf("released with reference left")
+	}
+	b.Release()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expect panic of releasing released buffer")
+			}
+		}()
+		b.Release()
+	}()
+	if r := pool.Get(8); len(r.Bytes()) != 8 || r.Bytes()[0] != 0 {
+		t.Errorf("pooled buffer not zeroed: %v", r.Bytes())
+	}
+
+	data := []uint16{1, 2, 3}
+	p, err := EncodePooled(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	var got []uint16
+	if err := Decode(p.Bytes(), &got); err != nil || len(got) != 3 || got[2] != 3 {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := EncodePooled(make(chan int)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestGrowthPolicy(t *testing.T) {
+	type growthMessage struct {
+		ID    uint32
+		Flags []bool
+		Name  string
+		Data  []uint16
+	}
+	msg := growthMessage{ID: 7, Flags: []bool{true, false, true}, Name: "growth", Data: make([]uint16, 100)}
+	for i := range msg.Data {
+		msg.Data[i] = uint16(i)
+	}
+	want, err := Encode(msg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoder := NewEncoderBuffer(nil)
+	encoder.SetGrowth(&GrowthPolicy{InitialSize: 8, Factor: 1.5})
+	if err := encoder.Value(msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := encoder.Buffer(); !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+	if c := encoder.Cap(); c < len(want) || c > len(want)*3/2+1 {
+		t.Errorf("grown capacity %d for %d bytes", c, len(want))
+	}
+
+	encoder = NewEncoder(4)
+	encoder.SetGrowth(&GrowthPolicy{MaxSize: 32})
+	if err := encoder.Value(msg); !errors.Is(err, ErrNotEnoughSpace) {
+		t.Errorf("got error %v, want ErrNotEnoughSpace", err)
+	}
+
+	encoder = NewEncoder(4)
+	if err := encoder.Value(msg); !errors.Is(err, ErrNotEnoughSpace) {
+		t.Errorf("got error %v without growth policy", err)
+	}
+
+	groups := growthGroups{A: []uint32{1, 1 << 20, 300, 1 << 30, 5}, B: []int64{-1, 100, 1 << 40}, C: []bool{true, false, true}}
+	RegStruct((*growthGroups)(nil))
+	want, err = Encode(&groups, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder = NewEncoderBuffer(nil)
+	encoder.SetGrowth(&GrowthPolicy{InitialSize: 1, Factor: 2})
+	if err := encoder.Value(&groups); err != nil {
+		t.Fatal(err)
+	}
+	if got := encoder.Buffer(); !bytes.Equal(got, want) {
+		t.Errorf("group varints: got %x, want %x", got, want)
+	}
+}
+
+type growthGroups struct {
+	A []uint32 `binary:"groupvarint"`
+	B []int64  `binary:"delta"`
+	C []bool
+}
+
+type safeNode struct {
+	Flags [3]bool
+	Names []string
+	Attrs map[string]int32
+	Next  *safeNode
+	Any   interface{}
+}
+
+func TestSafeDecoder(t *testing.T) {
+	RegType(safeNode{})
+	v := safeNode{Flags: [3]bool{true}, Names: []string{"a", "bc"}, Attrs: map[string]int32{"x": 1},
+		Next: &safeNode{Names: []string{"d"}}, Any: safeNode{}}
+	b, err := Encode(&v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got safeNode
+	if err := SafeDecode(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if b2, _ := Encode(&got, nil); !bytes.Equal(b2, b) {
+		t.Fatalf("got %+v", got)
+	}
+
+	forged := AppendUvarint(nil, 1<<40) //length of Flags
+	if err := SafeDecode(forged, &got); !errors.Is(err, ErrTruncated) {
+		t.Errorf("forged length: got error %v, want ErrTruncated", err)
+	}
+	chain := &safeNode{}
+	for i := 0; i < SafeMaxDepth; i++ {
+		chain = &safeNode{Next: chain}
+	}
+	deep, err := Encode(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SafeDecode(deep, &got); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("deep data: got error %v, want ErrLimitExceeded", err)
+	}
+
+	huge := AppendUvarint(make([]byte, 0, 1024), 8000)[:1024] //8000 elements of 32KB in 1KB
+	var arrays [][4096]int64
+	if err := SafeDecode(huge, &arrays); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("forged allocation: got error %v, want ErrLimitExceeded", err)
+	}
+
+	for _, seed := range safeSeeds(t) {
+		safeMutate(t, seed, 5000)
+	}
+}
+
+type safeElem struct {
+	A int16
+	B bool
+	C string
+}
+
+type safeTagged struct {
+	_ struct{}    `binary:"tagged"`
+	A int         `binary:"id=1"`
+	B []bool      `binary:"id=2"`
+	C *safeTagged `binary:"id=3"`
+}
+
+type safeVersioned struct {
+	_ struct{} `binary:"version=2"`
+	A int
+	B []string
+}
+
+type safeRich struct {
+	A  []int          `binary:"nilable"`
+	B  map[int]string `binary:"nilable"`
+	C  []bool         `binary:"nilable,lenprefix=uint16"`
+	D  string         `binary:"lenprefix=uint8"`
+	E  []safeElem     `binary:"columnar"`
+	F  [2]safeElem    `binary:"columnar"`
+	G  []int64        `binary:"delta"`
+	H  []uint32       `binary:"groupvarint"`
+	I  []int32        `binary:"runes"`
+	J  float32        `binary:"float16"`
+	K  time.Time      `binary:"unixnano"`
+	L  int32          `binary:"zigzag"`
+	M  uint16         `binary:"bits=5"`
+	N  bool
+	O  int64    `binary:"nozigzag,packed"`
+	P  []uint16 `binary:"big,lenprefix=uint32"`
+	Q  map[safeElem]int8
+	R  *safeRich
+	S  [3]bool
+	T  [][]bool
+	U  []*safeElem
+	V  Uint128 `binary:"packed"`
+	W  Decimal
+	X  [2][]string
+	Y  []byte
+	Z  Option[int32]
+	AA interface{}
+	AB safeTagged
+	AC []safeVersioned
+}
+
+// safeSeeds returns encoded values of all kinds of fields for SafeDecoder.
+func safeSeeds(t testing.TB) [][]byte {
+	RegStruct((*safeRich)(nil))
+	RegType(safeElem{})
+	v := &safeRich{A: []int{1, 2}, B: map[int]string{3: "x"}, C: []bool{true, false, true}, D: "dd",
+		E: []safeElem{{1, true, "a"}}, F: [2]safeElem{{2, false, "b"}}, G: []int64{5, 3, 100}, H: []uint32{1, 1 << 20, 7},
+		I: []int32{'a', 'é'}, J: 1.5, K: time.Unix(4, 5), L: -3, M: 7, N: true, O: -1, P: []uint16{1},
+		Q: map[safeElem]int8{{3, true, "q"}: 1}, R: &safeRich{D: "inner", AC: []safeVersioned{{A: 1}}}, S: [3]bool{true},
+		T: [][]bool{{true}, nil}, U: []*safeElem{{4, true, "u"}, nil}, V: Uint128{1, 2}, W: Decimal{12345, 2},
+		X: [2][]string{{"x"}, {}}, Y: []byte{1, 2, 3}, Z: Some(int32(9)), AA: safeElem{5, false, "iface"},
+		AB: safeTagged{A: 1, B: []bool{true}, C: &safeTagged{A: 2}}, AC: []safeVersioned{{A: 3, B: []string{"v"}}}}
+	var seeds [][]byte
+	for _, x := range []interface{}{v, []safeElem{{1, true, "a"}, {}}, safeNode{Names: []string{"n"}, Next: &safeNode{}}} {
+		b, err := Encode(x, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds = append(seeds, b)
+	}
+	return seeds
+}
+
+// checkSafeDecode decode data to types of safeSeeds, which must report
+// malformed data by errors of decoding instead of panicking.
+func checkSafeDecode(t testing.TB, data []byte) {
+	for _, x := range []interface{}{new(safeRich), new([]safeElem), new(safeNode), new([][4096]int64)} {
+		decoder := NewSafeDecoder(data)
+		err := decoder.Value(x)
+		var re runtime.Error
+		if errors.As(err, &re) || err != nil && strings.Contains(err.Error(), "malformed data") {
+			t.Fatalf("decode %x to %T: panic %v", data, x, err)
+		}
+		if d := &decoder.decoder; d.allocated > d.maxAlloc {
+			t.Fatalf("decode %x to %T: allocated %d bytes, exceeds %d", data, x, d.allocated, d.maxAlloc)
+		}
+	}
+}
+
+// safeMutate check SafeDecoder with n random mutations of data.
+func safeMutate(t *testing.T, data []byte, n int) {
+	rnd := mrand.New(mrand.NewSource(int64(len(data))))
+	for i := 0; i < n; i++ {
+		b := append([]byte(nil), data...)
+		switch i % 5 {
+		case 0: //truncated
+			b = b[:rnd.Intn(len(b)+1)]
+		case 1: //corrupted
+			for k := rnd.Intn(4); k >= 0; k-- {
+				b[rnd.Intn(len(b))] = byte(rnd.Intn(256))
+			}
+		case 2: //random
+			rnd.Read(b[:rnd.Intn(len(b)+1)])
+		case 3: //forged lengths
+			for k := rnd.Intn(3); k >= 0; k-- {
+				b[rnd.Intn(len(b))] = 0xff
+			}
+		case 4: //bytes removed
+			j := rnd.Intn(len(b))
+			b = append(b[:j], b[j+rnd.Intn(len(b)-j):]...)
+		}
+		checkSafeDecode(t, b)
+	}
+}
+
+func FuzzSafeDecoder(f *testing.F) {
+	for _, seed := range safeSeeds(f) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		checkSafeDecode(t, data)
+	})
+}
+
+type unexportedState struct {
+	_       struct{} `binary:"unexported"`
+	name    string
+	count   uint64 `binary:"packed"`
+	flags   []bool
+	Public  int16
+	skipped int `binary:"ignore"`
+	inner   *unexportedInner
+}
+
+type unexportedInner struct {
+	_    struct{} `binary:"unexported"`
+	tags map[string]int32
+}
+
+type unexportedPlain struct {
+	name   string
+	Public int16
+}
+
+func TestUnexportedFields(t *testing.T) {
+	RegStruct((*unexportedState)(nil))
+	RegStruct((*unexportedPlain)(nil))
+	v := unexportedState{name: "snapshot", count: 300, flags: []bool{true, false}, Public: -2, skipped: 9,
+		inner: &unexportedInner{tags: map[string]int32{"a": 1}}}
+	b, err := Encode(v, nil) //not addressable
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := Sizeof(v); size != len(b) {
+		t.Errorf("Sizeof %d, encoded %d bytes", size, len(b))
+	}
+	var got unexportedState
+	if err := Decode(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := v
+	want.skipped = 0
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	p := unexportedPlain{name: "hidden", Public: 3}
+	b, err = Encode(&p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 2 {
+		t.Errorf("unexported field encoded without tag: %x", b)
+	}
+}
+
+type FlattenHeader struct {
+	_    struct{} `binary:"version=2"`
+	ID   uint64
+	Size int32
+}
+
+type flattenNested struct {
+	FlattenHeader `binary:"packed"`
+	Body          []byte
+}
+
+type flattenPacket struct {
+	FlattenHeader `binary:"flatten,packed"`
+	Body          []byte
+}
+
+type flattenLayout struct {
+	ID   uint64 `binary:"packed"`
+	Size int32  `binary:"packed"`
+	Body []byte
+}
+
+type flattenIgnored struct {
+	FlattenHeader `binary:"flatten,ignore"`
+	Body          []byte
+}
+
+type flattenTagged struct {
+	FlattenHeader `binary:"flatten,tagged"`
+}
+
+type flattenNamed struct {
+	Header FlattenHeader `binary:"flatten"`
+}
+
+func TestFlatten(t *testing.T) {
+	RegStruct((*flattenNested)(nil))
+	RegStruct((*flattenPacket)(nil))
+	RegStruct((*flattenLayout)(nil))
+	RegStruct((*flattenIgnored)(nil))
+	h := FlattenHeader{ID: 1 << 40, Size: 3}
+	body := []byte{9, 8}
+
+	nested, err := Encode(&flattenNested{h, body}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := Encode(&h, nil)
+	if want = append(want, 2, 9, 8); !bytes.Equal(nested, want) {
+		t.Errorf("nested: got %x, want %x", nested, want)
+	}
+
+	v := flattenPacket{h, body}
+	b, err := Encode(&v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := Encode(&flattenLayout{h.ID, h.Size, body}, nil); !bytes.Equal(b, want) {
+		t.Errorf("flatten: got %x, want %x", b, want)
+	}
+	if size := Sizeof(&v); size != len(b) {
+		t.Errorf("Sizeof %d, encoded %d bytes", size, len(b))
+	}
+	var got flattenPacket
+	if err := Decode(b, &got); err != nil || !reflect.DeepEqual(got, v) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	decoder := NewDecoder(b)
+	if n, err := decoder.SkipValue(reflect.TypeOf(v)); err != nil || n != len(b) {
+		t.Errorf("skiped %d bytes of %d, %v", n, len(b), err)
+	}
+
+	b, err = Encode(&flattenIgnored{h, body}, nil)
+	if err != nil || !bytes.Equal(b, []byte{2, 9, 8}) {
+		t.Errorf("ignored: got %x, %v", b, err)
+	}
+
+	if err := RegStruct((*flattenTagged)(nil)); err == nil {
+		t.Errorf("expect error of flatten in tagged struct")
+	}
+	if err := RegStruct((*flattenNamed)(nil)); err == nil {
+		t.Errorf("expect error of flatten named field")
+	}
+}
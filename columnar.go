@@ -0,0 +1,90 @@
+// encode/decode slices/arrays of structs field by field, for field tag `binary:"columnar"`.
+// Values of a field are encoded together, which compresses better than
+// encoding structs one by one for analytics-style payloads.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// isColumnarElem reports whether slice/array elements of type t are encoded
+// field by field.
+func isColumnarElem(t reflect.Type, field *fieldInfo) bool {
+	return field.isColumnar() && t.Kind() == reflect.Struct && queryCodec(t, field) == nil
+}
+
+// columns encode struct elements of slice/array v field by field.
+func (encoder *Encoder) columns(v reflect.Value) error {
+	t := v.Type().Elem()
+	info := queryStruct(t)
+	for k, n, l := 0, t.NumField(), v.Len(); k < n; k++ {
+		i := info.index(k)
+		finfo := info.field(i)
+		if !finfo.isValid(i, t) {
+			continue
+		}
+		endian := encoder.endian
+		encoder.endian = finfo.endianOf(endian)
+		for j := 0; j < l; j++ {
+			if err := encoder.value(v.Index(j).Field(i), finfo); err != nil {
+				encoder.endian = endian
+				return err
+			}
+		}
+		encoder.endian = endian
+	}
+	return nil
+}
+
+// columns decode size struct elements to slice/array v field by field,
+// elements out of v are skiped.
+func (decoder *Decoder) columns(v reflect.Value, size int) error {
+	t := v.Type().Elem()
+	info := queryStruct(t)
+	for k, n, l := 0, t.NumField(), v.Len(); k < n; k++ {
+		i := info.index(k)
+		finfo := info.field(i)
+		if !finfo.isValid(i, t) {
+			continue
+		}
+		endian := decoder.endian
+		decoder.endian = finfo.endianOf(endian)
+		for j := 0; j < size; j++ {
+			if j < l {
+				if err := decoder.value(v.Index(j).Field(i), false, finfo); err != nil {
+					decoder.endian = endian
+					return err
+				}
+			} else {
+				decoder.skipByType(finfo.Type(i, t), finfo)
+			}
+		}
+		decoder.endian = endian
+	}
+	return nil
+}
+
+// skipColumns skip cnt struct elements of type t encoded field by field,
+// and returns bytes skiped.
+func (decoder *Decoder) skipColumns(t reflect.Type, cnt int) int {
+	info := queryStruct(t)
+	sum := 0
+	for k, n := 0, t.NumField(); k < n; k++ {
+		i := info.index(k)
+		finfo := info.field(i)
+		if !finfo.isValid(i, t) {
+			continue
+		}
+		ft := finfo.Type(i, t)
+		endian := decoder.endian
+		decoder.endian = finfo.endianOf(endian)
+		for j := 0; j < cnt; j++ {
+			s := decoder.skipByType(ft, finfo)
+			assert(s >= 0, "skip struct field fail:"+ft.String()) //I'm sure here cannot find unsupported type
+			sum += s
+		}
+		decoder.endian = endian
+	}
+	return sum
+}
@@ -0,0 +1,452 @@
+// compile encode/decode functions of fields of registed structs, to pay the
+// cost of walking reflect switch statements once at registration.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// fieldEncoder encode field value v of a registed struct.
+type fieldEncoder func(encoder *Encoder, v reflect.Value) error
+
+// fieldDecoder decode field value v of a registed struct, v must be settable.
+type fieldDecoder func(decoder *Decoder, v reflect.Value) error
+
+// fieldSizer returns bits of field value v of a registed struct encoded,
+// or -1 if v is not encodable.
+type fieldSizer func(v reflect.Value, vis *ptrVisitor) int
+
+// maxCompileDepth is the max nesting of compiled elements of slices, arrays,
+// pointers and maps, deeper elements fall back to the reflect path, so that
+// recursive types such as type T []T are compiled in finite steps.
+const maxCompileDepth = 8
+
+// compile make encode/decode functions of field of type t.
+// Fields of interface types or unsupported types are left nil,
+// which are encoded/decoded by the reflect path.
+func (field *fieldInfo) compile(t reflect.Type) {
+	field.compileDepth(t, maxCompileDepth)
+	field.compileSize(t)
+}
+
+// compileDepth make encode/decode functions of field of type t, of which
+// elements are compiled in depth levels.
+func (field *fieldInfo) compileDepth(t reflect.Type, depth int) {
+	if codec := queryCodec(t, field); codec != nil {
+		field.compileCodec(t, codec)
+		return
+	}
+	if n := field.bitsOf(t); n > 0 { //bits shared with bools
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.bitField(v, n)
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			decoder.bitField(v, n)
+			return nil
+		}
+		return
+	}
+	packed := field.isPacked()
+	switch t.Kind() {
+	case reflect.Int:
+		if field.isFixed() {
+			field.encode = func(encoder *Encoder, v reflect.Value) error {
+				encoder.Int64(v.Int(), false)
+				return nil
+			}
+			field.decode = func(decoder *Decoder, v reflect.Value) error {
+				v.SetInt(decoder.Int64(false))
+				return nil
+			}
+		} else {
+			field.encode = func(encoder *Encoder, v reflect.Value) error {
+				encoder.Int(int(v.Int()))
+				return nil
+			}
+			field.decode = func(decoder *Decoder, v reflect.Value) error {
+				v.SetInt(int64(decoder.Int()))
+				return nil
+			}
+		}
+	case reflect.Uint:
+		if field.isFixed() {
+			field.encode = func(encoder *Encoder, v reflect.Value) error {
+				encoder.Uint64(v.Uint(), false)
+				return nil
+			}
+			field.decode = func(decoder *Decoder, v reflect.Value) error {
+				v.SetUint(decoder.Uint64(false))
+				return nil
+			}
+		} else {
+			field.encode = func(encoder *Encoder, v reflect.Value) error {
+				encoder.Uint(uint(v.Uint()))
+				return nil
+			}
+			field.decode = func(decoder *Decoder, v reflect.Value) error {
+				v.SetUint(uint64(decoder.Uint()))
+				return nil
+			}
+		}
+
+	case reflect.Bool:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Bool(v.Bool())
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetBool(decoder.Bool())
+			return nil
+		}
+
+	case reflect.Int8:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Int8(int8(v.Int()))
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetInt(int64(decoder.Int8()))
+			return nil
+		}
+	case reflect.Int16:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Int16(int16(v.Int()), packed)
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetInt(int64(decoder.Int16(packed)))
+			return nil
+		}
+	case reflect.Int32:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Int32(int32(v.Int()), packed)
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetInt(int64(decoder.Int32(packed)))
+			return nil
+		}
+	case reflect.Int64:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Int64(v.Int(), packed)
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetInt(decoder.Int64(packed))
+			return nil
+		}
+
+	case reflect.Uint8:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Uint8(uint8(v.Uint()))
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetUint(uint64(decoder.Uint8()))
+			return nil
+		}
+	case reflect.Uint16:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Uint16(uint16(v.Uint()), packed)
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetUint(uint64(decoder.Uint16(packed)))
+			return nil
+		}
+	case reflect.Uint32:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Uint32(uint32(v.Uint()), packed)
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetUint(uint64(decoder.Uint32(packed)))
+			return nil
+		}
+	case reflect.Uint64:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Uint64(v.Uint(), packed)
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetUint(decoder.Uint64(packed))
+			return nil
+		}
+
+	case reflect.Float32:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Float32(float32(v.Float()))
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetFloat(float64(decoder.Float32()))
+			return nil
+		}
+	case reflect.Float64:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Float64(v.Float())
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetFloat(decoder.Float64())
+			return nil
+		}
+
+	case reflect.Complex64:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Complex64(complex64(v.Complex()))
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetComplex(complex128(decoder.Complex64()))
+			return nil
+		}
+	case reflect.Complex128:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.Complex128(v.Complex())
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetComplex(decoder.Complex128())
+			return nil
+		}
+
+	case reflect.String:
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			encoder.string(v.String(), field)
+			return nil
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			v.SetString(decoder.string(field))
+			return nil
+		}
+
+	case reflect.Struct:
+		info := field.structOf(t) //registed by parse of the struct of field
+		if info == nil {
+			return
+		}
+		field.encode = func(encoder *Encoder, v reflect.Value) error {
+			return info.encode(encoder, v)
+		}
+		field.decode = func(decoder *Decoder, v reflect.Value) error {
+			return info.decode(decoder, v)
+		}
+
+	case reflect.Slice, reflect.Array:
+		field.compileArray(t, depth)
+
+	case reflect.Ptr:
+		field.compilePtr(t, depth)
+
+	case reflect.Map:
+		field.compileMap(t, depth)
+	}
+}
+
+// compileSize make size function of field of type t, of which size is known
+// without walking the value by bitsOfValue.
+// Fields of pointers, maps, interfaces and slices/arrays of unfixed-size
+// elements are left nil, which are sized by bitsOfValue.
+func (field *fieldInfo) compileSize(t reflect.Type) {
+	if codec := queryCodec(t, field); codec != nil {
+		field.size = func(v reflect.Value, vis *ptrVisitor) int {
+			c := vis.codecs.find(t) //overrided codec
+			if c == nil {
+				c = codec
+			}
+			if s := c.size(v, field); s >= 0 {
+				return s * 8
+			}
+			return -1
+		}
+		return
+	}
+	if n := field.bitsOf(t); n > 0 { //bits shared with bools
+		field.size = fixedBits(n)
+		return
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		field.size = fixedBits(1)
+	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t.Kind() == reflect.Int && !field.isFixed() || t.Kind() != reflect.Int && field.isPacked() {
+			field.size = func(v reflect.Value, vis *ptrVisitor) int {
+				return SizeofVarint(v.Int()) * 8
+			}
+		} else if s := fixedTypeSize(t); s > 0 {
+			field.size = fixedBits(s * 8)
+		} else {
+			field.size = fixedBits(8 * 8)
+		}
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if t.Kind() == reflect.Uint && !field.isFixed() || t.Kind() != reflect.Uint && field.isPacked() {
+			field.size = func(v reflect.Value, vis *ptrVisitor) int {
+				return SizeofUvarint(v.Uint()) * 8
+			}
+		} else if s := fixedTypeSize(t); s > 0 {
+			field.size = fixedBits(s * 8)
+		} else {
+			field.size = fixedBits(8 * 8)
+		}
+	case reflect.Int8, reflect.Uint8, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		field.size = fixedBits(fixedTypeSize(t) * 8)
+	case reflect.String:
+		field.size = func(v reflect.Value, vis *ptrVisitor) int {
+			return (field.sizeofLen(v.Len()) + v.Len()) * 8
+		}
+	case reflect.Struct:
+		if info := field.structOf(t); info != nil {
+			field.size = func(v reflect.Value, vis *ptrVisitor) int {
+				return info.bitsOfValue(v, vis)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		et := t.Elem()
+		if isRuneElem(et, field) || isDeltaElem(et, field) || isGroupVarintElem(et, field) {
+			return
+		}
+		s := fixedElemSize(et, field)
+		if s <= 0 && !isBoolElem(et, field) {
+			return
+		}
+		nilable := t.Kind() == reflect.Slice && field.isNilable()
+		field.size = func(v reflect.Value, vis *ptrVisitor) int {
+			bits := 0
+			if nilable { //bool bit to keep nil
+				if v.IsNil() {
+					return 1
+				}
+				bits = 1
+			}
+			l := v.Len()
+			if s > 0 {
+				return (field.sizeofLen(l)+l*s)*8 + bits
+			}
+			return (field.sizeofLen(l)+(l+8-1)/8)*8 + bits //bools
+		}
+	}
+}
+
+// fixedBits returns size function of values of n bits.
+func fixedBits(n int) fieldSizer {
+	return func(v reflect.Value, vis *ptrVisitor) int {
+		return n
+	}
+}
+
+// compileCodec make encode/decode functions of field of type t by codec,
+// which are overrided by Codecs of encoder/decoder.
+func (field *fieldInfo) compileCodec(t reflect.Type, codec *typeCodec) {
+	field.encode = func(encoder *Encoder, v reflect.Value) error {
+		if c := encoder.codecs.find(t); c != nil { //overrided codec
+			return c.encode(encoder, v, field)
+		}
+		return codec.encode(encoder, v, field)
+	}
+	field.decode = func(decoder *Decoder, v reflect.Value) error {
+		if c := decoder.codecs.find(t); c != nil { //overrided codec
+			return c.decode(decoder, v, field)
+		}
+		return codec.decode(decoder, v, field)
+	}
+}
+
+// compileArray make encode/decode functions of slice/array field of type t,
+// of which elements are encoded/decoded by compiled functions of elements.
+func (field *fieldInfo) compileArray(t reflect.Type, depth int) {
+	et := t.Elem()
+	if depth <= 0 || !validUserType(et) {
+		return
+	}
+	elemField := field.elemField()
+	info := queryStructElem(et, elemField)
+	encodeElem, decodeElem := elemField.entryCodec(et, depth-1)
+	field.encode = func(encoder *Encoder, v reflect.Value) error {
+		return encoder.array(v, field, info, encodeElem)
+	}
+	field.decode = func(decoder *Decoder, v reflect.Value) error {
+		return decoder.array(v, field, info, decodeElem)
+	}
+}
+
+// compilePtr make encode/decode functions of pointer field of type t,
+// of which element is encoded/decoded by compiled functions of element.
+func (field *fieldInfo) compilePtr(t reflect.Type, depth int) {
+	switch t.Elem().Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Uintptr:
+		return
+	}
+	if depth <= 0 || !validUserType(t) {
+		return
+	}
+	encodeElem, decodeElem := field.entryCodec(t.Elem(), depth-1)
+	field.encode = func(encoder *Encoder, v reflect.Value) error {
+		return encoder.pointer(v, field, encodeElem)
+	}
+	field.decode = func(decoder *Decoder, v reflect.Value) error {
+		return decoder.pointer(v, decodeElem)
+	}
+}
+
+// compileMap make encode/decode functions of map field of type t, so that
+// entries are encoded/decoded by compiled functions of key and value as
+// elements of slice.
+func (field *fieldInfo) compileMap(t reflect.Type, depth int) {
+	kt, vt := t.Key(), t.Elem()
+	if depth <= 0 || !validUserType(kt) || !validUserType(vt) {
+		return
+	}
+	encodeKey, decodeKey := field.entryCodec(kt, depth-1)
+	encodeValue, decodeValue := field.entryCodec(vt, depth-1)
+	field.encode = func(encoder *Encoder, v reflect.Value) error {
+		if encoder.nilFlag(v, field) {
+			return nil
+		}
+		return encoder.mapEntries(v, field, encodeKey, encodeValue)
+	}
+	field.decode = func(decoder *Decoder, v reflect.Value) error {
+		if decoder.nilFlag(v, field) {
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+		size := decoder.allocLength(field, int(kt.Size()+vt.Size()))
+		for i := 0; i < size; i++ {
+			key := reflect.New(kt).Elem()
+			value := reflect.New(vt).Elem()
+			if err := decodeKey(decoder, key); err != nil {
+				return err
+			}
+			if err := decodeValue(decoder, value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+		return nil
+	}
+}
+
+// entryCodec returns encode/decode functions of element of type t of field,
+// as key or value of map or element of slice/array/pointer, compiled in
+// depth levels, which fall back to the reflect path if t cannot be compiled.
+func (field *fieldInfo) entryCodec(t reflect.Type, depth int) (fieldEncoder, fieldDecoder) {
+	if info := queryStructElem(t, field); info != nil {
+		return info.encode, info.decode
+	}
+	entry := *field
+	entry.encode, entry.decode = nil, nil
+	entry.compileDepth(t, depth)
+	if entry.encode == nil { //reflect path
+		entry.encode = func(encoder *Encoder, v reflect.Value) error {
+			return encoder.value(v, field)
+		}
+		entry.decode = func(decoder *Decoder, v reflect.Value) error {
+			return decoder.value(v, false, field)
+		}
+	}
+	return entry.encode, entry.decode
+}
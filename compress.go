@@ -0,0 +1,241 @@
+// compress streams of encoded messages transparently, for log shipping and
+// archival use cases.
+
+package binary
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compression is the algorithm of compressed streams.
+type Compression uint8
+
+const (
+	// NoCompression write messages without compression.
+	NoCompression Compression = iota
+	// Gzip compress streams by compress/gzip.
+	Gzip
+	// Snappy compress streams by snappy framing format, which must be
+	// registered by RegCompression, as:
+	//	binary.RegCompression(binary.Snappy,
+	//		func(w io.Writer) (io.WriteCloser, error) { return snappy.NewBufferedWriter(w), nil },
+	//		func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(snappy.NewReader(r)), nil })
+	Snappy
+	// Zstd compress streams by zstd, which must be registered by RegCompression.
+	Zstd
+)
+
+// String returns name of compression.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Gzip:
+		return "gzip"
+	case Snappy:
+		return "snappy"
+	case Zstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("Compression(%d)", uint8(c))
+}
+
+type compressor struct {
+	writer func(io.Writer) (io.WriteCloser, error)
+	reader func(io.Reader) (io.ReadCloser, error)
+}
+
+var _compressors = struct {
+	sync.RWMutex
+	reg map[Compression]compressor
+}{reg: map[Compression]compressor{
+	NoCompression: {
+		writer: func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil },
+		reader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil },
+	},
+	Gzip: {
+		writer: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		reader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	},
+}}
+
+// RegCompression register stream writer and reader of compression c, such as
+// Snappy and Zstd by third party packages. It replace the previous ones of c.
+// Writers which implement Flush() error are flushed by CompressedEncoder.Flush.
+func RegCompression(c Compression, writer func(io.Writer) (io.WriteCloser, error),
+	reader func(io.Reader) (io.ReadCloser, error)) error {
+	if c == NoCompression || writer == nil || reader == nil {
+		return fmt.Errorf("binary.RegCompression: invalid compression %s", c)
+	}
+	_compressors.Lock()
+	defer _compressors.Unlock()
+	_compressors.reg[c] = compressor{writer: writer, reader: reader}
+	return nil
+}
+
+func queryCompressor(c Compression) (compressor, error) {
+	_compressors.RLock()
+	defer _compressors.RUnlock()
+	if p, ok := _compressors.reg[c]; ok {
+		return p, nil
+	}
+	return compressor{}, fmt.Errorf("binary: compression %s is not registered", c)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// countWriter count bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+// CompressedEncoder encode values as messages of WriteMessage to a compressed
+// stream. The stream begins with a byte of compression, which is followed by
+// the compressed messages.
+// Call Close to complete the stream, which does not close the underlying writer.
+type CompressedEncoder struct {
+	cw  countWriter
+	zw  io.WriteCloser
+	raw int64 //bytes of messages before compression
+}
+
+// NewCompressedEncoder returns a CompressedEncoder which write stream of
+// compression c to w.
+func NewCompressedEncoder(w io.Writer, c Compression) (*CompressedEncoder, error) {
+	p, err := queryCompressor(c)
+	if err != nil {
+		return nil, err
+	}
+	enc := &CompressedEncoder{cw: countWriter{w: w}}
+	if _, err := enc.cw.Write([]byte{byte(c)}); err != nil {
+		return nil, err
+	}
+	if enc.zw, err = p.writer(&enc.cw); err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+// Encode encode data as a message to the compressed stream.
+// The message may be buffered by compressor until Flush or Close.
+func (enc *CompressedEncoder) Encode(data interface{}) error {
+	cw := countWriter{w: enc.zw}
+	err := WriteMessage(&cw, data)
+	enc.raw += cw.n
+	return err
+}
+
+// Flush flush messages buffered by compressor to the underlying writer, if
+// the compressor implements Flush() error.
+func (enc *CompressedEncoder) Flush() error {
+	if f, ok := enc.zw.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close flush messages and complete the compressed stream.
+func (enc *CompressedEncoder) Close() error {
+	return enc.zw.Close()
+}
+
+// Stats returns bytes number of messages encoded before compression, and
+// bytes number written to the underlying writer.
+func (enc *CompressedEncoder) Stats() (raw, compressed int64) {
+	return enc.raw, enc.cw.n
+}
+
+// CompressedDecoder decode values from compressed stream written by
+// CompressedEncoder. The compression is detected by the stream.
+type CompressedDecoder struct {
+	r   io.Reader
+	zr  io.ReadCloser
+	c   Compression
+	raw int64 //bytes of messages after decompression
+}
+
+// NewCompressedDecoder returns a CompressedDecoder which read compressed stream from r.
+func NewCompressedDecoder(r io.Reader) *CompressedDecoder {
+	return &CompressedDecoder{r: r}
+}
+
+// Decode decode next message of the stream to data, which must be a pointer.
+// It returns io.EOF if there is no more message.
+func (dec *CompressedDecoder) Decode(data interface{}) error {
+	if dec.zr == nil {
+		if err := dec.begin(); err != nil {
+			return err
+		}
+	}
+	cr := &countReader{r: dec.zr}
+	buf, err := readMessage(cr, 0)
+	dec.raw += cr.n
+	if err != nil {
+		return err
+	}
+	return Decode(buf, data)
+}
+
+// begin read compression of the stream and initialize decompressor.
+func (dec *CompressedDecoder) begin() error {
+	var b [1]byte
+	if _, err := io.ReadFull(dec.r, b[:]); err != nil {
+		return err
+	}
+	dec.c = Compression(b[0])
+	p, err := queryCompressor(dec.c)
+	if err != nil {
+		return err
+	}
+	zr, err := p.reader(dec.r)
+	if err != nil {
+		return err
+	}
+	dec.zr = zr
+	return nil
+}
+
+// Compression returns compression of the stream, which is known after the
+// first Decode.
+func (dec *CompressedDecoder) Compression() Compression {
+	return dec.c
+}
+
+// Stats returns bytes number of messages decoded after decompression.
+func (dec *CompressedDecoder) Stats() (raw int64) {
+	return dec.raw
+}
+
+// Close close the decompressor, which does not close the underlying reader.
+func (dec *CompressedDecoder) Close() error {
+	if dec.zr == nil {
+		return nil
+	}
+	return dec.zr.Close()
+}
+
+// countReader count bytes read from r.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.n += int64(n)
+	return n, err
+}
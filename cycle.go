@@ -0,0 +1,74 @@
+// detect cycles of pointer graphs while walking values.
+
+package binary
+
+import (
+	"reflect"
+	"sync"
+)
+
+// startDetectingCyclesAfter is the level of nested pointers/slices/maps to start
+// cycle detection, to avoid the cost of tracking them for most values.
+const startDetectingCyclesAfter = 1000
+
+// ptrVisitor detects cycles of pointers/slices/maps while walking a value.
+type ptrVisitor struct {
+	level int
+	seen  map[ptrKey]struct{} //pointers/slices/maps being visited
+	cycle reflect.Type        //type of the first detected cycle, nil if not found
+
+	codecs *Codecs //codec overrides of types, nil means not
+}
+
+// _visitorPool is the pool of ptrVisitors of Sizeof, which escape to
+// compiled size functions of fields.
+var _visitorPool = sync.Pool{New: func() interface{} { return new(ptrVisitor) }}
+
+type ptrKey struct {
+	ptr uintptr
+	len int //length of slice, to distinguish a slice with its sub-slices
+	typ reflect.Type
+}
+
+// enter visits pointer/slice/map v, and reports false if v is being visited,
+// which means a cycle is found.
+// It only counts levels until startDetectingCyclesAfter, so that it is inlined
+// for most values.
+func (vis *ptrVisitor) enter(v reflect.Value) bool {
+	vis.level++
+	return vis.level <= startDetectingCyclesAfter || vis.track(v)
+}
+
+// track records v of a deep level being visited, and reports false if it has
+// been recorded, which means a cycle is found.
+func (vis *ptrVisitor) track(v reflect.Value) bool {
+	if vis.seen == nil {
+		vis.seen = make(map[ptrKey]struct{})
+	}
+	key := keyOfPtr(v)
+	if _, ok := vis.seen[key]; ok {
+		vis.level--
+		if vis.cycle == nil {
+			vis.cycle = v.Type()
+		}
+		return false
+	}
+	vis.seen[key] = struct{}{}
+	return true
+}
+
+// leave finish visiting v which has entered successfully.
+func (vis *ptrVisitor) leave(v reflect.Value) {
+	if vis.level > startDetectingCyclesAfter {
+		delete(vis.seen, keyOfPtr(v))
+	}
+	vis.level--
+}
+
+func keyOfPtr(v reflect.Value) ptrKey {
+	key := ptrKey{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	return key
+}
@@ -0,0 +1,117 @@
+// encode/decode fixed-point decimals, so that monetary values are not
+// round-tripped through float64.
+
+package binary
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	_builtinCodecs[reflect.TypeOf(Decimal{})] = &decimalCodec
+}
+
+// Decimal is a fixed-point decimal of value Mantissa * 10^-Scale, such as
+// Decimal{Mantissa: 12345, Scale: 2} for 123.45.
+// Decimals of other libraries can be encoded by RegisterCodec, converting
+// them to Decimal.
+type Decimal struct {
+	Mantissa int64 //integer mantissa
+	Scale    int32 //digits after decimal point, negative for trailing zeros
+}
+
+// ParseDecimal parse decimal string s such as "-123.45", keeping its digits
+// after decimal point as Scale.
+func ParseDecimal(s string) (Decimal, error) {
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 {
+		return Decimal{}, fmt.Errorf("binary.ParseDecimal: invalid syntax %q", s)
+	}
+	intPart, frac := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		intPart, frac = digits[:i], digits[i+1:]
+	}
+	digits = intPart + frac
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("binary.ParseDecimal: invalid syntax %q", s)
+	}
+	if len(frac) > math.MaxInt32 {
+		return Decimal{}, errorf(ErrOverflow, "binary.ParseDecimal: %q overflows scale", s)
+	}
+	if strings.HasPrefix(s, "-") {
+		digits = "-" + digits
+	}
+	m, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Decimal{}, errorf(ErrOverflow, "binary.ParseDecimal: %q overflows int64 mantissa", s)
+	}
+	return Decimal{Mantissa: m, Scale: int32(len(frac))}, nil
+}
+
+// String returns decimal string of d, such as "-123.45".
+func (d Decimal) String() string {
+	if d.Mantissa == 0 && d.Scale <= 0 {
+		return "0"
+	}
+	s := strconv.FormatInt(d.Mantissa, 10)
+	sign := ""
+	if d.Mantissa < 0 {
+		sign, s = "-", s[1:]
+	}
+	if d.Scale <= 0 {
+		return sign + s + strings.Repeat("0", int(-d.Scale))
+	}
+	scale := int(d.Scale)
+	if len(s) <= scale {
+		s = strings.Repeat("0", scale-len(s)+1) + s
+	}
+	return sign + s[:len(s)-scale] + "." + s[len(s)-scale:]
+}
+
+// sizeofDecimal returns bytes number of d encoded by Encoder.Decimal.
+func sizeofDecimal(d Decimal) int {
+	return SizeofVarint(int64(d.Scale)) + SizeofVarint(d.Mantissa)
+}
+
+// Decimal encode a Decimal value to Encoder buffer, as varint scale and
+// varint mantissa(2~15 bytes).
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Decimal(x Decimal) {
+	encoder.Varint(int64(x.Scale))
+	encoder.Varint(x.Mantissa)
+}
+
+// Decimal decode a Decimal value from Decoder buffer.
+// It will panic if buffer is not enough or scale overflows int32.
+func (decoder *Decoder) Decimal() Decimal {
+	scale, _ := decoder.Varint()
+	if scale < math.MinInt32 || scale > math.MaxInt32 {
+		panic(errorf(ErrOverflow, "binary.Decoder.Decimal: scale %d overflows int32", scale))
+	}
+	m, _ := decoder.Varint()
+	return Decimal{Mantissa: m, Scale: int32(scale)}
+}
+
+// Decimal is encoded by Encoder.Decimal.
+var decimalCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		return sizeofDecimal(v.Interface().(Decimal))
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		encoder.Decimal(v.Interface().(Decimal))
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		v.Set(reflect.ValueOf(decoder.Decimal()))
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		_, n := decoder.Uvarint()
+		_, m := decoder.Uvarint()
+		return n + m
+	},
+}
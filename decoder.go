@@ -1,12 +1,17 @@
 package binary
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"math"
 	"reflect"
+	"time"
+	"unsafe"
 )
 
+const maxInt = int(^uint(0) >> 1)
+
 // NewDecoder make a new Decoder object with buffer.
 func NewDecoder(buffer []byte) *Decoder {
 	return NewDecoderEndian(buffer, DefaultEndian)
@@ -22,8 +27,32 @@ func NewDecoderEndian(buffer []byte, endian Endian) *Decoder {
 // Decoder is used to decode byte array to go data.
 type Decoder struct {
 	coder
-	reader    io.Reader //for decode from reader only
-	boolValue byte      //last bool value byte
+	reader      io.Reader //for decode from reader only
+	boolValue   byte      //last bool value byte
+	depth       int       //nesting depth of decoding value
+	maxDepth    int       //max nesting depth of value, 0 means no limit
+	maxLen      int       //max length of string/slice/map, 0 means no limit
+	allocated   int       //bytes allocated for decoding value
+	maxAlloc    int       //max bytes to allocate for decoding value, 0 means no limit
+	strict      bool      //if error on trailing bytes after value
+	zeroCopy    bool      //if decoded strings/byte slices refer to buffer instead of copying
+	useTable    bool      //if decode strings by string table
+	fixedArrays bool      //if decode arrays without length prefix
+	utf8Mode    UTF8Mode  //how to handle decoded strings of invalid UTF-8
+	arena       *Arena    //allocate decoded values, nil means not
+	safe        bool      //if lengths are bounded by bytes left, for SafeDecoder
+
+	strs    *stringTable //string table of decoding value, nil if not used
+	varint  VarintFormat //format of varints
+	cLayout *CLayout     //C layout of structs, nil means not
+	msgpack bool         //if decode in MessagePack format
+	cbor    bool         //if decode in CBOR format
+	std     bool         //if decode in layout of encoding/binary
+
+	tracer    Tracer       //observe fields of structs, nil means not
+	traceBase int          //offset of buffer in traced buffer
+	codecs    *Codecs      //codec overrides of types, nil means not
+	root      reflect.Type //type of decoding value to locate errors, nil means not
 }
 
 // Skip ignore the next size of bytes for encoding/decoding.
@@ -40,16 +69,25 @@ func (decoder *Decoder) Skip(size int) int {
 func (decoder *Decoder) reserve(size int) []byte {
 	if decoder.reader != nil { //decode from reader
 		if size > len(decoder.buff) {
+			decoder.alloc(size, 1)
 			decoder.buff = make([]byte, size)
 		}
 		buff := decoder.buff[:size]
-		if n, _ := decoder.reader.Read(buff); n < size {
+		if n, _ := io.ReadFull(decoder.reader, buff); n < size {
 			panic(io.ErrUnexpectedEOF)
 		}
 		return buff
 	}
 
-	return decoder.coder.reserve(size) //decode from bytes buffer
+	pos := decoder.pos //decode from bytes buffer, checked only once
+	if size > len(decoder.buff)-pos {
+		panic(errorf(ErrTruncated, "binary.Coder:buffer overflow pos=%d cap=%d require=%d, not enough space", pos, decoder.Cap(), size))
+	}
+	if size <= 0 {
+		return nil
+	}
+	decoder.pos = pos + size
+	return decoder.buff[pos:decoder.pos]
 }
 
 // Init initialize Encoder with buffer and endian.
@@ -59,6 +97,106 @@ func (decoder *Decoder) Init(buffer []byte, endian Endian) {
 	decoder.endian = endian
 }
 
+// ResetBuffer reset Decoder to decode data, so that a Decoder is reused for
+// messages without reallocating. Options of Decoder are kept.
+func (decoder *Decoder) ResetBuffer(data []byte) {
+	decoder.buff = data
+	decoder.pos = 0
+	decoder.reader = nil
+	decoder.boolValue = 0
+	decoder.resetBoolCoder()
+}
+
+// ResetWithEndian is like ResetBuffer, and set endian of Decoder.
+func (decoder *Decoder) ResetWithEndian(data []byte, endian Endian) {
+	decoder.ResetBuffer(data)
+	decoder.endian = endian
+}
+
+// ReadFrom reads data from r until EOF, and append it to the bytes not
+// decoded yet as buffer to decode. It implements io.ReaderFrom.
+// The buffer is copied, so strings/byte slices decoded from it in zero-copy
+// mode are still valid.
+func (decoder *Decoder) ReadFrom(r io.Reader) (int64, error) {
+	buf := bytes.NewBuffer(append([]byte(nil), decoder.buff[decoder.pos:]...))
+	n, err := buf.ReadFrom(r)
+	decoder.buff = buf.Bytes()
+	decoder.pos = 0
+	decoder.resetBoolCoder()
+	return n, err
+}
+
+// SetMaxDepth set max nesting depth of values to decode, 0 means no limit.
+// Value returns error if the data is nested deeper than it,
+// instead of exhausting the stack by deeply nested (possibly hostile) data.
+func (decoder *Decoder) SetMaxDepth(depth int) {
+	decoder.maxDepth = depth
+}
+
+// SetStrict set if Value returns ErrTrailingBytes when bytes remain in buffer
+// after the value is fully decoded, to catch framing bugs and version mismatches.
+// It does not work when decoding from a reader.
+func (decoder *Decoder) SetStrict(strict bool) {
+	decoder.strict = strict
+}
+
+// SetZeroCopy set if decoded strings and byte slices refer to the decoder buffer
+// instead of copying, to cut allocation churn for large strings and blobs.
+// Strings refer to the buffer by unsafe, and byte slices are sub-slices of the
+// buffer with capacity clipped to their length.
+// The caller must guarantee that the buffer is neither modified nor reused
+// while the decoded values are in use.
+// It does not work when decoding from a reader.
+func (decoder *Decoder) SetZeroCopy(zeroCopy bool) {
+	decoder.zeroCopy = zeroCopy
+}
+
+// SetStringTable set if Decoder decode strings of a value by a string table,
+// which is encoded by Encoder with SetStringTable.
+func (decoder *Decoder) SetStringTable(useTable bool) {
+	decoder.useTable = useTable
+}
+
+// SetMaxLen set max length of string/slice/map to decode, 0 means no limit.
+// Value returns error if the data contains a longer one.
+func (decoder *Decoder) SetMaxLen(l int) {
+	decoder.maxLen = l
+}
+
+// SetMaxAlloc set max bytes of string/slice/map to allocate for decoding a value,
+// 0 means no limit.
+// Value returns error if the data requires more, instead of attempting a giant
+// allocation by forged length of (possibly hostile) data.
+func (decoder *Decoder) SetMaxAlloc(size int) {
+	decoder.maxAlloc = size
+}
+
+// alloc count allocation of n elements of elemSize bytes.
+// It will panic if it exceeds max allocation bytes.
+func (decoder *Decoder) alloc(n, elemSize int) {
+	if decoder.maxAlloc <= 0 || n <= 0 || elemSize <= 0 {
+		return
+	}
+	if n > (decoder.maxAlloc-decoder.allocated)/elemSize {
+		panic(errorf(ErrLimitExceeded, "binary.Decoder.Value: allocation exceeds max allocation %d bytes", decoder.maxAlloc))
+	}
+	decoder.allocated += n * elemSize
+}
+
+// enter increase nesting depth of decoding value.
+// It will panic if it exceeds max depth.
+func (decoder *Decoder) enter() {
+	decoder.depth++
+	if decoder.depth > decoder.maxDepth {
+		panic(errorf(ErrLimitExceeded, "binary.Decoder.Value: exceeded max depth %d", decoder.maxDepth))
+	}
+}
+
+// leave decrease nesting depth of decoding value.
+func (decoder *Decoder) leave() {
+	decoder.depth--
+}
+
 // Bool decode a bool value from Decoder buffer.
 // It will panic if buffer is not enough.
 func (decoder *Decoder) Bool() bool {
@@ -191,10 +329,117 @@ func (decoder *Decoder) Complex128() complex128 {
 // String decode a string value from Decoder buffer.
 // It will panic if buffer is not enough.
 func (decoder *Decoder) String() string {
-	s, _ := decoder.Uvarint()
-	size := int(s)
+	return decoder.string(nil)
+}
+
+// Bytes decode a length-prefixed byte slice from Decoder buffer.
+// The result is a copy, or refers to the decoder buffer if SetZeroCopy is on.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) Bytes() []byte {
+	if decoder.zeroCopyBytes() {
+		l, _ := decoder.length(nil)
+		return decoder.reserve(l)[:l:l] //refers to the decoder buffer
+	}
+	l := decoder.allocLength(nil, 1)
+	if decoder.arena != nil && l > 0 {
+		return decoder.arenaBytes(decoder.reserve(l))
+	}
+	b := make([]byte, l)
+	copy(b, decoder.reserve(l))
+	return b
+}
+
+// Length decode a uvarint length prefix of string, slice, array or map from Decoder buffer.
+// It will panic if buffer is not enough, or the length is invalid or exceeds max length.
+func (decoder *Decoder) Length() int {
+	l, _ := decoder.length(nil)
+	return l
+}
+
+// string decode a string value with length prefix of field.
+func (decoder *Decoder) string(field *fieldInfo) string {
+	if s, ok := decoder.tableString(); ok {
+		return s
+	}
+	if decoder.zeroCopyBytes() {
+		size, _ := decoder.length(field)
+		b := decoder.reserve(size)
+		return decoder.validString(*(*string)(unsafe.Pointer(&b))) //refers to the decoder buffer
+	}
+	size := decoder.allocLength(field, 1)
 	b := decoder.reserve(size)
-	return string(b)
+	if decoder.arena != nil && size > 0 {
+		m := decoder.arenaBytes(b)
+		return decoder.validString(*(*string)(unsafe.Pointer(&m))) //refers to the arena
+	}
+	return decoder.validString(string(b))
+}
+
+// bytes decode a length-prefixed byte slice with length prefix of field.
+// The result refers to the decoder buffer.
+func (decoder *Decoder) bytes(field *fieldInfo) []byte {
+	size, _ := decoder.length(field)
+	return decoder.reserve(size)
+}
+
+// skipString skip a string value with length prefix of field, and returns bytes skiped.
+func (decoder *Decoder) skipString(field *fieldInfo) int {
+	if decoder.strs != nil { //index of string table
+		_, n := decoder.Uvarint()
+		return n
+	}
+	size, n := decoder.length(field) //string length and data
+	decoder.Skip(size)
+	return size + n
+}
+
+// zeroCopyBytes reports if byte slices refer to the decoder buffer.
+func (decoder *Decoder) zeroCopyBytes() bool {
+	return decoder.zeroCopy && decoder.reader == nil
+}
+
+// length decode length of string, slice, array or map from length prefix of field.
+// It returns the length and bytes number of the length prefix.
+func (decoder *Decoder) length(field *fieldInfo) (int, int) {
+	if field.isNoLen() { //bytes of the rest of buffer
+		return decoder.checkLen(decoder.restBytes()), 0
+	}
+	switch s := field.lenPrefixSize(); s {
+	case 1:
+		return decoder.checkLen(int(decoder.Uint8())), s
+	case 2:
+		return decoder.checkLen(int(decoder.Uint16(false))), s
+	case 4:
+		return decoder.checkLen(int(decoder.Uint32(false))), s
+	}
+	l, n := decoder.Uvarint()
+	if l > uint64(maxInt) {
+		panic(errorf(ErrOverflow, "binary.Decoder.Value: invalid length %d", l))
+	}
+	return decoder.checkLen(int(l)), n
+}
+
+// checkLen returns l if it does not exceed max length.
+// It will panic if it does.
+func (decoder *Decoder) checkLen(l int) int {
+	if l < 0 {
+		panic(errorf(ErrOverflow, "binary.Decoder.Value: invalid length %d", l))
+	}
+	if decoder.maxLen > 0 && l > decoder.maxLen {
+		panic(errorf(ErrLimitExceeded, "binary.Decoder.Value: length %d exceeds max length %d", l, decoder.maxLen))
+	}
+	if decoder.safe && l/8 > len(decoder.buff)-decoder.pos { //each element takes a bit at least
+		panic(errorf(ErrTruncated, "binary.Decoder.Value: length %d exceeds bytes left %d", l, len(decoder.buff)-decoder.pos))
+	}
+	return l
+}
+
+// allocLength decode length of string/slice/map which is going to allocate
+// elements of elemSize bytes, and count the allocation.
+func (decoder *Decoder) allocLength(field *fieldInfo, elemSize int) int {
+	l, _ := decoder.length(field)
+	decoder.alloc(l, elemSize)
+	return l
 }
 
 // Int decode an int value from Decoder buffer.
@@ -221,9 +466,16 @@ func (decoder *Decoder) Varint() (int64, int) {
 }
 
 // Uvarint decode a uint64 value from Decoder buffer with varint(1~10 bytes).
+// The varint is of format set by SetVarintFormat.
 // It will panic if buffer is not enough.
 // It will return n <= 0 if varint error
 func (decoder *Decoder) Uvarint() (uint64, int) {
+	switch decoder.varint {
+	case VarintSQLite:
+		return decoder.sqliteUvarint()
+	case VarintGit:
+		return decoder.gitUvarint()
+	}
 	var x uint64
 	var bit uint
 	var i int
@@ -239,7 +491,72 @@ func (decoder *Decoder) Uvarint() (uint64, int) {
 		bit += 7
 	}
 	//return 0, 0
-	panic(fmt.Errorf("binary.Decoder.Uvarint: overflow 64-bits value(pos:%d/%d)", decoder.Len(), decoder.Cap()))
+	panic(errorf(ErrOverflow, "binary.Decoder.Uvarint: overflow 64-bits value(pos:%d/%d)", decoder.Len(), decoder.Cap()))
+}
+
+// peek call read and then restore the read pointer.
+// It will panic if decoding from a reader.
+func (decoder *Decoder) peek(read func()) {
+	if decoder.reader != nil {
+		panic(fmt.Errorf("binary.Decoder: peek is not supported when decoding from reader"))
+	}
+	pos := decoder.pos
+	defer func() { decoder.pos = pos }()
+	read()
+}
+
+// PeekUint8 decode a uint8 value from Decoder buffer without moving the read pointer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) PeekUint8() (x uint8) {
+	decoder.peek(func() { x = decoder.Uint8() })
+	return
+}
+
+// PeekUint16 decode a uint16 value from Decoder buffer without moving the read pointer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) PeekUint16(packed bool) (x uint16) {
+	decoder.peek(func() { x = decoder.Uint16(packed) })
+	return
+}
+
+// PeekUint32 decode a uint32 value from Decoder buffer without moving the read pointer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) PeekUint32(packed bool) (x uint32) {
+	decoder.peek(func() { x = decoder.Uint32(packed) })
+	return
+}
+
+// PeekUint64 decode a uint64 value from Decoder buffer without moving the read pointer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) PeekUint64(packed bool) (x uint64) {
+	decoder.peek(func() { x = decoder.Uint64(packed) })
+	return
+}
+
+// PeekUvarint decode a uint64 value from Decoder buffer with uvarint(1~10 bytes)
+// without moving the read pointer.
+// It returns the value and bytes number of the uvarint.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) PeekUvarint() (x uint64, n int) {
+	decoder.peek(func() { x, n = decoder.Uvarint() })
+	return
+}
+
+// PeekVarint decode an int64 value from Decoder buffer with varint(1~10 bytes)
+// without moving the read pointer.
+// It returns the value and bytes number of the varint.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) PeekVarint() (x int64, n int) {
+	decoder.peek(func() { x, n = decoder.Varint() })
+	return
+}
+
+// PeekBytes returns the next n bytes of Decoder buffer without moving the read pointer.
+// The result refers to the decoder buffer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) PeekBytes(n int) (b []byte) {
+	decoder.peek(func() { b = decoder.reserve(n) })
+	return
 }
 
 // Value decode an interface value from Encoder buffer.
@@ -248,16 +565,39 @@ func (decoder *Decoder) Uvarint() (uint64, int) {
 // or buffer is not enough.
 // It will check if x implements interface BinaryEncoder and use x.Encode first.
 func (decoder *Decoder) Value(x interface{}) (err error) {
+	endian := decoder.endian
 	defer func() {
-		if info := recover(); info != nil {
-			err = info.(error)
-			assert(err != nil, info)
-		}
+		err = decoder.endValue(recover(), endian, err)
 	}()
 
 	decoder.resetBoolCoder() //reset bool reader
+	decoder.depth = 0
+	decoder.allocated = 0
+	if decoder.msgpack { //MessagePack format
+		v := reflect.ValueOf(x)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return fmt.Errorf("binary.Decoder.Value: non-pointer %s", v.Type().String())
+		}
+		decoder.mpValue(v.Elem())
+		return nil
+	}
+	if decoder.cbor { //CBOR format
+		v := reflect.ValueOf(x)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return fmt.Errorf("binary.Decoder.Value: non-pointer %s", v.Type().String())
+		}
+		decoder.cborValue(v.Elem())
+		return nil
+	}
+	if decoder.std { //layout of encoding/binary
+		decoder.stdValue(x)
+		return nil
+	}
+	defer decoder.endTable()
+	decoder.beginTable() //decode string table first
+	decoder.beginPath(reflect.TypeOf(x))
 
-	if decoder.fastValue(x) { //fast value path
+	if decoder.codecs == nil && decoder.fastValue(x) { //fast value path
 		return nil
 	}
 
@@ -289,13 +629,29 @@ func (decoder *Decoder) Value(x interface{}) (err error) {
 	}
 
 	if v.Kind() == reflect.Ptr { //only support decode for pointer interface
-		return decoder.value(v, true, false)
+		return decoder.value(v, true, nil)
 	}
 
 	return fmt.Errorf("binary.Decoder.Value: non-pointer type %s", v.Type().String())
 }
 
-func (decoder *Decoder) value(v reflect.Value, topLevel bool, packed bool) error {
+// endValue returns error of Value by panic info and err returned, restoring
+// endian of decoder if it panics.
+func (decoder *Decoder) endValue(info interface{}, endian Endian, err error) error {
+	if info != nil {
+		err = panicError(info, "binary.Decoder.Value")
+		decoder.endian = endian //restore endian changed by field tag
+	}
+	if err == nil && decoder.strict && decoder.reader == nil && decoder.pos < len(decoder.buff) {
+		err = ErrTrailingBytes
+	}
+	if err != nil {
+		err = decoder.pathError(err)
+	}
+	return err
+}
+
+func (decoder *Decoder) value(v reflect.Value, topLevel bool, field *fieldInfo) error {
 	// check Packer interface for every value is perfect
 	// but decoder is too costly
 	//
@@ -325,33 +681,25 @@ func (decoder *Decoder) value(v reflect.Value, topLevel bool, packed bool) error
 	//		}
 	//	}
 
-	switch k := v.Kind(); k {
-	case reflect.Int:
-		v.SetInt(int64(decoder.Int()))
-	case reflect.Uint:
-		v.SetUint(uint64(decoder.Uint()))
+	if decoder.maxDepth > 0 {
+		decoder.enter()
+		defer decoder.leave()
+	}
 
+	if codec := decoder.codecs.find(v.Type()); codec != nil { //overrided codec
+		return codec.decode(decoder, v, field)
+	}
+	if codec := queryCodec(v.Type(), field); codec != nil {
+		return codec.decode(decoder, v, field)
+	}
+
+	switch k := v.Kind(); k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		decoder.integer(v, k, field)
 	case reflect.Bool:
 		v.SetBool(decoder.Bool())
 
-	case reflect.Int8:
-		v.SetInt(int64(decoder.Int8()))
-	case reflect.Int16:
-		v.SetInt(int64(decoder.Int16(packed)))
-	case reflect.Int32:
-		v.SetInt(int64(decoder.Int32(packed)))
-	case reflect.Int64:
-		v.SetInt(decoder.Int64(packed))
-
-	case reflect.Uint8:
-		v.SetUint(uint64(decoder.Uint8()))
-	case reflect.Uint16:
-		v.SetUint(uint64(decoder.Uint16(packed)))
-	case reflect.Uint32:
-		v.SetUint(uint64(decoder.Uint32(packed)))
-	case reflect.Uint64:
-		v.SetUint(decoder.Uint64(packed))
-
 	case reflect.Float32:
 		v.SetFloat(float64(decoder.Float32()))
 	case reflect.Float64:
@@ -364,37 +712,23 @@ func (decoder *Decoder) value(v reflect.Value, topLevel bool, packed bool) error
 		v.SetComplex(decoder.Complex128())
 
 	case reflect.String:
-		v.SetString(decoder.String())
+		v.SetString(decoder.string(field))
 
 	case reflect.Slice, reflect.Array:
 		if !validUserType(v.Type().Elem()) { //verify array element is valid
-			return fmt.Errorf("binary.Decoder.Value: unsupported type %s", v.Type().String())
-		}
-		if decoder.boolArray(v) < 0 { //deal with bool array first
-			s, _ := decoder.Uvarint()
-			size := int(s)
-			if size > 0 && k == reflect.Slice { //make a new slice
-				ns := reflect.MakeSlice(v.Type(), size, size)
-				v.Set(ns)
-			}
-
-			l := v.Len()
-			for i := 0; i < size; i++ {
-				if i < l {
-					assert(decoder.value(v.Index(i), false, packed) == nil, "")
-				} else {
-					skiped := decoder.skipByType(v.Type().Elem(), packed)
-					assert(skiped >= 0, v.Type().Elem().String()) //I'm sure here cannot find unsupported type
-				}
-			}
+			return errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported type %s", v.Type().String())
 		}
+		return decoder.array(v, field, nil, nil)
 	case reflect.Map:
 		t := v.Type()
 		kt := t.Key()
 		vt := t.Elem()
 		if !validUserType(kt) ||
 			!validUserType(vt) { //verify map key and value type are both valid
-			return fmt.Errorf("binary.Decoder.Value: unsupported type %s", v.Type().String())
+			return errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported type %s", v.Type().String())
+		}
+		if decoder.nilFlag(v, field) {
+			return nil
 		}
 
 		if v.IsNil() {
@@ -402,30 +736,164 @@ func (decoder *Decoder) value(v reflect.Value, topLevel bool, packed bool) error
 			v.Set(newmap)
 		}
 
-		s, _ := decoder.Uvarint()
-		size := int(s)
+		size := decoder.allocLength(field, int(kt.Size()+vt.Size()))
 		for i := 0; i < size; i++ {
 			key := reflect.New(kt).Elem()
 			value := reflect.New(vt).Elem()
-			assert(decoder.value(key, false, packed) == nil, "")
-			assert(decoder.value(value, false, packed) == nil, "")
+			if err := decoder.value(key, false, field); err != nil {
+				return err
+			}
+			if err := decoder.value(value, false, field); err != nil {
+				return err
+			}
 			v.SetMapIndex(key, value)
 		}
 	case reflect.Struct:
-		return queryStruct(v.Type()).decode(decoder, v)
+		if decoder.cLayout != nil {
+			return decoder.cValue(v, field)
+		}
+		return field.structOf(v.Type()).decode(decoder, v)
+
+	case reflect.Interface:
+		return decoder.iface(v, field)
 
 	default:
 		if newPtr(v, decoder, topLevel) {
 			if !v.IsNil() {
-				return decoder.value(v.Elem(), false, packed)
+				return decoder.value(v.Elem(), false, field)
 			}
 		} else {
-			return fmt.Errorf("binary.Decoder.Value: unsupported type %s", v.Type().String())
+			return errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported type %s", v.Type().String())
 		}
 	}
 	return nil
 }
 
+// integer decode int/uint value v of kind k by the reflect path.
+// Fields of tag `binary:"bits=N"` are decoded from bits shared with bools here,
+// so that values of other kinds need not to check it.
+func (decoder *Decoder) integer(v reflect.Value, k reflect.Kind, field *fieldInfo) {
+	if field != nil && field.bits > 0 { //bits shared with bools
+		decoder.bitField(v, field.bits)
+		return
+	}
+	switch k {
+	case reflect.Int:
+		if field.isFixed() {
+			v.SetInt(decoder.Int64(false))
+		} else {
+			v.SetInt(int64(decoder.Int()))
+		}
+	case reflect.Uint:
+		if field.isFixed() {
+			v.SetUint(decoder.Uint64(false))
+		} else {
+			v.SetUint(uint64(decoder.Uint()))
+		}
+
+	case reflect.Int8:
+		v.SetInt(int64(decoder.Int8()))
+	case reflect.Int16:
+		v.SetInt(int64(decoder.Int16(field.isPacked())))
+	case reflect.Int32:
+		v.SetInt(int64(decoder.Int32(field.isPacked())))
+	case reflect.Int64:
+		v.SetInt(decoder.Int64(field.isPacked()))
+
+	case reflect.Uint8:
+		v.SetUint(uint64(decoder.Uint8()))
+	case reflect.Uint16:
+		v.SetUint(uint64(decoder.Uint16(field.isPacked())))
+	case reflect.Uint32:
+		v.SetUint(uint64(decoder.Uint32(field.isPacked())))
+	case reflect.Uint64:
+		v.SetUint(decoder.Uint64(field.isPacked()))
+	}
+}
+
+// array decode slice/array v, of which elements are decoded by elem, or by
+// info of registed struct elements, or by the reflect path if both are nil.
+func (decoder *Decoder) array(v reflect.Value, field *fieldInfo, info *structInfo, elem fieldDecoder) error {
+	k := v.Kind()
+	if k == reflect.Slice && decoder.nilFlag(v, field) {
+		return nil
+	}
+	et := v.Type().Elem()
+	if isRuneElem(et, field) { //UTF-8 text
+		decoder.runes(v, field)
+		return nil
+	}
+	if k == reflect.Slice && et.Kind() == reflect.Uint8 && decoder.zeroCopyBytes() {
+		size, _ := decoder.length(field)
+		if b := decoder.reserve(size); size > 0 || field.isNilable() {
+			v.SetBytes(b[:size:size]) //refers to the decoder buffer
+		}
+		return nil
+	}
+	if decoder.boolArray(v, field) >= 0 { //deal with bool array first
+		return nil
+	}
+	size, _ := decoder.arrayLength(v.Type(), field)
+	if k == reflect.Slice && (size > 0 || field.isNilable()) { //make a new slice
+		decoder.alloc(size, int(et.Size()))
+		decoder.makeSlice(v, size)
+	}
+	if decoder.numbers(v, size, field) { //copy memory of numbers at once
+		return nil
+	}
+	if isDeltaElem(et, field) { //varint deltas
+		decoder.deltas(v, size)
+		return nil
+	}
+	if isGroupVarintElem(et, field) { //group varints
+		decoder.groupVarints(v, size)
+		return nil
+	}
+	if isColumnarElem(et, field) { //field by field
+		return decoder.columns(v, size)
+	}
+
+	l := v.Len()
+	if elem == nil && info == nil {
+		info = queryStructElem(et, field)
+	}
+	if info != nil {
+		elem = info.decode
+	}
+	if decoder.maxDepth > 0 || decoder.cLayout != nil { //decode elements by value to check depth or in C layout
+		elem = nil
+	}
+	i := -1 //element being decoded, to locate errors of panics
+	defer func() { decoder.unwind(recover(), et, i, false) }()
+	for i = 0; i < size; i++ {
+		if i < l && elem != nil {
+			if err := elem(decoder, v.Index(i)); err != nil {
+				return decoder.indexError(err, et, i)
+			}
+		} else if i < l {
+			if err := decoder.value(v.Index(i), false, field.elemField()); err != nil {
+				return decoder.indexError(err, et, i)
+			}
+		} else {
+			skiped := decoder.skipByType(et, field.elemField())
+			assert(skiped >= 0, et.String()) //I'm sure here cannot find unsupported type
+		}
+	}
+	return nil
+}
+
+// pointer decode one bool bit for nil or not of pointer v, and its element
+// by elem, allocating a new element if v is nil.
+func (decoder *Decoder) pointer(v reflect.Value, elem fieldDecoder) error {
+	if decoder.Bool() && v.IsNil() {
+		v.Set(decoder.newValue(v.Type().Elem()))
+	}
+	if v.IsNil() {
+		return nil
+	}
+	return elem(decoder, v.Elem())
+}
+
 func (decoder *Decoder) fastValue(x interface{}) bool {
 	switch d := x.(type) {
 	case *int:
@@ -466,10 +934,13 @@ func (decoder *Decoder) fastValue(x interface{}) bool {
 
 	case *string:
 		*d = decoder.String()
+	case *time.Time:
+		*d = decoder.Time()
+	case *time.Duration:
+		*d = decoder.Duration()
 
 	case *[]bool:
-		s, _ := decoder.Uvarint()
-		l := int(s)
+		l := decoder.allocLength(nil, int(unsafe.Sizeof((*d)[0])))
 		*d = make([]bool, l)
 		var b []byte
 		for i := 0; i < l; i++ {
@@ -483,120 +954,143 @@ func (decoder *Decoder) fastValue(x interface{}) bool {
 		}
 
 	case *[]int:
-		s, _ := decoder.Uvarint()
-		l := int(s)
+		l := decoder.allocLength(nil, int(unsafe.Sizeof((*d)[0])))
 		*d = make([]int, l)
 		for i := 0; i < l; i++ {
 			(*d)[i] = decoder.Int()
 		}
 	case *[]uint:
-		s, _ := decoder.Uvarint()
-		l := int(s)
+		l := decoder.allocLength(nil, int(unsafe.Sizeof((*d)[0])))
 		*d = make([]uint, l)
 		for i := 0; i < l; i++ {
 			(*d)[i] = decoder.Uint()
 		}
-
-	case *[]int8:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]int8, l)
+	case *[]time.Duration:
+		l := decoder.allocLength(nil, int(unsafe.Sizeof((*d)[0])))
+		*d = make([]time.Duration, l)
 		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Int8()
+			(*d)[i] = decoder.Duration()
 		}
+
 	case *[]uint8:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]uint8, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Uint8()
-		}
-	case *[]int16:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]int16, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Int16(false)
-		}
-	case *[]uint16:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]uint16, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Uint16(false)
-		}
-	case *[]int32:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]int32, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Int32(false)
-		}
-	case *[]uint32:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]uint32, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Uint32(false)
-		}
-	case *[]int64:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]int64, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Int64(false)
-		}
-	case *[]uint64:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]uint64, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Uint64(false)
-		}
-	case *[]float32:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]float32, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Float32()
-		}
-	case *[]float64:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]float64, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Float64()
-		}
-	case *[]complex64:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]complex64, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Complex64()
-		}
-	case *[]complex128:
-		s, _ := decoder.Uvarint()
-		l := int(s)
-		*d = make([]complex128, l)
-		for i := 0; i < l; i++ {
-			(*d)[i] = decoder.Complex128()
+		*d = decoder.Bytes()
+	case *[]int8, *[]int16, *[]uint16, *[]int32, *[]uint32, *[]int64, *[]uint64,
+		*[]float32, *[]float64, *[]complex64, *[]complex128:
+		v := reflect.ValueOf(d).Elem()
+		if !canBulk(v, bulkWordSize(v.Type().Elem(), nil), decoder.endian) {
+			return false
 		}
+		l := decoder.allocLength(nil, int(v.Type().Elem().Size()))
+		decoder.makeSlice(v, l)
+		decoder.numbers(v, l, nil) //copy memory at once
 	case *[]string:
-		s, _ := decoder.Uvarint()
-		l := int(s)
+		l := decoder.allocLength(nil, int(unsafe.Sizeof((*d)[0])))
 		*d = make([]string, l)
 		for i := 0; i < l; i++ {
 			(*d)[i] = decoder.String()
 		}
 	default:
-		return false
+		return decoder.fastMap(x)
 	}
 	return true
 }
 
-func (decoder *Decoder) skipByType(t reflect.Type, packed bool) int {
+// ValueFields decode the fields with names of struct value only, and skip the
+// other fields in buffer without decoding them.
+// x must be pointer of struct, and fields of x without names are not modified.
+// Use RegStruct for the struct type to improve efficiency.
+// It will return none-nil error if x has no field of a name.
+func (decoder *Decoder) ValueFields(x interface{}, names ...string) (err error) {
+	endian := decoder.endian
+	defer func() {
+		if info := recover(); info != nil {
+			err = panicError(info, "binary.Decoder.ValueFields")
+			decoder.endian = endian //restore endian changed by field tag
+		}
+		if err != nil {
+			err = decoder.pathError(err)
+		}
+	}()
+
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binary.Decoder.ValueFields: non-pointer of struct type %T", x)
+	}
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	decoder.resetBoolCoder() //reset bool reader
+	decoder.depth = 0
+	decoder.allocated = 0
+	if decoder.msgpack || decoder.cbor {
+		return fmt.Errorf("binary.Decoder.ValueFields: unsupported in MessagePack/CBOR format")
+	}
+	defer decoder.endTable()
+	decoder.beginTable() //decode string table first
+	v = v.Elem()
+	decoder.beginPath(v.Type())
+	return queryStruct(v.Type()).decodeFields(decoder, v, selected)
+}
+
+// SkipValue skip the next value of type t without decoding it, and returns
+// bytes number skiped.
+// Pointer type t is same to its element type, as the data for Value.
+// It will return none-nil error if t is unsupported type or buffer is not enough.
+func (decoder *Decoder) SkipValue(t reflect.Type) (n int, err error) {
+	endian := decoder.endian
+	defer func() {
+		if info := recover(); info != nil {
+			err = panicError(info, "binary.Decoder.SkipValue")
+			decoder.endian = endian //restore endian changed by field tag
+		}
+	}()
+
+	if !validUserType(t) {
+		return 0, errorf(ErrUnsupportedType, "binary.Decoder.SkipValue: unsupported type %s", t.String())
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	decoder.resetBoolCoder() //reset bool reader
+	decoder.depth = 0
+	pos := decoder.pos
+	if decoder.msgpack { //MessagePack format
+		decoder.mpSkip()
+		return decoder.pos - pos, nil
+	}
+	if decoder.cbor { //CBOR format
+		decoder.cborSkip(decoder.cborHead())
+		return decoder.pos - pos, nil
+	}
+	defer decoder.endTable()
+	decoder.beginTable() //skip string table first
+	s := decoder.skipByType(t, nil)
+	if decoder.reader != nil { //read pointer is not moved when decoding from reader
+		return s, nil
+	}
+	return decoder.pos - pos, nil
+}
+
+func (decoder *Decoder) skipByType(t reflect.Type, field *fieldInfo) int {
+	if decoder.maxDepth > 0 {
+		decoder.enter()
+		defer decoder.leave()
+	}
+	if codec := decoder.codecs.find(t); codec != nil { //overrided codec
+		return codec.skipByType(decoder, t, field)
+	}
+	if codec := queryCodec(t, field); codec != nil {
+		return codec.skipByType(decoder, t, field)
+	}
+	if n := field.bitsOf(t); n > 0 { //bits shared with bools
+		decoder.Bits(n)
+		return (n + 7) / 8
+	}
 	if s := fixedTypeSize(t); s > 0 {
-		if packedType := packedIntsType(t); packedType > 0 && packed {
+		if packedType := packedIntsType(t); packedType > 0 && field.isPacked() {
 			switch packedType {
 			case _SignedInts:
 				_, n := decoder.Varint()
@@ -611,75 +1105,121 @@ func (decoder *Decoder) skipByType(t reflect.Type, packed bool) int {
 		}
 	}
 	switch t.Kind() {
+	case reflect.Interface:
+		return decoder.skipInterface(field)
 	case reflect.Ptr:
 		if isNotNil := decoder.Bool(); isNotNil {
-			return decoder.skipByType(t.Elem(), packed) + 1
+			return decoder.skipByType(t.Elem(), field) + 1
 		}
 		return 1
 	case reflect.Bool:
 		decoder.Bool()
 		return 1
-	case reflect.Int:
-		_, n := decoder.Varint()
-		return n
-	case reflect.Uint:
+	case reflect.Int, reflect.Uint:
+		if field.isFixed() {
+			decoder.Skip(8)
+			return 8
+		}
 		_, n := decoder.Uvarint()
 		return n
 	case reflect.String:
-		s, n := decoder.Uvarint()
-		size := int(s) //string length and data
-		decoder.Skip(size)
-		return size + n
+		return decoder.skipString(field)
 	case reflect.Slice, reflect.Array:
-		s, sLen := decoder.Uvarint()
-		cnt := int(s)
+		flag := 0
+		if t.Kind() == reflect.Slice && field.isNilable() {
+			if isNotNil := decoder.Bool(); !isNotNil {
+				return 1
+			}
+			flag = 1
+		}
+		cnt, sLen := decoder.arrayLength(t, field)
+		sLen += flag
 		elemtype := t.Elem()
-		if s := fixedTypeSize(elemtype); s > 0 {
+		if isRuneElem(elemtype, field) { //UTF-8 text
+			decoder.Skip(cnt)
+			return cnt + sLen
+		}
+		if isDeltaElem(elemtype, field) { //varint deltas
+			return decoder.skipDeltas(cnt) + sLen
+		}
+		if isGroupVarintElem(elemtype, field) { //group varints
+			return decoder.skipGroupVarints(cnt) + sLen
+		}
+		if s := fixedElemSize(elemtype, field); s > 0 {
 			size := cnt * s
 			decoder.Skip(size)
-			return size
+			return size + sLen
 		}
 
-		if elemtype.Kind() == reflect.Bool { //compressed bool array
-			totalSize := sizeofBoolArray(cnt)
-			size := totalSize - SizeofUvarint(uint64(cnt)) //cnt has been read
+		if isBoolElem(elemtype, field) { //compressed bool array
+			size := (cnt + 8 - 1) / 8 //cnt has been read
 			decoder.Skip(size)
-			return totalSize
+			return size + sLen
+		}
+
+		if isColumnarElem(elemtype, field) { //field by field
+			return decoder.skipColumns(elemtype, cnt) + sLen
 		}
 
 		sum := sLen //array size
 		for i, n := 0, cnt; i < n; i++ {
-			s := decoder.skipByType(elemtype, packed)
+			s := decoder.skipByType(elemtype, field.elemField())
 			assert(s >= 0, "skip fail: "+elemtype.String()) //I'm sure here cannot find unsupported type
 			sum += s
 		}
 		return sum
 	case reflect.Map:
-		s, sLen := decoder.Uvarint()
-		cnt := int(s)
+		flag := 0
+		if field.isNilable() {
+			if isNotNil := decoder.Bool(); !isNotNil {
+				return 1
+			}
+			flag = 1
+		}
+		cnt, sLen := decoder.length(field)
+		sLen += flag
 		kt := t.Key()
 		vt := t.Elem()
 		sum := sLen //array size
 		for i, n := 0, cnt; i < n; i++ {
-			sum += decoder.skipByType(kt, packed)
-			sum += decoder.skipByType(vt, packed)
+			sum += decoder.skipByType(kt, field)
+			sum += decoder.skipByType(vt, field)
 		}
 		return sum
 
 	case reflect.Struct:
-		return queryStruct(t).decodeSkipByType(decoder, t, packed)
+		if decoder.cLayout != nil {
+			size, _ := decoder.cLayout.layoutOf(t)
+			if size < 0 {
+				panic(cLayoutError(t))
+			}
+			decoder.Skip(size)
+			return size
+		}
+		return field.structOf(t).decodeSkipByType(decoder, t)
 	}
 	return -1
 }
 
+// nilFlag decode the bool bit of slice/map v for field tag `binary:"nilable"`,
+// and set v to nil if it is not set.
+// It reports whether v is nil.
+func (decoder *Decoder) nilFlag(v reflect.Value, field *fieldInfo) bool {
+	if !field.isNilable() || decoder.Bool() {
+		return false
+	}
+	v.Set(reflect.Zero(v.Type()))
+	return true
+}
+
 // decode bool array
-func (decoder *Decoder) boolArray(v reflect.Value) int {
+func (decoder *Decoder) boolArray(v reflect.Value, field *fieldInfo) int {
 	if k := v.Kind(); k == reflect.Slice || k == reflect.Array {
-		if v.Type().Elem().Kind() == reflect.Bool {
-			_l, _ := decoder.Uvarint()
-			l := int(_l)
-			if k == reflect.Slice && l > 0 { //make a new slice
-				v.Set(reflect.MakeSlice(v.Type(), l, l))
+		if isBoolElem(v.Type().Elem(), field) {
+			l, n := decoder.arrayLength(v.Type(), field)
+			if k == reflect.Slice && (l > 0 || field.isNilable()) { //make a new slice
+				decoder.alloc(l, 1)
+				decoder.makeSlice(v, l)
 			}
 			var b []byte
 			for i := 0; i < l; i++ {
@@ -688,10 +1228,11 @@ func (decoder *Decoder) boolArray(v reflect.Value) int {
 				if bit == 0 {
 					b = decoder.reserve(1)
 				}
-				x := ((b[0] & mask) != 0)
-				v.Index(i).SetBool(x)
+				if i < v.Len() { //elements out of array are skiped
+					v.Index(i).SetBool((b[0] & mask) != 0)
+				}
 			}
-			return sizeofBoolArray(l)
+			return n + (l+8-1)/8
 		}
 	}
 	return -1
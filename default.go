@@ -0,0 +1,62 @@
+// fill fields absent on the wire with default values for field tag
+// `binary:"default=V"`, instead of leaving zero values.
+// Fields may be absent when decoding tagged structs, migrating old versions
+// of structs, and decoding structs in MessagePack, CBOR or self-describing
+// streams. Defaults are not applied in protobuf format, which omits zero values.
+// Default values are of bool, int, uint, float and string kinds, and a
+// string default must not contain comma.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// parseDefault parse default value of field by its kind.
+func (field *fieldInfo) parseDefault(value string) error {
+	t := field.field.Type
+	v := reflect.New(t).Elem()
+	var err error
+	switch t.Kind() {
+	case reflect.Bool:
+		var x bool
+		x, err = strconv.ParseBool(value)
+		v.SetBool(x)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var x int64
+		x, err = strconv.ParseInt(value, 0, t.Bits())
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var x uint64
+		x, err = strconv.ParseUint(value, 0, t.Bits())
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		var x float64
+		x, err = strconv.ParseFloat(value, t.Bits())
+		v.SetFloat(x)
+	case reflect.String:
+		v.SetString(value)
+	default:
+		return fmt.Errorf("binary: default value of field %s is not supported for type %s", field.field.Name, t.String())
+	}
+	if err != nil {
+		return fmt.Errorf("binary: invalid tag option default=%s of field %s", value, field.field.Name)
+	}
+	field.def = v
+	return nil
+}
+
+// setDefaults set fields of struct v with default values,
+// and only fields with names if names is not nil.
+func (info *structInfo) setDefaults(v reflect.Value, names map[string]bool) {
+	if info == nil || !info.hasDefault {
+		return
+	}
+	for i, field := range info.fields {
+		if field.def.IsValid() && !field.ignore && (names == nil || names[field.field.Name]) {
+			info.fieldOf(v, i).Set(field.def)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// encode/decode integer slices/arrays as varint deltas from previous elements,
+// for field tag `binary:"delta"`.
+// Sorted ints such as timestamps and increasing IDs have small deltas,
+// which are encoded in few bytes.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// isDeltaElem reports whether slice/array elements of type t are encoded as deltas.
+func isDeltaElem(t reflect.Type, field *fieldInfo) bool {
+	if !field.isDelta() || queryCodec(t, field) != nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// deltaAt returns delta of element i of integer slice/array v from element i-1.
+// Deltas of uints wrap around, so unsorted elements are encoded as well.
+func deltaAt(v reflect.Value, i int) int64 {
+	if isUintKind(v.Type().Elem().Kind()) {
+		x := v.Index(i).Uint()
+		if i > 0 {
+			x -= v.Index(i - 1).Uint()
+		}
+		return int64(x)
+	}
+	x := v.Index(i).Int()
+	if i > 0 {
+		x -= v.Index(i - 1).Int()
+	}
+	return x
+}
+
+func isUintKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// sizeofDeltas returns bytes of delta encoded elements of integer slice/array v.
+func sizeofDeltas(v reflect.Value) int {
+	s := 0
+	for i, l := 0, v.Len(); i < l; i++ {
+		s += SizeofVarint(deltaAt(v, i))
+	}
+	return s
+}
+
+// deltas encode elements of integer slice/array v as varint deltas.
+func (encoder *Encoder) deltas(v reflect.Value) {
+	for i, l := 0, v.Len(); i < l; i++ {
+		encoder.Varint(deltaAt(v, i))
+	}
+}
+
+// deltas decode size varint deltas to integer slice/array v,
+// elements out of v are skiped.
+func (decoder *Decoder) deltas(v reflect.Value, size int) {
+	unsigned := isUintKind(v.Type().Elem().Kind())
+	l := v.Len()
+	var x int64
+	for i := 0; i < size; i++ {
+		d, _ := decoder.Varint()
+		x += d
+		if i >= l {
+			continue
+		}
+		if unsigned {
+			v.Index(i).SetUint(uint64(x))
+		} else {
+			v.Index(i).SetInt(x)
+		}
+	}
+}
+
+// skipDeltas skip cnt varint deltas, and returns bytes skiped.
+func (decoder *Decoder) skipDeltas(cnt int) int {
+	sum := 0
+	for i := 0; i < cnt; i++ {
+		_, n := decoder.Varint()
+		sum += n
+	}
+	return sum
+}
@@ -0,0 +1,134 @@
+// print annotated hexdumps of encoded buffers by type info of registered
+// structs, for debugging the wire format.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Dump returns hexdump of data encoded from value of type of x, interleaved
+// with offsets, names and types of fields. x is value or pointer of the type,
+// nil pointer is aviable. Fields of structs and elements of slices of structs
+// are dumped recursively, and other values are dumped as a whole.
+// Bools shared bytes with previous bools are dumped with no bytes.
+// Errors and trailing bytes are dumped at the end, as:
+//
+//	000000                                                  pkg.Item
+//	000000  07 00 00 00                                       ID uint32
+//	000004  03 61 62 63                                       Name string
+func Dump(data []byte, x interface{}) string {
+	d := &dumper{data: data}
+	d.decoder.Init(data, DefaultEndian)
+	d.decoder.resetBoolCoder()
+	t := reflect.TypeOf(x)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	func() {
+		defer func() {
+			if info := recover(); info != nil {
+				d.buf.WriteString(fmt.Sprintf("error: %v\n", info))
+			}
+		}()
+		if t == nil || !validUserType(t) {
+			panic(errorf(ErrUnsupportedType, "binary.Dump: unsupported type %T", x))
+		}
+		d.value(t, nil, "", 0)
+	}()
+	if d.decoder.pos < len(data) {
+		d.line(d.decoder.pos, len(data), 0, "(trailing bytes)")
+	}
+	return d.buf.String()
+}
+
+type dumper struct {
+	data    []byte
+	decoder Decoder
+	buf     strings.Builder
+}
+
+// line write hexdump of data[start:end] with label at depth.
+func (d *dumper) line(start, end, depth int, label string) {
+	label = strings.Repeat("  ", depth) + label
+	for {
+		n := end - start
+		if n > 16 {
+			n = 16
+		}
+		hex := make([]string, n)
+		for i := range hex {
+			hex[i] = fmt.Sprintf("%02x", d.data[start+i])
+		}
+		d.buf.WriteString(strings.TrimRight(fmt.Sprintf("%06x  %-48s  %s", start, strings.Join(hex, " "), label), " "))
+		d.buf.WriteByte('\n')
+		if start += n; start >= end {
+			return
+		}
+		label = ""
+	}
+}
+
+// value dump value of type t with name.
+func (d *dumper) value(t reflect.Type, field *fieldInfo, name string, depth int) {
+	label := strings.TrimSpace(name + " " + schemaType(t))
+	start := d.decoder.pos
+	switch {
+	case queryCodec(t, field) != nil || field.bitsOf(t) > 0:
+	case t.Kind() == reflect.Struct:
+		d.line(start, start, depth, label)
+		d.structFields(t, depth+1)
+		return
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && !field.isNilable() &&
+		t.Elem().Kind() == reflect.Struct && queryCodec(t.Elem(), field) == nil && !isColumnarElem(t.Elem(), field):
+		n, _ := d.decoder.length(field)
+		d.line(start, d.decoder.pos, depth, fmt.Sprintf("%s len=%d", label, n))
+		for i := 0; i < n; i++ {
+			d.value(t.Elem(), field, fmt.Sprintf("[%d]", i), depth+1)
+		}
+		return
+	}
+	d.decoder.skipByType(t, field)
+	if d.decoder.pos == start && t.Kind() == reflect.Bool {
+		label += " (bit)"
+	}
+	d.line(start, d.decoder.pos, depth, label)
+}
+
+// structFields dump fields of struct t.
+func (d *dumper) structFields(t reflect.Type, depth int) {
+	info := queryStruct(t)
+	start := d.decoder.pos
+	if version := info.versionOf(); version > 0 {
+		v, _ := d.decoder.version()
+		d.line(start, d.decoder.pos, depth, fmt.Sprintf("version=%d", v))
+		if v != version { //fields of other versions
+			p := d.decoder.pos
+			info.skipVersion(&d.decoder, t, v, start)
+			d.line(p, d.decoder.pos, depth, "(fields of other version)")
+			return
+		}
+	}
+	if info.isTagged() {
+		p := d.decoder.pos
+		d.decoder.skipTagged()
+		d.line(p, d.decoder.pos, depth, "(tagged fields)")
+		return
+	}
+	for j, n := 0, t.NumField(); j < n; j++ {
+		i := info.index(j)
+		f := info.field(i)
+		if !f.isValid(i, t) {
+			continue
+		}
+		if p := d.decoder.pos; d.decoder.skipToOffset(start, f) > 0 {
+			d.line(p, d.decoder.pos, depth, "(padding)")
+		}
+		endian := d.decoder.endian
+		d.decoder.endian = f.endianOf(endian)
+		d.value(f.Type(i, t), f, t.Field(i).Name, depth)
+		d.decoder.endian = endian
+	}
+}
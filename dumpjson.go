@@ -0,0 +1,181 @@
+// print encoded buffers as JSON by type info of registered structs, for
+// debugging payloads captured off the wire.
+
+package binary
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var tJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// DumpJSON decode data as value of type t by SafeDecoder, and print it as JSON.
+// Field tags of registered structs are applied as Decode.
+// Byte slices/arrays are printed as hex strings, keys of maps are printed as
+// strings in sorted order, and NaN/Inf floats are printed as strings.
+// Types which implement json.Marshaler or encoding.TextMarshaler are printed
+// by them.
+func DumpJSON(data []byte, t reflect.Type) (string, error) {
+	if t == nil || !validUserType(t) {
+		return "", errorf(ErrUnsupportedType, "binary.DumpJSON: unsupported type %v", t)
+	}
+	v := reflect.New(t)
+	if err := NewSafeDecoder(data).Value(v.Interface()); err != nil { //data off the wire is untrusted
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, v.Elem()); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeJSON write v as JSON to buf.
+func writeJSON(buf *bytes.Buffer, v reflect.Value) error {
+	t := v.Type()
+	if v.CanInterface() && isJSONMarshaler(t) { //including pointers such as *big.Int
+		return writeJSONMarshaler(buf, v.Interface())
+	}
+	if v.CanAddr() && v.Addr().CanInterface() && isJSONMarshaler(reflect.PtrTo(t)) { //methods of pointer receiver
+		return writeJSONMarshaler(buf, v.Addr().Interface())
+	}
+
+	switch k := v.Kind(); k {
+	case reflect.Bool:
+		buf.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buf.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		buf.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		writeJSONFloat(buf, v.Float(), t.Bits())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		buf.WriteByte('[')
+		writeJSONFloat(buf, real(c), t.Bits()/2)
+		buf.WriteByte(',')
+		writeJSONFloat(buf, imag(c), t.Bits()/2)
+		buf.WriteByte(']')
+	case reflect.String:
+		writeJSONString(buf, v.String())
+	case reflect.Slice, reflect.Array:
+		if k == reflect.Slice && v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 { //hex string
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			writeJSONString(buf, hex.EncodeToString(b))
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, n := 0, v.Len(); i < n; i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSON(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value, v.Len())
+		for _, key := range v.MapKeys() {
+			var s string
+			if key.Kind() == reflect.String {
+				s = key.String()
+			} else {
+				var kb bytes.Buffer
+				if err := writeJSON(&kb, key); err != nil {
+					return err
+				}
+				s = kb.String()
+			}
+			keys = append(keys, s)
+			values[s] = v.MapIndex(key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, key)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, values[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case reflect.Struct:
+		info := queryStruct(t)
+		buf.WriteByte('{')
+		first := true
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if !info.fieldValid(i, t) {
+				continue
+			}
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			writeJSONString(buf, t.Field(i).Name)
+			buf.WriteByte(':')
+			if err := writeJSON(buf, v.Field(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSON(buf, v.Elem())
+	default:
+		return errorf(ErrUnsupportedType, "binary.DumpJSON: unsupported type %s", t.String())
+	}
+	return nil
+}
+
+// isJSONMarshaler reports whether values of type t are printed by
+// json.Marshaler or encoding.TextMarshaler.
+func isJSONMarshaler(t reflect.Type) bool {
+	return t.Kind() != reflect.Interface && (t.Implements(tJSONMarshaler) || t.Implements(tTextMarshaler))
+}
+
+// writeJSONMarshaler write x which implements json.Marshaler or
+// encoding.TextMarshaler as JSON to buf.
+func writeJSONMarshaler(buf *bytes.Buffer, x interface{}) error {
+	b, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+func writeJSONFloat(buf *bytes.Buffer, f float64, bits int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		writeJSONString(buf, strconv.FormatFloat(f, 'g', -1, bits))
+		return
+	}
+	buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
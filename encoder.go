@@ -1,9 +1,14 @@
 package binary
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"reflect"
+	"sort"
+	"sync"
+	"time"
 )
 
 // NewEncoder make a new Encoder object with buffer size.
@@ -21,6 +26,25 @@ func NewEncoderBuffer(buffer []byte) *Encoder {
 	return p
 }
 
+// _encoderPool is the pool of Encoders of Encode and generic functions,
+// so that they do not allocate an Encoder for each call.
+var _encoderPool = sync.Pool{New: func() interface{} { return new(Encoder) }}
+
+// getEncoder returns an Encoder of buffer from pool, which must be returned
+// by putEncoder after use.
+func getEncoder(buffer []byte) *Encoder {
+	encoder := _encoderPool.Get().(*Encoder)
+	encoder.buff = buffer
+	encoder.endian = DefaultEndian
+	return encoder
+}
+
+// putEncoder reset encoder and return it to pool.
+func putEncoder(encoder *Encoder) {
+	*encoder = Encoder{}
+	_encoderPool.Put(encoder)
+}
+
 // NewEncoderEndian make a new Encoder object with buffer size and endian.
 func NewEncoderEndian(size int, endian Endian) *Encoder {
 	p := &Encoder{}
@@ -31,6 +55,25 @@ func NewEncoderEndian(size int, endian Endian) *Encoder {
 // Encoder is used to encode go data to byte array.
 type Encoder struct {
 	coder
+	visitor       ptrVisitor //detect cycles of pointers
+	deterministic bool       //if sort keys of maps before encoding
+	useTable      bool       //if encode strings by string table
+	fixedArrays   bool       //if encode arrays without length prefix
+	parallel      int        //goroutines to encode large slices of fixed-size structs, less than 2 means not
+
+	strs    *stringTable //string table of encoding value, nil if not used
+	varint  VarintFormat //format of varints
+	cLayout *CLayout     //C layout of structs, nil means not
+	msgpack bool         //if encode in MessagePack format
+	cbor    bool         //if encode in CBOR format
+	std     bool         //if encode in layout of encoding/binary
+
+	tracer    Tracer  //observe fields of structs, nil means not
+	traceBase int     //offset of buffer in traced buffer
+	codecs    *Codecs //codec overrides of types, nil means not
+
+	pool   *BufferPool   //pool of buffers handed out by TakeBuffer, nil means the default pool
+	growth *GrowthPolicy //policy of growing buffer, nil means not grow
 }
 
 // Init initialize Encoder with buffer size and endian.
@@ -51,6 +94,43 @@ func (encoder *Encoder) ResizeBuffer(size int) bool {
 	return ok
 }
 
+// ResetBuffer reset Encoder to encode into buf, such as preallocated or
+// pooled packet buffers, instead of copying out of Buffer.
+// The encoded bytes are buf[:Len()], and it will panic if buf is not enough
+// as other buffers. Options of Encoder are kept.
+func (encoder *Encoder) ResetBuffer(buf []byte) {
+	encoder.buff = buf
+	encoder.pos = 0
+	encoder.resetBoolCoder()
+}
+
+// WriteTo writes the encoded bytes to w, and implements io.WriterTo.
+// The encoded bytes are kept, call Reset to encode next values.
+func (encoder *Encoder) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(encoder.Buffer())
+	if err == nil && n < encoder.Len() {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
+
+// SetDeterministic set if Encoder sort keys of maps before encoding them,
+// so that the same value always produces the same bytes.
+// It is required for hashing, signing and reproducible snapshots.
+func (encoder *Encoder) SetDeterministic(deterministic bool) {
+	encoder.deterministic = deterministic
+}
+
+// SetStringTable set if Encoder encode strings of a value by a string table,
+// which is emitted once before the value, and strings are encoded as indexes of it.
+// It shrinks values with repeated strings, such as log/event payloads.
+// The value is encoded twice to collect its strings.
+// Use SizeofStringTable to get size of the value encoded with string table,
+// and the Decoder must SetStringTable too.
+func (encoder *Encoder) SetStringTable(useTable bool) {
+	encoder.useTable = useTable
+}
+
 // Bool encode a bool value to Encoder buffer.
 // It will panic if buffer is not enough.
 func (encoder *Encoder) Bool(x bool) {
@@ -172,11 +252,54 @@ func (encoder *Encoder) Complex128(x complex128) {
 // String encode a string value to Encoder buffer.
 // It will panic if buffer is not enough.
 func (encoder *Encoder) String(x string) {
-	_b := []byte(x)
-	size := len(_b)
-	encoder.Uvarint(uint64(size))
+	encoder.string(x, nil)
+}
+
+// Bytes encode a byte slice to Encoder buffer with uvarint length prefix.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Bytes(x []byte) {
+	encoder.bytes(x, nil)
+}
+
+// string encode a string value with length prefix of field.
+func (encoder *Encoder) string(x string, field *fieldInfo) {
+	if encoder.tableString(x, field) {
+		return
+	}
+	size := len(x)
+	encoder.length(size, field)
+	buff := encoder.reserve(size)
+	copy(buff, x)
+}
+
+// bytes encode a byte slice with length prefix of field.
+func (encoder *Encoder) bytes(x []byte, field *fieldInfo) {
+	size := len(x)
+	encoder.length(size, field)
 	buff := encoder.reserve(size)
-	copy(buff, _b)
+	copy(buff, x)
+}
+
+// length encode length of string, slice, array or map as length prefix of field.
+// It will panic if buffer is not enough or length overflows the length prefix.
+func (encoder *Encoder) length(l int, field *fieldInfo) {
+	if field.isNoLen() { //implied by context
+		return
+	}
+	s := field.lenPrefixSize()
+	if s > 0 && uint64(l) >= 1<<(uint(s)*8) {
+		panic(errorf(ErrOverflow, "binary.Encoder: length %d overflows %d bytes length prefix", l, s))
+	}
+	switch s {
+	case 1:
+		encoder.Uint8(uint8(l))
+	case 2:
+		encoder.Uint16(uint16(l), false)
+	case 4:
+		encoder.Uint32(uint32(l), false)
+	default:
+		encoder.Uvarint(uint64(l))
+	}
 }
 
 // Int encode an int value to Encoder buffer.
@@ -200,8 +323,15 @@ func (encoder *Encoder) Varint(x int64) int {
 }
 
 // Uvarint encode a uint64 value to Encoder buffer with varint(1~10 bytes).
+// The varint is of format set by SetVarintFormat.
 // It will panic if buffer is not enough.
 func (encoder *Encoder) Uvarint(x uint64) int {
+	switch encoder.varint {
+	case VarintSQLite:
+		return encoder.sqliteUvarint(x)
+	case VarintGit:
+		return encoder.gitUvarint(x)
+	}
 	i, _x := 0, x
 	for ; _x >= 0x80; _x >>= 7 {
 		encoder.Uint8(byte(_x) | 0x80)
@@ -216,15 +346,41 @@ func (encoder *Encoder) Uvarint(x uint64) int {
 // or buffer is not enough.
 // It will check if x implements interface BinaryEncoder and use x.Encode first.
 func (encoder *Encoder) Value(x interface{}) (err error) {
+	endian := encoder.endian
 	defer func() {
 		if e := recover(); e != nil {
-			err = e.(error)
+			err = panicError(e, "binary.Encoder.Value")
+			encoder.endian = endian //restore endian changed by field tag
 		}
 	}()
 
-	encoder.resetBoolCoder() //reset bool writer
+	encoder.resetBoolCoder()       //reset bool writer
+	encoder.visitor = ptrVisitor{} //reset cycle detector
+
+	if encoder.msgpack { //MessagePack format
+		encoder.mpValue(reflect.ValueOf(x))
+		return nil
+	}
+
+	if encoder.cbor { //CBOR format
+		encoder.cborValue(reflect.ValueOf(x))
+		return nil
+	}
 
-	if encoder.fastValue(x) { //fast value path
+	if encoder.std { //layout of encoding/binary
+		encoder.stdValue(x)
+		return nil
+	}
+
+	if encoder.useTable && encoder.strs == nil { //collect strings and encode table first
+		t, err := collectStrings(x, encoder.endian, encoder.deterministic, encoder.varint)
+		if err != nil {
+			return err
+		}
+		return encoder.valueTable(x, t)
+	}
+
+	if encoder.codecs == nil && encoder.fastValue(x) { //fast value path
 		return nil
 	}
 
@@ -235,6 +391,7 @@ func (encoder *Encoder) Value(x interface{}) (err error) {
 			panic(fmt.Errorf("expect but not BinarySizer: %s", v.Type().String()))
 		}
 
+		encoder.ensure(x.(BinarySizer).Size())
 		r, err := p.Encode(encoder.buff[encoder.pos:])
 		if err == nil {
 			encoder.reserve(len(r))
@@ -246,7 +403,7 @@ func (encoder *Encoder) Value(x interface{}) (err error) {
 		panic(fmt.Errorf("unexpected BinarySizer: %s", v.Type().String()))
 	}
 
-	return encoder.value(reflect.Indirect(v), false)
+	return encoder.value(reflect.Indirect(v), nil)
 }
 
 func (encoder *Encoder) fastValue(x interface{}) bool {
@@ -284,6 +441,10 @@ func (encoder *Encoder) fastValue(x interface{}) bool {
 		encoder.Complex128(d)
 	case string:
 		encoder.String(d)
+	case time.Time:
+		encoder.Time(d)
+	case time.Duration:
+		encoder.Duration(d)
 	case []bool:
 		l := len(d)
 		encoder.Uvarint(uint64(l))
@@ -300,79 +461,9 @@ func (encoder *Encoder) fastValue(x interface{}) bool {
 			}
 		}
 
-	case []int8:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Int8(d[i])
-		}
-	case []uint8:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Uint8(d[i])
-		}
-	case []int16:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Int16(d[i], false)
-		}
-	case []uint16:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Uint16(d[i], false)
-		}
-
-	case []int32:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Int32(d[i], false)
-		}
-	case []uint32:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Uint32(d[i], false)
-		}
-	case []int64:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Int64(d[i], false)
-		}
-	case []uint64:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Uint64(d[i], false)
-		}
-	case []float32:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Float32(d[i])
-		}
-	case []float64:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Float64(d[i])
-		}
-	case []complex64:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Complex64(d[i])
-		}
-	case []complex128:
-		l := len(d)
-		encoder.Uvarint(uint64(len(d)))
-		for i := 0; i < l; i++ {
-			encoder.Complex128(d[i])
-		}
+	case []int8, []uint8, []int16, []uint16, []int32, []uint32, []int64, []uint64,
+		[]float32, []float64, []complex64, []complex128:
+		return encoder.numbers(reflect.ValueOf(d), nil) //copy memory at once
 	case []string:
 		l := len(d)
 		encoder.Uvarint(uint64(len(d)))
@@ -391,14 +482,20 @@ func (encoder *Encoder) fastValue(x interface{}) bool {
 		for i := 0; i < l; i++ {
 			encoder.Uint(d[i])
 		}
+	case []time.Duration:
+		l := len(d)
+		encoder.Uvarint(uint64(len(d)))
+		for i := 0; i < l; i++ {
+			encoder.Duration(d[i])
+		}
 	default:
-		return false
+		return encoder.fastMap(x)
 	}
 	return true
 
 }
 
-func (encoder *Encoder) value(v reflect.Value, packed bool) error {
+func (encoder *Encoder) value(v reflect.Value, field *fieldInfo) error {
 	// check Packer interface for every value is perfect
 	// but encoder is too costly
 	//
@@ -418,33 +515,20 @@ func (encoder *Encoder) value(v reflect.Value, packed bool) error {
 	//		}
 	//	}
 
-	switch k := v.Kind(); k {
-	case reflect.Int:
-		encoder.Int(int(v.Int()))
-	case reflect.Uint:
-		encoder.Uint(uint(v.Uint()))
+	if codec := encoder.codecs.find(v.Type()); codec != nil { //overrided codec
+		return codec.encode(encoder, v, field)
+	}
+	if codec := queryCodec(v.Type(), field); codec != nil {
+		return codec.encode(encoder, v, field)
+	}
 
+	switch k := v.Kind(); k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		encoder.integer(v, k, field)
 	case reflect.Bool:
 		encoder.Bool(v.Bool())
 
-	case reflect.Int8:
-		encoder.Int8(int8(v.Int()))
-	case reflect.Int16:
-		encoder.Int16(int16(v.Int()), packed)
-	case reflect.Int32:
-		encoder.Int32(int32(v.Int()), packed)
-	case reflect.Int64:
-		encoder.Int64(v.Int(), packed)
-
-	case reflect.Uint8:
-		encoder.Uint8(uint8(v.Uint()))
-	case reflect.Uint16:
-		encoder.Uint16(uint16(v.Uint()), packed)
-	case reflect.Uint32:
-		encoder.Uint32(uint32(v.Uint()), packed)
-	case reflect.Uint64:
-		encoder.Uint64(v.Uint(), packed)
-
 	case reflect.Float32:
 		encoder.Float32(float32(v.Float()))
 	case reflect.Float64:
@@ -459,68 +543,226 @@ func (encoder *Encoder) value(v reflect.Value, packed bool) error {
 		encoder.Complex128(x)
 
 	case reflect.String:
-		encoder.String(v.String())
+		encoder.string(v.String(), field)
 
 	case reflect.Slice, reflect.Array:
 		if !validUserType(v.Type().Elem()) { //verify array element is valid
-			return fmt.Errorf("binary.Encoder.Value: unsupported type %s", v.Type().String())
-		}
-		if encoder.boolArray(v) < 0 { //deal with bool array first
-			l := v.Len()
-			encoder.Uvarint(uint64(l))
-			for i := 0; i < l; i++ {
-				assert(encoder.value(v.Index(i), packed) == nil, "")
-			}
+			return errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type %s", v.Type().String())
 		}
+		return encoder.array(v, field, nil, nil)
 	case reflect.Map:
 		t := v.Type()
 		kt := t.Key()
 		vt := t.Elem()
 		if !validUserType(kt) ||
 			!validUserType(vt) { //verify map key and value type are both valid
-			return fmt.Errorf("binary.Decoder.Value: unsupported type %s", v.Type().String())
+			return errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported type %s", v.Type().String())
 		}
-
-		keys := v.MapKeys()
-		l := len(keys)
-		encoder.Uvarint(uint64(l))
-		for i := 0; i < l; i++ {
-			key := keys[i]
-			assert(encoder.value(key, packed) == nil, "")
-			assert(encoder.value(v.MapIndex(key), packed) == nil, "")
+		if encoder.nilFlag(v, field) {
+			return nil
 		}
+		return encoder.mapEntries(v, field, nil, nil)
 	case reflect.Struct:
-		return queryStruct(v.Type()).encode(encoder, v)
+		if encoder.cLayout != nil {
+			return encoder.cValue(v, field)
+		}
+		return field.structOf(v.Type()).encode(encoder, v)
+
+	case reflect.Interface:
+		return encoder.iface(v, field)
 
 	case reflect.Ptr:
 		if !validUserType(v.Type()) {
-			return fmt.Errorf("binary.Encoder.Value: unsupported type %s", v.Type().String())
-		}
-		if !v.IsNil() {
-			encoder.Bool(true)
-			if e := v.Elem(); e.Kind() != reflect.Ptr {
-				return encoder.value(e, packed)
-			}
-		} else {
-			encoder.Bool(false)
-			//			if encoder.nilPointer(v.Type()) < 0 {
-			//				return fmt.Errorf("binary.Encoder.Value: unsupported type [%s]", v.Type().String())
-			//			}
+			return errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type %s", v.Type().String())
 		}
+		return encoder.pointer(v, field, nil)
 		//	case reflect.Invalid://BUG: it will panic to get zero.Type
 		//		return fmt.Errorf("binary.Encoder.Value: unsupported type [%s]", v.Kind().String())
 	default:
-		return fmt.Errorf("binary.Encoder.Value: unsupported type [%s]", v.Type().String())
+		return errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type [%s]", v.Type().String())
+	}
+	return nil
+}
+
+// integer encode int/uint value v of kind k by the reflect path.
+// Fields of tag `binary:"bits=N"` are encoded in bits shared with bools here,
+// so that values of other kinds need not to check it.
+func (encoder *Encoder) integer(v reflect.Value, k reflect.Kind, field *fieldInfo) {
+	if field != nil && field.bits > 0 { //bits shared with bools
+		encoder.bitField(v, field.bits)
+		return
+	}
+	switch k {
+	case reflect.Int:
+		if field.isFixed() {
+			encoder.Int64(v.Int(), false)
+		} else {
+			encoder.Int(int(v.Int()))
+		}
+	case reflect.Uint:
+		if field.isFixed() {
+			encoder.Uint64(v.Uint(), false)
+		} else {
+			encoder.Uint(uint(v.Uint()))
+		}
+
+	case reflect.Int8:
+		encoder.Int8(int8(v.Int()))
+	case reflect.Int16:
+		encoder.Int16(int16(v.Int()), field.isPacked())
+	case reflect.Int32:
+		encoder.Int32(int32(v.Int()), field.isPacked())
+	case reflect.Int64:
+		encoder.Int64(v.Int(), field.isPacked())
+
+	case reflect.Uint8:
+		encoder.Uint8(uint8(v.Uint()))
+	case reflect.Uint16:
+		encoder.Uint16(uint16(v.Uint()), field.isPacked())
+	case reflect.Uint32:
+		encoder.Uint32(uint32(v.Uint()), field.isPacked())
+	case reflect.Uint64:
+		encoder.Uint64(v.Uint(), field.isPacked())
+	}
+}
+
+// array encode slice/array v, of which elements are encoded by elem, or by
+// info of registed struct elements, or by the reflect path if both are nil.
+func (encoder *Encoder) array(v reflect.Value, field *fieldInfo, info *structInfo, elem fieldEncoder) error {
+	k := v.Kind()
+	if k == reflect.Slice && encoder.nilFlag(v, field) {
+		return nil
+	}
+	et := v.Type().Elem()
+	if isRuneElem(et, field) { //UTF-8 text
+		encoder.runes(v, field)
+		return nil
+	}
+	if encoder.boolArray(v, field) >= 0 || encoder.numbers(v, field) { //deal with bool/number array first
+		return nil
+	}
+	if k == reflect.Slice && v.Len() > 0 {
+		if !encoder.visitor.enter(v) {
+			return encoder.cycleError(v)
+		}
+		err := encoder.elems(v, field, info, elem)
+		encoder.visitor.leave(v)
+		return err
+	}
+	return encoder.elems(v, field, info, elem)
+}
+
+// elems encode length and elements of slice/array v for array.
+func (encoder *Encoder) elems(v reflect.Value, field *fieldInfo, info *structInfo, elem fieldEncoder) error {
+	et := v.Type().Elem()
+	l := v.Len()
+	encoder.arrayLength(v, field)
+	if isDeltaElem(et, field) { //varint deltas
+		encoder.deltas(v)
+		return nil
+	}
+	if isGroupVarintElem(et, field) { //group varints
+		encoder.groupVarints(v)
+		return nil
+	}
+	if isColumnarElem(et, field) { //field by field
+		return encoder.columns(v)
+	}
+	if elem == nil && info == nil {
+		info = queryStructElem(et, field)
+	}
+	if info != nil && encoder.cLayout == nil { //registed struct elements
+		if ok, err := encoder.parallelStructs(v, info); ok {
+			return err
+		}
+		elem = info.encode
+	}
+	for i := 0; i < l; i++ {
+		var err error
+		if elem != nil && encoder.cLayout == nil {
+			err = elem(encoder, v.Index(i))
+		} else {
+			err = encoder.value(v.Index(i), field.elemField())
+		}
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// pointer encode one bool bit for nil or not of pointer v, and its element
+// by elem, or by the reflect path if elem is nil.
+// One bool bit is encoded for each level of multi-level pointer.
+func (encoder *Encoder) pointer(v reflect.Value, field *fieldInfo, elem fieldEncoder) error {
+	if v.IsNil() {
+		encoder.Bool(false)
+		return nil
+	}
+	if !encoder.visitor.enter(v) {
+		return encoder.cycleError(v)
+	}
+	encoder.Bool(true)
+	err := encoder.valueBy(v.Elem(), field, elem)
+	encoder.visitor.leave(v)
+	return err
+}
+
+// mapEntries encode length and entries of map v, of which keys and values
+// are encoded by encodeKey and encodeValue, or by the reflect path if nil.
+func (encoder *Encoder) mapEntries(v reflect.Value, field *fieldInfo, encodeKey, encodeValue fieldEncoder) error {
+	keys := v.MapKeys()
+	if encoder.deterministic {
+		sortMapKeys(keys)
+	}
+	l := len(keys)
+	if l > 0 && !encoder.visitor.enter(v) {
+		return encoder.cycleError(v)
+	}
+	encoder.length(l, field)
+	var err error
+	for i := 0; i < l && err == nil; i++ {
+		if err = encoder.valueBy(keys[i], field, encodeKey); err == nil {
+			err = encoder.valueBy(v.MapIndex(keys[i]), field, encodeValue)
+		}
+	}
+	if l > 0 {
+		encoder.visitor.leave(v)
+	}
+	return err
+}
+
+// valueBy encode v by compiled function encode, or by the reflect path if
+// encode is nil.
+func (encoder *Encoder) valueBy(v reflect.Value, field *fieldInfo, encode fieldEncoder) error {
+	if encode != nil {
+		return encode(encoder, v)
+	}
+	return encoder.value(v, field)
+}
+
+// cycleError returns error of encoding a cycle via pointer v.
+func (encoder *Encoder) cycleError(v reflect.Value) error {
+	return fmt.Errorf("binary.Encoder.Value: encountered a cycle via %s", v.Type().String())
+}
+
+// nilFlag encode a bool bit if slice/map v is not nil for field tag `binary:"nilable"`,
+// and reports whether v is nil.
+func (encoder *Encoder) nilFlag(v reflect.Value, field *fieldInfo) bool {
+	if !field.isNilable() {
+		return false
+	}
+	isNil := v.IsNil()
+	encoder.Bool(!isNil)
+	return isNil
+}
+
 // encode bool array
-func (encoder *Encoder) boolArray(v reflect.Value) int {
+func (encoder *Encoder) boolArray(v reflect.Value, field *fieldInfo) int {
 	if k := v.Kind(); k == reflect.Slice || k == reflect.Array {
-		if v.Type().Elem().Kind() == reflect.Bool {
+		if isBoolElem(v.Type().Elem(), field) {
 			l := v.Len()
-			encoder.Uvarint(uint64(l))
+			encoder.arrayLength(v, field)
 			var b []byte
 			for i := 0; i < l; i++ {
 				bit := i % 8
@@ -533,8 +775,169 @@ func (encoder *Encoder) boolArray(v reflect.Value) int {
 					b[0] |= mask
 				}
 			}
-			return sizeofBoolArray(l)
+			return field.sizeofLen(l) + (l+8-1)/8
 		}
 	}
 	return -1
 }
+
+// sortMapKeys sort keys of a map for deterministic encoding.
+// Numbers, strings, bools and keys of interface type holding them are
+// compared by value like fmtsort, while composite keys (struct, array and
+// pointer) are sorted by their encoded bytes, with type name prefix for keys
+// of interface type.
+func sortMapKeys(keys []reflect.Value) {
+	if len(keys) < 2 {
+		return
+	}
+	if hasCompositeKey(keys) {
+		sortKeysByBytes(keys)
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool { return compareKeys(keys[i], keys[j]) < 0 })
+}
+
+// isCompositeKey reports whether map keys of kind k are sorted by their
+// encoded bytes.
+func isCompositeKey(k reflect.Kind) bool {
+	return k == reflect.Struct || k == reflect.Array || k == reflect.Ptr
+}
+
+// hasCompositeKey reports whether keys of a map are composite, or any key
+// of interface type holds a composite value.
+func hasCompositeKey(keys []reflect.Value) bool {
+	if k := keys[0].Kind(); k != reflect.Interface {
+		return isCompositeKey(k)
+	}
+	for _, key := range keys {
+		if !key.IsNil() && isCompositeKey(key.Elem().Kind()) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareKeys compare non-composite map keys a and b of the same type,
+// returns -1, 0 or 1.
+func compareKeys(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return compareOrdered(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareFloat(a.Float(), b.Float())
+	case reflect.Complex64, reflect.Complex128:
+		x, y := a.Complex(), b.Complex()
+		if c := compareFloat(real(x), real(y)); c != 0 {
+			return c
+		}
+		return compareFloat(imag(x), imag(y))
+	case reflect.String:
+		return compareOrdered(a.String(), b.String())
+	case reflect.Bool:
+		return compareOrdered(boolOrder(a.Bool()), boolOrder(b.Bool()))
+	case reflect.Chan, reflect.UnsafePointer:
+		return compareOrdered(a.Pointer(), b.Pointer())
+	case reflect.Interface:
+		if a.IsNil() || b.IsNil() { //nil interface first
+			return compareOrdered(boolOrder(!a.IsNil()), boolOrder(!b.IsNil()))
+		}
+		x, y := a.Elem(), b.Elem()
+		if tx, ty := x.Type(), y.Type(); tx != ty {
+			return compareOrdered(typeName(tx), typeName(ty))
+		}
+		return compareKeys(x, y)
+	}
+	return 0
+}
+
+// compareOrdered compare a and b, returns -1, 0 or 1.
+func compareOrdered[T int | int64 | uint64 | uintptr | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareFloat compare a and b as compareOrdered, with NaN first.
+func compareFloat(a, b float64) int {
+	if c := compareOrdered(boolOrder(a == a), boolOrder(b == b)); c != 0 {
+		return c
+	}
+	return compareOrdered(a, b)
+}
+
+// boolOrder returns order of bool b, false first.
+func boolOrder(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// sortKeysByBytes sort composite map keys by their encoded bytes.
+// All keys are encoded into one reused buffer.
+func sortKeysByBytes(keys []reflect.Value) {
+	encoded := make([][]byte, len(keys))
+	var buf []byte
+	encoder := getEncoder(nil)
+	for i, key := range keys {
+		start := len(buf)
+		if key.Kind() == reflect.Interface {
+			if key.IsNil() {
+				continue //nil interface first
+			}
+			buf = append(append(buf, typeName(key.Elem().Type())...), 0)
+			key = key.Elem()
+		}
+		buf = encoder.appendKey(buf, key)
+		encoded[i] = buf[start:len(buf):len(buf)]
+	}
+	putEncoder(encoder)
+	sort.Sort(&keysByBytes{keys, encoded})
+}
+
+// appendKey append encoded bytes of map key v to buf.
+// v is encoded by reflect path without calling v.Interface(), so that
+// keys reached through unexported fields are supported.
+// Keys failed to encode are appended as far as they are encoded.
+func (encoder *Encoder) appendKey(buf []byte, v reflect.Value) []byte {
+	vis := _visitorPool.Get().(*ptrVisitor)
+	bits := bitsOfValue(v, true, nil, vis)
+	*vis = ptrVisitor{}
+	_visitorPool.Put(vis)
+	if bits < 0 {
+		return buf
+	}
+	l, size := len(buf), (bits+7)/8
+	if cap(buf)-l < size {
+		b := make([]byte, l, 2*cap(buf)+size)
+		copy(b, buf)
+		buf = b
+	}
+	encoder.buff, encoder.pos = buf[l:l+size], 0
+	encoder.resetBoolCoder()
+	encoder.visitor = ptrVisitor{}
+	func() {
+		defer func() { recover() }() //keep order of keys which are not encodable
+		encoder.value(v, nil)
+	}()
+	return buf[:l+encoder.pos]
+}
+
+// keysByBytes sort map keys by their encoded bytes.
+type keysByBytes struct {
+	keys    []reflect.Value
+	encoded [][]byte
+}
+
+func (p *keysByBytes) Len() int           { return len(p.keys) }
+func (p *keysByBytes) Less(i, j int) bool { return bytes.Compare(p.encoded[i], p.encoded[j]) < 0 }
+func (p *keysByBytes) Swap(i, j int) {
+	p.keys[i], p.keys[j] = p.keys[j], p.keys[i]
+	p.encoded[i], p.encoded[j] = p.encoded[j], p.encoded[i]
+}
@@ -0,0 +1,88 @@
+// seal encoded messages by AEAD ciphers, for users persisting sensitive
+// records in this format.
+
+package binary
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrAuthentication is returned if a sealed message fails authentication,
+// which is corrupted, forged or sealed by another key.
+var ErrAuthentication = errors.New("binary.EncryptedCodec: message authentication failed")
+
+// EncryptedCodec seal encoded messages by an AEAD cipher, and authenticate
+// them on decode.
+// A sealed message is a random nonce followed by the ciphertext of encoded
+// bytes and tag of the cipher. Random nonces of 12 bytes such as AES-GCM are
+// safe for about 2^32 messages of a key, rotate keys before that.
+// It is safe for concurrent use if the cipher is.
+type EncryptedCodec struct {
+	aead cipher.AEAD
+	rand io.Reader //source of nonces
+}
+
+// NewEncryptedCodec returns an EncryptedCodec of cipher aead.
+func NewEncryptedCodec(aead cipher.AEAD) *EncryptedCodec {
+	return &EncryptedCodec{aead: aead, rand: rand.Reader}
+}
+
+// NewAESGCMCodec returns an EncryptedCodec of AES-GCM, key must be 16, 24 or
+// 32 bytes to select AES-128, AES-192 or AES-256.
+func NewAESGCMCodec(key []byte) (*EncryptedCodec, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptedCodec(aead), nil
+}
+
+// Overhead returns bytes number of a sealed message besides the encoded bytes.
+func (c *EncryptedCodec) Overhead() int {
+	return c.aead.NonceSize() + c.aead.Overhead()
+}
+
+// Encode encode data and seal it with additional data, which is authenticated
+// but not encrypted, and must be the same on decode. additional may be nil.
+func (c *EncryptedCodec) Encode(data interface{}, additional []byte) ([]byte, error) {
+	size := Sizeof(data)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(data, nil) //error of invalid data
+		return nil, err
+	}
+	ns := c.aead.NonceSize()
+	buf := make([]byte, ns+size, c.Overhead()+size)
+	if _, err := io.ReadFull(c.rand, buf[:ns]); err != nil {
+		return nil, fmt.Errorf("binary.EncryptedCodec.Encode: nonce: %s", err.Error())
+	}
+	encoder := NewEncoderBuffer(buf[ns:])
+	if err := encoder.Value(data); err != nil {
+		return nil, err
+	}
+	plain := encoder.Buffer()
+	return c.aead.Seal(buf[:ns], buf[:ns], plain, additional), nil //in place of plain
+}
+
+// Decode authenticate and decrypt message sealed by Encode, and decode it to data.
+// It returns ErrAuthentication if the message fails authentication, and data
+// is not modified.
+func (c *EncryptedCodec) Decode(buffer []byte, data interface{}, additional []byte) error {
+	ns := c.aead.NonceSize()
+	if len(buffer) < c.Overhead() {
+		return ErrAuthentication
+	}
+	plain, err := c.aead.Open(nil, buffer[:ns], buffer[ns:], additional)
+	if err != nil {
+		return ErrAuthentication
+	}
+	return Decode(plain, data)
+}
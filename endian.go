@@ -19,6 +19,9 @@ var (
 	BigEndian bigEndian
 	//DefaultEndian is LittleEndian
 	DefaultEndian = LittleEndian
+	// NativeEndian is the byte order of the running machine, with which
+	// numbers are copied without byte swapping, as for same-machine IPC.
+	NativeEndian = nativeEndian()
 )
 
 type littleEndian struct{}
@@ -0,0 +1,89 @@
+// native endian of the running machine, and one-byte endianness markers in
+// message headers, so that same-machine IPC can skip byte swapping while
+// cross-machine consumers can still detect and convert.
+
+package binary
+
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+const (
+	// EndianMarkerLittle is the endianness marker of LittleEndian
+	EndianMarkerLittle byte = 'L'
+	// EndianMarkerBig is the endianness marker of BigEndian
+	EndianMarkerBig byte = 'B'
+)
+
+// nativeEndian returns the byte order of the running machine.
+func nativeEndian() Endian {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return LittleEndian
+	}
+	return BigEndian
+}
+
+// EndianMarker returns the one-byte endianness marker of endian, which is
+// LittleEndian or BigEndian.
+func EndianMarker(endian Endian) byte {
+	if endian == Endian(BigEndian) {
+		return EndianMarkerBig
+	}
+	return EndianMarkerLittle
+}
+
+// MarkerEndian returns endian of the one-byte endianness marker, or error if
+// it is not a valid marker.
+func MarkerEndian(marker byte) (Endian, error) {
+	switch marker {
+	case EndianMarkerLittle:
+		return LittleEndian, nil
+	case EndianMarkerBig:
+		return BigEndian, nil
+	}
+	return nil, fmt.Errorf("binary: invalid endianness marker 0x%02x", marker)
+}
+
+// WriteMessageEndian encode data with endian and write it to w as a message
+// as WriteMessage, of which the first byte is the endianness marker.
+// Use NativeEndian for same-machine IPC to skip byte swapping.
+func WriteMessageEndian(w io.Writer, endian Endian, data interface{}) error {
+	size := Sizeof(data)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(data, nil) //error of invalid data
+		return err
+	}
+	buf := make([]byte, MaxVarintLen64+1+size)
+	buf[MaxVarintLen64] = EndianMarker(endian)
+	encoder := NewEncoderBuffer(buf[MaxVarintLen64+1:])
+	encoder.setEndian(endian)
+	if err := encoder.Value(data); err != nil {
+		return err
+	}
+	l := 1 + encoder.Len()
+	start := MaxVarintLen64 - SizeofUvarint(uint64(l))
+	PutUvarint(buf[start:], uint64(l))
+	_, err := w.Write(buf[start : MaxVarintLen64+l])
+	return err
+}
+
+// ReadMessageEndian read a message written by WriteMessageEndian from r, and
+// decode it to data with endian of its marker, as ReadMessage.
+// It returns endian of the message.
+func ReadMessageEndian(r io.Reader, data interface{}) (Endian, error) {
+	buf, err := readMessage(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("binary.ReadMessageEndian: missing endianness marker")
+	}
+	endian, err := MarkerEndian(buf[0])
+	if err != nil {
+		return nil, err
+	}
+	return endian, NewDecoderEndian(buf[1:], endian).Value(data)
+}
@@ -0,0 +1,184 @@
+// envelope payloads with magic number, format version, flags and length, so
+// that files and sockets can be sanity-checked before parsing payloads.
+
+package binary
+
+import (
+	"fmt"
+	"io"
+)
+
+// EnvelopeHeaderSize is bytes number of envelope header, which is
+//
+//	magic   uint32 //identify the format
+//	version uint16 //version of the format
+//	flags   uint16 //EnvelopeBigEndian and user flags
+//	length  uint32 //bytes number of payload
+//
+// Fields of header are big-endian, and payload is encoded in endian of flags.
+// Checksum trailer of header and payload follows payload if flags require.
+const EnvelopeHeaderSize = 12
+
+// Flags of envelope header.
+const (
+	// EnvelopeBigEndian is set if payload is encoded in BigEndian,
+	// or it's LittleEndian.
+	EnvelopeBigEndian uint16 = 1 << iota
+
+	// EnvelopeCRC32 is set if payload is followed by CRC32 checksum trailer.
+	EnvelopeCRC32
+
+	// EnvelopeXXHash64 is set if payload is followed by XXHash64 checksum trailer.
+	EnvelopeXXHash64
+
+	// EnvelopeUserFlags are flag bits reserved for users.
+	EnvelopeUserFlags uint16 = 0xFF00
+)
+
+// Envelope prefix payloads with header of magic number, format version, flags
+// and payload length. Decode validates the header before decoding payloads.
+type Envelope struct {
+	Magic   uint32 //magic number of the format
+	Version uint16 //format version, payloads of higher versions are rejected
+	Flags   uint16 //flags of header
+}
+
+// Endian returns endian of payload by Flags.
+func (e Envelope) Endian() Endian {
+	if e.Flags&EnvelopeBigEndian != 0 {
+		return BigEndian
+	}
+	return LittleEndian
+}
+
+// Checksum returns checksum of envelope by Flags.
+func (e Envelope) Checksum() Checksum {
+	switch {
+	case e.Flags&EnvelopeCRC32 != 0:
+		return CRC32
+	case e.Flags&EnvelopeXXHash64 != 0:
+		return XXHash64
+	}
+	return NoChecksum
+}
+
+// Encode encode data as payload with envelope header.
+func (e Envelope) Encode(data interface{}) ([]byte, error) {
+	size := Sizeof(data)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(data, nil) //error of invalid data
+		return nil, err
+	}
+	if uint64(size) > 0xFFFFFFFF {
+		return nil, errorf(ErrOverflow, "binary.Envelope.Encode: payload size %d overflows", size)
+	}
+	c := e.Checksum()
+	encoder := NewEncoderBuffer(make([]byte, EnvelopeHeaderSize+size, EnvelopeHeaderSize+size+c.Size()))
+	encoder.setEndian(e.Endian())
+	encoder.reserve(EnvelopeHeaderSize)
+	if err := encoder.Value(data); err != nil {
+		return nil, err
+	}
+	e.putHeader(encoder.buff, uint32(encoder.Len()-EnvelopeHeaderSize))
+	return AppendChecksum(encoder.Buffer(), c), nil
+}
+
+// Decode validate envelope header and checksum trailer of buffer, and decode
+// payload to data. It returns the header of buffer.
+func (e Envelope) Decode(buffer []byte, data interface{}) (Envelope, error) {
+	h, length, err := e.Check(buffer)
+	if err != nil {
+		return h, err
+	}
+	if len(buffer) != EnvelopeHeaderSize+length+h.Checksum().Size() {
+		return h, fmt.Errorf("binary.Envelope.Decode: envelope size %d mismatch payload length %d", len(buffer), length)
+	}
+	if buffer, err = VerifyChecksum(buffer, h.Checksum()); err != nil {
+		return h, err
+	}
+	decoder := NewDecoderEndian(buffer[EnvelopeHeaderSize:], h.Endian())
+	if err := decoder.Value(data); err != nil {
+		return h, err
+	}
+	if decoder.Len() != length {
+		return h, ErrTrailingBytes
+	}
+	return h, nil
+}
+
+// Check validate envelope header at the beginning of buffer, and returns the
+// header and payload length. The magic must equal e.Magic, and the version
+// must not exceed e.Version.
+func (e Envelope) Check(buffer []byte) (Envelope, int, error) {
+	var h Envelope
+	if len(buffer) < EnvelopeHeaderSize {
+		return h, 0, fmt.Errorf("binary.Envelope: header needs %d bytes, got %d", EnvelopeHeaderSize, len(buffer))
+	}
+	h.Magic = BigEndian.Uint32(buffer)
+	h.Version = BigEndian.Uint16(buffer[4:])
+	h.Flags = BigEndian.Uint16(buffer[6:])
+	length := BigEndian.Uint32(buffer[8:])
+	if h.Magic != e.Magic {
+		return h, 0, fmt.Errorf("binary.Envelope: magic %#08x mismatch %#08x", h.Magic, e.Magic)
+	}
+	if h.Version > e.Version {
+		return h, 0, fmt.Errorf("binary.Envelope: unsupported version %d, max %d", h.Version, e.Version)
+	}
+	if h.Flags&^(EnvelopeBigEndian|EnvelopeCRC32|EnvelopeXXHash64|EnvelopeUserFlags) != 0 ||
+		h.Flags&(EnvelopeCRC32|EnvelopeXXHash64) == EnvelopeCRC32|EnvelopeXXHash64 {
+		return h, 0, fmt.Errorf("binary.Envelope: invalid flags %#04x", h.Flags)
+	}
+	if uint64(length) > uint64(maxInt) {
+		return h, 0, errorf(ErrOverflow, "binary.Envelope: payload length %d overflows", length)
+	}
+	return h, int(length), nil
+}
+
+// Write encode data with envelope header, and write it to w by a single Write call.
+func (e Envelope) Write(w io.Writer, data interface{}) error {
+	b, err := e.Encode(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Read read an envelope written by Write from r, and decode payload to data.
+// The header is validated before reading payload, and payloads exceed
+// MaxMessageSize are rejected.
+// It returns io.EOF if there is no more envelope, or io.ErrUnexpectedEOF if
+// the envelope is truncated.
+func (e Envelope) Read(r io.Reader, data interface{}) (Envelope, error) {
+	var header [EnvelopeHeaderSize]byte
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF && n > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return Envelope{}, err
+	}
+	h, length, err := e.Check(header[:])
+	if err != nil {
+		return h, err
+	}
+	if length > MaxMessageSize {
+		return h, errorf(ErrLimitExceeded, "binary.Envelope.Read: payload size %d exceeds max size %d", length, MaxMessageSize)
+	}
+	buf := make([]byte, EnvelopeHeaderSize+length+h.Checksum().Size())
+	copy(buf, header[:])
+	if _, err := io.ReadFull(r, buf[EnvelopeHeaderSize:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return h, err
+	}
+	return e.Decode(buf, data)
+}
+
+// putHeader write envelope header of payload length to b.
+func (e Envelope) putHeader(b []byte, length uint32) {
+	BigEndian.PutUint32(b, e.Magic)
+	BigEndian.PutUint16(b[4:], e.Version)
+	BigEndian.PutUint16(b[6:], e.Flags)
+	BigEndian.PutUint32(b[8:], length)
+}
@@ -0,0 +1,113 @@
+// locate decode errors by byte offset and field path, for users to find
+// malformed data in buffers.
+
+package binary
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DecodeError is error returned by Decoder.Value when decoding a field of
+// struct or an element of slice/array failed.
+// Errors of io.EOF and io.ErrUnexpectedEOF from readers are returned as they
+// are, as io.Reader does.
+type DecodeError struct {
+	Offset int          //offset in buffer where decoding failed, -1 if unknown when decoding from reader
+	Type   reflect.Type //type of the value failed to decode
+	Path   string       //dotted path of the value, such as "Order.Items[3].Price"
+	Err    error        //the underlying error
+
+	unwinding bool //if path is being prepended by frames of decoder
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s (%s at offset %d)", e.Err.Error(), e.Path, e.Offset)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// beginPath start path of decoding value of type t or pointer to it.
+func (decoder *Decoder) beginPath(t reflect.Type) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	decoder.root = t
+}
+
+// fieldError returns err of decoding field i of struct t, of which path is
+// prepended with the field name as the error unwinds.
+func (decoder *Decoder) fieldError(err error, t reflect.Type, i int) error {
+	f := t.Field(i)
+	return decoder.locate(err, f.Type, "."+f.Name)
+}
+
+// indexError returns err of decoding element i of type t, of which path is
+// prepended with the index as the error unwinds.
+func (decoder *Decoder) indexError(err error, t reflect.Type, i int) error {
+	return decoder.locate(err, t, "["+strconv.Itoa(i)+"]")
+}
+
+// locate prepend segment to path of DecodeError err which is unwinding, or
+// make err a DecodeError of value of type t at current offset.
+// Nothing is recorded while decoding, paths are built only for errors.
+func (decoder *Decoder) locate(err error, t reflect.Type, segment string) error {
+	if decoder.root == nil || err == ErrTrailingBytes {
+		return err
+	}
+	if decoder.reader != nil && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		return err
+	}
+	e, ok := err.(*DecodeError)
+	if !ok {
+		offset := decoder.traceBase + decoder.pos
+		if decoder.reader != nil {
+			offset = int(decoder.Offset())
+		}
+		e = &DecodeError{Offset: offset, Type: t, Err: err, unwinding: true}
+	} else if !e.unwinding { //located by another decoder
+		return err
+	}
+	e.Path = segment + e.Path
+	return e
+}
+
+// unwind panics on with panic info located at field i of struct t if field,
+// or element i of type t if not, or as it is if i < 0.
+// It is deferred by frames of fields and elements with recover() as info.
+func (decoder *Decoder) unwind(info interface{}, t reflect.Type, i int, field bool) {
+	if info == nil {
+		return
+	}
+	if i >= 0 {
+		err := panicError(info, "binary.Decoder.Value")
+		if field {
+			info = decoder.fieldError(err, t, i)
+		} else {
+			info = decoder.indexError(err, t, i)
+		}
+	}
+	panic(info)
+}
+
+// pathError returns err located by path of decoder, prefixed by name of
+// type of the decoding value, or err itself if it is not located.
+func (decoder *Decoder) pathError(err error) error {
+	e, ok := err.(*DecodeError)
+	if !ok || !e.unwinding {
+		return err
+	}
+	e.unwinding = false
+	if name := decoder.root.Name(); name != "" {
+		e.Path = name + e.Path
+	} else {
+		e.Path = strings.TrimPrefix(e.Path, ".")
+	}
+	return e
+}
@@ -123,7 +123,7 @@ func Read(r io.Reader, endian Endian, data interface{}) error {
 func Write(w io.Writer, endian Endian, data interface{}) error {
 	size := Sizeof(data)
 	if size < 0 {
-		return errors.New("binary.Write: invalid type " + reflect.TypeOf(data).String())
+		return errorf(ErrUnsupportedType, "binary.Write: invalid type %s", reflect.TypeOf(data).String())
 	}
 	var b [16]byte
 	var bs []byte
@@ -176,10 +176,11 @@ func Encode(data interface{}, buffer []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	encoder := NewEncoderBuffer(buff)
-
+	encoder := getEncoder(buff)
 	err = encoder.Value(data)
-	return encoder.Buffer(), err
+	b := encoder.Buffer()
+	putEncoder(encoder)
+	return b, err
 }
 
 // Decode unmarshal go data from byte array.
@@ -191,12 +192,116 @@ func Decode(buffer []byte, data interface{}) error {
 	return decoder.Value(data)
 }
 
+// DecodeFields is like Decode but decode the fields with names of struct only.
+// data must be pointer of struct.
+func DecodeFields(buffer []byte, data interface{}, names ...string) error {
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	return decoder.ValueFields(data, names...)
+}
+
+// DecodeStrict is like Decode but returns ErrTrailingBytes if bytes remain
+// after data is fully decoded.
+func DecodeStrict(buffer []byte, data interface{}) error {
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	decoder.SetStrict(true)
+	return decoder.Value(data)
+}
+
+// SizeofStringTable get the encoded bytes of data with string table,
+// as Encoder with SetStringTable.
+// It returns -1 if data is unsupported.
+func SizeofStringTable(data interface{}) int {
+	t, err := collectStrings(data, DefaultEndian, false, VarintLEB128)
+	if err != nil {
+		return -1
+	}
+	return t.size
+}
+
+// EncodeStringTable is like Encode but encode strings of data by a string table,
+// as Encoder with SetStringTable.
+func EncodeStringTable(data interface{}, buffer []byte) ([]byte, error) {
+	t, err := collectStrings(data, DefaultEndian, false, VarintLEB128)
+	if err != nil {
+		return nil, err
+	}
+	buff := buffer
+	if len(buff) < t.size {
+		buff = make([]byte, t.size)
+	}
+
+	encoder := NewEncoderBuffer(buff)
+	encoder.SetStringTable(true)
+	err = encoder.valueTable(data, t)
+	return encoder.Buffer(), err
+}
+
+// DecodeStringTable is like Decode but decode strings of data by a string table,
+// which is encoded by EncodeStringTable.
+func DecodeStringTable(buffer []byte, data interface{}) error {
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	decoder.SetStringTable(true)
+	return decoder.Value(data)
+}
+
+// EncodeMsgpack encode data in MessagePack format to buffer,
+// as Encoder with SetMsgpack.
+// The buffer is reused if it is large enough.
+func EncodeMsgpack(data interface{}, buffer []byte) (b []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.EncodeMsgpack")
+		}
+	}()
+	var encoder Encoder
+	b = encoder.appendMsgpack(buffer[:0], reflect.ValueOf(data))
+	return b, nil
+}
+
+// DecodeMsgpack decode data from buffer in MessagePack format,
+// as Decoder with SetMsgpack.
+func DecodeMsgpack(buffer []byte, data interface{}) error {
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	decoder.SetMsgpack(true)
+	return decoder.Value(data)
+}
+
+// EncodeCBOR encode data in CBOR format to buffer,
+// as Encoder with SetCBOR.
+// The buffer is reused if it is large enough.
+func EncodeCBOR(data interface{}, buffer []byte) (b []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.EncodeCBOR")
+		}
+	}()
+	var encoder Encoder
+	b = encoder.appendCBOR(buffer[:0], reflect.ValueOf(data))
+	return b, nil
+}
+
+// DecodeCBOR decode data from buffer in CBOR format,
+// as Decoder with SetCBOR.
+func DecodeCBOR(buffer []byte, data interface{}) error {
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	decoder.SetCBOR(true)
+	return decoder.Value(data)
+}
+
 // MakeEncodeBuffer create enough buffer to encode data.
 // nil buffer is aviable, it will create new buffer if necessary.
 func MakeEncodeBuffer(data interface{}, buffer []byte) ([]byte, error) {
 	size := Sizeof(data)
 	if size < 0 {
-		return nil, errors.New("binary.MakeEncodeBuffer: invalid type " + reflect.TypeOf(data).String())
+		if _, err := sizeofValue(data); err != nil { //cycle of data
+			return nil, err
+		}
+		return nil, errorf(ErrUnsupportedType, "binary.MakeEncodeBuffer: invalid type %s", reflect.TypeOf(data).String())
 	}
 
 	buff := buffer
@@ -0,0 +1,214 @@
+// fast paths of common map types, which avoid walking maps by reflection.
+
+package binary
+
+import (
+	"unsafe"
+)
+
+// fastSizeofMap returns size of map of common types, -1 if data is not.
+func fastSizeofMap(data interface{}) int {
+	switch d := data.(type) {
+	case map[string]string:
+		s := SizeofUvarint(uint64(len(d)))
+		for k, v := range d {
+			s += sizeofString(len(k)) + sizeofString(len(v))
+		}
+		return s
+	case map[string]int:
+		s := SizeofUvarint(uint64(len(d)))
+		for k, v := range d {
+			s += sizeofString(len(k)) + SizeofVarint(int64(v))
+		}
+		return s
+	case map[string]int64:
+		s := SizeofUvarint(uint64(len(d)))
+		for k := range d {
+			s += sizeofString(len(k)) + 8
+		}
+		return s
+	case map[string]struct{}:
+		s := SizeofUvarint(uint64(len(d)))
+		for k := range d {
+			s += sizeofString(len(k))
+		}
+		return s
+	case map[int]int:
+		s := SizeofUvarint(uint64(len(d)))
+		for k, v := range d {
+			s += SizeofVarint(int64(k)) + SizeofVarint(int64(v))
+		}
+		return s
+	case map[int]string:
+		s := SizeofUvarint(uint64(len(d)))
+		for k, v := range d {
+			s += SizeofVarint(int64(k)) + sizeofString(len(v))
+		}
+		return s
+	case map[int64]int64:
+		return sizeofFixArray(len(d), 16)
+	case map[int64]string:
+		s := SizeofUvarint(uint64(len(d)))
+		for _, v := range d {
+			s += 8 + sizeofString(len(v))
+		}
+		return s
+	case map[int64]struct{}:
+		return sizeofFixArray(len(d), 8)
+	}
+	return -1
+}
+
+// fastMap encode map of common types, reports false if x is not.
+// Deterministic encoding is left to the reflect path to sort keys.
+func (encoder *Encoder) fastMap(x interface{}) bool {
+	if encoder.deterministic {
+		return false
+	}
+	switch d := x.(type) {
+	case map[string]string:
+		encoder.Uvarint(uint64(len(d)))
+		for k, v := range d {
+			encoder.String(k)
+			encoder.String(v)
+		}
+	case map[string]int:
+		encoder.Uvarint(uint64(len(d)))
+		for k, v := range d {
+			encoder.String(k)
+			encoder.Int(v)
+		}
+	case map[string]int64:
+		encoder.Uvarint(uint64(len(d)))
+		for k, v := range d {
+			encoder.String(k)
+			encoder.Int64(v, false)
+		}
+	case map[string]struct{}:
+		encoder.Uvarint(uint64(len(d)))
+		for k := range d {
+			encoder.String(k)
+		}
+	case map[int]int:
+		encoder.Uvarint(uint64(len(d)))
+		for k, v := range d {
+			encoder.Int(k)
+			encoder.Int(v)
+		}
+	case map[int]string:
+		encoder.Uvarint(uint64(len(d)))
+		for k, v := range d {
+			encoder.Int(k)
+			encoder.String(v)
+		}
+	case map[int64]int64:
+		encoder.Uvarint(uint64(len(d)))
+		for k, v := range d {
+			encoder.Int64(k, false)
+			encoder.Int64(v, false)
+		}
+	case map[int64]string:
+		encoder.Uvarint(uint64(len(d)))
+		for k, v := range d {
+			encoder.Int64(k, false)
+			encoder.String(v)
+		}
+	case map[int64]struct{}:
+		encoder.Uvarint(uint64(len(d)))
+		for k := range d {
+			encoder.Int64(k, false)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// fastMap decode map of common types, reports false if x is not pointer of them.
+// Decoded elements are added to the map, which is made if it is nil.
+func (decoder *Decoder) fastMap(x interface{}) bool {
+	switch d := x.(type) {
+	case *map[string]string:
+		l := decoder.allocLength(nil, int(unsafe.Sizeof("")*2))
+		if *d == nil {
+			*d = make(map[string]string, l)
+		}
+		for i := 0; i < l; i++ {
+			k := decoder.String()
+			(*d)[k] = decoder.String()
+		}
+	case *map[string]int:
+		l := decoder.allocLength(nil, int(unsafe.Sizeof("")+unsafe.Sizeof(int(0))))
+		if *d == nil {
+			*d = make(map[string]int, l)
+		}
+		for i := 0; i < l; i++ {
+			k := decoder.String()
+			(*d)[k] = decoder.Int()
+		}
+	case *map[string]int64:
+		l := decoder.allocLength(nil, int(unsafe.Sizeof("")+8))
+		if *d == nil {
+			*d = make(map[string]int64, l)
+		}
+		for i := 0; i < l; i++ {
+			k := decoder.String()
+			(*d)[k] = decoder.Int64(false)
+		}
+	case *map[string]struct{}:
+		l := decoder.allocLength(nil, int(unsafe.Sizeof("")))
+		if *d == nil {
+			*d = make(map[string]struct{}, l)
+		}
+		for i := 0; i < l; i++ {
+			(*d)[decoder.String()] = struct{}{}
+		}
+	case *map[int]int:
+		l := decoder.allocLength(nil, int(unsafe.Sizeof(int(0))*2))
+		if *d == nil {
+			*d = make(map[int]int, l)
+		}
+		for i := 0; i < l; i++ {
+			k := decoder.Int()
+			(*d)[k] = decoder.Int()
+		}
+	case *map[int]string:
+		l := decoder.allocLength(nil, int(unsafe.Sizeof(int(0))+unsafe.Sizeof("")))
+		if *d == nil {
+			*d = make(map[int]string, l)
+		}
+		for i := 0; i < l; i++ {
+			k := decoder.Int()
+			(*d)[k] = decoder.String()
+		}
+	case *map[int64]int64:
+		l := decoder.allocLength(nil, 16)
+		if *d == nil {
+			*d = make(map[int64]int64, l)
+		}
+		for i := 0; i < l; i++ {
+			k := decoder.Int64(false)
+			(*d)[k] = decoder.Int64(false)
+		}
+	case *map[int64]string:
+		l := decoder.allocLength(nil, int(8+unsafe.Sizeof("")))
+		if *d == nil {
+			*d = make(map[int64]string, l)
+		}
+		for i := 0; i < l; i++ {
+			k := decoder.Int64(false)
+			(*d)[k] = decoder.String()
+		}
+	case *map[int64]struct{}:
+		l := decoder.allocLength(nil, 8)
+		if *d == nil {
+			*d = make(map[int64]struct{}, l)
+		}
+		for i := 0; i < l; i++ {
+			(*d)[decoder.Int64(false)] = struct{}{}
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+// encode fields of structs in order of their ids for field tag `binary:"id=N"`,
+// so the wire layout depends on stable ids rather than declaration order,
+// and fields are reordered in source without breaking compatibility.
+// If any encoded field of a struct has an id, all of them must have unique
+// ids. Removing fields keeps compatibility only in tagged structs, see
+// field tag `binary:"tagged"`.
+// Fields are still laid out in declaration order in C layout.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// parseOrder sort fields of struct t by ids if they have, and ignored fields last.
+func (info *structInfo) parseOrder(t reflect.Type) error {
+	var ids, valid []int
+	for i, field := range info.fields {
+		if field.ignore {
+			continue
+		}
+		valid = append(valid, i)
+		if field.id > 0 {
+			ids = append(ids, i)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if len(ids) != len(valid) {
+		for _, i := range valid {
+			if info.fields[i].id == 0 {
+				return fmt.Errorf("binary: field %s of %s has no id", info.fields[i].field.Name, t.String())
+			}
+		}
+	}
+	sort.SliceStable(valid, func(i, j int) bool {
+		return info.fields[valid[i]].id < info.fields[valid[j]].id
+	})
+	for j := 1; j < len(valid); j++ {
+		if a, b := info.fields[valid[j-1]], info.fields[valid[j]]; a.id == b.id {
+			return fmt.Errorf("binary: fields %s and %s of %s have the same id %d",
+				a.field.Name, b.field.Name, t.String(), a.id)
+		}
+	}
+	info.order = valid
+	for i, field := range info.fields {
+		if field.ignore {
+			info.order = append(info.order, i)
+		}
+	}
+	return nil
+}
+
+// index returns index of the j-th field in encoding order.
+func (info *structInfo) index(j int) int {
+	if info != nil && info.order != nil {
+		return info.order[j]
+	}
+	return j
+}
+
+// position returns position of field i in encoding order.
+func (info *structInfo) position(i int) int {
+	if info != nil && info.order != nil {
+		for j, k := range info.order {
+			if k == i {
+				return j
+			}
+		}
+	}
+	return i
+}
@@ -0,0 +1,44 @@
+// encode/decode arrays [N]T without length prefix, as fixed-layout formats,
+// since the length is known by type.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// SetFixedArrays set if arrays [N]T are encoded by Encoder without length
+// prefix, to save bytes and match fixed-layout formats.
+// Arrays of runes by field tag `binary:"runes"` keep length prefix of text bytes.
+// It is shorter than default, so that Sizeof is enough as buffer size.
+func (encoder *Encoder) SetFixedArrays(fixed bool) {
+	encoder.fixedArrays = fixed
+}
+
+// SetFixedArrays set if arrays [N]T are decoded by Decoder without length
+// prefix, which are encoded by Encoder with SetFixedArrays.
+func (decoder *Decoder) SetFixedArrays(fixed bool) {
+	decoder.fixedArrays = fixed
+}
+
+// arrayLength encode length prefix of slice/array v of field, which is
+// omitted for arrays with SetFixedArrays.
+func (encoder *Encoder) arrayLength(v reflect.Value, field *fieldInfo) {
+	if v.Kind() == reflect.Array && encoder.fixedArrays {
+		return
+	}
+	encoder.length(v.Len(), field)
+}
+
+// arrayLength decode length prefix of slice/array of type t of field, and
+// returns it with bytes decoded. Arrays with SetFixedArrays or nolen field
+// returns length of type t without decoding.
+func (decoder *Decoder) arrayLength(t reflect.Type, field *fieldInfo) (int, int) {
+	if t.Kind() == reflect.Array && (decoder.fixedArrays || field.isNoLen()) {
+		return t.Len(), 0
+	}
+	if field.isNoLen() { //elements of the rest of buffer
+		return decoder.restLength(t.Elem(), field), 0
+	}
+	return decoder.length(field)
+}
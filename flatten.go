@@ -0,0 +1,74 @@
+// lay out embedded structs flattened into the parent struct, for field tag
+// `binary:"flatten"`.
+//
+// An embedded struct is encoded as a nested block by default, as a named
+// struct field: its version is encoded before its fields, and field tags of
+// the embedded field other than endian options and ignore are not applied to
+// its fields. A flattened embedded struct is laid out as fields of the parent
+// struct, as
+//
+//	type Header struct {
+//		ID   uint64
+//		Size int32
+//	}
+//	type Packet struct {
+//		Header `binary:"flatten,packed"`
+//		Body   []byte
+//	}
+//
+// Its version is not encoded, and options packed, fixed, big and little of
+// the embedded field apply to its fields without these options. Tag ignore
+// of the embedded field ignores all of its fields in both layouts.
+// Flattening is supported for embedded structs of registered structs which
+// are neither tagged nor containing offsets, and not in tagged structs.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// parseFlatten parse info of embedded struct of field tag `binary:"flatten"`,
+// of which fields inherit options of the embedded field.
+func (field *fieldInfo) parseFlatten() error {
+	f := field.field
+	if !f.Anonymous || f.Type.Kind() != reflect.Struct {
+		return fmt.Errorf("binary: invalid tag option flatten of field %s, which is not an embedded struct", f.Name)
+	}
+	flat := &structInfo{}
+	if err := flat.parse(f.Type); err != nil {
+		return err
+	}
+	if flat.isTagged() {
+		return fmt.Errorf("binary: unsupported tag option flatten of field %s of tagged struct %s", f.Name, f.Type.String())
+	}
+	flat.version = 0 //laid out as fields of the parent
+	for _, ff := range flat.fields {
+		if ff.offset >= 0 {
+			return fmt.Errorf("binary: unsupported tag option flatten of field %s, which has offset field %s", f.Name, ff.field.Name)
+		}
+		if ff.ignore {
+			continue
+		}
+		if !ff.packed && !ff.fixed {
+			ff.packed, ff.fixed = field.packed, field.fixed
+		}
+		if ff.endian == nil {
+			ff.endian = field.endian
+		}
+		ff.encode, ff.decode, ff.size = nil, nil, nil
+		ff.compile(ff.field.Type)
+	}
+	field.flat = flat
+	return nil
+}
+
+// structOf returns info of struct t of field, which is the flattened info of
+// embedded struct of field tag `binary:"flatten"`.
+func (field *fieldInfo) structOf(t reflect.Type) *structInfo {
+	if field != nil && field.flat != nil {
+		return field.flat
+	}
+	return queryStruct(t)
+}
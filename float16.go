@@ -0,0 +1,87 @@
+package binary
+
+import (
+	"math"
+	"reflect"
+)
+
+// Float16 encode a float32 value to Encoder buffer as IEEE 754 half precision
+// float of 2 bytes.
+// It is rounded to the nearest even, and overflows to infinity.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Float16(x float32) {
+	encoder.Uint16(Float16bits(x), false)
+}
+
+// Float16 decode an IEEE 754 half precision float value from Decoder buffer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) Float16() float32 {
+	return Float16frombits(decoder.Uint16(false))
+}
+
+// Float16bits returns the IEEE 754 half precision representation of f,
+// which is rounded to the nearest even, and overflows to infinity.
+func Float16bits(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+	switch {
+	case b&0x7fffffff > 0x7f800000: //NaN
+		return sign | 0x7e00
+	case exp >= 0x1f: //infinity or overflow
+		return sign | 0x7c00
+	case exp <= 0: //subnormal or zero
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		r, rem, half := mant>>shift, mant&(1<<shift-1), uint32(1)<<(shift-1)
+		if rem > half || rem == half && r&1 == 1 {
+			r++
+		}
+		return sign | uint16(r)
+	}
+	r, rem := uint32(exp)<<10|mant>>13, mant&0x1fff
+	if rem > 0x1000 || rem == 0x1000 && r&1 == 1 {
+		r++ //may carry to exponent, which is right
+	}
+	return sign | uint16(r)
+}
+
+// Float16frombits returns the float32 value of IEEE 754 half precision representation h.
+func Float16frombits(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch exp {
+	case 0x1f: //infinity or NaN
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case 0: //subnormal or zero
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// float32/float64 are encoded as half precision float for field tag `binary:"float16"`.
+var float16Codec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		return 2
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		encoder.Float16(float32(v.Float()))
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		v.SetFloat(float64(decoder.Float16()))
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		return decoder.Skip(2)
+	},
+}
@@ -3,6 +3,9 @@ package binary
 import (
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -26,15 +29,28 @@ import (
 //}
 
 func sizeof(data interface{}) int {
+	s, _ := sizeofValue(data)
+	return s
+}
+
+// sizeofValue is like sizeof but returns error if data contains a cycle.
+func sizeofValue(data interface{}) (int, error) {
 	if s := fastSizeof(data); s >= 0 {
-		return s
+		return s, nil
 	}
 
-	s := bitsOfValue(reflect.ValueOf(data), true, false)
+	vis := _visitorPool.Get().(*ptrVisitor)
+	s := bitsOfValue(reflect.ValueOf(data), true, nil, vis)
+	cycle := vis.cycle
+	*vis = ptrVisitor{}
+	_visitorPool.Put(vis)
+	if cycle != nil {
+		return -1, fmt.Errorf("binary: encountered a cycle via %s", cycle.String())
+	}
 	if s < 0 {
-		return -1
+		return -1, nil
 	}
-	return (s + 7) / 8
+	return (s + 7) / 8, nil
 }
 
 func fastSizeof(data interface{}) int {
@@ -49,6 +65,8 @@ func fastSizeof(data interface{}) int {
 		return 8
 	case complex128, *complex128:
 		return 16
+	case time.Time:
+		return sizeofTime(d)
 	case string:
 		return sizeofString(len(d))
 
@@ -64,6 +82,16 @@ func fastSizeof(data interface{}) int {
 		if d != nil {
 			return SizeofUvarint(uint64(*d))
 		}
+	case time.Duration:
+		return SizeofVarint(int64(d))
+	case *time.Time:
+		if d != nil {
+			return sizeofTime(*d)
+		}
+	case *time.Duration:
+		if d != nil {
+			return SizeofVarint(int64(*d))
+		}
 	case []bool:
 		return sizeofBoolArray(len(d))
 	case []int8:
@@ -111,6 +139,13 @@ func fastSizeof(data interface{}) int {
 			s += SizeofUvarint(uint64(v))
 		}
 		return s
+	case []time.Duration:
+		l := len(d)
+		s := SizeofUvarint(uint64(l))
+		for _, v := range d {
+			s += SizeofVarint(int64(v))
+		}
+		return s
 
 	case *[]bool:
 		if d != nil {
@@ -176,8 +211,12 @@ func fastSizeof(data interface{}) int {
 		if d != nil {
 			return fastSizeof(*d)
 		}
+	case *[]time.Duration:
+		if d != nil {
+			return fastSizeof(*d)
+		}
 	}
-	return -1
+	return fastSizeofMap(data)
 }
 
 func assert(b bool, msg interface{}) {
@@ -186,23 +225,36 @@ func assert(b bool, msg interface{}) {
 	}
 }
 
-func bitsOfUnfixedArray(v reflect.Value, packed bool) int {
+func bitsOfUnfixedArray(v reflect.Value, field *fieldInfo, vis *ptrVisitor) int {
 	if !validUserType(v.Type().Elem()) { //check if array element type valid
 		return -1
 	}
 
 	arrayLen := v.Len()
-	sum := SizeofUvarint(uint64(arrayLen)) * 8 //array size bytes num
-	for i, n := 0, arrayLen; i < n; i++ {
-		s := bitsOfValue(v.Index(i), false, packed)
-		//assert(s >= 0, v.Type().String()) //element size must not error
-		sum += s
+	visit := v.Kind() == reflect.Slice && arrayLen > 0
+	if visit && !vis.enter(v) {
+		return -1
+	}
+	sum := field.sizeofLen(arrayLen) * 8 //array size bytes num
+	if info := queryStructElem(v.Type().Elem(), field); info != nil { //registed struct elements
+		for i, n := 0, arrayLen; i < n; i++ {
+			sum += info.bitsOfValue(v.Index(i), vis)
+		}
+	} else {
+		for i, n := 0, arrayLen; i < n; i++ {
+			s := bitsOfValue(v.Index(i), false, field.elemField(), vis)
+			//assert(s >= 0, v.Type().String()) //element size must not error
+			sum += s
+		}
+	}
+	if visit {
+		vis.leave(v)
 	}
 	return sum
 }
 
 // sizeof returns the size >= 0 of variables for the given type or -1 if the type is not acceptable.
-func bitsOfValue(v reflect.Value, topLevel bool, packed bool) (r int) {
+func bitsOfValue(v reflect.Value, topLevel bool, field *fieldInfo, vis *ptrVisitor) (r int) {
 	//	defer func() {
 	//		fmt.Printf("bitsOfValue(%#v)=%d\n", v.Interface(), r)
 	//	}()
@@ -217,12 +269,35 @@ func bitsOfValue(v reflect.Value, topLevel bool, packed bool) (r int) {
 			}
 			return 1
 		}
+		if !vis.enter(v) {
+			return -1
+		}
+		s := bitsOfValue(v.Elem(), false, field, vis) //one bool bit for each level of multi-level pointer
+		vis.leave(v)
+		if s < 0 {
+			return -1
+		}
+		return s + bits
 	}
 
-	v = reflect.Indirect(v) //redrect pointer to it's value
 	t := v.Type()
+	if codec := vis.codecs.find(t); codec != nil { //overrided codec
+		if s := codec.size(v, field); s >= 0 {
+			return s*8 + bits
+		}
+		return -1
+	}
+	if codec := queryCodec(t, field); codec != nil {
+		if s := codec.size(v, field); s >= 0 {
+			return s*8 + bits
+		}
+		return -1
+	}
+	if n := field.bitsOf(t); n > 0 { //bits shared with bools
+		return n + bits
+	}
 	if s := fixedTypeSize(t); s > 0 { //fixed size
-		if packedType := packedIntsType(t); packedType > 0 && packed {
+		if packedType := packedIntsType(t); packedType > 0 && field.isPacked() {
 			switch packedType {
 			case _SignedInts:
 				return SizeofVarint(v.Int())*8 + bits
@@ -237,53 +312,88 @@ func bitsOfValue(v reflect.Value, topLevel bool, packed bool) (r int) {
 	case reflect.Bool:
 		return 1 + bits
 	case reflect.Int:
+		if field.isFixed() {
+			return 8*8 + bits
+		}
 		return SizeofVarint(v.Int())*8 + bits
 	case reflect.Uint:
+		if field.isFixed() {
+			return 8*8 + bits
+		}
 		return SizeofUvarint(v.Uint())*8 + bits
 	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && field.isNilable() { //bool bit to keep nil
+			if v.IsNil() {
+				return 1 + bits
+			}
+			bits++
+		}
 		arrayLen := v.Len()
 		elemtype := t.Elem()
-		if s := fixedTypeSize(elemtype); s > 0 {
-			if packedIntsType(elemtype) > 0 && packed {
-				return bitsOfUnfixedArray(v, packed) + bits
-			}
-
-			return sizeofFixArray(arrayLen, s)*8 + bits
+		if isRuneElem(elemtype, field) {
+			size := sizeofRunes(v)
+			return (field.sizeofLen(size)+size)*8 + bits
+		}
+		if isDeltaElem(elemtype, field) {
+			return (field.sizeofLen(arrayLen)+sizeofDeltas(v))*8 + bits
+		}
+		if isGroupVarintElem(elemtype, field) {
+			return (field.sizeofLen(arrayLen)+sizeofGroupVarints(v))*8 + bits
+		}
+		if s := fixedElemSize(elemtype, field); s > 0 {
+			return (field.sizeofLen(arrayLen)+arrayLen*s)*8 + bits
 		}
 
-		if elemtype.Kind() == reflect.Bool {
-			return sizeofBoolArray(arrayLen)*8 + bits
+		if isBoolElem(elemtype, field) {
+			return (field.sizeofLen(arrayLen)+(arrayLen+8-1)/8)*8 + bits
 		}
-		return bitsOfUnfixedArray(v, packed) + bits
+		return bitsOfUnfixedArray(v, field, vis) + bits
 	case reflect.Map:
-		mapLen := v.Len()
-		sum := SizeofUvarint(uint64(mapLen))*8 + bits //array size
-		keys := v.MapKeys()
-
+		if field.isNilable() { //bool bit to keep nil
+			if v.IsNil() {
+				return 1 + bits
+			}
+			bits++
+		}
 		if !validUserType(t.Key()) ||
 			!validUserType(t.Elem()) { //check if map key and value type valid
 			return -1
 		}
+		mapLen := v.Len()
+		if mapLen > 0 && !vis.enter(v) {
+			return -1
+		}
+		sum := field.sizeofLen(mapLen)*8 + bits //array size
+		keys := v.MapKeys()
 
 		for i := 0; i < mapLen; i++ {
 			key := keys[i]
-			sizeKey := bitsOfValue(key, false, packed)
+			sizeKey := bitsOfValue(key, false, field, vis)
 			//assert(sizeKey >= 0, key.Type().Kind().String()) //key size must not error
 
 			sum += sizeKey
 			value := v.MapIndex(key)
-			sizeValue := bitsOfValue(value, false, packed)
+			sizeValue := bitsOfValue(value, false, field, vis)
 			//assert(sizeValue >= 0, value.Type().Kind().String()) //key size must not error
 
 			sum += sizeValue
 		}
+		if mapLen > 0 {
+			vis.leave(v)
+		}
 		return sum
 
 	case reflect.Struct:
-		return queryStruct(v.Type()).bitsOfValue(v) + bits
+		return field.structOf(v.Type()).bitsOfValue(v, vis) + bits
+
+	case reflect.Interface:
+		if s := bitsOfInterface(v, field, vis); s >= 0 {
+			return s + bits
+		}
+		return -1
 
 	case reflect.String:
-		return sizeofString(v.Len())*8 + bits //string length and data
+		return (field.sizeofLen(v.Len())+v.Len())*8 + bits //string length and data
 	}
 	return -1
 }
@@ -293,10 +403,34 @@ func bitsOfValue(v reflect.Value, topLevel bool, packed bool) (r int) {
 // always use this functin to verify if Type is valid
 // and do not care the value of return bytes
 func sizeofNilPointer(t reflect.Type) int {
+	if s, ok := _nilPointerSizes.Load(t); ok {
+		return s.(int)
+	}
+	s := sizeofNilPointerOf(t, make(map[reflect.Type]bool))
+	_nilPointerSizes.Store(t, s)
+	return s
+}
+
+var _nilPointerSizes sync.Map //reflect.Type -> int, cache of sizeofNilPointer
+
+// sizeofNilPointerOf is sizeofNilPointer without cache.
+// visiting is the types being checked, to deal with recursive types.
+func sizeofNilPointerOf(t reflect.Type, visiting map[reflect.Type]bool) int {
 	tt := t
 	if tt.Kind() == reflect.Ptr {
 		tt = t.Elem()
 	}
+	switch tt.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map, reflect.Array:
+		if visiting[tt] { //recursive type, it is valid if the other parts are valid
+			return 1
+		}
+		visiting[tt] = true
+		defer delete(visiting, tt)
+	}
+	if queryCodec(tt, nil) != nil {
+		return SizeofUvarint(0)
+	}
 	if s := fixedTypeSize(tt); s > 0 { //fix size
 		return s
 	}
@@ -305,15 +439,15 @@ func sizeofNilPointer(t reflect.Type) int {
 		return 1
 	case reflect.Int, reflect.Uint: //zero varint will be encoded as 1 byte
 		return 1
-	case reflect.String:
+	case reflect.String, reflect.Interface: //nil interface is encoded as type ID 0
 		return SizeofUvarint(0)
 	case reflect.Slice:
-		if validUserType(tt.Elem()) { //verify element type valid
+		if sizeofNilPointerOf(tt.Elem(), visiting) >= 0 { //verify element type valid
 			return SizeofUvarint(0)
 		}
 	case reflect.Map:
-		if validUserType(tt.Key()) &&
-			validUserType(tt.Elem()) { //verify key and value type valid
+		if sizeofNilPointerOf(tt.Key(), visiting) >= 0 &&
+			sizeofNilPointerOf(tt.Elem(), visiting) >= 0 { //verify key and value type valid
 			return SizeofUvarint(0)
 		}
 	case reflect.Array:
@@ -325,12 +459,14 @@ func sizeofNilPointer(t reflect.Type) int {
 		if elemtype.Kind() == reflect.Bool {
 			return sizeofBoolArray(tt.Len())
 		}
-		size := sizeofNilPointer(elemtype)
+		size := sizeofNilPointerOf(elemtype, visiting)
 		if size > 0 { //verify element type valid
 			return sizeofFixArray(tt.Len(), size)
 		}
 	case reflect.Struct:
-		return queryStruct(tt).sizeofNilPointer(tt)
+		return queryStruct(tt).sizeofNilPointer(tt, visiting)
+	case reflect.Ptr: //multi-level pointer
+		return sizeofNilPointerOf(tt, visiting)
 	}
 
 	return -1
@@ -351,6 +487,20 @@ func packedIntsType(t reflect.Type) int {
 	return 0
 }
 
+// fixedElemSize returns size of array element type t if it is encoded as fixed size
+// with options of field, or -1 if not.
+func fixedElemSize(t reflect.Type, field *fieldInfo) int {
+	if packedIntsType(t) > 0 && field.isPacked() || queryCodec(t, field) != nil || field.bitsOf(t) > 0 {
+		return -1
+	}
+	return fixedTypeSize(t)
+}
+
+// isBoolElem reports whether array element type t is encoded as bits.
+func isBoolElem(t reflect.Type, field *fieldInfo) bool {
+	return t.Kind() == reflect.Bool && queryCodec(t, field) == nil
+}
+
 func fixedTypeSize(t reflect.Type) int {
 	switch t.Kind() {
 	case reflect.Int8, reflect.Uint8:
@@ -372,7 +522,7 @@ func newPtr(v reflect.Value, decoder *Decoder, topLevel bool) bool {
 	if v.Kind() == reflect.Ptr {
 		e := v.Type().Elem()
 		switch e.Kind() {
-		case reflect.Array, reflect.Struct, reflect.Slice, reflect.Map:
+		case reflect.Array, reflect.Struct, reflect.Slice, reflect.Map, reflect.Interface, reflect.Ptr:
 			if !validUserType(e) { //check if valid pointer type
 				return false
 			}
@@ -386,7 +536,7 @@ func newPtr(v reflect.Value, decoder *Decoder, topLevel bool) bool {
 				isNotNilPointer = decoder.Bool()
 				if v.IsNil() {
 					if isNotNilPointer {
-						v.Set(reflect.New(e))
+						v.Set(decoder.newValue(e))
 					}
 				}
 			}
@@ -400,12 +550,30 @@ func newPtr(v reflect.Value, decoder *Decoder, topLevel bool) bool {
 // This function will make the encode/decode of struct slow down.
 // It is recommended to use RegStruct to improve this case.
 func validField(f reflect.StructField) bool {
-	if isExported(f.Name) && f.Tag.Get("binary") != "ignore" {
+	if isExported(f.Name) && !hasTagOption(f.Tag.Get("binary"), "ignore") {
 		return true
 	}
 	return false
 }
 
+// hasTagOption reports whether field tag contains option name.
+// It is called for fields of unregisted structs of every value, so the tag
+// is scaned without allocation.
+func hasTagOption(tag, name string) bool {
+	for tag != "" {
+		opt := tag
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			opt, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
+
 // isExported reports whether the identifier is exported.
 func isExported(id string) bool {
 	r, _ := utf8.DecodeRuneInString(id)
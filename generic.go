@@ -0,0 +1,181 @@
+// typed codecs of known concrete types by generics, to avoid interface{} boxing
+// and dispatching by reflect switch statements of each value.
+
+package binary
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Codec encode/decode values of type T in the default format.
+// Encode/decode functions of basic types and structs are compiled once when
+// the Codec is obtained by CodecFor, and the others are done as Encode/Decode.
+type Codec[T any] struct {
+	t      reflect.Type
+	size   int          //bytes of fixed-size T, -1 if not fixed
+	encode fieldEncoder //compiled encoder of T, nil means Encode
+	decode fieldDecoder //compiled decoder of T, nil means Decode
+}
+
+var _typedCodecs sync.Map //reflect.Type -> *Codec[T]
+
+// CodecFor returns Codec of type T, which is made once and cached.
+// Structs are registed by RegStruct if not.
+func CodecFor[T any]() *Codec[T] {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if c, ok := _typedCodecs.Load(t); ok {
+		return c.(*Codec[T])
+	}
+	c := &Codec[T]{t: t, size: -1}
+	if t.Kind() == reflect.Struct && queryStruct(t) == nil {
+		_structInfoMgr.regist(t) //registed concurrently by other Codec is ok
+	}
+	pt := reflect.PtrTo(t)
+	if !t.Implements(tBinaryEncoder) && !pt.Implements(tBinaryEncoder) { //BinarySerializer first as Encoder.Value
+		field := &fieldInfo{offset: -1}
+		field.compile(t)
+		c.encode, c.decode = field.encode, field.decode
+		if c.encode != nil {
+			c.size = fixedTypeSize(t)
+		}
+	}
+	actual, _ := _typedCodecs.LoadOrStore(t, c)
+	return actual.(*Codec[T])
+}
+
+// Size returns bytes number of value x encoded, or -1 if x is not encodable.
+func (c *Codec[T]) Size(x *T) int {
+	if c.size >= 0 {
+		return c.size
+	}
+	return Sizeof(x)
+}
+
+// Encode marshal value x to byte array.
+// nil buffer is aviable, it will create new buffer if necessary.
+func (c *Codec[T]) Encode(x *T, buffer []byte) (b []byte, err error) {
+	if c.encode == nil {
+		return Encode(x, buffer)
+	}
+	if c.size < 0 {
+		if buffer, err = MakeEncodeBuffer(x, buffer); err != nil {
+			return nil, err
+		}
+	} else if len(buffer) < c.size {
+		buffer = make([]byte, c.size)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.Codec.Encode")
+		}
+	}()
+	encoder := getEncoder(buffer)
+	defer putEncoder(encoder)
+	encoder.resetBoolCoder()
+	err = c.encode(encoder, reflect.ValueOf(x).Elem())
+	return encoder.Buffer(), err
+}
+
+// Decode unmarshal value x from byte array.
+func (c *Codec[T]) Decode(buffer []byte, x *T) (err error) {
+	if c.decode == nil {
+		return Decode(buffer, x)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.Codec.Decode")
+		}
+	}()
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	decoder.resetBoolCoder()
+	return c.decode(&decoder, reflect.ValueOf(x).Elem())
+}
+
+// Marshal encode value x of type T to a new byte array, by Codec of T.
+func Marshal[T any](x T) ([]byte, error) {
+	return CodecFor[T]().Encode(&x, nil)
+}
+
+// Unmarshal decode value of type T from buffer, by Codec of T.
+func Unmarshal[T any](buffer []byte) (T, error) {
+	var x T
+	err := CodecFor[T]().Decode(buffer, &x)
+	return x, err
+}
+
+// sizeofSlice returns bytes number of slice s encoded, or -1 if it is not encodable.
+func (c *Codec[T]) sizeofSlice(s []T) int {
+	switch {
+	case c.t.Kind() == reflect.Bool:
+		return SizeofUvarint(uint64(len(s))) + (len(s)+7)/8
+	case c.size >= 0:
+		return SizeofUvarint(uint64(len(s))) + len(s)*c.size
+	}
+	return Sizeof(s)
+}
+
+// EncodeSlice marshal slice s of type T to byte array, as Encode(s, buffer).
+// Numbers and bools are copied at once, and elements of other types are
+// encoded by Codec of T without dispatching by reflect.
+// nil buffer is aviable, it will create new buffer if necessary.
+func EncodeSlice[T any](s []T, buffer []byte) (b []byte, err error) {
+	c := CodecFor[T]()
+	if c.encode == nil {
+		return Encode(s, buffer)
+	}
+	size := c.sizeofSlice(s)
+	if size < 0 {
+		return Encode(s, buffer) //error of invalid type
+	}
+	if len(buffer) < size {
+		buffer = make([]byte, size)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.EncodeSlice")
+		}
+	}()
+	encoder := getEncoder(buffer)
+	defer putEncoder(encoder)
+	encoder.resetBoolCoder()
+	v := reflect.ValueOf(s)
+	if encoder.boolArray(v, nil) >= 0 || encoder.numbers(v, nil) {
+		return encoder.Buffer(), nil
+	}
+	encoder.length(len(s), nil)
+	for i := range s {
+		if err := c.encode(encoder, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return encoder.Buffer(), nil
+}
+
+// DecodeSlice unmarshal slice of type T from buffer, as Decode(buffer, &s).
+// Numbers and bools are copied at once, and elements of other types are
+// decoded by Codec of T without dispatching by reflect.
+func DecodeSlice[T any](buffer []byte) (s []T, err error) {
+	c := CodecFor[T]()
+	if c.decode == nil || c.t.Kind() == reflect.Bool || bulkWordSize(c.t, nil) > 0 {
+		err = Decode(buffer, &s)
+		return s, err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.DecodeSlice")
+		}
+	}()
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	decoder.resetBoolCoder()
+	s = make([]T, decoder.allocLength(nil, int(c.t.Size())))
+	v := reflect.ValueOf(s)
+	for i := range s {
+		if err := c.decode(&decoder, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,114 @@
+// encode/decode int32/uint32 slices/arrays as group varints, for field tag
+// `binary:"groupvarint"`.
+// Each group of 4 values is encoded as a control byte of 2 bits bytes number
+// of each value, followed by the values in 1~4 little-endian bytes.
+// The last group may have less than 4 values.
+// Int32 values are zigzag encoded.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// isGroupVarintElem reports whether slice/array elements of type t are encoded
+// as group varints.
+func isGroupVarintElem(t reflect.Type, field *fieldInfo) bool {
+	if !field.isGroupVarint() || queryCodec(t, field) != nil {
+		return false
+	}
+	k := t.Kind()
+	return k == reflect.Int32 || k == reflect.Uint32
+}
+
+// groupVarintAt returns value of element i of int32/uint32 slice/array v to encode.
+func groupVarintAt(v reflect.Value, i int) uint32 {
+	e := v.Index(i)
+	if e.Kind() == reflect.Int32 {
+		x := int32(e.Int())
+		return uint32(x<<1) ^ uint32(x>>31) //zigzag
+	}
+	return uint32(e.Uint())
+}
+
+// bytesOfUint32 returns bytes number of x without leading zero bytes, at least 1.
+func bytesOfUint32(x uint32) int {
+	switch {
+	case x < 1<<8:
+		return 1
+	case x < 1<<16:
+		return 2
+	case x < 1<<24:
+		return 3
+	}
+	return 4
+}
+
+// sizeofGroupVarints returns bytes of group varints of int32/uint32 slice/array v.
+func sizeofGroupVarints(v reflect.Value) int {
+	l := v.Len()
+	s := (l + 3) / 4 //control bytes
+	for i := 0; i < l; i++ {
+		s += bytesOfUint32(groupVarintAt(v, i))
+	}
+	return s
+}
+
+// groupVarints encode elements of int32/uint32 slice/array v as group varints.
+func (encoder *Encoder) groupVarints(v reflect.Value) {
+	for i, l := 0, v.Len(); i < l; i += 4 {
+		ctrl := encoder.pos //buffer may grow by encoding the group
+		encoder.reserve(1)
+		c := byte(0)
+		for j := 0; j < 4 && i+j < l; j++ {
+			x := groupVarintAt(v, i+j)
+			n := bytesOfUint32(x)
+			c |= byte(n-1) << (uint(j) * 2)
+			b := encoder.reserve(n)
+			for k := range b {
+				b[k] = byte(x >> (uint(k) * 8))
+			}
+		}
+		encoder.buff[ctrl] = c
+	}
+}
+
+// groupVarints decode size group varints to int32/uint32 slice/array v,
+// elements out of v are skiped.
+func (decoder *Decoder) groupVarints(v reflect.Value, size int) {
+	signed := v.Type().Elem().Kind() == reflect.Int32
+	l := v.Len()
+	for i := 0; i < size; i += 4 {
+		c := decoder.Uint8()
+		for j := 0; j < 4 && i+j < size; j++ {
+			b := decoder.reserve(int(c>>(uint(j)*2)&3) + 1)
+			x := uint32(0)
+			for k := len(b) - 1; k >= 0; k-- {
+				x = x<<8 | uint32(b[k])
+			}
+			if i+j >= l {
+				continue
+			}
+			if signed {
+				v.Index(i + j).SetInt(int64(int32(x>>1) ^ -int32(x&1)))
+			} else {
+				v.Index(i + j).SetUint(uint64(x))
+			}
+		}
+	}
+}
+
+// skipGroupVarints skip cnt group varints, and returns bytes skiped.
+func (decoder *Decoder) skipGroupVarints(cnt int) int {
+	sum := 0
+	for i := 0; i < cnt; i += 4 {
+		c := decoder.Uint8()
+		size := 0
+		for j := 0; j < 4 && i+j < cnt; j++ {
+			size += int(c>>(uint(j)*2)&3) + 1
+		}
+		decoder.Skip(size)
+		sum += 1 + size
+	}
+	return sum
+}
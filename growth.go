@@ -0,0 +1,74 @@
+// grow buffer of Encoder automatically by a configurable policy, instead of
+// panicking with ErrNotEnoughSpace.
+
+package binary
+
+import (
+	"fmt"
+)
+
+// GrowthPolicy is policy of growing buffer of Encoder when it is not enough.
+// Small initial size and factor fit tiny control messages, and a max size
+// with a small factor limits memory wasted by huge exports.
+type GrowthPolicy struct {
+	InitialSize int     //capacity of the first buffer if Encoder has no buffer, 0 means 64
+	Factor      float64 //capacity is multiplied by Factor at least when grows, not greater than 1 means 2
+	MaxSize     int     //max capacity of buffer, 0 means no limit. ErrNotEnoughSpace if exceeded
+}
+
+// DefaultGrowthPolicy doubles the buffer from 64 bytes without limit.
+var DefaultGrowthPolicy = GrowthPolicy{InitialSize: 64, Factor: 2}
+
+// SetGrowth set policy of growing buffer of Encoder when it is not enough,
+// nil means never grow and panic with ErrNotEnoughSpace, which is default.
+// The encoded bytes are copied to the grown buffer, so buffers got from
+// Buffer before are not updated any more.
+func (encoder *Encoder) SetGrowth(p *GrowthPolicy) {
+	if p != nil && (p.InitialSize < 0 || p.MaxSize < 0) {
+		panic(fmt.Errorf("binary.Encoder.SetGrowth: invalid policy %+v", *p))
+	}
+	encoder.growth = p
+}
+
+// reserve grows buffer by growth policy if it is not enough for size bytes,
+// and returns the reserved bytes.
+func (encoder *Encoder) reserve(size int) []byte {
+	encoder.ensure(size)
+	return encoder.coder.reserve(size)
+}
+
+// ensure grows buffer by growth policy if it is not enough for size bytes.
+// Size of buffer is unchanged if Encoder has no growth policy.
+func (encoder *Encoder) ensure(size int) {
+	need := encoder.pos + size
+	p := encoder.growth
+	if p == nil || need <= len(encoder.buff) {
+		return
+	}
+	if p.MaxSize > 0 && need > p.MaxSize {
+		panic(errorf(ErrNotEnoughSpace, "binary.Encoder: buffer overflow pos=%d require=%d, exceeds max size %d", encoder.pos, size, p.MaxSize))
+	}
+	newCap := p.InitialSize
+	if newCap == 0 {
+		newCap = DefaultGrowthPolicy.InitialSize
+	}
+	if n := len(encoder.buff); n > 0 {
+		factor := p.Factor
+		if factor <= 1 {
+			factor = DefaultGrowthPolicy.Factor
+		}
+		newCap = int(float64(n) * factor)
+		if newCap <= n {
+			newCap = n + 1
+		}
+	}
+	if newCap < need {
+		newCap = need
+	}
+	if p.MaxSize > 0 && newCap > p.MaxSize {
+		newCap = p.MaxSize
+	}
+	buff := make([]byte, newCap)
+	copy(buff, encoder.buff[:encoder.pos])
+	encoder.buff = buff
+}
@@ -0,0 +1,84 @@
+// lifecycle hooks of structs, so that types normalize or validate their
+// state without custom serializers.
+
+package binary
+
+import (
+	"reflect"
+	"sync"
+)
+
+// BeforeEncoder is implemented by structs to normalize or validate state,
+// such as recomputing derived fields, before they are encoded.
+// BeforeEncode is also called by Sizeof, so it may be called more than once
+// for a value and should be idempotent.
+// Pointer receivers are called only if the struct is addressable, such as
+// encoding by pointer.
+type BeforeEncoder interface {
+	BeforeEncode() error
+}
+
+// AfterDecoder is implemented by structs to normalize or validate state after
+// they are decoded. Errors of AfterDecode fail the decoding.
+type AfterDecoder interface {
+	AfterDecode() error
+}
+
+var (
+	tBeforeEncoder = reflect.TypeOf((*BeforeEncoder)(nil)).Elem()
+	tAfterDecoder  = reflect.TypeOf((*AfterDecoder)(nil)).Elem()
+)
+
+const (
+	hookBeforeEncode = 1 << iota
+	hookAfterDecode
+)
+
+var _structHooks sync.Map //reflect.Type => hook flags
+
+// hooksOf returns hook flags of struct t.
+func hooksOf(t reflect.Type) int {
+	if flags, ok := _structHooks.Load(t); ok {
+		return flags.(int)
+	}
+	flags := 0
+	if pt := reflect.PtrTo(t); pt.Implements(tBeforeEncoder) {
+		flags |= hookBeforeEncode
+	}
+	if pt := reflect.PtrTo(t); pt.Implements(tAfterDecoder) {
+		flags |= hookAfterDecode
+	}
+	_structHooks.Store(t, flags)
+	return flags
+}
+
+// hookOf returns v or its address which implements hook interface of flag,
+// or nil if not.
+func hookOf(v reflect.Value, flag int) interface{} {
+	if hooksOf(v.Type())&flag == 0 {
+		return nil
+	}
+	if v.CanAddr() && v.Addr().CanInterface() {
+		return v.Addr().Interface()
+	}
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return nil
+}
+
+// beforeEncode call BeforeEncode of struct v if it implements.
+func beforeEncode(v reflect.Value) error {
+	if h, ok := hookOf(v, hookBeforeEncode).(BeforeEncoder); ok {
+		return h.BeforeEncode()
+	}
+	return nil
+}
+
+// afterDecode call AfterDecode of struct v if it implements.
+func afterDecode(v reflect.Value) error {
+	if h, ok := hookOf(v, hookAfterDecode).(AfterDecoder); ok {
+		return h.AfterDecode()
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+// encode/decode interface values with type IDs of registed concrete types.
+
+package binary
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+)
+
+// RegType regist concrete type of data to encode/decode it as value of interface
+// fields, like gob.Register.
+// Interface values are encoded as uvarint type ID and the concrete value.
+// ID 0 means a nil interface.
+// Type ID is hash of package path and name of the type, so that independently
+// built programs agree on it without caring about registration order.
+// RegType((*someStruct)(nil)) regists type *someStruct,
+// and RegType(someStruct{}) regists type someStruct.
+func RegType(data interface{}) error {
+	t := reflect.TypeOf(data)
+	if t == nil {
+		return fmt.Errorf("binary: regist type of nil interface")
+	}
+	return _typeIDMgr.regist(typeName(t), t)
+}
+
+// RegTypeName is like RegType but use name instead of package path and name
+// of the type to generate type ID.
+// It is useful to keep type ID after the type is moved or renamed.
+func RegTypeName(name string, data interface{}) error {
+	t := reflect.TypeOf(data)
+	if t == nil {
+		return fmt.Errorf("binary: regist type of nil interface")
+	}
+	return _typeIDMgr.regist(name, t)
+}
+
+// typeName returns package path and name of type t, eg: "*github.com/vipally/binary.Decoder".
+// Unnamed types use their string representation.
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return "*" + typeName(t.Elem())
+	}
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
+
+// typeID returns FNV-1a hash of type name.
+func typeID(name string) uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return uint64(h.Sum32())
+}
+
+var _typeIDMgr typeIDMgr
+
+func init() {
+	_typeIDMgr.init()
+}
+
+type typeIDMgr struct {
+	ids   map[reflect.Type]uint64
+	types map[uint64]reflect.Type
+}
+
+func (mgr *typeIDMgr) init() {
+	mgr.ids = make(map[reflect.Type]uint64)
+	mgr.types = make(map[uint64]reflect.Type)
+}
+
+func (mgr *typeIDMgr) regist(name string, t reflect.Type) error {
+	if !validUserType(t) {
+		return errorf(ErrUnsupportedType, "binary: regist unsupported type %s", t.String())
+	}
+	if _, ok := mgr.ids[t]; ok {
+		return fmt.Errorf("binary: regist duplicate type %s", t.String())
+	}
+	id := typeID(name)
+	if id == 0 { //0 is nil interface
+		return fmt.Errorf("binary: regist type %s with invalid type ID 0 of name %s", t.String(), name)
+	}
+	if _t, ok := mgr.types[id]; ok {
+		return fmt.Errorf("binary: regist type %s with type ID %d conflicts with type %s", t.String(), id, _t.String())
+	}
+	mgr.ids[t] = id
+	mgr.types[id] = t
+	return nil
+}
+
+// idOf returns type ID of registed type t.
+func (mgr *typeIDMgr) idOf(t reflect.Type) (uint64, bool) {
+	id, ok := mgr.ids[t]
+	return id, ok
+}
+
+// typeOf returns registed type of type ID id, nil if not found.
+func (mgr *typeIDMgr) typeOf(id uint64) reflect.Type {
+	return mgr.types[id]
+}
+
+// iface encode interface value v as type ID and its concrete value.
+func (encoder *Encoder) iface(v reflect.Value, field *fieldInfo) error {
+	if v.IsNil() {
+		encoder.Uvarint(0)
+		return nil
+	}
+	e := v.Elem()
+	id, ok := _typeIDMgr.idOf(e.Type())
+	if !ok {
+		return fmt.Errorf("binary.Encoder.Value: unregisted type %s of interface %s", e.Type().String(), v.Type().String())
+	}
+	encoder.Uvarint(id)
+	return encoder.value(e, field)
+}
+
+// iface decode type ID and a new value of the registed type to interface value v.
+func (decoder *Decoder) iface(v reflect.Value, field *fieldInfo) error {
+	id, _ := decoder.Uvarint()
+	if id == 0 {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	t := _typeIDMgr.typeOf(id)
+	if t == nil {
+		return fmt.Errorf("binary.Decoder.Value: unregisted type ID %d of interface %s", id, v.Type().String())
+	}
+	if !t.Implements(v.Type()) {
+		return fmt.Errorf("binary.Decoder.Value: type %s does not implement %s", t.String(), v.Type().String())
+	}
+	e := reflect.New(t).Elem()
+	if err := decoder.value(e, false, field); err != nil {
+		return err
+	}
+	v.Set(e)
+	return nil
+}
+
+// skipInterface skip the next interface value.
+func (decoder *Decoder) skipInterface(field *fieldInfo) int {
+	id, n := decoder.Uvarint()
+	if id == 0 {
+		return n
+	}
+	t := _typeIDMgr.typeOf(id)
+	if t == nil {
+		return -1
+	}
+	if s := decoder.skipByType(t, field); s >= 0 {
+		return s + n
+	}
+	return -1
+}
+
+// bitsOfInterface returns bits number of interface value v, -1 if its type is not registed.
+func bitsOfInterface(v reflect.Value, field *fieldInfo, vis *ptrVisitor) int {
+	if v.IsNil() {
+		return SizeofUvarint(0) * 8
+	}
+	e := v.Elem()
+	id, ok := _typeIDMgr.idOf(e.Type())
+	if !ok {
+		return -1
+	}
+	if s := bitsOfValue(e, false, field, vis); s >= 0 {
+		return SizeofUvarint(id)*8 + s
+	}
+	return -1
+}
@@ -0,0 +1,98 @@
+// decode fields of encoded struct value on demand.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// LazyStruct is a read-only view of a struct value encoded in buffer.
+// It resolves offsets of fields on demand and decodes a field only when it
+// is accessed, for read-mostly workloads over large records.
+// Use RegStruct for the struct type to apply field tags.
+type LazyStruct struct {
+	t      reflect.Type
+	info   *structInfo
+	starts []Decoder //decoder state at beginning of resolved fields
+}
+
+// NewLazyStruct make a LazyStruct view of struct value encoded in buffer.
+// data is value or pointer of the struct type, nil pointer is aviable.
+// NewLazyStruct(buffer, (*someStruct)(nil)) is recommended usage.
+// The buffer must not be modified while the view is in use.
+func NewLazyStruct(buffer []byte, data interface{}) (*LazyStruct, error) {
+	t, ok, _ := _structInfoMgr.deepStructType(reflect.TypeOf(data), false)
+	if !ok || !validUserType(t) {
+		return nil, errorf(ErrUnsupportedType, "binary.NewLazyStruct: unsupported type %T", data)
+	}
+	if queryStruct(t).isTagged() { //fields are not in fixed order
+		return nil, errorf(ErrUnsupportedType, "binary.NewLazyStruct: unsupported tagged struct %s", t.String())
+	}
+	lazy := &LazyStruct{
+		t:      t,
+		info:   queryStruct(t),
+		starts: make([]Decoder, 1, t.NumField()+1),
+	}
+	lazy.starts[0].Init(buffer, DefaultEndian)
+	lazy.starts[0].resetBoolCoder()
+	if version := lazy.info.versionOf(); version > 0 { //fields of other versions are not resolvable
+		x, n := Uvarint(buffer)
+		if n <= 0 || x != uint64(version) {
+			return nil, fmt.Errorf("binary.NewLazyStruct: buffer is not version %d of %s", version, t.String())
+		}
+		lazy.starts[0].pos = n
+	}
+	return lazy, nil
+}
+
+// Field decode the field with name to x, which must be pointer of the field type.
+// It will return none-nil error if the struct has no field of name,
+// or buffer is not enough.
+func (lazy *LazyStruct) Field(name string, x interface{}) (err error) {
+	defer func() {
+		if info := recover(); info != nil {
+			err = panicError(info, "binary.LazyStruct.Field")
+		}
+	}()
+
+	f, ok := lazy.t.FieldByName(name)
+	if !ok || len(f.Index) != 1 || !lazy.info.fieldValid(f.Index[0], lazy.t) {
+		return fmt.Errorf("binary.LazyStruct.Field: %s has no field %s", lazy.t.String(), name)
+	}
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Type().Elem() != f.Type {
+		return fmt.Errorf("binary.LazyStruct.Field: %T is not pointer of field %s %s", x, name, f.Type.String())
+	}
+
+	i := f.Index[0]
+	decoder := lazy.start(lazy.info.position(i)) //copy of decoder state
+	finfo := lazy.info.field(i)
+	decoder.skipToOffset(0, finfo)
+	decoder.endian = finfo.endianOf(decoder.endian)
+	return decoder.value(v.Elem(), false, finfo)
+}
+
+// Size returns bytes number of the encoded struct value.
+// It will panic if buffer is not enough.
+func (lazy *LazyStruct) Size() int {
+	return lazy.start(lazy.t.NumField()).pos
+}
+
+// start returns decoder state at beginning of field at position p in
+// encoding order, resolve the fields before it if necessary.
+func (lazy *LazyStruct) start(p int) Decoder {
+	for j := len(lazy.starts) - 1; j < p; j++ {
+		decoder := lazy.starts[j]
+		i := lazy.info.index(j)
+		if finfo := lazy.info.field(i); finfo.isValid(i, lazy.t) {
+			decoder.skipToOffset(0, finfo)
+			endian := decoder.endian
+			decoder.endian = finfo.endianOf(endian)
+			decoder.skipByType(finfo.Type(i, lazy.t), finfo)
+			decoder.endian = endian
+		}
+		lazy.starts = append(lazy.starts, decoder)
+	}
+	return lazy.starts[p]
+}
@@ -0,0 +1,251 @@
+// append-only logs of records in segment files, for event-sourcing and WAL
+// use cases. Each record is a message of WriteMessageChecksum with CRC32.
+
+package binary
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLogSegmentSize is the default max bytes of a log segment file.
+const DefaultLogSegmentSize = 64 << 20
+
+const logSegmentExt = ".log"
+
+// logSegments returns sorted sequence numbers of segment files in dir.
+func logSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, logSegmentExt) {
+			continue
+		}
+		if n, err := strconv.ParseUint(strings.TrimSuffix(name, logSegmentExt), 10, 64); err == nil {
+			segs = append(segs, n)
+		}
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i] < segs[j] })
+	return segs, nil
+}
+
+func logSegmentPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d%s", seq, logSegmentExt))
+}
+
+// readLogRecord read a record from r, and returns bytes of the value.
+func readLogRecord(r io.Reader) ([]byte, error) {
+	buf, err := readMessage(r, CRC32.Size())
+	if err != nil {
+		return nil, err
+	}
+	return VerifyChecksum(buf, CRC32)
+}
+
+// LogWriter append records to segment files of a log directory.
+// A new segment is started when the current one exceeds the segment size.
+// Records are buffered until Sync or Close.
+type LogWriter struct {
+	dir         string
+	segmentSize int64
+	seq         uint64 //sequence number of current segment
+	f           *os.File
+	w           *bufio.Writer
+	cw          countWriter //bytes of current segment
+}
+
+// OpenLogWriter open log directory dir to append records, which is created
+// if not exists. Segments larger than segmentSize are rotated, and
+// DefaultLogSegmentSize is used if segmentSize <= 0.
+// A torn or corrupted tail of the last segment, which is left by crashes, is
+// truncated.
+func OpenLogWriter(dir string, segmentSize int64) (*LogWriter, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultLogSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	segs, err := logSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	lw := &LogWriter{dir: dir, segmentSize: segmentSize}
+	if len(segs) == 0 {
+		return lw, lw.openSegment(0)
+	}
+	if err := lw.openSegment(segs[len(segs)-1]); err != nil {
+		return nil, err
+	}
+	if err := lw.recover(); err != nil {
+		lw.f.Close()
+		return nil, err
+	}
+	return lw, nil
+}
+
+// openSegment open segment seq for appending.
+func (lw *LogWriter) openSegment(seq uint64) error {
+	f, err := os.OpenFile(logSegmentPath(lw.dir, seq), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	lw.seq, lw.f = seq, f
+	lw.cw = countWriter{w: f}
+	lw.w = bufio.NewWriter(&lw.cw)
+	return nil
+}
+
+// recover truncate invalid tail of current segment after its valid records.
+func (lw *LogWriter) recover() error {
+	if _, err := lw.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	cr := &countReader{r: bufio.NewReader(lw.f)}
+	valid := int64(0)
+	for {
+		if _, err := readLogRecord(cr); err != nil {
+			break
+		}
+		valid = cr.n
+	}
+	if err := lw.f.Truncate(valid); err != nil {
+		return err
+	}
+	lw.cw.n = valid
+	return nil
+}
+
+// Append encode data as a record to the end of the log.
+func (lw *LogWriter) Append(data interface{}) error {
+	if lw.cw.n+int64(lw.w.Buffered()) >= lw.segmentSize {
+		if err := lw.rotate(); err != nil {
+			return err
+		}
+	}
+	return WriteMessageChecksum(lw.w, data, CRC32)
+}
+
+// rotate complete current segment and start the next one.
+func (lw *LogWriter) rotate() error {
+	if err := lw.Sync(); err != nil {
+		return err
+	}
+	if err := lw.f.Close(); err != nil {
+		return err
+	}
+	return lw.openSegment(lw.seq + 1)
+}
+
+// Sync write buffered records to current segment, and commit it to stable storage.
+func (lw *LogWriter) Sync() error {
+	if err := lw.w.Flush(); err != nil {
+		return err
+	}
+	return lw.f.Sync()
+}
+
+// Close sync buffered records and close the log.
+func (lw *LogWriter) Close() error {
+	if err := lw.Sync(); err != nil {
+		lw.f.Close()
+		return err
+	}
+	return lw.f.Close()
+}
+
+// LogReader replay records of a log directory in order of appending, as
+//
+//	r, err := OpenLogReader(dir)
+//	...
+//	defer r.Close()
+//	for r.Next() {
+//		var e Event
+//		if err := r.Decode(&e); err != nil {...}
+//	}
+//	if err := r.Err(); err != nil {...}
+//
+// A torn tail of the last segment is treated as end of the log.
+type LogReader struct {
+	dir   string
+	segs  []uint64 //segments to read, the first is current
+	f     *os.File
+	r     *bufio.Reader
+	value []byte
+	err   error
+}
+
+// OpenLogReader open log directory dir to replay records.
+func OpenLogReader(dir string) (*LogReader, error) {
+	segs, err := logSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &LogReader{dir: dir, segs: segs}, nil
+}
+
+// Next read the next record, and reports whether there is one.
+// It returns false at end of the log or on error.
+func (lr *LogReader) Next() bool {
+	for lr.err == nil {
+		if lr.f == nil {
+			if len(lr.segs) == 0 {
+				return false
+			}
+			f, err := os.Open(logSegmentPath(lr.dir, lr.segs[0]))
+			if err != nil {
+				lr.err = err
+				return false
+			}
+			lr.f, lr.r = f, bufio.NewReader(f)
+		}
+		value, err := readLogRecord(lr.r)
+		if err == nil {
+			lr.value = value
+			return true
+		}
+		last := len(lr.segs) == 1
+		if err != io.EOF && !(err == io.ErrUnexpectedEOF && last) {
+			lr.err = fmt.Errorf("binary.LogReader: segment %d: %s", lr.segs[0], err.Error())
+			return false
+		}
+		lr.f.Close()
+		lr.f, lr.segs = nil, lr.segs[1:]
+	}
+	return false
+}
+
+// Bytes returns encoded value of current record, which is valid until Next.
+func (lr *LogReader) Bytes() []byte {
+	return lr.value
+}
+
+// Decode decode value of current record to data, as Decode.
+func (lr *LogReader) Decode(data interface{}) error {
+	return Decode(lr.value, data)
+}
+
+// Err returns the error stopped Next, or nil at end of the log.
+func (lr *LogReader) Err() error {
+	return lr.err
+}
+
+// Close close the log.
+func (lr *LogReader) Close() error {
+	if lr.f == nil {
+		return nil
+	}
+	err := lr.f.Close()
+	lr.f = nil
+	return err
+}
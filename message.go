@@ -0,0 +1,86 @@
+// frame encoded values with uvarint length prefixes on streams, such as TCP
+// connections, so that each message is read as a whole.
+
+package binary
+
+import (
+	"io"
+)
+
+// MaxMessageSize is the max bytes of a message read by ReadMessage, to avoid
+// allocating huge buffers by length prefixes of corrupted or hostile streams.
+var MaxMessageSize = 64 << 20
+
+// WriteMessage encode data and write it to w as a message, which is the
+// encoded bytes preceded by their length as uvarint.
+// The message is written by a single Write call.
+func WriteMessage(w io.Writer, data interface{}) error {
+	size := Sizeof(data)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(data, nil) //error of invalid data
+		return err
+	}
+	buf := make([]byte, MaxVarintLen64+size)
+	encoder := NewEncoderBuffer(buf[MaxVarintLen64:])
+	if err := encoder.Value(data); err != nil {
+		return err
+	}
+	l := encoder.Len()
+	start := MaxVarintLen64 - SizeofUvarint(uint64(l))
+	PutUvarint(buf[start:], uint64(l))
+	_, err := w.Write(buf[start : MaxVarintLen64+l])
+	return err
+}
+
+// ReadMessage read a message written by WriteMessage from r, and decode it to
+// data, which must be a pointer.
+// It reads no more bytes than the message from r, and partial reads are
+// continued until the message is read.
+// It returns io.EOF if there is no more message, io.ErrUnexpectedEOF if the
+// message is truncated, or error if the message exceeds MaxMessageSize.
+func ReadMessage(r io.Reader, data interface{}) error {
+	buf, err := readMessage(r, 0)
+	if err != nil {
+		return err
+	}
+	return Decode(buf, data)
+}
+
+// readMessage read a message and extra bytes of trailer after it from r.
+func readMessage(r io.Reader, extra int) ([]byte, error) {
+	br := &messageByteReader{r: r}
+	size, err := ReadUvarint(br)
+	if err != nil {
+		if err == io.EOF && br.n > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if size > uint64(MaxMessageSize) {
+		return nil, errorf(ErrLimitExceeded, "binary.ReadMessage: message size %d exceeds max size %d", size, MaxMessageSize)
+	}
+	buf := make([]byte, int(size)+extra)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// messageByteReader read bytes of r one by one, to read no more than the
+// length prefix of a message.
+type messageByteReader struct {
+	r   io.Reader
+	n   int //bytes read
+	buf [1]byte
+}
+
+func (br *messageByteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(br.r, br.buf[:]); err != nil {
+		return 0, err
+	}
+	br.n++
+	return br.buf[0], nil
+}
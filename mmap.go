@@ -0,0 +1,68 @@
+// decode files mapped into memory, so that large datasets are read lazily
+// by pages without loading them into heap.
+
+package binary
+
+import (
+	"errors"
+	"os"
+)
+
+// MappedFile is a read-only file mapped into memory, on platforms which
+// support mmap, or read into memory on others.
+// Values decoded with zero copy refer to the mapping, and must not be used
+// after Close.
+type MappedFile struct {
+	data  []byte
+	unmap func([]byte) error //nil if not mapped
+}
+
+// OpenMapped map file of path into memory for reading.
+func OpenMapped(path string) (*MappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size < 0 || uint64(size) > uint64(maxInt) {
+		return nil, errors.New("binary.OpenMapped: file is too large to map")
+	}
+	if size == 0 {
+		return &MappedFile{data: []byte{}}, nil
+	}
+	return mapFile(f, int(size))
+}
+
+// Bytes returns the mapped bytes, which must not be modified.
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+// Len returns bytes number of the file.
+func (m *MappedFile) Len() int {
+	return len(m.data)
+}
+
+// Decoder returns a Decoder over the mapped bytes with SetZeroCopy, of which
+// decoded strings and byte slices refer to the mapping instead of copying.
+func (m *MappedFile) Decoder() *Decoder {
+	decoder := NewDecoder(m.data)
+	decoder.SetZeroCopy(true)
+	return decoder
+}
+
+// Close unmap the file. Bytes and values decoded with zero copy are invalid
+// after Close.
+func (m *MappedFile) Close() error {
+	data, unmap := m.data, m.unmap
+	m.data, m.unmap = nil, nil
+	if unmap == nil {
+		return nil
+	}
+	return unmap(data)
+}
@@ -0,0 +1,17 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package binary
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile read size bytes of f into memory, where mmap is not supported.
+func mapFile(f *os.File, size int) (*MappedFile, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return &MappedFile{data: data}, nil
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package binary
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile map size bytes of f into memory read-only.
+func mapFile(f *os.File, size int) (*MappedFile, error) {
+	data, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	return &MappedFile{data: data, unmap: syscall.Munmap}, nil
+}
@@ -0,0 +1,435 @@
+// encode/decode values in MessagePack format by Encoder/Decoder with
+// SetMsgpack, to switch wire format without a different library.
+
+package binary
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// types of MessagePack values
+const (
+	mpNil = iota
+	mpBool
+	mpInt  //negative int
+	mpUint //non-negative int
+	mpFloat
+	mpStr
+	mpBin
+	mpArray
+	mpMap
+)
+
+var mpTypeNames = [...]string{"nil", "bool", "int", "uint", "float", "str", "bin", "array", "map"}
+
+// SetMsgpack set if Encoder encode values in MessagePack format.
+// Structs are encoded as maps of field names to field values, and field tags
+// of encoding options are ignored.
+// Use EncodeMsgpack to encode a value without knowing its size.
+func (encoder *Encoder) SetMsgpack(msgpack bool) {
+	encoder.msgpack = msgpack
+}
+
+// SetMsgpack set if Decoder decode values in MessagePack format,
+// which is encoded by Encoder with SetMsgpack or other MessagePack libraries.
+// Unknown fields of structs are skipped.
+func (decoder *Decoder) SetMsgpack(msgpack bool) {
+	decoder.msgpack = msgpack
+}
+
+// mpValue encode v in MessagePack format.
+func (encoder *Encoder) mpValue(v reflect.Value) {
+	b := encoder.appendMsgpack(nil, v)
+	copy(encoder.reserve(len(b)), b)
+}
+
+// appendMsgpack append v in MessagePack format to b.
+func (encoder *Encoder) appendMsgpack(b []byte, v reflect.Value) []byte {
+	switch k := v.Kind(); k {
+	case reflect.Invalid: //nil interface
+		return append(b, 0xc0)
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if x := v.Int(); x < 0 {
+			return mpAppendInt(b, x)
+		}
+		return mpAppendUint(b, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return mpAppendUint(b, v.Uint())
+	case reflect.Float32:
+		return mpAppendBits(append(b, 0xca), uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		return mpAppendBits(append(b, 0xcb), math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		b = mpAppendLen(b, v.Len(), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		return append(b, v.String()...)
+	case reflect.Slice, reflect.Array:
+		if k == reflect.Slice && v.IsNil() {
+			return append(b, 0xc0)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 { //bin
+			b = mpAppendLen(b, v.Len(), 0, 0, 0xc4, 0xc5, 0xc6)
+			for i, n := 0, v.Len(); i < n; i++ {
+				b = append(b, byte(v.Index(i).Uint()))
+			}
+			return b
+		}
+		b = mpAppendLen(b, v.Len(), 0x90, 15, 0, 0xdc, 0xdd)
+		for i, n := 0, v.Len(); i < n; i++ {
+			b = encoder.appendMsgpack(b, v.Index(i))
+		}
+		return b
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xc0)
+		}
+		if !encoder.visitor.enter(v) {
+			panic(encoder.cycleError(v))
+		}
+		defer encoder.visitor.leave(v)
+		keys := v.MapKeys()
+		if encoder.deterministic {
+			sortMapKeys(keys)
+		}
+		b = mpAppendLen(b, len(keys), 0x80, 15, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			b = encoder.appendMsgpack(b, key)
+			b = encoder.appendMsgpack(b, v.MapIndex(key))
+		}
+		return b
+	case reflect.Struct:
+		t := v.Type()
+		if queryCodec(t, nil) != nil {
+			panic(errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type %s in MessagePack", t.String()))
+		}
+		info := queryStruct(t)
+		n := 0
+		for i, num := 0, t.NumField(); i < num; i++ {
+			if info.fieldValid(i, t) {
+				n++
+			}
+		}
+		b = mpAppendLen(b, n, 0x80, 15, 0, 0xde, 0xdf)
+		for i, num := 0, t.NumField(); i < num; i++ {
+			if info.fieldValid(i, t) {
+				name := t.Field(i).Name
+				b = mpAppendLen(b, len(name), 0xa0, 31, 0xd9, 0xda, 0xdb)
+				b = append(b, name...)
+				b = encoder.appendMsgpack(b, v.Field(i))
+			}
+		}
+		return b
+	case reflect.Ptr:
+		if v.IsNil() {
+			return append(b, 0xc0)
+		}
+		if !encoder.visitor.enter(v) {
+			panic(encoder.cycleError(v))
+		}
+		defer encoder.visitor.leave(v)
+		return encoder.appendMsgpack(b, v.Elem())
+	case reflect.Interface:
+		return encoder.appendMsgpack(b, v.Elem())
+	}
+	panic(errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type %s in MessagePack", v.Type().String()))
+}
+
+// mpAppendUint append x in the shortest MessagePack uint format to b.
+func mpAppendUint(b []byte, x uint64) []byte {
+	switch {
+	case x <= 0x7f: //positive fixint
+		return append(b, byte(x))
+	case x <= math.MaxUint8:
+		return append(b, 0xcc, byte(x))
+	case x <= math.MaxUint16:
+		return mpAppendBits(append(b, 0xcd), x, 2)
+	case x <= math.MaxUint32:
+		return mpAppendBits(append(b, 0xce), x, 4)
+	}
+	return mpAppendBits(append(b, 0xcf), x, 8)
+}
+
+// mpAppendInt append negative x in the shortest MessagePack int format to b.
+func mpAppendInt(b []byte, x int64) []byte {
+	switch {
+	case x >= -32: //negative fixint
+		return append(b, byte(x))
+	case x >= math.MinInt8:
+		return append(b, 0xd0, byte(x))
+	case x >= math.MinInt16:
+		return mpAppendBits(append(b, 0xd1), uint64(x), 2)
+	case x >= math.MinInt32:
+		return mpAppendBits(append(b, 0xd2), uint64(x), 4)
+	}
+	return mpAppendBits(append(b, 0xd3), uint64(x), 8)
+}
+
+// mpAppendLen append header of str/bin/array/map with length n to b.
+// fix is the fix format code for length up to fixMax, and code8 0 means no
+// 8 bits length format.
+func mpAppendLen(b []byte, n int, fix byte, fixMax int, code8, code16, code32 byte) []byte {
+	switch {
+	case fix != 0 && n <= fixMax:
+		return append(b, fix|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return mpAppendBits(append(b, code16), uint64(n), 2)
+	}
+	return mpAppendBits(append(b, code32), uint64(n), 4)
+}
+
+// mpAppendBits append low size bytes of x in big endian to b.
+func mpAppendBits(b []byte, x uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(x>>(uint(i)*8)))
+	}
+	return b
+}
+
+// mpBits decode size bytes of big endian number.
+func (decoder *Decoder) mpBits(size int) uint64 {
+	x := uint64(0)
+	for _, c := range decoder.reserve(size) {
+		x = x<<8 | uint64(c)
+	}
+	return x
+}
+
+// mpHeader decode type of next value, and returns length of str/bin/array/map,
+// bits of int/uint, bits of float64 of float, or 1 for true.
+func (decoder *Decoder) mpHeader() (int, uint64) {
+	switch c := decoder.Uint8(); {
+	case c <= 0x7f:
+		return mpUint, uint64(c)
+	case c >= 0xe0:
+		return mpInt, uint64(int64(int8(c)))
+	case c <= 0x8f:
+		return mpMap, uint64(c & 0xf)
+	case c <= 0x9f:
+		return mpArray, uint64(c & 0xf)
+	case c <= 0xbf:
+		return mpStr, uint64(c & 0x1f)
+	case c == 0xc0:
+		return mpNil, 0
+	case c == 0xc2, c == 0xc3:
+		return mpBool, uint64(c & 1)
+	case c >= 0xc4 && c <= 0xc6:
+		return mpBin, decoder.mpBits(1 << (c - 0xc4))
+	case c == 0xca:
+		return mpFloat, math.Float64bits(float64(math.Float32frombits(uint32(decoder.mpBits(4)))))
+	case c == 0xcb:
+		return mpFloat, decoder.mpBits(8)
+	case c >= 0xcc && c <= 0xcf:
+		return mpUint, decoder.mpBits(1 << (c - 0xcc))
+	case c >= 0xd0 && c <= 0xd3:
+		size := 1 << (c - 0xd0)
+		x := decoder.mpBits(size)
+		shift := uint(64 - size*8)
+		if x = uint64(int64(x<<shift) >> shift); int64(x) >= 0 {
+			return mpUint, x
+		}
+		return mpInt, x
+	case c >= 0xd9 && c <= 0xdb:
+		return mpStr, decoder.mpBits(1 << (c - 0xd9))
+	case c == 0xdc, c == 0xdd:
+		return mpArray, decoder.mpBits(2 << (c - 0xdc))
+	case c == 0xde, c == 0xdf:
+		return mpMap, decoder.mpBits(2 << (c - 0xde))
+	default:
+		panic(fmt.Errorf("binary.Decoder.Value: unsupported MessagePack format 0x%02x", c))
+	}
+}
+
+// mpLen returns length x of str/bin/array/map if it does not exceed max length.
+func (decoder *Decoder) mpLen(x uint64, elemSize int) int {
+	if x > uint64(maxInt) {
+		panic(errorf(ErrOverflow, "binary.Decoder.Value: invalid length %d", x))
+	}
+	l := decoder.checkLen(int(x))
+	decoder.alloc(l, elemSize)
+	return l
+}
+
+// mpValue decode v in MessagePack format.
+func (decoder *Decoder) mpValue(v reflect.Value) {
+	if decoder.maxDepth > 0 {
+		decoder.enter()
+		defer decoder.leave()
+	}
+	typ, x := decoder.mpHeader()
+	decoder.mpValueAt(v, typ, x)
+}
+
+// mpValueAt decode v from MessagePack value, whose header is decoded as typ and x.
+func (decoder *Decoder) mpValueAt(v reflect.Value, typ int, x uint64) {
+	if typ == mpNil {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	t := v.Type()
+	mismatch := func() {
+		panic(fmt.Errorf("binary.Decoder.Value: can not decode MessagePack %s to %s", mpTypeNames[typ], t.String()))
+	}
+	switch k := v.Kind(); k {
+	case reflect.Bool:
+		if typ != mpBool {
+			mismatch()
+		}
+		v.SetBool(x != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if (typ != mpInt && typ != mpUint) || (typ == mpUint && x > math.MaxInt64) || v.OverflowInt(int64(x)) {
+			mismatch()
+		}
+		v.SetInt(int64(x))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if typ != mpUint || v.OverflowUint(x) {
+			mismatch()
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		switch typ {
+		case mpFloat:
+			v.SetFloat(math.Float64frombits(x))
+		case mpInt:
+			v.SetFloat(float64(int64(x)))
+		case mpUint:
+			v.SetFloat(float64(x))
+		default:
+			mismatch()
+		}
+	case reflect.String:
+		if typ != mpStr && typ != mpBin {
+			mismatch()
+		}
+		v.SetString(decoder.validString(string(decoder.reserve(decoder.mpLen(x, 1)))))
+	case reflect.Slice, reflect.Array:
+		et := t.Elem()
+		if (typ == mpBin || typ == mpStr) && et.Kind() == reflect.Uint8 {
+			b := decoder.reserve(decoder.mpLen(x, 1))
+			if k == reflect.Slice {
+				v.Set(reflect.MakeSlice(t, len(b), len(b)))
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return
+		}
+		if typ != mpArray {
+			mismatch()
+		}
+		l := decoder.mpLen(x, int(et.Size()))
+		if k == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, l, l))
+		}
+		for i := 0; i < l; i++ {
+			if i < v.Len() {
+				decoder.mpValue(v.Index(i))
+			} else {
+				decoder.mpSkip() //elements out of array
+			}
+		}
+	case reflect.Map:
+		if typ != mpMap {
+			mismatch()
+		}
+		l := decoder.mpLen(x, int(t.Key().Size()+t.Elem().Size()))
+		v.Set(reflect.MakeMapWithSize(t, l))
+		for i := 0; i < l; i++ {
+			key := reflect.New(t.Key()).Elem()
+			value := reflect.New(t.Elem()).Elem()
+			decoder.mpValue(key)
+			decoder.mpValue(value)
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		if typ != mpMap || queryCodec(t, nil) != nil {
+			mismatch()
+		}
+		info := queryStruct(t)
+		info.setDefaults(v, nil)
+		for i, l := 0, decoder.mpLen(x, 0); i < l; i++ {
+			var name string
+			decoder.mpValue(reflect.ValueOf(&name).Elem())
+			if f, ok := t.FieldByName(name); ok && len(f.Index) == 1 && info.fieldValid(f.Index[0], t) {
+				decoder.mpValue(v.Field(f.Index[0]))
+			} else {
+				decoder.mpSkip() //unknown field
+			}
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		decoder.mpValueAt(v.Elem(), typ, x)
+	case reflect.Interface:
+		if t.NumMethod() > 0 {
+			mismatch()
+		}
+		if a := decoder.mpAny(typ, x); a != nil {
+			v.Set(reflect.ValueOf(a))
+		}
+	default:
+		mismatch()
+	}
+}
+
+// mpAny decode MessagePack value as nil, bool, int64, uint64 out of int64,
+// float64, string, []byte, []interface{} or map[interface{}]interface{}.
+func (decoder *Decoder) mpAny(typ int, x uint64) interface{} {
+	switch typ {
+	case mpBool:
+		return x != 0
+	case mpInt:
+		return int64(x)
+	case mpUint:
+		if x > math.MaxInt64 {
+			return x
+		}
+		return int64(x)
+	case mpFloat:
+		return math.Float64frombits(x)
+	case mpStr:
+		return decoder.validString(string(decoder.reserve(decoder.mpLen(x, 1))))
+	case mpBin:
+		return append([]byte{}, decoder.reserve(decoder.mpLen(x, 1))...)
+	case mpArray:
+		a := make([]interface{}, decoder.mpLen(x, 16))
+		for i := range a {
+			a[i] = decoder.mpNext()
+		}
+		return a
+	case mpMap:
+		l := decoder.mpLen(x, 32)
+		m := make(map[interface{}]interface{}, l)
+		for i := 0; i < l; i++ {
+			key := decoder.mpNext()
+			if b, ok := key.([]byte); ok { //unhashable
+				key = string(b)
+			} else if key != nil && !reflect.TypeOf(key).Comparable() {
+				panic(errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported MessagePack map key of type %T", key))
+			}
+			m[key] = decoder.mpNext()
+		}
+		return m
+	}
+	return nil
+}
+
+// mpNext decode next MessagePack value by mpAny.
+func (decoder *Decoder) mpNext() interface{} {
+	if decoder.maxDepth > 0 {
+		decoder.enter()
+		defer decoder.leave()
+	}
+	return decoder.mpAny(decoder.mpHeader())
+}
+
+// mpSkip skip next MessagePack value.
+func (decoder *Decoder) mpSkip() {
+	decoder.mpNext()
+}
@@ -0,0 +1,212 @@
+package binary
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+)
+
+func init() {
+	_builtinCodecs[reflect.TypeOf(net.IP{})] = &netIPCodec
+	_builtinCodecs[reflect.TypeOf(netip.Addr{})] = &netipAddrCodec
+	_builtinCodecs[reflect.TypeOf(netip.AddrPort{})] = &netipAddrPortCodec
+}
+
+// tag byte of IP addresses, followed by address bytes
+const (
+	ipTagNone   = 0  //nil net.IP or zero netip.Addr
+	ipTagV4     = 4  //4 bytes IPv4 address
+	ipTagV6     = 16 //16 bytes IPv6 address
+	ipTagV6Zone = 17 //16 bytes IPv6 address and zone string
+)
+
+// IP encode a net.IP value to Encoder buffer as tag byte and 4/16 address bytes.
+// IPv4 addresses in 16-byte form are encoded as 4 bytes.
+// It will panic if buffer is not enough or x is not a valid IP.
+func (encoder *Encoder) IP(x net.IP) {
+	if len(x) == 0 {
+		encoder.Uint8(ipTagNone)
+	} else if ip4 := x.To4(); ip4 != nil {
+		encoder.Uint8(ipTagV4)
+		copy(encoder.reserve(net.IPv4len), ip4)
+	} else if len(x) == net.IPv6len {
+		encoder.Uint8(ipTagV6)
+		copy(encoder.reserve(net.IPv6len), x)
+	} else {
+		panic(fmt.Errorf("binary.Encoder.IP: invalid IP length %d", len(x)))
+	}
+}
+
+// IP decode a net.IP value from Decoder buffer.
+// It will panic if buffer is not enough or tag byte is invalid.
+func (decoder *Decoder) IP() net.IP {
+	switch tag := decoder.Uint8(); tag {
+	case ipTagNone:
+		return nil
+	case ipTagV4, ipTagV6:
+		ip := make(net.IP, tag)
+		copy(ip, decoder.reserve(int(tag)))
+		return ip
+	default:
+		panic(fmt.Errorf("binary.Decoder.IP: invalid IP tag %d", tag))
+	}
+}
+
+// Addr encode a netip.Addr value to Encoder buffer as tag byte and 4/16 address bytes.
+// Zone of IPv6 address is encoded as string after address bytes.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Addr(x netip.Addr) {
+	switch {
+	case !x.IsValid():
+		encoder.Uint8(ipTagNone)
+	case x.Is4():
+		encoder.Uint8(ipTagV4)
+		b := x.As4()
+		copy(encoder.reserve(len(b)), b[:])
+	case x.Zone() == "":
+		encoder.Uint8(ipTagV6)
+		b := x.As16()
+		copy(encoder.reserve(len(b)), b[:])
+	default:
+		encoder.Uint8(ipTagV6Zone)
+		b := x.As16()
+		copy(encoder.reserve(len(b)), b[:])
+		encoder.String(x.Zone())
+	}
+}
+
+// Addr decode a netip.Addr value from Decoder buffer.
+// It will panic if buffer is not enough or tag byte is invalid.
+func (decoder *Decoder) Addr() netip.Addr {
+	switch tag := decoder.Uint8(); tag {
+	case ipTagNone:
+		return netip.Addr{}
+	case ipTagV4:
+		var b [net.IPv4len]byte
+		copy(b[:], decoder.reserve(len(b)))
+		return netip.AddrFrom4(b)
+	case ipTagV6, ipTagV6Zone:
+		var b [net.IPv6len]byte
+		copy(b[:], decoder.reserve(len(b)))
+		addr := netip.AddrFrom16(b)
+		if tag == ipTagV6Zone {
+			addr = addr.WithZone(decoder.String())
+		}
+		return addr
+	default:
+		panic(fmt.Errorf("binary.Decoder.Addr: invalid IP tag %d", tag))
+	}
+}
+
+// AddrPort encode a netip.AddrPort value to Encoder buffer as address and uint16 port.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) AddrPort(x netip.AddrPort) {
+	encoder.Addr(x.Addr())
+	encoder.Uint16(x.Port(), false)
+}
+
+// AddrPort decode a netip.AddrPort value from Decoder buffer.
+// It will panic if buffer is not enough or tag byte is invalid.
+func (decoder *Decoder) AddrPort() netip.AddrPort {
+	addr := decoder.Addr()
+	return netip.AddrPortFrom(addr, decoder.Uint16(false))
+}
+
+// sizeofIP returns bytes number of net.IP x encoded by Encoder.IP, -1 if x is invalid.
+func sizeofIP(x net.IP) int {
+	switch {
+	case len(x) == 0:
+		return 1
+	case x.To4() != nil:
+		return 1 + net.IPv4len
+	case len(x) == net.IPv6len:
+		return 1 + net.IPv6len
+	}
+	return -1
+}
+
+// sizeofAddr returns bytes number of netip.Addr x encoded by Encoder.Addr.
+func sizeofAddr(x netip.Addr) int {
+	switch {
+	case !x.IsValid():
+		return 1
+	case x.Is4():
+		return 1 + net.IPv4len
+	case x.Zone() == "":
+		return 1 + net.IPv6len
+	}
+	return 1 + net.IPv6len + SizeofUvarint(uint64(len(x.Zone()))) + len(x.Zone())
+}
+
+// skipIP skip a net.IP or netip.Addr value and returns bytes skiped.
+func skipIP(decoder *Decoder) int {
+	switch tag := decoder.Uint8(); tag {
+	case ipTagNone:
+		return 1
+	case ipTagV4, ipTagV6:
+		decoder.Skip(int(tag))
+		return 1 + int(tag)
+	case ipTagV6Zone:
+		decoder.Skip(net.IPv6len)
+		return 1 + net.IPv6len + decoder.skipString(nil)
+	default:
+		panic(fmt.Errorf("binary.Decoder.Value: invalid IP tag %d", tag))
+	}
+}
+
+var netIPCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		return sizeofIP(net.IP(v.Bytes()))
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		if sizeofIP(net.IP(v.Bytes())) < 0 {
+			return fmt.Errorf("binary.Encoder.Value: invalid IP length %d", v.Len())
+		}
+		encoder.IP(net.IP(v.Bytes()))
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		v.SetBytes(decoder.IP())
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		return skipIP(decoder)
+	},
+}
+
+var netipAddrCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		return sizeofAddr(v.Interface().(netip.Addr))
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		encoder.Addr(v.Interface().(netip.Addr))
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		v.Set(reflect.ValueOf(decoder.Addr()))
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		return skipIP(decoder)
+	},
+}
+
+var netipAddrPortCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		return sizeofAddr(v.Interface().(netip.AddrPort).Addr()) + 2
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		encoder.AddrPort(v.Interface().(netip.AddrPort))
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		v.Set(reflect.ValueOf(decoder.AddrPort()))
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		n := skipIP(decoder)
+		decoder.Skip(2)
+		return n + 2
+	},
+}
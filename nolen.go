@@ -0,0 +1,57 @@
+// encode/decode slice/string fields without length prefix, for field tag
+// `binary:"nolen"`, of which length is implied by protocol context such as
+// "rest of message".
+// Decoding consumes the rest of the buffer, so the field should be the last
+// one encoded, or the buffer is bounded by framing such as messages or
+// fields of tagged structs.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// restBytes returns bytes number of the rest of buffer to decode nolen field.
+// It will panic if decoding from reader.
+func (decoder *Decoder) restBytes() int {
+	if decoder.reader != nil {
+		panic(fmt.Errorf("binary.Decoder.Value: nolen field is not supported when decoding from reader"))
+	}
+	return len(decoder.buff) - decoder.pos
+}
+
+// restLength returns number of elements of type elem of nolen slice field in
+// the rest of buffer. Elements of variable size are counted by skiping them.
+// It will panic if the number is ambiguous, as bools, deltas and group varints.
+func (decoder *Decoder) restLength(elem reflect.Type, field *fieldInfo) int {
+	rest := decoder.restBytes()
+	if isBoolElem(elem, field) || isDeltaElem(elem, field) || isGroupVarintElem(elem, field) {
+		panic(errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported nolen slice of %s", elem.String()))
+	}
+	if s := fixedElemSize(elem, field); s > 0 {
+		return decoder.checkLen(rest / s)
+	}
+	m := decoder.mark()
+	n := 0
+	for decoder.pos < len(decoder.buff) {
+		if decoder.skipByType(elem, field.elemField()) <= 0 { //elements of no bytes
+			panic(errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported nolen slice of %s", elem.String()))
+		}
+		n++
+	}
+	decoder.restore(m)
+	return decoder.checkLen(n)
+}
+
+// checkNoLen returns error if type t of nolen field is not slice/array/string.
+func checkNoLen(t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array:
+		return nil
+	}
+	return errorf(ErrUnsupportedType, "binary: unsupported nolen field of type %s", t.String())
+}
@@ -0,0 +1,56 @@
+// place fields at absolute offsets of their struct encoding for field tag
+// `binary:"offset=N"`, with zero padding before them.
+// Fixed-layout file headers and firmware images are encoded without manual
+// padding fields.
+
+package binary
+
+import (
+	"fmt"
+)
+
+// offsetOf returns offset of field in its struct encoding, or -1 if it is not specified.
+func (field *fieldInfo) offsetOf() int {
+	if field != nil {
+		return field.offset
+	}
+	return -1
+}
+
+// offsetError returns error of field which overlaps the previous fields.
+func offsetError(field *fieldInfo, pos int) error {
+	return fmt.Errorf("binary: field %s at offset %d overlaps previous fields ending at %d",
+		field.field.Name, field.offset, pos)
+}
+
+// padToOffset encode zero padding before field of struct beginning at start.
+// It will panic if the previous fields overlap the field.
+func (encoder *Encoder) padToOffset(start int, field *fieldInfo) {
+	offset := field.offsetOf()
+	if offset < 0 {
+		return
+	}
+	if pos := encoder.pos - start; pos > offset {
+		panic(offsetError(field, pos))
+	}
+	encoder.zeros(start + offset - encoder.pos)
+}
+
+// skipToOffset skip padding before field of struct beginning at start,
+// and returns bytes skiped.
+// It will panic if the previous fields overlap the field, or decoding from a reader.
+func (decoder *Decoder) skipToOffset(start int, field *fieldInfo) int {
+	offset := field.offsetOf()
+	if offset < 0 {
+		return 0
+	}
+	if decoder.reader != nil {
+		panic(fmt.Errorf("binary.Decoder: field offset is not supported when decoding from reader"))
+	}
+	if pos := decoder.pos - start; pos > offset {
+		panic(offsetError(field, pos))
+	}
+	n := start + offset - decoder.pos
+	decoder.reserve(n)
+	return n
+}
@@ -0,0 +1,107 @@
+// optional values without pointer allocation.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Option is an optional value of type T, which is encoded as a presence byte,
+// 1 followed by Value if Valid, or 0 if not.
+// It is an explicit and type-safe way to express optional fields without
+// allocation of pointers. Field tags of an Option field apply to its Value.
+type Option[T any] struct {
+	Value T
+	Valid bool //if Value is present
+}
+
+// Some returns a valid Option of value x.
+func Some[T any](x T) Option[T] {
+	return Option[T]{Value: x, Valid: true}
+}
+
+// None returns an Option without value.
+func None[T any]() Option[T] {
+	return Option[T]{}
+}
+
+// Get returns value of the Option and if it is present.
+func (o Option[T]) Get() (T, bool) {
+	return o.Value, o.Valid
+}
+
+// GetOr returns value of the Option, or def if it is not present.
+func (o Option[T]) GetOr(def T) T {
+	if o.Valid {
+		return o.Value
+	}
+	return def
+}
+
+// Set set value of the Option to x.
+func (o *Option[T]) Set(x T) {
+	o.Value, o.Valid = x, true
+}
+
+// Reset clear value of the Option.
+func (o *Option[T]) Reset() {
+	*o = Option[T]{}
+}
+
+func (Option[T]) binaryOption() {}
+
+// optional is implemented by all Option types.
+type optional interface {
+	binaryOption()
+}
+
+var tOptional = reflect.TypeOf((*optional)(nil)).Elem()
+
+// Options are encoded as a presence byte and value, of which bools are packed
+// in its bytes.
+// It is initialized by init since it refers to the reflect path.
+var optionCodec typeCodec
+
+func init() {
+	optionCodec = typeCodec{
+		size: func(v reflect.Value, field *fieldInfo) int {
+			if !v.Field(1).Bool() {
+				return 1
+			}
+			bits := bitsOfValue(v.Field(0), false, field, &ptrVisitor{})
+			if bits < 0 {
+				return -1
+			}
+			return 1 + (bits+7)/8
+		},
+		encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+			if !v.Field(1).Bool() {
+				encoder.Uint8(0)
+				return nil
+			}
+			encoder.Uint8(1)
+			boolPos, boolBit := encoder.boolPos, encoder.boolBit
+			encoder.resetBoolCoder()
+			err := encoder.value(v.Field(0), field)
+			encoder.boolPos, encoder.boolBit = boolPos, boolBit
+			return err
+		},
+		decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+			switch b := decoder.Uint8(); b {
+			case 0:
+				v.Set(reflect.Zero(v.Type()))
+				return nil
+			case 1:
+				boolPos, boolBit, boolValue := decoder.boolPos, decoder.boolBit, decoder.boolValue
+				decoder.resetBoolCoder()
+				err := decoder.value(v.Field(0), false, field)
+				decoder.boolPos, decoder.boolBit, decoder.boolValue = boolPos, boolBit, boolValue
+				v.Field(1).SetBool(true)
+				return err
+			default:
+				return fmt.Errorf("binary.Decoder.Value: invalid presence byte %d of %s", b, v.Type().String())
+			}
+		},
+	}
+}
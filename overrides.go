@@ -0,0 +1,70 @@
+// override codecs of types per Encoder/Decoder, so that a type is encoded
+// differently by protocols, such as time.Time as uint32 seconds in one and
+// int64 nanoseconds in another.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Codecs is a set of codec overrides of types, which is set to Encoder and
+// Decoder by SetCodecs. It must not be modified while in use.
+type Codecs struct {
+	reg map[reflect.Type]*typeCodec
+}
+
+// NewCodecs make an empty set of codec overrides.
+func NewCodecs() *Codecs {
+	return &Codecs{reg: make(map[reflect.Type]*typeCodec)}
+}
+
+// Override override codec of the type of t by functions as RegisterCodec.
+// The type must be a named struct type or a type has special codec, such as
+// time.Time and types registered by RegisterCodec.
+func (cs *Codecs) Override(t interface{}, enc func(encoder *Encoder, x interface{}) error,
+	dec func(decoder *Decoder, x interface{}) error, size func(x interface{}) int) error {
+	rt := reflect.TypeOf(t)
+	if rt != nil && rt.Kind() == reflect.Ptr && rt.Name() == "" {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.PkgPath() == "" || rt.Kind() != reflect.Struct && queryCodec(rt, nil) == nil {
+		return errorf(ErrUnsupportedType, "binary.Codecs.Override: unsupported type %T", t)
+	}
+	if enc == nil || dec == nil || size == nil {
+		return fmt.Errorf("binary.Codecs.Override: nil functions of %s", rt.String())
+	}
+	cs.reg[rt] = funcCodec(enc, dec, size)
+	return nil
+}
+
+// find returns overrided codec of type t, or nil if not.
+func (cs *Codecs) find(t reflect.Type) *typeCodec {
+	if cs == nil {
+		return nil
+	}
+	return cs.reg[t]
+}
+
+// Sizeof returns bytes number of data encoded by Encoder with the codec
+// overrides, or -1 if data is invalid.
+func (cs *Codecs) Sizeof(data interface{}) int {
+	vis := ptrVisitor{codecs: cs}
+	s := bitsOfValue(reflect.ValueOf(data), true, nil, &vis)
+	if s < 0 || vis.cycle != nil {
+		return -1
+	}
+	return (s + 7) / 8
+}
+
+// SetCodecs set codec overrides of types for Encoder, nil means not.
+// Use Codecs.Sizeof to get size of values encoded with it.
+func (encoder *Encoder) SetCodecs(cs *Codecs) {
+	encoder.codecs = cs
+}
+
+// SetCodecs set codec overrides of types for Decoder, nil means not.
+func (decoder *Decoder) SetCodecs(cs *Codecs) {
+	decoder.codecs = cs
+}
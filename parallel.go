@@ -0,0 +1,136 @@
+// encode large slices of fixed-size structs by goroutines, each of which
+// encode a part of elements into its own region of buffer.
+
+package binary
+
+import (
+	"reflect"
+	"sync"
+)
+
+// min elements of each goroutine to encode in parallel
+const parallelMinLen = 1024
+
+// SetParallel set number of goroutines to encode large slices/arrays of
+// registed structs, of which every element is encoded in the same size,
+// such as structs of fixed-size numbers without bools. Less than 2 means
+// encoding in the current goroutine.
+// Elements are encoded concurrently, so that their BeforeEncode hooks must be
+// safe for concurrent use.
+func (encoder *Encoder) SetParallel(goroutines int) {
+	encoder.parallel = goroutines
+}
+
+// parallelStructs encode elements of slice/array v of registed struct info by
+// goroutines of SetParallel, and reports false if v is not encoded in
+// parallel as elements are too few or not fixed-size.
+func (encoder *Encoder) parallelStructs(v reflect.Value, info *structInfo) (bool, error) {
+	l := v.Len()
+	goroutines := encoder.parallel
+	if n := l / parallelMinLen; goroutines > n {
+		goroutines = n
+	}
+	if goroutines < 2 || encoder.codecs != nil || encoder.tracer != nil {
+		return false, nil
+	}
+	size := encoder.fixedEncodedSize(v.Type().Elem(), nil)
+	if size <= 0 {
+		return false, nil
+	}
+
+	buff := encoder.reserve(size * l)
+	errs := make([]error, goroutines)
+	per := (l + goroutines - 1) / goroutines
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		from, to := g*per, (g+1)*per
+		if to > l {
+			to = l
+		}
+		wg.Add(1)
+		go func(g, from, to int) {
+			defer wg.Done()
+			defer func() {
+				if e := recover(); e != nil {
+					errs[g] = panicError(e, "binary.Encoder.Value")
+				}
+			}()
+			part := *encoder
+			part.buff, part.pos = buff[from*size:to*size], 0
+			part.visitor = ptrVisitor{}
+			part.growth = nil
+			part.resetBoolCoder()
+			for i := from; i < to; i++ {
+				if err := info.encode(&part, v.Index(i)); err != nil {
+					errs[g] = err
+					return
+				}
+			}
+			assert(part.pos == len(part.buff), v.Type().Elem().String())
+		}(g, from, to)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// fixedEncodedSize returns bytes of every value of type t of field encoded by
+// Encoder, or -1 if values of t are not in the same size, or they are not
+// independent of each other, such as bools sharing bytes.
+func (encoder *Encoder) fixedEncodedSize(t reflect.Type, field *fieldInfo) int {
+	if queryCodec(t, field) != nil || field.bitsOf(t) > 0 {
+		return -1
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Uint:
+		if field.isFixed() {
+			return 8
+		}
+	case reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !field.isPacked() {
+			return fixedTypeSize(t)
+		}
+	case reflect.Int8, reflect.Uint8, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return fixedTypeSize(t)
+	case reflect.Array:
+		et := t.Elem()
+		if isRuneElem(et, field) || isDeltaElem(et, field) || isGroupVarintElem(et, field) || isColumnarElem(et, field) {
+			return -1
+		}
+		s := encoder.fixedEncodedSize(et, field.elemField())
+		if s < 0 {
+			return -1
+		}
+		s *= t.Len()
+		if !encoder.fixedArrays {
+			s += field.sizeofLen(t.Len())
+		}
+		return s
+	case reflect.Struct:
+		info := queryStruct(t)
+		if info == nil || info.versionOf() > 0 || info.isTagged() {
+			return -1
+		}
+		sum := 0
+		for i, n := 0, t.NumField(); i < n; i++ {
+			finfo := info.field(i)
+			if !finfo.isValid(i, t) {
+				continue
+			}
+			s := -1
+			if finfo.offset < 0 {
+				s = encoder.fixedEncodedSize(t.Field(i).Type, finfo)
+			}
+			if s < 0 {
+				return -1
+			}
+			sum += s
+		}
+		return sum
+	}
+	return -1
+}
@@ -0,0 +1,124 @@
+// hand out encoded buffers as reference counted objects, which return to a
+// pool when released, so that they can be passed to network writes without
+// copying.
+
+package binary
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// BufferPool is a pool of PooledBuffers. It is safe for concurrent use.
+type BufferPool struct {
+	pool sync.Pool
+}
+
+// NewBufferPool create a BufferPool.
+func NewBufferPool() *BufferPool {
+	return &BufferPool{}
+}
+
+// _defaultBufferPool is used by Encoders without BufferPool and EncodePooled.
+var _defaultBufferPool = NewBufferPool()
+
+// Get returns a zeroed PooledBuffer of size bytes from pool, which is
+// referenced once.
+func (p *BufferPool) Get(size int) *PooledBuffer {
+	b, _ := p.pool.Get().(*PooledBuffer)
+	if b == nil {
+		b = &PooledBuffer{}
+	}
+	if cap(b.buff) < size {
+		b.buff = make([]byte, size)
+	} else {
+		b.buff = b.buff[:size]
+		for i := range b.buff {
+			b.buff[i] = 0
+		}
+	}
+	b.n = size
+	b.refs = 1
+	b.pool = p
+	return b
+}
+
+// PooledBuffer is a buffer of encoded bytes referenced by counting.
+// It returns to its pool when the last reference is released, after which its
+// bytes must not be used any more.
+type PooledBuffer struct {
+	buff []byte
+	n    int   //number of encoded bytes
+	refs int32 //number of references
+	pool *BufferPool
+}
+
+// Bytes returns the encoded bytes, which are valid until the buffer is released.
+func (b *PooledBuffer) Bytes() []byte {
+	return b.buff[:b.n]
+}
+
+// Len returns number of the encoded bytes.
+func (b *PooledBuffer) Len() int {
+	return b.n
+}
+
+// Retain add a reference to the buffer, for another holder of it, such as a
+// goroutine which writes it to network. Each Retain must be paired with a
+// Release.
+func (b *PooledBuffer) Retain() {
+	if atomic.AddInt32(&b.refs, 1) <= 1 {
+		panic(fmt.Errorf("binary.PooledBuffer.Retain: buffer is released"))
+	}
+}
+
+// Release drop a reference to the buffer, and returns it to pool when no
+// reference is left.
+func (b *PooledBuffer) Release() {
+	switch n := atomic.AddInt32(&b.refs, -1); {
+	case n == 0:
+		b.n = 0
+		b.pool.pool.Put(b)
+	case n < 0:
+		panic(fmt.Errorf("binary.PooledBuffer.Release: buffer is released"))
+	}
+}
+
+// SetBufferPool set the pool of buffers handed out by TakeBuffer,
+// nil means a default pool.
+func (encoder *Encoder) SetBufferPool(p *BufferPool) {
+	encoder.pool = p
+}
+
+// TakeBuffer hands out the encoded bytes of Encoder as a PooledBuffer without
+// copying, and continue encoding into a new buffer of the same size from the
+// pool. The caller owns the returned buffer, and must Release it after used.
+// The handed out buffer returns to the pool when released, even if it was not
+// got from the pool.
+func (encoder *Encoder) TakeBuffer() *PooledBuffer {
+	p := encoder.pool
+	if p == nil {
+		p = _defaultBufferPool
+	}
+	b := &PooledBuffer{buff: encoder.buff, n: encoder.pos, refs: 1, pool: p}
+	encoder.ResetBuffer(p.Get(len(encoder.buff)).buff)
+	return b
+}
+
+// EncodePooled encode data into a PooledBuffer got from a default pool.
+// The caller must Release the returned buffer after used.
+func EncodePooled(data interface{}) (*PooledBuffer, error) {
+	size := Sizeof(data)
+	if size < 0 {
+		return nil, errorf(ErrUnsupportedType, "binary.EncodePooled: invalid type %T", data)
+	}
+	b := _defaultBufferPool.Get(size)
+	encoder := NewEncoderBuffer(b.buff)
+	if err := encoder.Value(data); err != nil {
+		b.Release()
+		return nil, err
+	}
+	b.n = encoder.pos
+	return b, nil
+}
@@ -0,0 +1,423 @@
+// encode/decode registered structs in protobuf wire format, driven by field
+// numbers of field tag `binary:"pb=N"`, to interoperate with protobuf peers.
+
+package binary
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// protobuf wire types
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+// max depth of nested messages, as protobuf implementations
+const pbMaxDepth = 100
+
+var errPbTruncated = errors.New("binary.DecodeProtobuf: truncated buffer")
+
+// EncodeProtobuf encode data in protobuf wire format to buffer, which is reused
+// if it is large enough.
+//
+// Data must be struct or pointer to struct, which is registered by RegStruct.
+// Only fields with tag `binary:"pb=N"` are encoded as protobuf field N, and
+// zero values are omitted as proto3 scalars except for non-nil pointers.
+// Ints are encoded as int32/int64, uints as uint32/uint64, and tag options
+// `zigzag` and `fixed` select sint32/sint64 and fixed32/fixed64/sfixed32/sfixed64.
+// Slices of numbers are packed, other slices/arrays are repeated fields,
+// structs are messages, and maps are repeated entries with key 1 and value 2.
+func EncodeProtobuf(data interface{}, buffer []byte) ([]byte, error) {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if v.Kind() != reflect.Struct {
+		return nil, errorf(ErrUnsupportedType, "binary.EncodeProtobuf: unsupported type %s", reflect.TypeOf(data).String())
+	}
+	return appendPbMessage(buffer[:0], v, 0)
+}
+
+// DecodeProtobuf decode data from buffer in protobuf wire format, which is
+// encoded by EncodeProtobuf or protobuf peers. Unknown fields are skipped.
+func DecodeProtobuf(buffer []byte, data interface{}) error {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errorf(ErrUnsupportedType, "binary.DecodeProtobuf: unsupported type %s", reflect.TypeOf(data).String())
+	}
+	return decodePbMessage(buffer, v.Elem(), 0)
+}
+
+// pbFieldOf returns info of struct field i, or nil if it is not a protobuf field.
+func pbFieldOf(info *structInfo, i int, t reflect.Type) *fieldInfo {
+	if f := info.field(i); f != nil && f.pbNum > 0 && f.isValid(i, t) {
+		return f
+	}
+	return nil
+}
+
+// appendPbMessage append fields of struct v to b.
+func appendPbMessage(b []byte, v reflect.Value, depth int) ([]byte, error) {
+	t := v.Type()
+	if depth > pbMaxDepth {
+		return nil, errorf(ErrLimitExceeded, "binary.EncodeProtobuf: message %s exceeds max depth %d", t.String(), pbMaxDepth)
+	}
+	info := queryStruct(t)
+	if info == nil {
+		return nil, fmt.Errorf("binary.EncodeProtobuf: unregistered struct %s", t.String())
+	}
+	var err error
+	for i, n := 0, t.NumField(); i < n; i++ {
+		if f := pbFieldOf(info, i, t); f != nil {
+			if b, err = appendPbField(b, v.Field(i), f, false, depth); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b, nil
+}
+
+// appendPbField append field f with value v to b.
+// Zero value is omitted unless force.
+func appendPbField(b []byte, v reflect.Value, f *fieldInfo, force bool, depth int) ([]byte, error) {
+	var err error
+	switch k := v.Kind(); k {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return b, nil
+		}
+		return appendPbField(b, v.Elem(), f, true, depth)
+	case reflect.String:
+		if v.Len() > 0 || force {
+			b = appendPbBytes(b, f.pbNum, []byte(v.String()))
+		}
+	case reflect.Slice, reflect.Array:
+		et := v.Type().Elem()
+		if et.Kind() == reflect.Uint8 { //bytes
+			if v.Len() > 0 || force {
+				b = appendPbKey(b, f.pbNum, pbBytes)
+				b = AppendUvarint(b, uint64(v.Len()))
+				for i, n := 0, v.Len(); i < n; i++ {
+					b = append(b, byte(v.Index(i).Uint()))
+				}
+			}
+			return b, nil
+		}
+		if _, ok := pbWireOf(et.Kind(), f); ok { //packed
+			if v.Len() == 0 {
+				return b, nil
+			}
+			var p []byte
+			for i, n := 0, v.Len(); i < n; i++ {
+				p = appendPbScalar(p, v.Index(i), f)
+			}
+			return appendPbBytes(b, f.pbNum, p), nil
+		}
+		for i, n := 0, v.Len(); i < n; i++ {
+			if b, err = appendPbField(b, v.Index(i), f, true, depth); err != nil {
+				return nil, err
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sortMapKeys(keys)
+		entry := &fieldInfo{fixed: f.fixed, zigzag: f.zigzag}
+		for _, key := range keys {
+			var p []byte
+			entry.pbNum = 1
+			if p, err = appendPbField(p, key, entry, true, depth+1); err != nil {
+				return nil, err
+			}
+			entry.pbNum = 2
+			if p, err = appendPbField(p, v.MapIndex(key), entry, true, depth+1); err != nil {
+				return nil, err
+			}
+			b = appendPbBytes(b, f.pbNum, p)
+		}
+	case reflect.Struct:
+		p, err := appendPbMessage(nil, v, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) > 0 || force {
+			b = appendPbBytes(b, f.pbNum, p)
+		}
+	default:
+		wire, ok := pbWireOf(k, f)
+		if !ok {
+			return nil, errorf(ErrUnsupportedType, "binary.EncodeProtobuf: unsupported type %s of field %s", v.Type().String(), f.field.Name)
+		}
+		if force || !v.IsZero() {
+			b = appendPbKey(b, f.pbNum, wire)
+			b = appendPbScalar(b, v, f)
+		}
+	}
+	return b, nil
+}
+
+// pbWireOf returns wire type of number kind k, or false if k is not number.
+func pbWireOf(k reflect.Kind, f *fieldInfo) (int, bool) {
+	switch k {
+	case reflect.Bool:
+		return pbVarint, true
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		if f.isFixed() {
+			return pbFixed32, true
+		}
+		return pbVarint, true
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		if f.isFixed() {
+			return pbFixed64, true
+		}
+		return pbVarint, true
+	case reflect.Float32:
+		return pbFixed32, true
+	case reflect.Float64:
+		return pbFixed64, true
+	}
+	return 0, false
+}
+
+// appendPbScalar append number v without key to b.
+func appendPbScalar(b []byte, v reflect.Value, f *fieldInfo) []byte {
+	var x uint64
+	switch k := v.Kind(); k {
+	case reflect.Bool:
+		if v.Bool() {
+			x = 1
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x = uint64(v.Int())
+		if f.zigzag && !f.isFixed() {
+			x = ToUvarint(v.Int())
+		}
+	case reflect.Float32:
+		x = uint64(math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		x = math.Float64bits(v.Float())
+	default:
+		x = v.Uint()
+	}
+	wire, _ := pbWireOf(v.Kind(), f)
+	switch wire {
+	case pbFixed32:
+		return append(b, byte(x), byte(x>>8), byte(x>>16), byte(x>>24))
+	case pbFixed64:
+		return append(b, byte(x), byte(x>>8), byte(x>>16), byte(x>>24),
+			byte(x>>32), byte(x>>40), byte(x>>48), byte(x>>56))
+	}
+	return AppendUvarint(b, x)
+}
+
+func appendPbKey(b []byte, num, wire int) []byte {
+	return AppendUvarint(b, uint64(num)<<3|uint64(wire))
+}
+
+func appendPbBytes(b []byte, num int, p []byte) []byte {
+	b = appendPbKey(b, num, pbBytes)
+	b = AppendUvarint(b, uint64(len(p)))
+	return append(b, p...)
+}
+
+// pbReader read protobuf wire format from buffer.
+type pbReader struct {
+	buff []byte
+	pos  int
+}
+
+func (r *pbReader) uvarint() uint64 {
+	x, n := Uvarint(r.buff[r.pos:])
+	if n < 0 {
+		panic(errOverflow)
+	}
+	if n == 0 {
+		panic(errPbTruncated)
+	}
+	r.pos += n
+	return x
+}
+
+func (r *pbReader) bytes(n int) []byte {
+	if n < 0 || n > len(r.buff)-r.pos {
+		panic(errPbTruncated)
+	}
+	b := r.buff[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// value read value of wire type, which is bytes for pbBytes and number for others.
+func (r *pbReader) value(wire int) (uint64, []byte) {
+	switch wire {
+	case pbVarint:
+		return r.uvarint(), nil
+	case pbFixed32:
+		b := r.bytes(4)
+		return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24, nil
+	case pbFixed64:
+		b := r.bytes(8)
+		return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+			uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56, nil
+	case pbBytes:
+		return 0, r.bytes(int(r.uvarint()))
+	}
+	panic(fmt.Errorf("binary.DecodeProtobuf: unsupported wire type %d", wire))
+}
+
+// decodePbMessage decode fields of struct v from b.
+func decodePbMessage(b []byte, v reflect.Value, depth int) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.DecodeProtobuf")
+		}
+	}()
+	decodePbFields(b, v, depth)
+	return nil
+}
+
+func decodePbFields(b []byte, v reflect.Value, depth int) {
+	t := v.Type()
+	if depth > pbMaxDepth {
+		panic(errorf(ErrLimitExceeded, "binary.DecodeProtobuf: message %s exceeds max depth %d", t.String(), pbMaxDepth))
+	}
+	info := queryStruct(t)
+	if info == nil {
+		panic(fmt.Errorf("binary.DecodeProtobuf: unregistered struct %s", t.String()))
+	}
+	var counts map[int]int //decoded elements of array fields
+	r := &pbReader{buff: b}
+	for r.pos < len(r.buff) {
+		key := r.uvarint()
+		num, wire := int(key>>3), int(key&7)
+		x, p := r.value(wire)
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if f := pbFieldOf(info, i, t); f != nil && f.pbNum == num {
+				fv := v.Field(i)
+				if fv.Kind() == reflect.Array && fv.Type().Elem().Kind() != reflect.Uint8 {
+					if counts == nil {
+						counts = make(map[int]int)
+					}
+					counts[i] = decodePbArray(fv, counts[i], wire, x, p, f, depth)
+				} else {
+					decodePbField(fv, wire, x, p, f, depth)
+				}
+				break
+			}
+		}
+	}
+}
+
+// decodePbField decode value x or p of wire type to field f with value v.
+// Elements of repeated fields are appended.
+func decodePbField(v reflect.Value, wire int, x uint64, p []byte, f *fieldInfo, depth int) {
+	switch k := v.Kind(); k {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		decodePbField(v.Elem(), wire, x, p, f, depth)
+	case reflect.String:
+		pbCheckWire(wire, pbBytes, f)
+		v.SetString(string(p))
+	case reflect.Slice:
+		et := v.Type().Elem()
+		if et.Kind() == reflect.Uint8 {
+			pbCheckWire(wire, pbBytes, f)
+			v.SetBytes(append([]byte{}, p...))
+			return
+		}
+		if ew, ok := pbWireOf(et.Kind(), f); ok && wire == pbBytes && ew != pbBytes { //packed
+			r := &pbReader{buff: p}
+			for r.pos < len(r.buff) {
+				e := reflect.New(et).Elem()
+				ex, _ := r.value(ew)
+				decodePbScalar(e, ew, ex, f)
+				v.Set(reflect.Append(v, e))
+			}
+			return
+		}
+		e := reflect.New(et).Elem()
+		decodePbField(e, wire, x, p, f, depth)
+		v.Set(reflect.Append(v, e))
+	case reflect.Array: //bytes
+		pbCheckWire(wire, pbBytes, f)
+		reflect.Copy(v, reflect.ValueOf(p))
+	case reflect.Map:
+		pbCheckWire(wire, pbBytes, f)
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		value := reflect.New(v.Type().Elem()).Elem()
+		entry := &fieldInfo{fixed: f.fixed, zigzag: f.zigzag}
+		r := &pbReader{buff: p}
+		for r.pos < len(r.buff) {
+			ek := r.uvarint()
+			ex, ep := r.value(int(ek & 7))
+			entry.pbNum = int(ek >> 3)
+			switch entry.pbNum {
+			case 1:
+				decodePbField(key, int(ek&7), ex, ep, entry, depth+1)
+			case 2:
+				decodePbField(value, int(ek&7), ex, ep, entry, depth+1)
+			}
+		}
+		v.SetMapIndex(key, value)
+	case reflect.Struct:
+		pbCheckWire(wire, pbBytes, f)
+		decodePbFields(p, v, depth+1)
+	default:
+		ew, ok := pbWireOf(k, f)
+		if !ok {
+			panic(errorf(ErrUnsupportedType, "binary.DecodeProtobuf: unsupported type %s of field %s", v.Type().String(), f.field.Name))
+		}
+		pbCheckWire(wire, ew, f)
+		decodePbScalar(v, wire, x, f)
+	}
+}
+
+// decodePbArray decode elements of array field f from index i, and returns
+// the next index. Elements out of range are dropped.
+func decodePbArray(v reflect.Value, i int, wire int, x uint64, p []byte, f *fieldInfo, depth int) int {
+	s := reflect.New(reflect.SliceOf(v.Type().Elem())).Elem()
+	decodePbField(s, wire, x, p, f, depth)
+	for j := 0; j < s.Len(); j++ {
+		if i < v.Len() {
+			v.Index(i).Set(s.Index(j))
+		}
+		i++
+	}
+	return i
+}
+
+// decodePbScalar set number v by value x of wire type.
+func decodePbScalar(v reflect.Value, wire int, x uint64, f *fieldInfo) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(x != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch {
+		case wire == pbFixed32:
+			v.SetInt(int64(int32(x)))
+		case wire == pbVarint && f.zigzag:
+			v.SetInt(ToVarint(x))
+		default:
+			v.SetInt(int64(x))
+		}
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(uint32(x))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(x))
+	default:
+		v.SetUint(x)
+	}
+}
+
+func pbCheckWire(wire, need int, f *fieldInfo) {
+	if wire != need {
+		panic(fmt.Errorf("binary.DecodeProtobuf: wire type %d of field %s, need %d", wire, f.field.Name, need))
+	}
+}
@@ -0,0 +1,43 @@
+// decode values from io.ReaderAt at offsets, so that different records of
+// the same file are decoded concurrently without shared position state.
+
+package binary
+
+import (
+	"io"
+	"math"
+)
+
+// NewDecoderAt make a new Decoder to decode values from r starting at offset.
+// Each Decoder reads r by ReadAt with its own position, so Decoders of the
+// same r such as *os.File are safe for concurrent use by goroutines.
+// As decoding from a reader, values are read in the least bytes and peeking
+// is not supported.
+func NewDecoderAt(r io.ReaderAt, offset int64) *Decoder {
+	decoder := &Decoder{}
+	decoder.Init(nil, DefaultEndian)
+	decoder.reader = io.NewSectionReader(r, offset, math.MaxInt64-offset)
+	return decoder
+}
+
+// Offset returns offset in io.ReaderAt of the next value of Decoder made by
+// NewDecoderAt, or -1 if it is not.
+func (decoder *Decoder) Offset() int64 {
+	sr, ok := decoder.reader.(*io.SectionReader)
+	if !ok {
+		return -1
+	}
+	_, base, _ := sr.Outer()
+	pos, _ := sr.Seek(0, io.SeekCurrent)
+	return base + pos
+}
+
+// DecodeAt decode a value from r at offset to data, and returns offset of
+// the next value. It is safe for concurrent use if r is.
+func DecodeAt(r io.ReaderAt, offset int64, data interface{}) (int64, error) {
+	decoder := NewDecoderAt(r, offset)
+	if err := decoder.Value(data); err != nil {
+		return offset, err
+	}
+	return decoder.Offset(), nil
+}
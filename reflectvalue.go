@@ -0,0 +1,119 @@
+// encode/decode reflect.Value directly, for frameworks which already hold
+// reflect.Values, such as ORMs and RPC layers.
+
+package binary
+
+import (
+	"reflect"
+)
+
+var (
+	tBinarySizer   = reflect.TypeOf((*BinarySizer)(nil)).Elem()
+	tBinaryDecoder = reflect.TypeOf((*BinaryDecoder)(nil)).Elem()
+)
+
+// isSerializer reports whether t implements any method of BinarySerializer,
+// which is dealed by Encoder.Value and Decoder.Value.
+func isSerializer(t reflect.Type) bool {
+	return t.Implements(tBinarySizer) || t.Implements(tBinaryEncoder) || t.Implements(tBinaryDecoder)
+}
+
+// SizeofValue is like Sizeof but get size of reflect.Value v.
+// It returns -1 if v is invalid or unsupported.
+func SizeofValue(v reflect.Value) int {
+	if !v.IsValid() {
+		return -1
+	}
+	if isSerializer(v.Type()) && v.CanInterface() {
+		return Sizeof(v.Interface())
+	}
+	var vis ptrVisitor
+	s := bitsOfValue(v, true, nil, &vis)
+	if s < 0 || vis.cycle != nil {
+		return -1
+	}
+	return (s + 7) / 8
+}
+
+// EncodeValue is like Encode but encode reflect.Value v, without dispatching
+// type by interface.
+// nil buffer is aviable, it will create new buffer if necessary.
+func EncodeValue(v reflect.Value, buffer []byte) ([]byte, error) {
+	size := SizeofValue(v)
+	if size < 0 {
+		return nil, errorf(ErrUnsupportedType, "binary.EncodeValue: invalid value %s", v.String())
+	}
+	if len(buffer) < size {
+		buffer = make([]byte, size)
+	}
+	encoder := NewEncoderBuffer(buffer)
+	err := encoder.EncodeValue(v)
+	return encoder.Buffer(), err
+}
+
+// DecodeValue is like Decode but decode to reflect.Value v, which must be a
+// non-nil pointer or an addressable value.
+func DecodeValue(buffer []byte, v reflect.Value) error {
+	var decoder Decoder
+	decoder.Init(buffer, DefaultEndian)
+	return decoder.DecodeValue(v)
+}
+
+// EncodeValue is like Value but encode reflect.Value v, without dispatching
+// type by interface.
+// Values implement BinarySerializer and formats other than the default one
+// are encoded by Value.
+func (encoder *Encoder) EncodeValue(v reflect.Value) (err error) {
+	if !v.IsValid() {
+		return errorf(ErrUnsupportedType, "binary.Encoder.EncodeValue: invalid value")
+	}
+	if encoder.msgpack || encoder.cbor || encoder.std || encoder.useTable && encoder.strs == nil ||
+		isSerializer(v.Type()) {
+		if !v.CanInterface() {
+			return errorf(ErrUnsupportedType, "binary.Encoder.EncodeValue: unexported value of %s", v.Type().String())
+		}
+		return encoder.Value(v.Interface())
+	}
+	endian := encoder.endian
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.Encoder.EncodeValue")
+			encoder.endian = endian //restore endian changed by field tag
+		}
+	}()
+
+	encoder.resetBoolCoder()       //reset bool writer
+	encoder.visitor = ptrVisitor{} //reset cycle detector
+	return encoder.value(reflect.Indirect(v), nil)
+}
+
+// DecodeValue is like Value but decode to reflect.Value v, without dispatching
+// type by interface. v must be a non-nil pointer or an addressable value.
+// Values implement BinarySerializer and formats other than the default one
+// are decoded by Value.
+func (decoder *Decoder) DecodeValue(v reflect.Value) (err error) {
+	if v.IsValid() && v.Kind() != reflect.Ptr && v.CanAddr() {
+		v = v.Addr()
+	}
+	if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() {
+		return errorf(ErrUnsupportedType, "binary.Decoder.DecodeValue: non-pointer or unaddressable value %s", v.String())
+	}
+	if decoder.msgpack || decoder.cbor || decoder.std || isSerializer(v.Type()) {
+		if !v.CanInterface() {
+			return errorf(ErrUnsupportedType, "binary.Decoder.DecodeValue: unexported value of %s", v.Type().String())
+		}
+		return decoder.Value(v.Interface())
+	}
+	endian := decoder.endian
+	defer func() {
+		err = decoder.endValue(recover(), endian, err)
+	}()
+
+	decoder.resetBoolCoder() //reset bool reader
+	decoder.depth = 0
+	decoder.allocated = 0
+	defer decoder.endTable()
+	decoder.beginTable() //decode string table first
+	decoder.beginPath(v.Type())
+	return decoder.value(v, true, nil)
+}
@@ -0,0 +1,58 @@
+// encode/decode int32 slices/arrays as UTF-8 text, for field tag
+// `binary:"runes"`.
+// []rune is the same type as []int32, so text semantics of runes is declared
+// by field tag. The length prefix is bytes number of the text, as strings.
+// Invalid runes are encoded as utf8.RuneError(U+FFFD).
+
+package binary
+
+import (
+	"reflect"
+	"unicode/utf8"
+)
+
+// isRuneElem reports whether slice/array elements of type t are encoded as
+// UTF-8 text.
+func isRuneElem(t reflect.Type, field *fieldInfo) bool {
+	return field.isRunes() && t.Kind() == reflect.Int32 && queryCodec(t, field) == nil
+}
+
+// sizeofRunes returns bytes of UTF-8 text of int32 slice/array v.
+func sizeofRunes(v reflect.Value) int {
+	s := 0
+	for i, l := 0, v.Len(); i < l; i++ {
+		n := utf8.RuneLen(rune(v.Index(i).Int()))
+		if n < 0 {
+			n = utf8.RuneLen(utf8.RuneError)
+		}
+		s += n
+	}
+	return s
+}
+
+// runes encode elements of int32 slice/array v as UTF-8 text with length prefix.
+func (encoder *Encoder) runes(v reflect.Value, field *fieldInfo) {
+	size := sizeofRunes(v)
+	encoder.length(size, field)
+	b := encoder.reserve(size)
+	for i, l, n := 0, v.Len(), 0; i < l; i++ {
+		n += utf8.EncodeRune(b[n:], rune(v.Index(i).Int()))
+	}
+}
+
+// runes decode UTF-8 text with length prefix to int32 slice/array v,
+// runes out of array v are skiped.
+func (decoder *Decoder) runes(v reflect.Value, field *fieldInfo) {
+	size, _ := decoder.length(field)
+	b := decoder.reserve(size)
+	cnt := utf8.RuneCount(b)
+	if v.Kind() == reflect.Slice && (cnt > 0 || field.isNilable()) { //make a new slice
+		decoder.alloc(cnt, 4)
+		decoder.makeSlice(v, cnt)
+	}
+	for i, l := 0, v.Len(); i < l && len(b) > 0; i++ {
+		r, n := utf8.DecodeRune(b)
+		v.Index(i).SetInt(int64(r))
+		b = b[n:]
+	}
+}
@@ -0,0 +1,110 @@
+// decode untrusted data with a decoder which is guaranteed not to panic.
+
+package binary
+
+import (
+	"fmt"
+)
+
+// SafeMaxDepth is default max nesting depth of values decoded by SafeDecoder.
+const SafeMaxDepth = 100
+
+// SafeAllocRatio is default max bytes SafeDecoder allocates for each byte of
+// data. A decoded pointer or slice/map/string header takes 1 bit of data at
+// least, so that valid data never exceeds it.
+const SafeAllocRatio = 64
+
+// SafeDecoder is a Decoder for untrusted data, which is guaranteed not to
+// panic on any input bytes:
+//   - malformed or truncated data is reported as error by Value, such as
+//     ErrTruncated, ErrOverflow or ErrLimitExceeded;
+//   - lengths of strings/slices/maps are bounded by the bytes left in buffer;
+//   - bytes of strings/slices/maps and pointers to allocate are bounded by
+//     SafeAllocRatio times size of the data by default, which are checked
+//     before allocation;
+//   - values are nested not deeper than SafeMaxDepth by default.
+//
+// Slices of zero-size elements, such as []struct{}, longer than 8 times the
+// bytes left are reported as ErrTruncated. Structs of large ignored fields
+// may require more allocation than the default, see SetMaxAlloc.
+// Panics of user codecs and BinaryDecoders are reported as error too.
+type SafeDecoder struct {
+	decoder  Decoder
+	maxAlloc int //max bytes to allocate, 0 means SafeAllocRatio times size of the data
+}
+
+// NewSafeDecoder make a new SafeDecoder object with buffer.
+func NewSafeDecoder(buffer []byte) *SafeDecoder {
+	return NewSafeDecoderEndian(buffer, DefaultEndian)
+}
+
+// NewSafeDecoderEndian make a new SafeDecoder object with buffer and endian.
+func NewSafeDecoderEndian(buffer []byte, endian Endian) *SafeDecoder {
+	p := &SafeDecoder{}
+	p.decoder.Init(buffer, endian)
+	p.decoder.maxDepth = SafeMaxDepth
+	p.decoder.safe = true
+	return p
+}
+
+// SafeDecode decode untrusted buffer to x by a SafeDecoder, as Decode.
+func SafeDecode(buffer []byte, x interface{}) error {
+	return NewSafeDecoder(buffer).Value(x)
+}
+
+// ResetBuffer reset SafeDecoder to decode data. Options are kept.
+func (decoder *SafeDecoder) ResetBuffer(data []byte) {
+	decoder.decoder.ResetBuffer(data)
+}
+
+// Len returns bytes number decoded.
+func (decoder *SafeDecoder) Len() int {
+	return decoder.decoder.Len()
+}
+
+// SetMaxDepth set max nesting depth of values to decode, not greater than 0
+// means SafeMaxDepth.
+func (decoder *SafeDecoder) SetMaxDepth(depth int) {
+	if depth <= 0 {
+		depth = SafeMaxDepth
+	}
+	decoder.decoder.SetMaxDepth(depth)
+}
+
+// SetMaxLen set max length of string/slice/map to decode, 0 means no limit
+// other than the bytes left.
+func (decoder *SafeDecoder) SetMaxLen(l int) {
+	decoder.decoder.SetMaxLen(l)
+}
+
+// SetMaxAlloc set max bytes of strings/slices/maps and pointers to allocate
+// for decoding a value, not greater than 0 means SafeAllocRatio times size of
+// the data.
+func (decoder *SafeDecoder) SetMaxAlloc(size int) {
+	decoder.maxAlloc = size
+}
+
+// SetStrict set if Value returns ErrTrailingBytes when bytes remain in buffer
+// after the value is fully decoded.
+func (decoder *SafeDecoder) SetStrict(strict bool) {
+	decoder.decoder.SetStrict(strict)
+}
+
+// Value decode buffer to x, as Decoder.Value.
+// It never panics, and returns non-nil error if the data is malformed.
+func (decoder *SafeDecoder) Value(x interface{}) (err error) {
+	endian := decoder.decoder.endian
+	defer func() {
+		if info := recover(); info != nil { //not an error of decoding
+			decoder.decoder.endian = endian
+			err = fmt.Errorf("binary.SafeDecoder.Value: malformed data: %v", info)
+		}
+	}()
+	if decoder.decoder.maxAlloc = decoder.maxAlloc; decoder.maxAlloc <= 0 {
+		decoder.decoder.maxAlloc = SafeAllocRatio * (len(decoder.decoder.buff) - decoder.decoder.pos)
+		if decoder.decoder.maxAlloc <= 0 { //nothing to allocate, 0 means no limit of Decoder
+			decoder.decoder.maxAlloc = 1
+		}
+	}
+	return decoder.decoder.Value(x)
+}
@@ -0,0 +1,355 @@
+// export textual schema of registered structs, for implementations in other
+// languages and auditors to implement or verify the encoding format.
+
+package binary
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteSchema writes schema of all registered structs to w, sorted by names.
+// Each struct lists its fields in encoding order with their types and field
+// tags of binary, and fields not encoded are marked as ignored.
+// Named types other than structs and special types such as time.Time are
+// written as their underlying types, as:
+//
+//	struct pkg.Name {
+//		Field1 uint32 `big`
+//		Field2 []pkg.Item
+//		field3 int // ignored
+//	}
+func WriteSchema(w io.Writer) error {
+	names := make([]string, 0, len(_structInfoMgr.reg))
+	for name := range _structInfoMgr.reg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for i, name := range names {
+		if i > 0 {
+			bw.WriteByte('\n')
+		}
+		bw.WriteString("struct " + name + " {\n")
+		info := _structInfoMgr.reg[name]
+		for j := range info.fields {
+			f := info.fields[info.index(j)]
+			bw.WriteString("\t" + f.field.Name + " " + schemaType(f.field.Type))
+			if tag := f.field.Tag.Get("binary"); tag != "" {
+				bw.WriteString(" `" + tag + "`")
+			}
+			if f.ignore {
+				bw.WriteString(" // ignored")
+			}
+			bw.WriteByte('\n')
+		}
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
+
+// schemaType returns name of type t in schema.
+func schemaType(t reflect.Type) string {
+	if t.Name() != "" && (t.Kind() == reflect.Struct || t.PkgPath() == "" || queryCodec(t, nil) != nil) {
+		return t.String()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + schemaType(t.Elem())
+	case reflect.Slice:
+		return "[]" + schemaType(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), schemaType(t.Elem()))
+	case reflect.Map:
+		return "map[" + schemaType(t.Key()) + "]" + schemaType(t.Elem())
+	case reflect.Struct, reflect.Interface:
+		return t.String()
+	}
+	return t.Kind().String()
+}
+
+// Schema is schema of structs written by WriteSchema, to decode buffers to
+// generic values without corresponding Go types.
+type Schema struct {
+	structs map[string][]schemaField
+	types   map[string]reflect.Type //struct types built from schema
+}
+
+type schemaField struct {
+	name   string
+	typ    string
+	tag    string
+	ignore bool
+}
+
+// schemaBasicTypes are types of basic names in schema.
+var schemaBasicTypes = func() map[string]reflect.Type {
+	m := make(map[string]reflect.Type)
+	for _, v := range []interface{}{false, int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0), "", struct{}{}} {
+		m[reflect.TypeOf(v).String()] = reflect.TypeOf(v)
+	}
+	return m
+}()
+
+// schemaBasicType returns type of name in schema besides structs of schema.
+func schemaBasicType(name string) (reflect.Type, bool) {
+	if t, ok := schemaBasicTypes[name]; ok {
+		return t, true
+	}
+	for t := range _builtinCodecs { //special types such as time.Time
+		if t.String() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// ParseSchema parse schema written by WriteSchema.
+func ParseSchema(r io.Reader) (*Schema, error) {
+	s := &Schema{structs: make(map[string][]schemaField), types: make(map[string]reflect.Type)}
+	scanner := bufio.NewScanner(r)
+	name, line := "", 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+		case name == "" && strings.HasPrefix(text, "struct ") && strings.HasSuffix(text, " {"):
+			name = strings.TrimSpace(text[len("struct ") : len(text)-2])
+			if _, ok := s.structs[name]; ok || name == "" {
+				return nil, fmt.Errorf("binary.ParseSchema: line %d: duplicate struct %s", line, name)
+			}
+			s.structs[name] = []schemaField{}
+		case name != "" && text == "}":
+			name = ""
+		case name != "":
+			f, err := parseSchemaField(text)
+			if err != nil {
+				return nil, fmt.Errorf("binary.ParseSchema: line %d: %s", line, err.Error())
+			}
+			s.structs[name] = append(s.structs[name], f)
+		default:
+			return nil, fmt.Errorf("binary.ParseSchema: line %d: unexpected %q", line, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if name != "" {
+		return nil, fmt.Errorf("binary.ParseSchema: struct %s is not closed", name)
+	}
+	return s, nil
+}
+
+// parseSchemaField parse field line as "Name Type `tag` // ignored".
+func parseSchemaField(text string) (schemaField, error) {
+	var f schemaField
+	if i := strings.Index(text, "//"); i >= 0 {
+		f.ignore = strings.TrimSpace(text[i+2:]) == "ignored"
+		text = strings.TrimSpace(text[:i])
+	}
+	if i := strings.IndexByte(text, '`'); i >= 0 {
+		j := strings.LastIndexByte(text, '`')
+		if j <= i {
+			return f, fmt.Errorf("invalid tag of %q", text)
+		}
+		f.tag = text[i+1 : j]
+		text = strings.TrimSpace(text[:i])
+	}
+	i := strings.IndexByte(text, ' ')
+	if i <= 0 {
+		return f, fmt.Errorf("invalid field %q", text)
+	}
+	f.name, f.typ = text[:i], strings.TrimSpace(text[i+1:])
+	return f, nil
+}
+
+// Type returns Go type built from struct name of schema, of which fields have
+// the same encoding. Ignored fields are renamed, and types of recursive
+// structs are not supported.
+func (s *Schema) Type(name string) (reflect.Type, error) {
+	return s.structType(name, make(map[string]bool))
+}
+
+func (s *Schema) structType(name string, building map[string]bool) (reflect.Type, error) {
+	if t, ok := s.types[name]; ok {
+		return t, nil
+	}
+	fields, ok := s.structs[name]
+	if !ok {
+		return nil, fmt.Errorf("binary.Schema: undefined type %s", name)
+	}
+	if building[name] {
+		return nil, errorf(ErrUnsupportedType, "binary.Schema: unsupported recursive struct %s", name)
+	}
+	building[name] = true
+	defer delete(building, name)
+
+	sfs := make([]reflect.StructField, len(fields))
+	for i, f := range fields {
+		t, err := s.parseType(f.typ, building)
+		if err != nil {
+			return nil, err
+		}
+		sfs[i] = reflect.StructField{Name: f.name, Type: t, Tag: reflect.StructTag(`binary:` + strconv.Quote(f.tag))}
+		if f.ignore { //keep ignored fields as padding of C layout, and their versions
+			sfs[i].Name = fmt.Sprintf("Ignored%d", i)
+			sfs[i].Tag = reflect.StructTag(`binary:` + strconv.Quote(strings.TrimSuffix("ignore,"+f.tag, ",")))
+		} else if !isExported(f.name) { //encoded unexported field of struct declared by `binary:"unexported"`
+			sfs[i].Name = fmt.Sprintf("Unexported%d", i)
+		}
+	}
+	t := reflect.StructOf(sfs)
+	RegStruct(reflect.Zero(reflect.PtrTo(t)).Interface()) //enable field tags, duplicate struct is ok
+	s.types[name] = t
+	return t, nil
+}
+
+// parseType returns Go type of type name in schema.
+func (s *Schema) parseType(name string, building map[string]bool) (reflect.Type, error) {
+	switch {
+	case strings.HasPrefix(name, "*"):
+		t, err := s.parseType(name[1:], building)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.PtrTo(t), nil
+	case strings.HasPrefix(name, "[]"):
+		t, err := s.parseType(name[2:], building)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.SliceOf(t), nil
+	case strings.HasPrefix(name, "["):
+		i := strings.IndexByte(name, ']')
+		if i < 0 {
+			return nil, fmt.Errorf("binary.Schema: invalid type %s", name)
+		}
+		n, err := strconv.Atoi(name[1:i])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("binary.Schema: invalid type %s", name)
+		}
+		t, err := s.parseType(name[i+1:], building)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ArrayOf(n, t), nil
+	case strings.HasPrefix(name, "map["):
+		depth, i := 0, len("map[")
+		for ; i < len(name) && (name[i] != ']' || depth > 0); i++ {
+			switch name[i] {
+			case '[':
+				depth++
+			case ']':
+				depth--
+			}
+		}
+		if i >= len(name) {
+			return nil, fmt.Errorf("binary.Schema: invalid type %s", name)
+		}
+		kt, err := s.parseType(name[len("map["):i], building)
+		if err != nil {
+			return nil, err
+		}
+		vt, err := s.parseType(name[i+1:], building)
+		if err != nil {
+			return nil, err
+		}
+		if !kt.Comparable() {
+			return nil, fmt.Errorf("binary.Schema: invalid map key of type %s", name)
+		}
+		return reflect.MapOf(kt, vt), nil
+	}
+	if _, ok := s.structs[name]; ok {
+		return s.structType(name, building)
+	}
+	if t, ok := schemaBasicType(name); ok {
+		return t, nil
+	}
+	return nil, errorf(ErrUnsupportedType, "binary.Schema: unsupported type %s", name)
+}
+
+// Decode decode buffer as struct name of schema, and returns it as generic value.
+// Structs are decoded as map[string]interface{} of fields, slices and arrays
+// as []interface{} except bytes, maps as map[string]interface{} if keys are
+// strings or map[interface{}]interface{}, and nil pointers as nil.
+// Keys of struct/array types keep their types of schema, as generic values
+// of them cannot be map keys.
+// Numbers and special types such as time.Time keep their Go types.
+func (s *Schema) Decode(buffer []byte, name string) (map[string]interface{}, error) {
+	return s.Value(NewDecoder(buffer), name)
+}
+
+// Value decode next value of decoder as struct name of schema, as Decode.
+func (s *Schema) Value(decoder *Decoder, name string) (map[string]interface{}, error) {
+	t, err := s.Type(name)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.New(t)
+	if err := decoder.Value(v.Interface()); err != nil {
+		return nil, err
+	}
+	return schemaGeneric(v.Elem()).(map[string]interface{}), nil
+}
+
+// schemaGeneric returns generic value of v.
+func schemaGeneric(v reflect.Value) interface{} {
+	t := v.Type()
+	if queryCodec(t, nil) != nil { //special types
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		info := queryStruct(t)
+		m := make(map[string]interface{}, t.NumField())
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if info.fieldValid(i, t) {
+				m[t.Field(i).Name] = schemaGeneric(v.Field(i))
+			}
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 { //bytes
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return b
+		}
+		a := make([]interface{}, v.Len())
+		for i := range a {
+			a[i] = schemaGeneric(v.Index(i))
+		}
+		return a
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			m := make(map[string]interface{}, v.Len())
+			for _, key := range v.MapKeys() {
+				m[key.String()] = schemaGeneric(v.MapIndex(key))
+			}
+			return m
+		}
+		m := make(map[interface{}]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			k := schemaGeneric(key)
+			if kt := reflect.TypeOf(k); kt != nil && !kt.Comparable() { //generic struct/array keys cannot be map keys
+				k = key.Interface()
+			}
+			m[k] = schemaGeneric(v.MapIndex(key))
+		}
+		return m
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return schemaGeneric(v.Elem())
+	}
+	return v.Interface()
+}
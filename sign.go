@@ -0,0 +1,112 @@
+// detached signatures over the canonical encoding of values, so that signed
+// messages don't require a separate canonical-bytes implementation.
+
+package binary
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// ErrSignature is returned by Verify if the signature is invalid.
+var ErrSignature = errors.New("binary.Verify: invalid signature")
+
+// canonicalEncoder returns Encoder of canonical encoding of data, which is
+// deterministic encoding with sorted keys of maps.
+func canonicalEncoder(data interface{}) (*Encoder, error) {
+	size := Sizeof(data)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(data, nil) //error of invalid data
+		return nil, err
+	}
+	encoder := NewEncoder(size)
+	encoder.SetDeterministic(true)
+	if err := encoder.Value(data); err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+// Digest write canonical encoding of data to h, and returns its sum.
+// The canonical encoding is encoding of Encoder with SetDeterministic.
+func Digest(h hash.Hash, data interface{}) ([]byte, error) {
+	encoder, err := canonicalEncoder(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := encoder.WriteTo(h); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// signed returns bytes to sign of data by opts, which is digest of canonical
+// encoding of data by opts.HashFunc(), or the encoding itself if the hash is
+// zero, such as Ed25519.
+func signed(data interface{}, opts crypto.SignerOpts, fn string) ([]byte, error) {
+	h := opts.HashFunc()
+	if h == 0 {
+		encoder, err := canonicalEncoder(data)
+		if err != nil {
+			return nil, err
+		}
+		return encoder.Buffer(), nil
+	}
+	if !h.Available() {
+		return nil, fmt.Errorf("binary.%s: unavailable hash %s", fn, h.String())
+	}
+	return Digest(h.New(), data)
+}
+
+// Sign returns detached signature of canonical encoding of data by signer,
+// such as *ecdsa.PrivateKey, *rsa.PrivateKey and ed25519.PrivateKey.
+// The encoding is digested by opts.HashFunc() and the digest is signed, or
+// the encoding is signed if the hash is zero, as crypto.Signer requires.
+func Sign(signer crypto.Signer, data interface{}, opts crypto.SignerOpts) ([]byte, error) {
+	b, err := signed(data, opts, "Sign")
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(rand.Reader, b, opts)
+}
+
+// Verify verify detached signature sig of data signed by Sign with the same
+// opts, by public key pub of *ecdsa.PublicKey, *rsa.PublicKey or
+// ed25519.PublicKey. RSA signatures are PSS if opts is *rsa.PSSOptions, or
+// PKCS #1 v1.5.
+// It returns ErrSignature if the signature is invalid.
+func Verify(pub crypto.PublicKey, data interface{}, sig []byte, opts crypto.SignerOpts) error {
+	b, err := signed(data, opts, "Verify")
+	if err != nil {
+		return err
+	}
+	ok := false
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, b, sig)
+	case *rsa.PublicKey:
+		if pss, _ok := opts.(*rsa.PSSOptions); _ok {
+			ok = rsa.VerifyPSS(key, opts.HashFunc(), b, sig, pss) == nil
+		} else {
+			ok = rsa.VerifyPKCS1v15(key, opts.HashFunc(), b, sig) == nil
+		}
+	case ed25519.PublicKey:
+		eopts, _ok := opts.(*ed25519.Options)
+		if !_ok {
+			eopts = &ed25519.Options{Hash: opts.HashFunc()}
+		}
+		ok = ed25519.VerifyWithOptions(key, b, sig, eopts) == nil
+	default:
+		return errorf(ErrUnsupportedType, "binary.Verify: unsupported public key %T", pub)
+	}
+	if !ok {
+		return ErrSignature
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// index offsets of elements of encoded slices, to random-access elements
+// without decoding their predecessors.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// sliceMark is decoder state at beginning of an element.
+type sliceMark struct {
+	pos       int
+	boolPos   int
+	boolBit   byte
+	boolValue byte
+}
+
+// SliceIndex is an index of element offsets of a slice value encoded in
+// buffer, for random access of the i-th element of large slices.
+// Offsets of elements of fixed size are computed, and others are resolved on
+// demand by skipping their predecessors once.
+// The buffer must not be modified while the index is in use.
+type SliceIndex struct {
+	elem  reflect.Type
+	base  Decoder //decoder state after length of the slice
+	n     int     //number of elements
+	size  int     //size of elements of fixed size, or 0
+	marks []sliceMark
+}
+
+// NewSliceIndex make a SliceIndex of slice value encoded in buffer.
+// data is value or pointer of the slice/array type, nil pointer is aviable.
+// NewSliceIndex(buffer, (*[]someStruct)(nil)) is recommended usage.
+// Slices of bools are not supported, which are encoded as bits.
+func NewSliceIndex(buffer []byte, data interface{}) (ix *SliceIndex, err error) {
+	defer func() {
+		if info := recover(); info != nil {
+			ix, err = nil, panicError(info, "binary.NewSliceIndex")
+		}
+	}()
+
+	t := reflect.TypeOf(data)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) ||
+		!validUserType(t) || isBoolElem(t.Elem(), nil) || queryCodec(t, nil) != nil {
+		return nil, errorf(ErrUnsupportedType, "binary.NewSliceIndex: unsupported type %T", data)
+	}
+	ix = &SliceIndex{elem: t.Elem()}
+	ix.base.Init(buffer, DefaultEndian)
+	ix.base.resetBoolCoder()
+	ix.n, _ = ix.base.length(nil)
+	if s := fixedElemSize(ix.elem, nil); s > 0 {
+		ix.size = s
+		if ix.n > (len(buffer)-ix.base.pos)/s {
+			return nil, ErrNotEnoughSpace
+		}
+	} else {
+		ix.marks = make([]sliceMark, 1)
+		ix.marks[0] = ix.base.mark()
+	}
+	return ix, nil
+}
+
+func (decoder *Decoder) mark() sliceMark {
+	return sliceMark{pos: decoder.pos, boolPos: decoder.boolPos, boolBit: decoder.boolBit, boolValue: decoder.boolValue}
+}
+
+func (decoder *Decoder) restore(m sliceMark) {
+	decoder.pos, decoder.boolPos, decoder.boolBit, decoder.boolValue = m.pos, m.boolPos, m.boolBit, m.boolValue
+}
+
+// Len returns number of elements.
+func (ix *SliceIndex) Len() int {
+	return ix.n
+}
+
+// Offset returns offset in buffer of element i, or the end of the slice if i
+// equals Len.
+// It will return none-nil error if i is out of range, or buffer is not enough.
+func (ix *SliceIndex) Offset(i int) (offset int, err error) {
+	defer func() {
+		if info := recover(); info != nil {
+			err = panicError(info, "binary.SliceIndex.Offset")
+		}
+	}()
+	if i < 0 || i > ix.n {
+		return 0, fmt.Errorf("binary.SliceIndex.Offset: index %d out of range [0,%d]", i, ix.n)
+	}
+	return ix.start(i).pos, nil
+}
+
+// Offsets returns offsets of all elements in buffer, resolve them if necessary.
+func (ix *SliceIndex) Offsets() ([]int, error) {
+	offsets := make([]int, ix.n)
+	for i := range offsets {
+		o, err := ix.Offset(i)
+		if err != nil {
+			return nil, err
+		}
+		offsets[i] = o
+	}
+	return offsets, nil
+}
+
+// Element decode element i to x, which must be pointer of the element type.
+// It will return none-nil error if i is out of range, or buffer is not enough.
+func (ix *SliceIndex) Element(i int, x interface{}) (err error) {
+	defer func() {
+		if info := recover(); info != nil {
+			err = panicError(info, "binary.SliceIndex.Element")
+		}
+	}()
+	if i < 0 || i >= ix.n {
+		return fmt.Errorf("binary.SliceIndex.Element: index %d out of range [0,%d)", i, ix.n)
+	}
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Type().Elem() != ix.elem {
+		return fmt.Errorf("binary.SliceIndex.Element: %T is not pointer of element %s", x, ix.elem.String())
+	}
+	decoder := ix.base //copy of decoder state
+	decoder.restore(ix.start(i))
+	return decoder.value(v.Elem(), false, nil)
+}
+
+// start returns decoder state at beginning of element i, resolve the
+// elements before it if necessary.
+func (ix *SliceIndex) start(i int) sliceMark {
+	if ix.size > 0 {
+		m := ix.base.mark()
+		m.pos += i * ix.size
+		return m
+	}
+	decoder := ix.base
+	for j := len(ix.marks) - 1; j < i; j++ {
+		decoder.restore(ix.marks[j])
+		decoder.skipByType(ix.elem, nil)
+		ix.marks = append(ix.marks, decoder.mark())
+	}
+	return ix.marks[i]
+}
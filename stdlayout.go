@@ -0,0 +1,256 @@
+// encode/decode values in layout of encoding/binary, so that formats defined
+// with the standard library can be migrated without wire changes.
+
+package binary
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// SetStdLayout set if Encoder encode values in layout of encoding/binary.
+// Only fixed-size values are supported: bools of one byte, fixed-size ints,
+// floats, complexes, and arrays/structs of them, without length prefix or
+// varints. A slice of fixed-size values is supported as top level value.
+// Blank (_) fields are written as zeros, and field tags are ignored.
+// Use SizeofStd to get the buffer size.
+func (encoder *Encoder) SetStdLayout(std bool) {
+	encoder.std = std
+}
+
+// SetStdLayout set if Decoder decode values in layout of encoding/binary,
+// which is encoded by Encoder with SetStdLayout or encoding/binary.
+// Blank (_) fields are skipped, and the other fields must be exported.
+// Slices are decoded by their length.
+func (decoder *Decoder) SetStdLayout(std bool) {
+	decoder.std = std
+}
+
+// SizeofStd returns bytes number of data encoded in layout of encoding/binary,
+// as binary.Size of encoding/binary.
+// Data must be a fixed-size value or a slice of fixed-size values, or a
+// pointer to such data, otherwise it returns -1.
+func SizeofStd(data interface{}) int {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	if !v.IsValid() {
+		return -1
+	}
+	if v.Kind() == reflect.Slice {
+		if s := sizeofStdType(v.Type().Elem()); s >= 0 {
+			return s * v.Len()
+		}
+		return -1
+	}
+	return sizeofStdType(v.Type())
+}
+
+// sizeofStdType returns bytes number of fixed-size type t in layout of
+// encoding/binary, or -1 if it is not fixed-size.
+func sizeofStdType(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8:
+		return 1
+	case reflect.Int16, reflect.Uint16:
+		return 2
+	case reflect.Int32, reflect.Uint32, reflect.Float32:
+		return 4
+	case reflect.Int64, reflect.Uint64, reflect.Float64, reflect.Complex64:
+		return 8
+	case reflect.Complex128:
+		return 16
+	case reflect.Array:
+		if s := sizeofStdType(t.Elem()); s >= 0 {
+			return s * t.Len()
+		}
+	case reflect.Struct:
+		sum := 0
+		for i, n := 0, t.NumField(); i < n; i++ {
+			s := sizeofStdType(t.Field(i).Type)
+			if s < 0 {
+				return -1
+			}
+			sum += s
+		}
+		return sum
+	}
+	return -1
+}
+
+// WriteStd writes data to w in layout of encoding/binary, as binary.Write of
+// encoding/binary.
+// Data must be a fixed-size value or a slice of fixed-size values, or a
+// pointer to such data.
+func WriteStd(w io.Writer, endian Endian, data interface{}) error {
+	size := SizeofStd(data)
+	if size < 0 {
+		return errorf(ErrUnsupportedType, "binary.WriteStd: invalid type %s", reflect.TypeOf(data).String())
+	}
+	encoder := NewEncoderEndian(size, endian)
+	encoder.SetStdLayout(true)
+	if err := encoder.Value(data); err != nil {
+		return err
+	}
+	_, err := w.Write(encoder.Buffer())
+	return err
+}
+
+// ReadStd reads data from r in layout of encoding/binary, as binary.Read of
+// encoding/binary.
+// Data must be a pointer to a fixed-size value or a slice of fixed-size values.
+// The error is io.EOF only if no bytes were read. If an EOF happens after
+// reading some but not all the bytes, ReadStd returns io.ErrUnexpectedEOF.
+func ReadStd(r io.Reader, endian Endian, data interface{}) error {
+	size := SizeofStd(data)
+	if size < 0 {
+		return errorf(ErrUnsupportedType, "binary.ReadStd: invalid type %s", reflect.TypeOf(data).String())
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	decoder := NewDecoderEndian(b, endian)
+	decoder.SetStdLayout(true)
+	return decoder.Value(data)
+}
+
+// stdValue encode x in layout of encoding/binary.
+func (encoder *Encoder) stdValue(x interface{}) {
+	if SizeofStd(x) < 0 {
+		panic(errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type %T in std layout", x))
+	}
+	v := reflect.Indirect(reflect.ValueOf(x))
+	if v.Kind() == reflect.Slice {
+		for i, n := 0, v.Len(); i < n; i++ {
+			encoder.stdElem(v.Index(i))
+		}
+		return
+	}
+	encoder.stdElem(v)
+}
+
+// stdElem encode fixed-size value v in layout of encoding/binary.
+func (encoder *Encoder) stdElem(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		b := uint8(0)
+		if v.Bool() {
+			b = 1
+		}
+		encoder.Uint8(b)
+	case reflect.Int8:
+		encoder.Int8(int8(v.Int()))
+	case reflect.Uint8:
+		encoder.Uint8(uint8(v.Uint()))
+	case reflect.Int16:
+		encoder.Int16(int16(v.Int()), false)
+	case reflect.Uint16:
+		encoder.Uint16(uint16(v.Uint()), false)
+	case reflect.Int32:
+		encoder.Int32(int32(v.Int()), false)
+	case reflect.Uint32:
+		encoder.Uint32(uint32(v.Uint()), false)
+	case reflect.Int64:
+		encoder.Int64(v.Int(), false)
+	case reflect.Uint64:
+		encoder.Uint64(v.Uint(), false)
+	case reflect.Float32:
+		encoder.Uint32(math.Float32bits(float32(v.Float())), false)
+	case reflect.Float64:
+		encoder.Uint64(math.Float64bits(v.Float()), false)
+	case reflect.Complex64:
+		c := v.Complex()
+		encoder.Uint32(math.Float32bits(float32(real(c))), false)
+		encoder.Uint32(math.Float32bits(float32(imag(c))), false)
+	case reflect.Complex128:
+		c := v.Complex()
+		encoder.Uint64(math.Float64bits(real(c)), false)
+		encoder.Uint64(math.Float64bits(imag(c)), false)
+	case reflect.Array:
+		for i, n := 0, v.Len(); i < n; i++ {
+			encoder.stdElem(v.Index(i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i, n := 0, v.NumField(); i < n; i++ {
+			if t.Field(i).Name == "_" { //padding
+				b := encoder.reserve(sizeofStdType(t.Field(i).Type))
+				for j := range b {
+					b[j] = 0
+				}
+				continue
+			}
+			encoder.stdElem(v.Field(i))
+		}
+	}
+}
+
+// stdValue decode x in layout of encoding/binary, x is pointer or slice.
+func (decoder *Decoder) stdValue(x interface{}) {
+	v := reflect.ValueOf(x)
+	if k := v.Kind(); k != reflect.Ptr && k != reflect.Slice || SizeofStd(x) < 0 {
+		panic(errorf(ErrUnsupportedType, "binary.Decoder.Value: unsupported type %T in std layout", x))
+	}
+	v = reflect.Indirect(v)
+	if v.Kind() == reflect.Slice {
+		for i, n := 0, v.Len(); i < n; i++ {
+			decoder.stdElem(v.Index(i))
+		}
+		return
+	}
+	decoder.stdElem(v)
+}
+
+// stdElem decode fixed-size value v in layout of encoding/binary.
+func (decoder *Decoder) stdElem(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(decoder.Uint8() != 0)
+	case reflect.Int8:
+		v.SetInt(int64(decoder.Int8()))
+	case reflect.Uint8:
+		v.SetUint(uint64(decoder.Uint8()))
+	case reflect.Int16:
+		v.SetInt(int64(decoder.Int16(false)))
+	case reflect.Uint16:
+		v.SetUint(uint64(decoder.Uint16(false)))
+	case reflect.Int32:
+		v.SetInt(int64(decoder.Int32(false)))
+	case reflect.Uint32:
+		v.SetUint(uint64(decoder.Uint32(false)))
+	case reflect.Int64:
+		v.SetInt(decoder.Int64(false))
+	case reflect.Uint64:
+		v.SetUint(decoder.Uint64(false))
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(decoder.Uint32(false))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(decoder.Uint64(false)))
+	case reflect.Complex64:
+		re := math.Float32frombits(decoder.Uint32(false))
+		im := math.Float32frombits(decoder.Uint32(false))
+		v.SetComplex(complex(float64(re), float64(im)))
+	case reflect.Complex128:
+		re := math.Float64frombits(decoder.Uint64(false))
+		im := math.Float64frombits(decoder.Uint64(false))
+		v.SetComplex(complex(re, im))
+	case reflect.Array:
+		for i, n := 0, v.Len(); i < n; i++ {
+			decoder.stdElem(v.Index(i))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i, n := 0, v.NumField(); i < n; i++ {
+			f := v.Field(i)
+			if t.Field(i).Name == "_" { //padding
+				decoder.Skip(sizeofStdType(f.Type()))
+				continue
+			}
+			if !f.CanSet() {
+				panic(fmt.Errorf("binary.Decoder.Value: unexported field %s of %s in std layout", t.Field(i).Name, t.String()))
+			}
+			decoder.stdElem(f)
+		}
+	}
+}
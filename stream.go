@@ -0,0 +1,710 @@
+// encode/decode values in self-describing streams as gob, where the first
+// occurrence of each type is preceded by its schema, so receivers can decode
+// values without compile-time knowledge of the structs.
+
+package binary
+
+import (
+	"bufio"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// ids of stream types less than streamFirstID are reflect.Kind of basic types
+const streamFirstID = 32
+
+// max nesting depth of stream values
+const streamMaxDepth = 1000
+
+var errStreamTruncated = errors.New("binary.StreamDecoder: truncated message")
+
+// streamType is the schema of a type in stream.
+type streamType struct {
+	kind   reflect.Kind
+	name   string        //name of struct
+	len    int           //length of array
+	key    uint64        //type id of map key
+	elem   uint64        //type id of array/slice/map/pointer element
+	fields []streamField //fields of struct
+}
+
+type streamField struct {
+	name string
+	id   uint64
+}
+
+// StreamEncoder encode values to a self-describing stream.
+// The first value of each type is preceded by its schema, which is sent once
+// per stream, and StreamDecoder can decode the values to compatible types or
+// generic values without knowing the types of encoder.
+//
+// Exported fields of structs are encoded, field tag `binary:"ignore"` is
+// respected and the other field tags are ignored.
+// Types implement encoding.TextMarshaler are encoded as their text.
+type StreamEncoder struct {
+	w       io.Writer
+	types   map[reflect.Type]uint64 //ids of types sent
+	nextID  uint64
+	defs    [][]byte //definitions of new types of value
+	visitor ptrVisitor
+}
+
+// NewStreamEncoder returns a StreamEncoder which writes to w.
+func NewStreamEncoder(w io.Writer) *StreamEncoder {
+	return &StreamEncoder{w: w, types: make(map[reflect.Type]uint64), nextID: streamFirstID}
+}
+
+// Encode write message of x to the stream, which is preceded by the schemas
+// of types of x not sent yet.
+func (enc *StreamEncoder) Encode(x interface{}) (err error) {
+	next := enc.nextID
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.StreamEncoder.Encode")
+			for t, id := range enc.types { //forget types of failed message
+				if id >= next {
+					delete(enc.types, t)
+				}
+			}
+			enc.nextID = next
+		}
+		enc.defs = nil
+		enc.visitor = ptrVisitor{}
+	}()
+
+	v := reflect.ValueOf(x)
+	if !v.IsValid() {
+		return errors.New("binary.StreamEncoder.Encode: nil value")
+	}
+	id := enc.typeID(v.Type())
+	body := enc.appendValue(nil, v)
+
+	msg := AppendUvarint(nil, uint64(len(enc.defs)))
+	for _, def := range enc.defs {
+		msg = append(msg, def...)
+	}
+	msg = AppendUvarint(msg, id)
+	msg = append(msg, body...)
+	_, err = enc.w.Write(append(AppendUvarint(nil, uint64(len(msg))), msg...))
+	return err
+}
+
+// isStreamText returns if t is encoded as text in stream.
+func isStreamText(t reflect.Type) bool {
+	return t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface &&
+		(t.Implements(tTextMarshaler) || reflect.PtrTo(t).Implements(tTextMarshaler))
+}
+
+// typeID returns id of type t, and define t if it is not sent yet.
+func (enc *StreamEncoder) typeID(t reflect.Type) uint64 {
+	if isStreamText(t) {
+		return uint64(reflect.String)
+	}
+	switch k := t.Kind(); k {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+		reflect.String, reflect.Interface:
+		return uint64(k)
+	case reflect.Array, reflect.Slice, reflect.Ptr, reflect.Map, reflect.Struct:
+	default:
+		panic(errorf(ErrUnsupportedType, "binary.StreamEncoder.Encode: unsupported type %s", t.String()))
+	}
+	if id, ok := enc.types[t]; ok {
+		return id
+	}
+	id := enc.nextID
+	enc.nextID++
+	enc.types[t] = id //before elements for recursive types
+
+	def := AppendUvarint(nil, id)
+	def = append(def, byte(t.Kind()))
+	switch t.Kind() {
+	case reflect.Array:
+		def = AppendUvarint(def, uint64(t.Len()))
+		def = AppendUvarint(def, enc.typeID(t.Elem()))
+	case reflect.Slice, reflect.Ptr:
+		def = AppendUvarint(def, enc.typeID(t.Elem()))
+	case reflect.Map:
+		def = AppendUvarint(def, enc.typeID(t.Key()))
+		def = AppendUvarint(def, enc.typeID(t.Elem()))
+	case reflect.Struct:
+		def = appendStreamString(def, t.Name())
+		info := queryStruct(t)
+		var fields []byte
+		n := 0
+		for i, num := 0, t.NumField(); i < num; i++ {
+			if info.fieldValid(i, t) {
+				fields = appendStreamString(fields, t.Field(i).Name)
+				fields = AppendUvarint(fields, enc.typeID(t.Field(i).Type))
+				n++
+			}
+		}
+		def = AppendUvarint(def, uint64(n))
+		def = append(def, fields...)
+	}
+	enc.defs = append(enc.defs, def)
+	return id
+}
+
+func appendStreamString(b []byte, s string) []byte {
+	return append(AppendUvarint(b, uint64(len(s))), s...)
+}
+
+// appendValue append v to b.
+func (enc *StreamEncoder) appendValue(b []byte, v reflect.Value) []byte {
+	t := v.Type()
+	if isStreamText(t) {
+		if !v.CanAddr() { //for methods of pointer receiver
+			p := reflect.New(t).Elem()
+			p.Set(v)
+			v = p
+		}
+		m, ok := v.Interface().(encoding.TextMarshaler)
+		if !ok {
+			m = v.Addr().Interface().(encoding.TextMarshaler)
+		}
+		text, err := m.MarshalText()
+		if err != nil {
+			panic(err)
+		}
+		return appendStreamString(b, string(text))
+	}
+
+	switch k := v.Kind(); k {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return AppendUvarint(b, ToUvarint(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return AppendUvarint(b, v.Uint())
+	case reflect.Float32:
+		return appendStreamBits(b, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		return appendStreamBits(b, math.Float64bits(v.Float()), 8)
+	case reflect.Complex64:
+		b = appendStreamBits(b, uint64(math.Float32bits(float32(real(v.Complex())))), 4)
+		return appendStreamBits(b, uint64(math.Float32bits(float32(imag(v.Complex())))), 4)
+	case reflect.Complex128:
+		b = appendStreamBits(b, math.Float64bits(real(v.Complex())), 8)
+		return appendStreamBits(b, math.Float64bits(imag(v.Complex())), 8)
+	case reflect.String:
+		return appendStreamString(b, v.String())
+	case reflect.Slice, reflect.Array:
+		if k == reflect.Slice {
+			b = AppendUvarint(b, uint64(v.Len()))
+		}
+		if t.Elem().Kind() == reflect.Uint8 && !isStreamText(t.Elem()) { //raw bytes
+			for i, n := 0, v.Len(); i < n; i++ {
+				b = append(b, byte(v.Index(i).Uint()))
+			}
+			return b
+		}
+		for i, n := 0, v.Len(); i < n; i++ {
+			b = enc.appendValue(b, v.Index(i))
+		}
+		return b
+	case reflect.Map:
+		if v.Len() > 0 {
+			if !enc.visitor.enter(v) {
+				panic(fmt.Errorf("binary.StreamEncoder.Encode: cycle of %s", t.String()))
+			}
+			defer enc.visitor.leave(v)
+		}
+		keys := v.MapKeys()
+		sortMapKeys(keys)
+		b = AppendUvarint(b, uint64(len(keys)))
+		for _, key := range keys {
+			b = enc.appendValue(b, key)
+			b = enc.appendValue(b, v.MapIndex(key))
+		}
+		return b
+	case reflect.Struct:
+		info := queryStruct(t)
+		for i, n := 0, t.NumField(); i < n; i++ {
+			if info.fieldValid(i, t) {
+				b = enc.appendValue(b, v.Field(i))
+			}
+		}
+		return b
+	case reflect.Ptr:
+		if v.IsNil() {
+			return append(b, 0)
+		}
+		if !enc.visitor.enter(v) {
+			panic(fmt.Errorf("binary.StreamEncoder.Encode: cycle of %s", t.String()))
+		}
+		defer enc.visitor.leave(v)
+		return enc.appendValue(append(b, 1), v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return AppendUvarint(b, 0)
+		}
+		b = AppendUvarint(b, enc.typeID(v.Elem().Type()))
+		return enc.appendValue(b, v.Elem())
+	}
+	panic(errorf(ErrUnsupportedType, "binary.StreamEncoder.Encode: unsupported type %s", t.String()))
+}
+
+// appendStreamBits append low size bytes of x in little endian to b.
+func appendStreamBits(b []byte, x uint64, size int) []byte {
+	for i := 0; i < size; i++ {
+		b = append(b, byte(x>>(uint(i)*8)))
+	}
+	return b
+}
+
+// StreamDecoder decode values from a self-describing stream, which is encoded
+// by StreamEncoder.
+// Values are decoded to types of compatible kinds, where struct fields are
+// matched by names, and fields not in both types are skipped.
+// Empty slices and maps are decoded as nil.
+// Values decoded to interface{} are generic values: bool, int64, uint64,
+// float32, float64, complex64, complex128, string, []byte, []interface{},
+// map[interface{}]interface{}, or map[string]interface{} for structs.
+// Values can also be read token by token, by NextKind, ReadPrimitive,
+// ReadLength, EnterStruct, Leave and Skip, without building Go values.
+type StreamDecoder struct {
+	r     io.ByteReader
+	types map[uint64]*streamType //types received
+	buff  []byte
+	pos   int
+	depth int
+
+	frames []streamFrame //containers entered by token API, the first is message
+	next   *streamToken  //next token resolved by token API, nil means not
+}
+
+// NewStreamDecoder returns a StreamDecoder which reads from r.
+// r is buffered if it is not an io.ByteReader.
+func NewStreamDecoder(r io.Reader) *StreamDecoder {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &StreamDecoder{r: br, types: make(map[uint64]*streamType)}
+}
+
+// Decode read next message from the stream, and decode its value to x,
+// which must be a pointer.
+// It returns io.EOF if there is no more message.
+func (dec *StreamDecoder) Decode(x interface{}) (err error) {
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("binary.StreamDecoder.Decode: non-pointer %T", x)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.StreamDecoder.Decode")
+		}
+	}()
+	dec.frames, dec.next = dec.frames[:0], nil //drop tokens of message not finished
+	dec.value(v.Elem(), dec.readMessage())
+	return nil
+}
+
+// readMessage read next message and definitions of its types, and returns
+// type id of its value. It panics io.EOF if there is no more message.
+func (dec *StreamDecoder) readMessage() uint64 {
+	size, err := ReadUvarint(dec.r)
+	if err != nil {
+		panic(err)
+	}
+	if size > uint64(maxInt) {
+		panic(fmt.Errorf("binary.StreamDecoder.Decode: invalid message size %d", size))
+	}
+	dec.buff, dec.pos, dec.depth = make([]byte, size), 0, 0
+	if _, err := io.ReadFull(dec.r.(io.Reader), dec.buff); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		panic(err)
+	}
+	for i, n := 0, dec.uvarint(); uint64(i) < n; i++ {
+		dec.define()
+	}
+	return dec.uvarint()
+}
+
+func (dec *StreamDecoder) uvarint() uint64 {
+	x, n := Uvarint(dec.buff[dec.pos:])
+	if n < 0 {
+		panic(errOverflow)
+	}
+	if n == 0 {
+		panic(errStreamTruncated)
+	}
+	dec.pos += n
+	return x
+}
+
+func (dec *StreamDecoder) bytes(n uint64) []byte {
+	if n > uint64(len(dec.buff)-dec.pos) {
+		panic(errStreamTruncated)
+	}
+	b := dec.buff[dec.pos : dec.pos+int(n)]
+	dec.pos += int(n)
+	return b
+}
+
+func (dec *StreamDecoder) string() string {
+	return string(dec.bytes(dec.uvarint()))
+}
+
+func (dec *StreamDecoder) bits(size int) uint64 {
+	x := uint64(0)
+	for i, c := range dec.bytes(uint64(size)) {
+		x |= uint64(c) << (uint(i) * 8)
+	}
+	return x
+}
+
+// define decode definition of a type.
+func (dec *StreamDecoder) define() {
+	id := dec.uvarint()
+	st := &streamType{kind: reflect.Kind(dec.bytes(1)[0])}
+	switch st.kind {
+	case reflect.Array:
+		l := dec.uvarint()
+		if l > uint64(maxInt) {
+			panic(fmt.Errorf("binary.StreamDecoder.Decode: invalid array length %d", l))
+		}
+		st.len, st.elem = int(l), dec.uvarint()
+	case reflect.Slice, reflect.Ptr:
+		st.elem = dec.uvarint()
+	case reflect.Map:
+		st.key, st.elem = dec.uvarint(), dec.uvarint()
+	case reflect.Struct:
+		st.name = dec.string()
+		n := dec.uvarint()
+		if n > uint64(len(dec.buff)-dec.pos) {
+			panic(errStreamTruncated)
+		}
+		st.fields = make([]streamField, n)
+		for i := range st.fields {
+			st.fields[i].name = dec.string()
+			st.fields[i].id = dec.uvarint()
+		}
+	default:
+		panic(fmt.Errorf("binary.StreamDecoder.Decode: invalid kind %d of type %d", st.kind, id))
+	}
+	if id < streamFirstID {
+		panic(fmt.Errorf("binary.StreamDecoder.Decode: invalid type id %d", id))
+	}
+	dec.types[id] = st
+}
+
+// typeOf returns type of id.
+func (dec *StreamDecoder) typeOf(id uint64) *streamType {
+	if id < streamFirstID {
+		switch k := reflect.Kind(id); k {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128,
+			reflect.String, reflect.Interface:
+			return &streamType{kind: k}
+		}
+	} else if st, ok := dec.types[id]; ok {
+		return st
+	}
+	panic(fmt.Errorf("binary.StreamDecoder.Decode: undefined type id %d", id))
+}
+
+// length decode length of slice/map, which is limited by remain bytes.
+func (dec *StreamDecoder) length() int {
+	l := dec.uvarint()
+	if l > uint64(len(dec.buff)-dec.pos) {
+		panic(errStreamTruncated)
+	}
+	return int(l)
+}
+
+// value decode v of type id.
+func (dec *StreamDecoder) value(v reflect.Value, id uint64) {
+	if dec.depth++; dec.depth > streamMaxDepth {
+		panic(errorf(ErrLimitExceeded, "binary.StreamDecoder.Decode: exceeded max depth %d", streamMaxDepth))
+	}
+	defer func() { dec.depth-- }()
+
+	st := dec.typeOf(id)
+	t := v.Type()
+	mismatch := func() {
+		panic(fmt.Errorf("binary.StreamDecoder.Decode: can not decode %s to %s", st.kind, t.String()))
+	}
+	if st.kind == reflect.Ptr {
+		if dec.bytes(1)[0] == 0 {
+			v.Set(reflect.Zero(t))
+			return
+		}
+		dec.value(v, st.elem)
+		return
+	}
+	if t.Kind() == reflect.Interface {
+		if t.NumMethod() > 0 {
+			mismatch()
+		}
+		if a := dec.generic(st); a != nil {
+			v.Set(reflect.ValueOf(a))
+		} else {
+			v.Set(reflect.Zero(t))
+		}
+		return
+	}
+	if t.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		dec.value(v.Elem(), id)
+		return
+	}
+	if st.kind == reflect.String && reflect.PtrTo(t).Implements(tTextUnmarshaler) {
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(dec.string())); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	switch st.kind {
+	case reflect.Bool:
+		if t.Kind() != reflect.Bool {
+			mismatch()
+		}
+		v.SetBool(dec.bytes(1)[0] != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !setStreamInteger(v, dec.uvarint(), st.kind >= reflect.Int && st.kind <= reflect.Int64) {
+			mismatch()
+		}
+	case reflect.Float32, reflect.Float64:
+		if t.Kind() != reflect.Float32 && t.Kind() != reflect.Float64 {
+			mismatch()
+		}
+		v.SetFloat(dec.float(st.kind))
+	case reflect.Complex64, reflect.Complex128:
+		if t.Kind() != reflect.Complex64 && t.Kind() != reflect.Complex128 {
+			mismatch()
+		}
+		fk := reflect.Float32
+		if st.kind == reflect.Complex128 {
+			fk = reflect.Float64
+		}
+		re := dec.float(fk)
+		v.SetComplex(complex(re, dec.float(fk)))
+	case reflect.String:
+		switch {
+		case t.Kind() == reflect.String:
+			v.SetString(dec.string())
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), dec.string()...))
+		default:
+			mismatch()
+		}
+	case reflect.Slice, reflect.Array:
+		l := st.len
+		if st.kind == reflect.Slice {
+			l = dec.length()
+		} else if l > len(dec.buff)-dec.pos {
+			panic(errStreamTruncated)
+		}
+		switch t.Kind() {
+		case reflect.Slice:
+			v.Set(reflect.Zero(t)) //empty slice is nil as gob
+		case reflect.Array:
+		default:
+			mismatch()
+		}
+		et := dec.typeOf(st.elem)
+		for i := 0; i < l; i++ {
+			switch {
+			case t.Kind() == reflect.Slice:
+				v.Set(reflect.Append(v, reflect.Zero(t.Elem())))
+				dec.elem(v.Index(i), st.elem, et)
+			case i < v.Len():
+				dec.elem(v.Index(i), st.elem, et)
+			default:
+				dec.generic(et) //elements out of array
+			}
+		}
+	case reflect.Map:
+		if t.Kind() != reflect.Map {
+			mismatch()
+		}
+		l := dec.length()
+		v.Set(reflect.Zero(t)) //empty map is nil as gob
+		if l > 0 {
+			v.Set(reflect.MakeMap(t))
+		}
+		for i := 0; i < l; i++ {
+			key := reflect.New(t.Key()).Elem()
+			value := reflect.New(t.Elem()).Elem()
+			dec.value(key, st.key)
+			dec.value(value, st.elem)
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		if t.Kind() != reflect.Struct {
+			mismatch()
+		}
+		info := queryStruct(t)
+		info.setDefaults(v, nil)
+		for _, f := range st.fields {
+			if sf, ok := t.FieldByName(f.name); ok && len(sf.Index) == 1 && info.fieldValid(sf.Index[0], t) {
+				dec.value(v.Field(sf.Index[0]), f.id)
+			} else {
+				dec.generic(dec.typeOf(f.id)) //unknown field
+			}
+		}
+	case reflect.Interface:
+		if eid := dec.uvarint(); eid != 0 {
+			dec.value(v, eid)
+		} else {
+			v.Set(reflect.Zero(t))
+		}
+	default:
+		mismatch()
+	}
+}
+
+// elem decode element v of type id, of which raw bytes are decoded directly.
+func (dec *StreamDecoder) elem(v reflect.Value, id uint64, st *streamType) {
+	if id != uint64(reflect.Uint8) {
+		dec.value(v, id)
+		return
+	}
+	x := uint64(dec.bytes(1)[0])
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(x))
+	} else if !setStreamInteger(v, x, false) {
+		panic(fmt.Errorf("binary.StreamDecoder.Decode: can not decode %s to %s", st.kind, v.Type().String()))
+	}
+}
+
+// setStreamInteger set number v by integer x, which is zigzag if signed.
+// It returns false if v is not number or x overflows.
+func setStreamInteger(v reflect.Value, x uint64, signed bool) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := int64(x)
+		if signed {
+			n = ToVarint(x)
+		} else if x > math.MaxInt64 {
+			return false
+		}
+		if v.OverflowInt(n) {
+			return false
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if signed {
+			n := ToVarint(x)
+			if n < 0 {
+				return false
+			}
+			x = uint64(n)
+		}
+		if v.OverflowUint(x) {
+			return false
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		if signed {
+			v.SetFloat(float64(ToVarint(x)))
+		} else {
+			v.SetFloat(float64(x))
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (dec *StreamDecoder) float(k reflect.Kind) float64 {
+	if k == reflect.Float32 {
+		return float64(math.Float32frombits(uint32(dec.bits(4))))
+	}
+	return math.Float64frombits(dec.bits(8))
+}
+
+// generic decode value of type st as generic value.
+func (dec *StreamDecoder) generic(st *streamType) interface{} {
+	if dec.depth++; dec.depth > streamMaxDepth {
+		panic(errorf(ErrLimitExceeded, "binary.StreamDecoder.Decode: exceeded max depth %d", streamMaxDepth))
+	}
+	defer func() { dec.depth-- }()
+
+	switch st.kind {
+	case reflect.Bool:
+		return dec.bytes(1)[0] != 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ToVarint(dec.uvarint())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return dec.uvarint()
+	case reflect.Float32:
+		return float32(dec.float(reflect.Float32))
+	case reflect.Float64:
+		return dec.float(reflect.Float64)
+	case reflect.Complex64:
+		re := float32(dec.float(reflect.Float32))
+		return complex(re, float32(dec.float(reflect.Float32)))
+	case reflect.Complex128:
+		re := dec.float(reflect.Float64)
+		return complex(re, dec.float(reflect.Float64))
+	case reflect.String:
+		return dec.string()
+	case reflect.Slice, reflect.Array:
+		l := st.len
+		if st.kind == reflect.Slice {
+			l = dec.length()
+		}
+		if st.elem == uint64(reflect.Uint8) { //raw bytes
+			return append([]byte{}, dec.bytes(uint64(l))...)
+		}
+		if l > len(dec.buff)-dec.pos {
+			panic(errStreamTruncated)
+		}
+		et := dec.typeOf(st.elem)
+		a := make([]interface{}, l)
+		for i := range a {
+			a[i] = dec.generic(et)
+		}
+		return a
+	case reflect.Map:
+		l := dec.length()
+		kt, et := dec.typeOf(st.key), dec.typeOf(st.elem)
+		m := make(map[interface{}]interface{}, l)
+		for i := 0; i < l; i++ {
+			key := dec.generic(kt)
+			if b, ok := key.([]byte); ok { //unhashable
+				key = string(b)
+			} else if key != nil && !reflect.TypeOf(key).Comparable() {
+				panic(errorf(ErrUnsupportedType, "binary.StreamDecoder.Decode: unsupported map key of type %T", key))
+			}
+			m[key] = dec.generic(et)
+		}
+		return m
+	case reflect.Struct:
+		m := make(map[string]interface{}, len(st.fields))
+		for _, f := range st.fields {
+			m[f.name] = dec.generic(dec.typeOf(f.id))
+		}
+		return m
+	case reflect.Ptr:
+		if dec.bytes(1)[0] == 0 {
+			return nil
+		}
+		return dec.generic(dec.typeOf(st.elem))
+	case reflect.Interface:
+		if id := dec.uvarint(); id != 0 {
+			return dec.generic(dec.typeOf(id))
+		}
+		return nil
+	}
+	panic(errorf(ErrUnsupportedType, "binary.StreamDecoder.Decode: unsupported kind %s", st.kind))
+}
@@ -0,0 +1,61 @@
+// decode a stream of concatenated values in a loop, as json.Decoder.
+
+package binary
+
+import (
+	"bufio"
+	"io"
+)
+
+// NewDecoderReader make a new Decoder to decode values from r with endian.
+// r is buffered, so bytes may be read from r beyond the decoded values.
+// As decoding from a reader, peeking is not supported.
+func NewDecoderReader(r io.Reader, endian Endian) *Decoder {
+	decoder := &Decoder{}
+	decoder.Init(nil, endian)
+	decoder.reader = bufio.NewReader(r)
+	return decoder
+}
+
+// More reports whether there is another value to decode in buffer or reader
+// of Decoder. It is always true when decoding from a reader made by Read.
+func (decoder *Decoder) More() bool {
+	return decoder.next() == nil
+}
+
+// Decode decode the next value to x as Value, or returns io.EOF if there is
+// no more value, so that a stream of concatenated values is decoded in a loop:
+//
+//	for decoder.More() {
+//		if err := decoder.Decode(&x); err != nil {
+//			return err
+//		}
+//	}
+func (decoder *Decoder) Decode(x interface{}) error {
+	if err := decoder.next(); err != nil {
+		return err
+	}
+	return decoder.Value(x)
+}
+
+// next returns nil if there is another value to decode, or io.EOF or error
+// of reader if there is not.
+func (decoder *Decoder) next() error {
+	switch r := decoder.reader.(type) {
+	case nil:
+		if decoder.pos < len(decoder.buff) {
+			return nil
+		}
+		return io.EOF
+	case *bufio.Reader: //made by NewDecoderReader
+		_, err := r.Peek(1)
+		return err
+	case *io.SectionReader: //made by NewDecoderAt
+		var b [1]byte
+		pos, _ := r.Seek(0, io.SeekCurrent)
+		if n, err := r.ReadAt(b[:], pos); n == 0 {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// read values of self-describing streams token by token, so that streams are
+// transformed or filtered without building Go values.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// streamFrame is a container entered by token API, or a message.
+type streamFrame struct {
+	st *streamType //type of container, nil for message
+	id uint64      //type id of value of message
+	n  int         //number of tokens, keys and values of maps are tokens
+	i  int         //index of next token
+}
+
+// idOf returns type id of token i of the frame.
+func (f *streamFrame) idOf(i int) uint64 {
+	switch {
+	case f.st == nil:
+		return f.id
+	case f.st.kind == reflect.Map:
+		if i%2 == 0 {
+			return f.st.key
+		}
+		return f.st.elem
+	case f.st.kind == reflect.Struct:
+		return f.st.fields[i].id
+	}
+	return f.st.elem
+}
+
+// streamToken is the next value to read by token API.
+type streamToken struct {
+	st  *streamType //type of value, pointers and interfaces are resolved, nil for nil value
+	raw bool        //if it is a raw byte of []byte
+}
+
+// recoverStream set err by panic of token API.
+func recoverStream(err *error) {
+	if e := recover(); e != nil {
+		*err = panicError(e, "binary.StreamDecoder")
+	}
+}
+
+// NextKind returns kind of the next value of stream, reading the next message
+// if values of the last one are all read. It returns io.EOF if there is no
+// more message.
+// Pointers and interfaces are resolved to their elements, and reflect.Invalid
+// is returned for nil ones.
+// Kinds of ints are reflect.Int64/Uint64 as they are read by ReadPrimitive.
+func (dec *StreamDecoder) NextKind() (kind reflect.Kind, err error) {
+	defer recoverStream(&err)
+	tok := dec.token()
+	switch {
+	case tok.raw:
+		return reflect.Uint64, nil
+	case tok.st == nil:
+		return reflect.Invalid, nil
+	}
+	switch k := tok.st.kind; k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.Int64, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return reflect.Uint64, nil
+	default:
+		return k, nil
+	}
+}
+
+// ReadPrimitive read the next value of basic kind, byte slice/array or nil,
+// as generic value of Decode, such as int64 for ints and []byte for byte
+// slices.
+func (dec *StreamDecoder) ReadPrimitive() (x interface{}, err error) {
+	defer recoverStream(&err)
+	tok := dec.token()
+	switch {
+	case tok.raw:
+		x = uint64(dec.bytes(1)[0])
+	case tok.st == nil:
+	case tok.st.kind == reflect.Slice || tok.st.kind == reflect.Array:
+		if tok.st.elem != uint64(reflect.Uint8) {
+			panic(fmt.Errorf("binary.StreamDecoder.ReadPrimitive: %s is not primitive", tok.st.kind))
+		}
+		x = dec.generic(tok.st)
+	case tok.st.kind == reflect.Map || tok.st.kind == reflect.Struct:
+		panic(fmt.Errorf("binary.StreamDecoder.ReadPrimitive: %s is not primitive", tok.st.kind))
+	default:
+		x = dec.generic(tok.st)
+	}
+	dec.consume()
+	return x, nil
+}
+
+// ReadLength read length of the next value of slice/array/map and enter it,
+// then its elements, or keys and values of map entries alternately, are read
+// as tokens until Leave.
+func (dec *StreamDecoder) ReadLength() (l int, err error) {
+	defer recoverStream(&err)
+	tok := dec.token()
+	if tok.raw || tok.st == nil {
+		panic(fmt.Errorf("binary.StreamDecoder.ReadLength: next value is not slice/array/map"))
+	}
+	n := 0
+	switch tok.st.kind {
+	case reflect.Slice:
+		l = dec.length()
+		n = l
+	case reflect.Array:
+		l = tok.st.len
+		n = l
+	case reflect.Map:
+		l = dec.length()
+		n = 2 * l
+	default:
+		panic(fmt.Errorf("binary.StreamDecoder.ReadLength: %s is not slice/array/map", tok.st.kind))
+	}
+	dec.enter(tok.st, n)
+	return l, nil
+}
+
+// EnterStruct enter the next value of struct, and returns names of its fields,
+// of which values are read as tokens until Leave.
+func (dec *StreamDecoder) EnterStruct() (fields []string, err error) {
+	defer recoverStream(&err)
+	tok := dec.token()
+	if tok.raw || tok.st == nil || tok.st.kind != reflect.Struct {
+		panic(fmt.Errorf("binary.StreamDecoder.EnterStruct: next value is not struct"))
+	}
+	fields = make([]string, len(tok.st.fields))
+	for i, f := range tok.st.fields {
+		fields[i] = f.name
+	}
+	dec.enter(tok.st, len(fields))
+	return fields, nil
+}
+
+// Leave skip the values not read of the container entered last, and leave it.
+func (dec *StreamDecoder) Leave() (err error) {
+	defer recoverStream(&err)
+	if len(dec.frames) < 2 {
+		panic(fmt.Errorf("binary.StreamDecoder.Leave: not in container"))
+	}
+	for f := &dec.frames[len(dec.frames)-1]; f.i < f.n; {
+		dec.skip()
+	}
+	dec.frames = dec.frames[:len(dec.frames)-1]
+	dec.done()
+	return nil
+}
+
+// Skip skip the next value.
+func (dec *StreamDecoder) Skip() (err error) {
+	defer recoverStream(&err)
+	dec.skip()
+	return nil
+}
+
+func (dec *StreamDecoder) skip() {
+	tok := dec.token()
+	switch {
+	case tok.raw:
+		dec.bytes(1)
+	case tok.st != nil:
+		dec.generic(tok.st)
+	}
+	dec.consume()
+}
+
+// token returns the next token, and read the next message if values of the
+// last one are all read.
+func (dec *StreamDecoder) token() *streamToken {
+	if dec.next != nil {
+		return dec.next
+	}
+	if len(dec.frames) == 0 {
+		dec.frames = append(dec.frames, streamFrame{id: dec.readMessage(), n: 1})
+	}
+	f := &dec.frames[len(dec.frames)-1]
+	if f.i >= f.n {
+		panic(fmt.Errorf("binary.StreamDecoder: no more values in %s, call Leave", f.st.kind))
+	}
+	id := f.idOf(f.i)
+	tok := &streamToken{st: dec.typeOf(id)}
+	if f.st != nil && (f.st.kind == reflect.Slice || f.st.kind == reflect.Array) && id == uint64(reflect.Uint8) {
+		tok.raw = true
+	}
+	for !tok.raw && tok.st != nil { //resolve pointers and interfaces
+		if tok.st.kind == reflect.Ptr {
+			if dec.bytes(1)[0] == 0 {
+				tok.st = nil
+			} else {
+				tok.st = dec.typeOf(tok.st.elem)
+			}
+		} else if tok.st.kind == reflect.Interface {
+			if eid := dec.uvarint(); eid == 0 {
+				tok.st = nil
+			} else {
+				tok.st = dec.typeOf(eid)
+			}
+		} else {
+			break
+		}
+	}
+	dec.next = tok
+	return tok
+}
+
+// consume mark the next token read.
+func (dec *StreamDecoder) consume() {
+	dec.next = nil
+	dec.frames[len(dec.frames)-1].i++
+	dec.done()
+}
+
+// enter consume the next token and enter it as container of n tokens.
+func (dec *StreamDecoder) enter(st *streamType, n int) {
+	if len(dec.frames) > streamMaxDepth {
+		panic(errorf(ErrLimitExceeded, "binary.StreamDecoder: exceeded max depth %d", streamMaxDepth))
+	}
+	dec.next = nil
+	dec.frames[len(dec.frames)-1].i++
+	dec.frames = append(dec.frames, streamFrame{st: st, n: n})
+}
+
+// done finish the message if its value is read.
+func (dec *StreamDecoder) done() {
+	if len(dec.frames) == 1 && dec.frames[0].i == dec.frames[0].n {
+		dec.frames = dec.frames[:0]
+	}
+}
@@ -0,0 +1,135 @@
+// encode/decode strings of a message by a string table, which is emitted once
+// before the message, and strings are encoded as uvarint indexes of the table.
+// Repeated strings such as names of log/event payloads take 1~2 bytes each.
+
+package binary
+
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+// stringTable is the table of strings of a message.
+type stringTable struct {
+	counts map[string]int //times of strings, for collecting strings
+	bytes  int            //bytes of collected strings encoded without table
+	strs   []string       //strings of table, more frequent first
+	index  map[string]int //index of strings in table, for encoding
+	size   int            //bytes of the message encoded with table
+}
+
+// collectStrings encode x without table to count its strings, and returns
+// the table of them.
+func collectStrings(x interface{}, endian Endian, deterministic bool, varint VarintFormat) (*stringTable, error) {
+	buff, err := MakeEncodeBuffer(x, nil)
+	if err != nil {
+		return nil, err
+	}
+	encoder := NewEncoderBuffer(buff)
+	encoder.endian = endian
+	encoder.deterministic = deterministic
+	encoder.varint = varint
+	t := &stringTable{counts: make(map[string]int)}
+	encoder.strs = t
+	if err := encoder.Value(x); err != nil {
+		return nil, err
+	}
+
+	t.strs = make([]string, 0, len(t.counts))
+	for s := range t.counts {
+		t.strs = append(t.strs, s)
+	}
+	sort.Slice(t.strs, func(i, j int) bool { //the same table for any order of map iteration
+		ci, cj := t.counts[t.strs[i]], t.counts[t.strs[j]]
+		return ci > cj || ci == cj && t.strs[i] < t.strs[j]
+	})
+
+	t.index = make(map[string]int, len(t.strs))
+	t.size = encoder.Len() - t.bytes + SizeofUvarint(uint64(len(t.strs)))
+	for i, s := range t.strs {
+		t.index[s] = i
+		t.size += sizeofString(len(s)) + t.counts[s]*SizeofUvarint(uint64(i))
+	}
+	t.counts = nil
+	return t, nil
+}
+
+// valueTable encode table t and then x with strings of x as indexes of t.
+func (encoder *Encoder) valueTable(x interface{}, t *stringTable) error {
+	encoder.strs = t
+	defer func() {
+		encoder.strs = nil
+	}()
+	if err := encoder.table(t); err != nil {
+		return err
+	}
+	return encoder.Value(x)
+}
+
+// table encode strings of table t.
+func (encoder *Encoder) table(t *stringTable) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e, "binary.Encoder")
+		}
+	}()
+	encoder.Uvarint(uint64(len(t.strs)))
+	for _, s := range t.strs {
+		encoder.Uvarint(uint64(len(s)))
+		copy(encoder.reserve(len(s)), s)
+	}
+	return nil
+}
+
+// tableString encode x by string table, and reports false if it is not on.
+// Strings are counted instead if the table is collecting.
+func (encoder *Encoder) tableString(x string, field *fieldInfo) bool {
+	t := encoder.strs
+	if t == nil {
+		return false
+	}
+	if t.index == nil { //collecting
+		pos := encoder.pos
+		encoder.length(len(x), field)
+		copy(encoder.reserve(len(x)), x)
+		t.counts[x]++
+		t.bytes += encoder.pos - pos
+		return true
+	}
+	i, ok := t.index[x]
+	assert(ok, "binary.Encoder: string not in table: "+x) //I'm sure all strings has been collected
+	encoder.Uvarint(uint64(i))
+	return true
+}
+
+// beginTable decode the string table of a value if SetStringTable is on.
+func (decoder *Decoder) beginTable() {
+	if !decoder.useTable {
+		return
+	}
+	n := decoder.allocLength(nil, int(unsafe.Sizeof("")))
+	t := &stringTable{strs: make([]string, n)}
+	for i := range t.strs {
+		t.strs[i] = decoder.string(nil)
+	}
+	decoder.strs = t
+}
+
+// endTable drop the string table of a value.
+func (decoder *Decoder) endTable() {
+	decoder.strs = nil
+}
+
+// tableString decode a string by string table, and reports false if it is not on.
+func (decoder *Decoder) tableString() (string, bool) {
+	t := decoder.strs
+	if t == nil {
+		return "", false
+	}
+	i, _ := decoder.Uvarint()
+	if i >= uint64(len(t.strs)) {
+		panic(fmt.Errorf("binary.Decoder: invalid string index %d of %d strings", i, len(t.strs)))
+	}
+	return t.strs[i], true
+}
@@ -5,6 +5,8 @@ package binary
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 // RegStruct regist struct info to improve encoding/decoding efficiency.
@@ -31,8 +33,10 @@ func (mgr *structInfoMgr) regist(t reflect.Type) error {
 	if _t, _, err := mgr.deepStructType(t, true); err == nil {
 		if mgr.query(_t) == nil {
 			p := &structInfo{}
-			if p.parse(_t) {
-				mgr.reg[p.identify] = p
+			mgr.reg[_t.String()] = p //regist before parse to deal with recursive types
+			if err := p.parse(_t); err != nil {
+				delete(mgr.reg, _t.String())
+				return err
 			}
 		} else {
 			return fmt.Errorf("binary: regist duplicate type %s", _t.String())
@@ -69,74 +73,246 @@ func (mgr *structInfoMgr) deepStructType(t reflect.Type, needErr bool) (reflect.
 
 //informatin of a struct
 type structInfo struct {
-	identify string //reflect.Type.String()
-	fields   []*fieldInfo
+	identify   string //reflect.Type.String()
+	fields     []*fieldInfo
+	version    int          //version of field tag `binary:"version=N"`, 0 means not versioned
+	migrations []*migration //migrations from old versions, sorted by versions
+	ids        map[int]int  //indexes of fields by ids of tagged struct, nil means not tagged
+	order      []int        //indexes of fields in encoding order, nil means declaration order
+	hasDefault bool         //if any field has default value
+	unexported bool         //if unexported fields are encoded, by field tag `binary:"unexported"`
 }
 
 func (info *structInfo) encode(encoder *Encoder, v reflect.Value) error {
 	//assert(v.Kind() == reflect.Struct, v.Type().String())
+	if codec := encoder.codecs.find(v.Type()); codec != nil { //overrided codec of compiled fields and elements
+		return codec.encode(encoder, v, nil)
+	}
+	v = info.addressable(v)
+	if err := beforeEncode(v); err != nil {
+		return err
+	}
 	t := v.Type()
-	for i, n := 0, v.NumField(); i < n; i++ {
+	start := encoder.pos
+	if version := info.versionOf(); version > 0 {
+		encoder.Uvarint(uint64(version))
+	}
+	if info.isTagged() {
+		return info.encodeTagged(encoder, v)
+	}
+	for j, n := 0, v.NumField(); j < n; j++ {
 		// see comment for corresponding code in decoder.value()
+		i := info.index(j)
 		finfo := info.field(i)
-		if f := v.Field(i); finfo.isValid(i, t) {
-			if err := encoder.value(f, finfo.isPacked()); err != nil {
+		if f := info.fieldOf(v, i); finfo.isValid(i, t) {
+			encoder.padToOffset(start, finfo)
+			endian := encoder.endian
+			encoder.endian = finfo.endianOf(endian)
+			fstart := encoder.pos
+			var err error
+			if finfo != nil && finfo.encode != nil { //compiled by RegStruct
+				err = finfo.encode(encoder, f)
+			} else {
+				err = encoder.value(f, finfo)
+			}
+			encoder.endian = endian
+			if err != nil {
 				return err
 			}
+			encoder.traceField(t, i, fstart)
 		}
 	}
 	return nil
 }
 
 func (info *structInfo) decode(decoder *Decoder, v reflect.Value) error {
+	if codec := decoder.codecs.find(v.Type()); codec != nil { //overrided codec of compiled fields and elements
+		return codec.decode(decoder, v, nil)
+	}
+	start := decoder.pos
+	version := info.versionOf()
+	if version > 0 {
+		version, _ = decoder.version()
+	}
+	if err := info.decodeVersion(decoder, v, version, start); err != nil {
+		return err
+	}
+	return afterDecode(v)
+}
+
+// decodeVersion decode struct v of which encoding is version from start,
+// and migrate it if version is not current.
+func (info *structInfo) decodeVersion(decoder *Decoder, v reflect.Value, version, start int) error {
+	if version != info.versionOf() {
+		return info.migrate(decoder, v, version, start)
+	}
+	if info.isTagged() {
+		return info.decodeTagged(decoder, v, nil)
+	}
 	t := v.Type()
 	//assert(t.Kind() == reflect.Struct, t.String())
-	for i, n := 0, v.NumField(); i < n; i++ {
+	i := -1 //field being decoded, to locate errors of panics
+	defer func() { decoder.unwind(recover(), t, i, true) }()
+	for j, n := 0, v.NumField(); j < n; j++ {
+		i = info.index(j)
 		finfo := info.field(i)
-		if f := v.Field(i); finfo.isValid(i, t) {
-			if err := decoder.value(f, false, finfo.isPacked()); err != nil {
-				return err
+		if f := info.fieldOf(v, i); finfo.isValid(i, t) {
+			decoder.skipToOffset(start, finfo)
+			endian := decoder.endian
+			decoder.endian = finfo.endianOf(endian)
+			fstart := decoder.pos
+			var err error
+			if finfo != nil && finfo.decode != nil && decoder.maxDepth == 0 { //compiled by RegStruct, no depth to check
+				err = finfo.decode(decoder, f)
+			} else {
+				err = decoder.value(f, false, finfo)
 			}
+			decoder.endian = endian
+			if err != nil {
+				return decoder.fieldError(err, t, i)
+			}
+			decoder.traceField(t, i, fstart)
+		}
+	}
+	return nil
+}
+
+// decodeFields decode the fields with names only, and skip the other fields.
+func (info *structInfo) decodeFields(decoder *Decoder, v reflect.Value, names map[string]bool) error {
+	t := v.Type()
+	for name := range names {
+		if f, ok := t.FieldByName(name); !ok || len(f.Index) != 1 || !info.fieldValid(f.Index[0], t) {
+			return fmt.Errorf("binary.Decoder.ValueFields: %s has no field %s", t.String(), name)
+		}
+	}
+	start := decoder.pos
+	if version := info.versionOf(); version > 0 {
+		if got, _ := decoder.version(); got != version { //decode all fields by migration
+			return info.migrate(decoder, v, got, start)
+		}
+	}
+	if info.isTagged() {
+		return info.decodeTagged(decoder, v, names)
+	}
+	i := -1 //field being decoded, to locate errors of panics
+	defer func() { decoder.unwind(recover(), t, i, true) }()
+	for j, n := 0, v.NumField(); j < n; j++ {
+		i = info.index(j)
+		finfo := info.field(i)
+		if !finfo.isValid(i, t) {
+			continue
+		}
+		decoder.skipToOffset(start, finfo)
+		endian := decoder.endian
+		decoder.endian = finfo.endianOf(endian)
+		fstart := decoder.pos
+		var err error
+		if names[t.Field(i).Name] {
+			err = decoder.value(info.fieldOf(v, i), false, finfo)
+		} else {
+			decoder.skipByType(finfo.Type(i, t), finfo)
+		}
+		decoder.endian = endian
+		if err != nil {
+			return decoder.fieldError(err, t, i)
+		}
+		if names[t.Field(i).Name] {
+			decoder.traceField(t, i, fstart)
 		}
 	}
 	return nil
 }
 
-func (info *structInfo) decodeSkipByType(decoder *Decoder, t reflect.Type, packed bool) int {
+func (info *structInfo) decodeSkipByType(decoder *Decoder, t reflect.Type) int {
+	start := decoder.pos
+	if info.versionOf() > 0 {
+		version, n := decoder.version()
+		return n + info.skipVersion(decoder, t, version, start)
+	}
+	return info.skipFields(decoder, t, start)
+}
+
+// skipFields skip fields of struct t beginning at start, and returns bytes skiped.
+func (info *structInfo) skipFields(decoder *Decoder, t reflect.Type, start int) int {
 	//assert(t.Kind() == reflect.Struct, t.String())
+	if info.isTagged() {
+		return decoder.skipTagged()
+	}
 	sum := 0
-	for i, n := 0, t.NumField(); i < n; i++ {
+	for j, n := 0, t.NumField(); j < n; j++ {
+		i := info.index(j)
 		f := info.field(i)
+		if !f.isValid(i, t) {
+			continue
+		}
+		sum += decoder.skipToOffset(start, f)
 		ft := f.Type(i, t)
-		s := decoder.skipByType(ft, f.isPacked())
+		endian := decoder.endian
+		decoder.endian = f.endianOf(endian)
+		s := decoder.skipByType(ft, f)
+		decoder.endian = endian
 		assert(s >= 0, "skip struct field fail:"+ft.String()) //I'm sure here cannot find unsupported type
 		sum += s
 	}
 	return sum
 }
 
-func (info *structInfo) bitsOfValue(v reflect.Value) int {
+func (info *structInfo) bitsOfValue(v reflect.Value, vis *ptrVisitor) int {
 	t := v.Type()
 	//assert(t.Kind() == reflect.Struct,t.String())
+	if codec := vis.codecs.find(t); codec != nil { //overrided codec of elements
+		if s := codec.size(v, nil); s >= 0 {
+			return s * 8
+		}
+		return -1
+	}
+	v = info.addressable(v)
+	beforeEncode(v) //state to encode, error is reported by encoding
 	sum := 0
-	for i, n := 0, v.NumField(); i < n; i++ {
-
+	if version := info.versionOf(); version > 0 {
+		sum = SizeofUvarint(uint64(version)) * 8
+	}
+	if info.isTagged() {
+		if s := info.bitsOfTagged(v, vis); s >= 0 {
+			return sum + s
+		}
+		return -1
+	}
+	for j, n := 0, v.NumField(); j < n; j++ {
+		i := info.index(j)
 		if finfo := info.field(i); finfo.isValid(i, t) {
-			if s := bitsOfValue(v.Field(i), false, finfo.isPacked()); s >= 0 {
-				sum += s
+			if offset := finfo.offsetOf(); sum < offset*8 { //padding
+				sum = offset * 8
+			}
+			s := 0
+			if finfo != nil && finfo.size != nil { //compiled by RegStruct
+				s = finfo.size(info.fieldOf(v, i), vis)
 			} else {
+				s = bitsOfValue(info.fieldOf(v, i), false, finfo, vis)
+			}
+			if s < 0 {
 				return -1 //invalid field type
 			}
+			sum += s
 		}
 	}
 	return sum
 }
 
-func (info *structInfo) sizeofNilPointer(t reflect.Type) int {
+func (info *structInfo) sizeofNilPointer(t reflect.Type, visiting map[reflect.Type]bool) int {
 	sum := 0
+	if version := info.versionOf(); version > 0 {
+		sum = SizeofUvarint(uint64(version))
+	}
 	for i, n := 0, info.fieldNum(t); i < n; i++ {
 		if info.fieldValid(i, t) {
-			if s := sizeofNilPointer(info.field(i).Type(i, t)); s >= 0 {
+			s := 0
+			if f := info.field(i); f != nil && f.flat != nil { //flattened embedded struct
+				s = f.flat.sizeofNilPointer(f.Type(i, t), visiting)
+			} else {
+				s = sizeofNilPointerOf(info.field(i).Type(i, t), visiting)
+			}
+			if s >= 0 {
 				sum += s
 			} else {
 				return -1 //invalid field type
@@ -159,17 +335,30 @@ func (info *structInfo) fieldNum(t reflect.Type) int {
 	return info.numField()
 }
 
-func (info *structInfo) parse(t reflect.Type) bool {
+func (info *structInfo) parse(t reflect.Type) error {
 	//assert(t.Kind() == reflect.Struct, t.String())
 	info.identify = t.String()
+	info.unexported = declaresUnexported(t)
+	tagged := false
 	for i, n := 0, t.NumField(); i < n; i++ {
 		f := t.Field(i)
 
-		field := &fieldInfo{}
+		field := &fieldInfo{offset: -1}
 		field.field = f
-		tag := f.Tag.Get("binary")
-		field.ignore = !isExported(f.Name) || tag == "ignore"
-		field.packed = tag == "packed"
+		if err := field.parseTag(f.Tag.Get("binary")); err != nil {
+			return err
+		}
+		field.ignore = field.ignore || f.Name == "_" || !info.unexported && !isExported(f.Name)
+		if field.flatten && !field.ignore {
+			if err := field.parseFlatten(); err != nil {
+				return err
+			}
+		}
+		if field.version > 0 {
+			info.version = field.version
+		}
+		tagged = tagged || field.tagged
+		info.hasDefault = info.hasDefault || field.def.IsValid()
 
 		info.fields = append(info.fields, field)
 
@@ -181,7 +370,29 @@ func (info *structInfo) parse(t reflect.Type) bool {
 			}
 		}
 	}
-	return true
+	if tagged {
+		for _, field := range info.fields {
+			if field.flat != nil {
+				return fmt.Errorf("binary: unsupported tag option flatten of field %s in tagged struct %s", field.field.Name, t.String())
+			}
+		}
+		if err := info.parseTagged(t); err != nil {
+			return err
+		}
+	}
+	if err := info.parseOrder(t); err != nil {
+		return err
+	}
+	for _, field := range info.fields {
+		if !field.ignore {
+			field.lookupCodecs(field.field.Type)
+			if field.elem != nil { //elements of nolen field
+				field.elem.codecs = field.codecs
+			}
+			field.compile(field.field.Type)
+		}
+	}
+	return nil
 }
 
 func (info *structInfo) field(i int) *fieldInfo {
@@ -200,9 +411,153 @@ func (info *structInfo) numField() int {
 
 //informatin of a struct field
 type fieldInfo struct {
-	field  reflect.StructField
-	ignore bool //if this field is ignored
-	packed bool //if this ints field encode as varint/uvarint
+	field     reflect.StructField
+	ignore    bool   //if this field is ignored
+	packed    bool   //if this ints field encode as varint/uvarint
+	fixed     bool   //if this int/uint field encode as fixed 8 bytes
+	text      bool   //if this field encode as encoding.TextMarshaler
+	unixNano  bool   //if this time.Time field encode as int64 unix nanoseconds
+	nilable   bool   //if this slice/map field encode a bool bit to keep nil
+	columnar  bool   //if this slice/array of structs field encode field by field
+	delta     bool   //if this slice/array of ints field encode varint deltas of elements
+	float16   bool   //if this float field encode as half precision float
+	noZigzag  bool   //if this signed varint field encode as plain two's complement uvarint
+	groupVar  bool   //if this slice/array of int32/uint32 field encode as group varints
+	runes     bool   //if this slice/array of int32 field encode as UTF-8 text
+	noLen     bool   //if this slice/string field encode without length prefix
+	zigzag    bool   //if this signed field encode as protobuf sint32/sint64
+	bits      int    //bits of this int/uint field shared with bools, 0 means not
+	offset    int    //offset of this field in struct encoding, -1 means not specified
+	lenPrefix int    //bytes of length prefix, 0 means uvarint
+	version   int    //version of the struct declared by this field, 0 means not declared
+	tagged    bool   //if the struct is declared as tagged by this field
+	flatten   bool   //if this embedded struct field is laid out as fields of the parent
+	id        int    //id of this field in tagged struct, 0 means position of field
+	pbNum     int    //protobuf field number, 0 means not encoded in protobuf format
+	cborKey   *int64 //integer key of this field in CBOR maps, nil means field name
+	endian    Endian //endian of this field, nil means endian of coder
+
+	def  reflect.Value //default value of this field when it is absent, invalid means zero value
+	elem *fieldInfo    //field info of elements of nolen field, with length prefix
+	flat *structInfo   //info of flattened embedded struct, nil means not flattened
+
+	codecs []fieldCodec //codecs of type of this field and its elements, looked up by parse
+
+	encode fieldEncoder //compiled encoder of this field, nil means reflect path
+	decode fieldDecoder //compiled decoder of this field, nil means reflect path
+	size   fieldSizer   //compiled size of this field, nil means bitsOfValue
+}
+
+// parseTag parse options of field tag `binary:"opt1,opt2=value"`.
+// Unknown options are ignored.
+func (field *fieldInfo) parseTag(tag string) error {
+	for _, opt := range strings.Split(tag, ",") {
+		name, value := opt, ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			name, value = opt[:i], opt[i+1:]
+		}
+		switch name {
+		case "ignore":
+			field.ignore = true
+		case "packed":
+			field.packed = true
+		case "fixed":
+			field.fixed = true
+		case "text":
+			field.text = true
+		case "unixnano":
+			field.unixNano = true
+		case "nilable":
+			field.nilable = true
+		case "columnar":
+			field.columnar = true
+		case "delta":
+			field.delta = true
+		case "float16":
+			field.float16 = true
+		case "nozigzag":
+			field.noZigzag = true
+		case "groupvarint":
+			field.groupVar = true
+		case "runes":
+			field.runes = true
+		case "nolen":
+			if err := checkNoLen(field.field.Type); err != nil {
+				return err
+			}
+			field.noLen = true
+		case "bits":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 64 {
+				return fmt.Errorf("binary: invalid tag option %s=%s of field %s", name, value, field.field.Name)
+			}
+			field.bits = n
+		case "offset":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("binary: invalid tag option %s=%s of field %s", name, value, field.field.Name)
+			}
+			field.offset = n
+		case "version":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("binary: invalid tag option %s=%s of field %s", name, value, field.field.Name)
+			}
+			field.version = n
+		case "default":
+			if err := field.parseDefault(value); err != nil {
+				return err
+			}
+		case "tagged":
+			field.tagged = true
+		case "unexported": //declared by struct, see declaresUnexported
+		case "flatten":
+			field.flatten = true
+		case "id":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("binary: invalid tag option %s=%s of field %s", name, value, field.field.Name)
+			}
+			field.id = n
+		case "zigzag":
+			field.zigzag = true
+		case "pb":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 1<<29-1 {
+				return fmt.Errorf("binary: invalid tag option %s=%s of field %s", name, value, field.field.Name)
+			}
+			field.pbNum = n
+		case "cbor":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("binary: invalid tag option %s=%s of field %s", name, value, field.field.Name)
+			}
+			field.cborKey = &n
+		case "big":
+			field.endian = BigEndian
+		case "little":
+			field.endian = LittleEndian
+		case "lenprefix":
+			switch value {
+			case "uvarint":
+				field.lenPrefix = 0
+			case "uint8":
+				field.lenPrefix = 1
+			case "uint16":
+				field.lenPrefix = 2
+			case "uint32":
+				field.lenPrefix = 4
+			default:
+				return fmt.Errorf("binary: invalid tag option %s=%s of field %s", name, value, field.field.Name)
+			}
+		}
+	}
+	if field.noLen { //elements keep length prefix
+		elem := *field
+		elem.noLen = false
+		field.elem = &elem
+	}
+	return nil
 }
 
 func (field *fieldInfo) Type(i int, t reflect.Type) reflect.Type {
@@ -228,6 +583,106 @@ func (field *fieldInfo) isPacked() bool {
 	return field != nil && field.packed
 }
 
+func (field *fieldInfo) isFixed() bool {
+	return field != nil && field.fixed
+}
+
+func (field *fieldInfo) isText() bool {
+	return field != nil && field.text
+}
+
+func (field *fieldInfo) isUnixNano() bool {
+	return field != nil && field.unixNano
+}
+
+func (field *fieldInfo) isNilable() bool {
+	return field != nil && field.nilable
+}
+
+func (field *fieldInfo) isColumnar() bool {
+	return field != nil && field.columnar
+}
+
+func (field *fieldInfo) isDelta() bool {
+	return field != nil && field.delta
+}
+
+func (field *fieldInfo) isGroupVarint() bool {
+	return field != nil && field.groupVar
+}
+
+func (field *fieldInfo) isRunes() bool {
+	return field != nil && field.runes
+}
+
+func (field *fieldInfo) isNoLen() bool {
+	return field != nil && field.noLen
+}
+
+// elemField returns field info of elements of slice/array field.
+func (field *fieldInfo) elemField() *fieldInfo {
+	if field.isNoLen() {
+		return field.elem
+	}
+	return field
+}
+
+func (field *fieldInfo) isFloat16() bool {
+	return field != nil && field.float16
+}
+
+// isPlainVarint reports whether signed int of kind k is encoded as plain
+// two's complement uvarint instead of zigzag varint.
+func (field *fieldInfo) isPlainVarint(k reflect.Kind) bool {
+	if field == nil || !field.noZigzag {
+		return false
+	}
+	switch k {
+	case reflect.Int:
+		return !field.fixed
+	case reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.packed
+	}
+	return false
+}
+
+// endianOf returns endian of this field, or def if it is not specified.
+func (field *fieldInfo) endianOf(def Endian) Endian {
+	if field != nil && field.endian != nil {
+		return field.endian
+	}
+	return def
+}
+
+// lenPrefixSize returns bytes of length prefix, 0 means uvarint.
+func (field *fieldInfo) lenPrefixSize() int {
+	if field != nil {
+		return field.lenPrefix
+	}
+	return 0
+}
+
+// sizeofLen returns bytes number of length l encoded as length prefix of this field.
+func (field *fieldInfo) sizeofLen(l int) int {
+	if field.isNoLen() {
+		return 0
+	}
+	if s := field.lenPrefixSize(); s > 0 {
+		return s
+	}
+	return SizeofUvarint(uint64(l))
+}
+
 func queryStruct(t reflect.Type) *structInfo {
 	return _structInfoMgr.query(t)
 }
+
+// queryStructElem returns info of registed struct t, which is element type of
+// slice/array, to encode/decode elements without dispatching by value.
+// It returns nil if t is not a registed struct or it has special codec.
+func queryStructElem(t reflect.Type, field *fieldInfo) *structInfo {
+	if t.Kind() != reflect.Struct || queryCodec(t, field) != nil {
+		return nil
+	}
+	return queryStruct(t)
+}
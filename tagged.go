@@ -0,0 +1,175 @@
+// encode fields of structs with ids and lengths for field tag `binary:"tagged"`,
+// so decoders skip fields they don't know and old binaries tolerate values
+// encoded by newer struct definitions.
+//
+// A tagged struct is declared by field tag `binary:"tagged"` of any field, as
+//
+//	type Message struct {
+//		_    struct{} `binary:"tagged"`
+//		Name string   `binary:"id=1"`
+//		Tags []string `binary:"id=2"`
+//	}
+//
+// It is encoded as uvarint number of fields, and uvarint id, uvarint length
+// and value of each field in order of ids. Id of a field is specified by field
+// tag `binary:"id=N"`, or its position in struct from 1 if not, so fields
+// should be appended or given ids to keep ids of the others.
+// Fields of unknown ids are skiped by decoders, and missing fields are left
+// as they are. Field tag `binary:"offset=N"` is not supported in tagged
+// structs, and elements of field tag `binary:"columnar"` are not tagged.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// parseTagged assign ids of fields of tagged struct t.
+func (info *structInfo) parseTagged(t reflect.Type) error {
+	info.ids = make(map[int]int)
+	for i, field := range info.fields {
+		if field.id == 0 {
+			field.id = i + 1
+		}
+		if field.ignore {
+			continue
+		}
+		if field.offset >= 0 {
+			return fmt.Errorf("binary: field offset of %s.%s is not supported in tagged struct", t.String(), field.field.Name)
+		}
+		info.ids[field.id] = i
+	}
+	return nil
+}
+
+// isTagged reports whether the struct is tagged.
+func (info *structInfo) isTagged() bool {
+	return info != nil && info.ids != nil
+}
+
+// sizeofTagged returns bytes number of field f of tagged struct, or -1 if invalid.
+func sizeofTagged(f reflect.Value, field *fieldInfo, vis *ptrVisitor) int {
+	bits := bitsOfValue(f, false, field, vis)
+	if bits < 0 {
+		return -1
+	}
+	return (bits + 7) / 8 //bools of field are packed in its bytes
+}
+
+// encodeTagged encode fields of tagged struct v with ids and lengths.
+func (info *structInfo) encodeTagged(encoder *Encoder, v reflect.Value) error {
+	t := v.Type()
+	encoder.Uvarint(uint64(len(info.ids)))
+	for j, n := 0, v.NumField(); j < n; j++ {
+		i := info.index(j)
+		finfo := info.fields[i]
+		if finfo.ignore {
+			continue
+		}
+		f := info.fieldOf(v, i)
+		size := sizeofTagged(f, finfo, &ptrVisitor{})
+		if size < 0 {
+			return errorf(ErrUnsupportedType, "binary.Encoder.Value: unsupported type %s", f.Type().String())
+		}
+		encoder.Uvarint(uint64(finfo.id))
+		encoder.Uvarint(uint64(size))
+
+		sub := *encoder //encode field by its bytes, with its own bools
+		sub.traceBase += encoder.pos
+		sub.buff, sub.pos = encoder.reserve(size), 0
+		sub.growth = nil
+		sub.resetBoolCoder()
+		sub.endian = finfo.endianOf(encoder.endian)
+		err := sub.value(f, finfo)
+		encoder.visitor = sub.visitor
+		if err != nil {
+			return err
+		}
+		if sub.pos != size {
+			return fmt.Errorf("binary.Encoder.Value: field %s of %s is encoded as %d bytes, but sized %d",
+				finfo.field.Name, t.String(), sub.pos, size)
+		}
+		encoder.traceField(t, i, encoder.pos-size)
+	}
+	return nil
+}
+
+// decodeTagged decode fields of tagged struct v with names, or all fields
+// if names is nil, and skip the other fields.
+func (info *structInfo) decodeTagged(decoder *Decoder, v reflect.Value, names map[string]bool) error {
+	t := v.Type()
+	info.setDefaults(v, names)
+	located := -1 //field being decoded, to locate errors of panics
+	defer func() { decoder.unwind(recover(), t, located, true) }()
+	n, _ := decoder.taggedUvarint()
+	for j := 0; j < n; j++ {
+		id, _ := decoder.taggedUvarint()
+		size, _ := decoder.taggedUvarint()
+		b := decoder.reserve(decoder.checkLen(size))
+		i, ok := info.ids[id]
+		if !ok || names != nil && !names[t.Field(i).Name] { //unknown field
+			continue
+		}
+		finfo := info.fields[i]
+
+		sub := *decoder //decode field from its bytes, with its own bools
+		sub.reader = nil
+		sub.traceBase += decoder.pos - size
+		if decoder.reader != nil { //no offsets of reader
+			sub.tracer = nil
+		}
+		sub.buff, sub.pos = b, 0
+		sub.resetBoolCoder()
+		sub.endian = finfo.endianOf(decoder.endian)
+		located = i
+		err := sub.value(info.fieldOf(v, i), false, finfo)
+		decoder.allocated = sub.allocated
+		if err != nil {
+			return decoder.fieldError(err, t, i)
+		}
+		located = -1
+		decoder.traceField(t, i, decoder.pos-size)
+	}
+	return nil
+}
+
+// skipTagged skip fields of tagged struct, and returns bytes skiped.
+func (decoder *Decoder) skipTagged() int {
+	n, sum := decoder.taggedUvarint()
+	for j := 0; j < n; j++ {
+		_, s1 := decoder.taggedUvarint() //id
+		size, s2 := decoder.taggedUvarint()
+		decoder.reserve(decoder.checkLen(size))
+		sum += s1 + s2 + size
+	}
+	return sum
+}
+
+// bitsOfTagged returns bits number of tagged struct v, or -1 if invalid.
+func (info *structInfo) bitsOfTagged(v reflect.Value, vis *ptrVisitor) int {
+	sum := SizeofUvarint(uint64(len(info.ids)))
+	for j, n := 0, v.NumField(); j < n; j++ {
+		i := info.index(j)
+		finfo := info.fields[i]
+		if finfo.ignore {
+			continue
+		}
+		size := sizeofTagged(info.fieldOf(v, i), finfo, vis)
+		if size < 0 {
+			return -1
+		}
+		sum += SizeofUvarint(uint64(finfo.id)) + SizeofUvarint(uint64(size)) + size
+	}
+	return sum * 8
+}
+
+// taggedUvarint decode uvarint count, id or length of tagged struct,
+// and returns it with bytes decoded.
+func (decoder *Decoder) taggedUvarint() (int, int) {
+	x, n := decoder.Uvarint()
+	if n <= 0 || x > uint64(maxInt) {
+		panic(errorf(ErrOverflow, "binary.Decoder.Value: invalid uvarint %d of tagged struct", x))
+	}
+	return int(x), n
+}
@@ -0,0 +1,154 @@
+package binary
+
+import (
+	"reflect"
+	"time"
+)
+
+func init() {
+	_builtinCodecs[reflect.TypeOf(time.Time{})] = &timeCodec
+	_builtinCodecs[reflect.TypeOf(time.Duration(0))] = &durationCodec
+}
+
+// timeUTC is flag of time.Time encoded by Encoder.Time in UTC, without zone
+// offset.
+const timeUTC = 1
+
+// sizeofTime returns size of x encoded by Encoder.Time.
+func sizeofTime(x time.Time) int {
+	size := 1 + 8 + 4 //flags, unix seconds and nanoseconds
+	if x.Location() != time.UTC {
+		size += 4 //zone offset
+	}
+	return size
+}
+
+// Time encode a time.Time value to Encoder buffer.
+// It is encoded as flags(uint8), unix seconds(int64), nanoseconds(uint32),
+// and zone offset in seconds(int32) if it is not in UTC.
+// Monotonic clock reading is not encoded.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Time(x time.Time) {
+	utc := x.Location() == time.UTC
+	flags := uint8(0)
+	if utc {
+		flags |= timeUTC
+	}
+	encoder.Uint8(flags)
+	encoder.Int64(x.Unix(), false)
+	encoder.Uint32(uint32(x.Nanosecond()), false)
+	if !utc {
+		_, offset := x.Zone()
+		encoder.Int32(int32(offset), false)
+	}
+}
+
+// Time decode a time.Time value from Decoder buffer.
+// Time in UTC is decoded in time.UTC, and the others in time.FixedZone of
+// the encoded zone offset without zone name, even if it was time.Local.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) Time() time.Time {
+	flags := decoder.Uint8()
+	sec := decoder.Int64(false)
+	nsec := decoder.Uint32(false)
+	t := time.Unix(sec, int64(nsec))
+	if flags&timeUTC != 0 {
+		return t.UTC()
+	}
+	return t.In(time.FixedZone("", int(decoder.Int32(false))))
+}
+
+// skipTime skip a time.Time value encoded by Encoder.Time, and returns bytes
+// number skiped.
+func (decoder *Decoder) skipTime() int {
+	size := 1 + 8 + 4
+	if decoder.Uint8()&timeUTC == 0 {
+		size += 4
+	}
+	decoder.Skip(size - 1)
+	return size
+}
+
+// time.Time is encoded by Encoder.Time,
+// or as int64 unix nanoseconds with field tag `binary:"unixnano"`.
+var timeCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		if field.isUnixNano() {
+			return 8
+		}
+		return sizeofTime(v.Interface().(time.Time))
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		x := v.Interface().(time.Time)
+		if field.isUnixNano() {
+			encoder.Int64(x.UnixNano(), false)
+		} else {
+			encoder.Time(x)
+		}
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		if field.isUnixNano() {
+			v.Set(reflect.ValueOf(time.Unix(0, decoder.Int64(false)).UTC()))
+		} else {
+			v.Set(reflect.ValueOf(decoder.Time()))
+		}
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		if field.isUnixNano() {
+			decoder.Skip(8)
+			return 8
+		}
+		return decoder.skipTime()
+	},
+}
+
+// Duration encode a time.Duration value to Encoder buffer as varint nanoseconds.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Duration(x time.Duration) {
+	encoder.Varint(int64(x))
+}
+
+// Duration decode a time.Duration value from Decoder buffer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) Duration() time.Duration {
+	x, _ := decoder.Varint()
+	return time.Duration(x)
+}
+
+// time.Duration is encoded by Encoder.Duration,
+// or as fixed 8 bytes with field tag `binary:"fixed"`.
+var durationCodec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		if field.isFixed() {
+			return 8
+		}
+		return SizeofVarint(v.Int())
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		if field.isFixed() {
+			encoder.Int64(v.Int(), false)
+		} else {
+			encoder.Varint(v.Int())
+		}
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		if field.isFixed() {
+			v.SetInt(decoder.Int64(false))
+		} else {
+			x, _ := decoder.Varint()
+			v.SetInt(x)
+		}
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		if field.isFixed() {
+			decoder.Skip(8)
+			return 8
+		}
+		_, n := decoder.Uvarint()
+		return n
+	},
+}
@@ -0,0 +1,137 @@
+// tag-length-value records for extensible binary protocols, in which
+// receivers skip records of tags they don't know.
+// A record is encoded as uvarint tag, uvarint length and value bytes.
+
+package binary
+
+import (
+	"fmt"
+)
+
+// SizeofTLV returns bytes number of TLV record of tag with value of n bytes.
+func SizeofTLV(tag uint64, n int) int {
+	return SizeofUvarint(tag) + SizeofUvarint(uint64(n)) + n
+}
+
+// TLV encode a tag-length-value record to Encoder buffer.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) TLV(tag uint64, value []byte) {
+	encoder.Uvarint(tag)
+	encoder.Bytes(value)
+}
+
+// TLV decode a tag-length-value record from Decoder buffer.
+// The value refers to the buffer.
+// It will panic if buffer is not enough or the record is invalid.
+func (decoder *Decoder) TLV() (tag uint64, value []byte) {
+	tag, n := decoder.Uvarint()
+	if n <= 0 {
+		panic(fmt.Errorf("binary.Decoder.TLV: invalid tag"))
+	}
+	l, _ := decoder.length(nil)
+	return tag, decoder.reserve(l)
+}
+
+// TLVWriter append tag-length-value records to a buffer.
+// The zero value is an empty writer ready to use.
+type TLVWriter struct {
+	buff []byte
+}
+
+// NewTLVWriter returns a TLVWriter which appends records to buffer.
+func NewTLVWriter(buffer []byte) *TLVWriter {
+	return &TLVWriter{buff: buffer}
+}
+
+// Append append a record of tag and value.
+func (w *TLVWriter) Append(tag uint64, value []byte) {
+	w.buff = AppendUvarint(w.buff, tag)
+	w.buff = AppendUvarint(w.buff, uint64(len(value)))
+	w.buff = append(w.buff, value...)
+}
+
+// AppendValue append a record of tag and data encoded as Encode.
+func (w *TLVWriter) AppendValue(tag uint64, data interface{}) error {
+	size := Sizeof(data)
+	if size < 0 {
+		_, err := MakeEncodeBuffer(data, nil) //error of invalid data
+		return err
+	}
+	encoder := NewEncoderBuffer(make([]byte, size))
+	if err := encoder.Value(data); err != nil {
+		return err
+	}
+	w.Append(tag, encoder.Buffer())
+	return nil
+}
+
+// Bytes returns the records appended.
+func (w *TLVWriter) Bytes() []byte {
+	return w.buff
+}
+
+// Reset remove all records and keep the buffer to append again.
+func (w *TLVWriter) Reset() {
+	w.buff = w.buff[:0]
+}
+
+// TLVReader iterate tag-length-value records of a buffer, as
+//
+//	r := NewTLVReader(buffer)
+//	for r.Next() {
+//		switch r.Tag() {
+//		case tagName:
+//			name = string(r.Value())
+//		case tagPoint:
+//			err = r.Decode(&point)
+//		} //records of unknown tags are skiped
+//	}
+//	if err := r.Err(); err != nil {...}
+type TLVReader struct {
+	decoder Decoder
+	tag     uint64
+	value   []byte
+	err     error
+}
+
+// NewTLVReader returns a TLVReader of records in buffer.
+func NewTLVReader(buffer []byte) *TLVReader {
+	r := &TLVReader{}
+	r.decoder.Init(buffer, DefaultEndian)
+	return r
+}
+
+// Next read the next record, and reports whether there is one.
+// It returns false at end of buffer or if the record is invalid.
+func (r *TLVReader) Next() bool {
+	if r.err != nil || r.decoder.pos >= len(r.decoder.buff) {
+		return false
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			r.err = panicError(e, "binary.TLVReader.Next")
+		}
+	}()
+	r.tag, r.value = r.decoder.TLV()
+	return true
+}
+
+// Tag returns tag of the current record.
+func (r *TLVReader) Tag() uint64 {
+	return r.tag
+}
+
+// Value returns value of the current record, which refers to the buffer.
+func (r *TLVReader) Value() []byte {
+	return r.value
+}
+
+// Decode decode value of the current record to data, as Decode.
+func (r *TLVReader) Decode(data interface{}) error {
+	return Decode(r.value, data)
+}
+
+// Err returns the error of invalid record, or nil if there is not.
+func (r *TLVReader) Err() error {
+	return r.err
+}
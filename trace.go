@@ -0,0 +1,60 @@
+// trace how fields of structs map onto bytes during encoding/decoding, for
+// protocol analyzers and test assertions.
+
+package binary
+
+import (
+	"reflect"
+)
+
+// TraceField is a field of struct traced during encoding/decoding.
+type TraceField struct {
+	Struct reflect.Type //type of the struct
+	Name   string       //name of the field
+	Type   reflect.Type //type of the field
+	Offset int          //offset of the field value in buffer
+	Size   int          //bytes number of the field value, 0 for bools sharing bytes of previous bools
+	Decode bool         //if traced by Decoder, or Encoder
+}
+
+// Tracer observe fields of structs during encoding/decoding, which is set by
+// Encoder.SetTracer or Decoder.SetTracer.
+// TraceField is called after a field is coded, so fields of nested structs
+// are traced before the fields contain them.
+// Fields of structs coded by columns are not traced, and fields are not
+// traced when decoding from a reader.
+type Tracer interface {
+	TraceField(f TraceField)
+}
+
+// SetTracer set tracer to observe fields of structs encoded by Encoder, nil
+// means not.
+func (encoder *Encoder) SetTracer(tracer Tracer) {
+	encoder.tracer = tracer
+}
+
+// SetTracer set tracer to observe fields of structs decoded by Decoder, nil
+// means not.
+func (decoder *Decoder) SetTracer(tracer Tracer) {
+	decoder.tracer = tracer
+}
+
+// trace call tracer with field i of struct t coded in buffer from start to end.
+func trace(tracer Tracer, t reflect.Type, i, start, end int, decode bool) {
+	f := t.Field(i)
+	tracer.TraceField(TraceField{Struct: t, Name: f.Name, Type: f.Type, Offset: start, Size: end - start, Decode: decode})
+}
+
+// traceField call tracer of encoder with field i of struct t encoded from start.
+func (encoder *Encoder) traceField(t reflect.Type, i, start int) {
+	if encoder.tracer != nil {
+		trace(encoder.tracer, t, i, encoder.traceBase+start, encoder.traceBase+encoder.pos, false)
+	}
+}
+
+// traceField call tracer of decoder with field i of struct t decoded from start.
+func (decoder *Decoder) traceField(t reflect.Type, i, start int) {
+	if decoder.tracer != nil && decoder.reader == nil {
+		trace(decoder.tracer, t, i, decoder.traceBase+start, decoder.traceBase+decoder.pos, true)
+	}
+}
@@ -0,0 +1,202 @@
+// encode/decode 128-bit integers, for IPv6 addresses, hashes and keys of
+// databases.
+
+package binary
+
+import (
+	"reflect"
+)
+
+func init() {
+	_builtinCodecs[reflect.TypeOf(Uint128{})] = &uint128Codec
+	_builtinCodecs[reflect.TypeOf(Int128{})] = &int128Codec
+}
+
+// MaxVarintLen128 is the maximum length of a varint-encoded 128-bit integer.
+const MaxVarintLen128 = 19
+
+var errOverflow128 = errorf(ErrOverflow, "binary: varint overflows a 128-bit integer")
+
+// Uint128 is an unsigned 128-bit integer of high and low 64 bits.
+type Uint128 struct {
+	Hi uint64
+	Lo uint64
+}
+
+// Int128 is a signed 128-bit integer of high and low 64 bits, in two's
+// complement.
+type Int128 struct {
+	Hi int64
+	Lo uint64
+}
+
+// zigzag128 maps signed x to unsigned, as ToUvarint.
+func zigzag128(x Int128) Uint128 {
+	sign := uint64(x.Hi >> 63)
+	return Uint128{Hi: uint64(x.Hi)<<1 | x.Lo>>63 ^ sign, Lo: x.Lo<<1 ^ sign}
+}
+
+// unzigzag128 maps unsigned x to signed, as ToVarint.
+func unzigzag128(x Uint128) Int128 {
+	sign := -(x.Lo & 1)
+	return Int128{Hi: int64(x.Hi>>1 ^ sign), Lo: (x.Lo>>1 | x.Hi<<63) ^ sign}
+}
+
+// SizeofUvarint128 returns bytes number of x encoded as uvarint.
+func SizeofUvarint128(x Uint128) int {
+	if x.Hi == 0 {
+		return SizeofUvarint(x.Lo)
+	}
+	bits := 64
+	for h := x.Hi; h != 0; h >>= 1 {
+		bits++
+	}
+	return (bits + 6) / 7
+}
+
+// Uint128 encode a Uint128 value to Encoder buffer.
+// It is encoded as 16 bytes in endian of Encoder, or as uvarint(1~19 bytes)
+// if packed.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Uint128(x Uint128, packed bool) {
+	if packed {
+		encoder.Uvarint128(x)
+		return
+	}
+	if encoder.endian == Endian(BigEndian) {
+		encoder.Uint64(x.Hi, false)
+		encoder.Uint64(x.Lo, false)
+	} else {
+		encoder.Uint64(x.Lo, false)
+		encoder.Uint64(x.Hi, false)
+	}
+}
+
+// Int128 encode an Int128 value to Encoder buffer.
+// It is encoded as 16 bytes in endian of Encoder, or as zigzag varint(1~19
+// bytes) if packed.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Int128(x Int128, packed bool) {
+	if packed {
+		encoder.Uvarint128(zigzag128(x))
+		return
+	}
+	encoder.Uint128(Uint128{Hi: uint64(x.Hi), Lo: x.Lo}, false)
+}
+
+// Uvarint128 encode a Uint128 value to Encoder buffer with varint(1~19 bytes).
+// It is always of format VarintLEB128.
+// It will panic if buffer is not enough.
+func (encoder *Encoder) Uvarint128(x Uint128) int {
+	i := 0
+	for x.Hi != 0 || x.Lo >= 0x80 {
+		encoder.Uint8(byte(x.Lo) | 0x80)
+		x.Lo = x.Lo>>7 | x.Hi<<57
+		x.Hi >>= 7
+		i++
+	}
+	encoder.Uint8(byte(x.Lo))
+	return i + 1
+}
+
+// Uint128 decode a Uint128 value from Decoder buffer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) Uint128(packed bool) Uint128 {
+	if packed {
+		x, _ := decoder.Uvarint128()
+		return x
+	}
+	if decoder.endian == Endian(BigEndian) {
+		hi := decoder.Uint64(false)
+		return Uint128{Hi: hi, Lo: decoder.Uint64(false)}
+	}
+	lo := decoder.Uint64(false)
+	return Uint128{Hi: decoder.Uint64(false), Lo: lo}
+}
+
+// Int128 decode an Int128 value from Decoder buffer.
+// It will panic if buffer is not enough.
+func (decoder *Decoder) Int128(packed bool) Int128 {
+	if packed {
+		x, _ := decoder.Uvarint128()
+		return unzigzag128(x)
+	}
+	x := decoder.Uint128(false)
+	return Int128{Hi: int64(x.Hi), Lo: x.Lo}
+}
+
+// Uvarint128 decode a Uint128 value from Decoder buffer with varint(1~19 bytes).
+// It will panic if buffer is not enough or varint overflows.
+func (decoder *Decoder) Uvarint128() (Uint128, int) {
+	var x Uint128
+	for i, bit := 0, uint(0); i < MaxVarintLen128; i, bit = i+1, bit+7 {
+		b := decoder.Uint8()
+		v := uint64(b & 0x7f)
+		if i == MaxVarintLen128-1 && b > 3 {
+			break //overflow
+		}
+		switch {
+		case bit < 64:
+			x.Lo |= v << bit
+			if bit > 57 {
+				x.Hi |= v >> (64 - bit)
+			}
+		default:
+			x.Hi |= v << (bit - 64)
+		}
+		if b < 0x80 {
+			return x, i + 1
+		}
+	}
+	panic(errOverflow128)
+}
+
+// Uint128 is encoded by Encoder.Uint128, as uvarint with field tag `binary:"packed"`.
+var uint128Codec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		if field.isPacked() {
+			return SizeofUvarint128(v.Interface().(Uint128))
+		}
+		return 16
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		encoder.Uint128(v.Interface().(Uint128), field.isPacked())
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		v.Set(reflect.ValueOf(decoder.Uint128(field.isPacked())))
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		if field.isPacked() {
+			_, n := decoder.Uvarint128()
+			return n
+		}
+		return decoder.Skip(16)
+	},
+}
+
+// Int128 is encoded by Encoder.Int128, as zigzag varint with field tag `binary:"packed"`.
+var int128Codec = typeCodec{
+	size: func(v reflect.Value, field *fieldInfo) int {
+		if field.isPacked() {
+			return SizeofUvarint128(zigzag128(v.Interface().(Int128)))
+		}
+		return 16
+	},
+	encode: func(encoder *Encoder, v reflect.Value, field *fieldInfo) error {
+		encoder.Int128(v.Interface().(Int128), field.isPacked())
+		return nil
+	},
+	decode: func(decoder *Decoder, v reflect.Value, field *fieldInfo) error {
+		v.Set(reflect.ValueOf(decoder.Int128(field.isPacked())))
+		return nil
+	},
+	skip: func(decoder *Decoder, field *fieldInfo) int {
+		if field.isPacked() {
+			_, n := decoder.Uvarint128()
+			return n
+		}
+		return decoder.Skip(16)
+	},
+}
@@ -0,0 +1,53 @@
+// encode/decode unexported fields of structs declared by field tag
+// `binary:"unexported"`, for snapshots of internal state.
+//
+// The fields are accessed by unsafe, as
+//
+//	type counter struct {
+//		_     struct{} `binary:"unexported"`
+//		name  string
+//		count uint64
+//	}
+//
+// Field tags take effect only for structs registered by RegStruct.
+// Unexported fields are encoded in the binary format of Encoder only, and are
+// still ignored by MessagePack, CBOR, protobuf and the other formats.
+
+package binary
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// declaresUnexported reports whether struct t is declared by field tag
+// `binary:"unexported"` of any field.
+func declaresUnexported(t reflect.Type) bool {
+	for i, n := 0, t.NumField(); i < n; i++ {
+		if hasTagOption(t.Field(i).Tag.Get("binary"), "unexported") {
+			return true
+		}
+	}
+	return false
+}
+
+// addressable returns v or an addressable copy of it, so that unexported
+// fields of v are accessible by unsafe.
+func (info *structInfo) addressable(v reflect.Value) reflect.Value {
+	if info == nil || !info.unexported || v.CanAddr() {
+		return v
+	}
+	p := reflect.New(v.Type()).Elem()
+	p.Set(v)
+	return p
+}
+
+// fieldOf returns field i of struct v, which is accessed by unsafe if it is an
+// unexported field of struct declared by field tag `binary:"unexported"`.
+func (info *structInfo) fieldOf(v reflect.Value, i int) reflect.Value {
+	f := v.Field(i)
+	if info != nil && info.unexported && !f.CanInterface() && f.CanAddr() {
+		f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+	}
+	return f
+}
@@ -0,0 +1,45 @@
+// validate decoded strings as UTF-8, for applications that must not
+// propagate invalid text.
+
+package binary
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 decoded string is not valid UTF-8 with UTF8Error mode
+var ErrInvalidUTF8 = errors.New("binary.Decoder.Value: invalid UTF-8 string")
+
+// UTF8Mode is how Decoder handles decoded strings which are not valid UTF-8.
+type UTF8Mode int
+
+const (
+	// UTF8Unchecked strings are not validated, by default
+	UTF8Unchecked UTF8Mode = iota
+	// UTF8Error Value returns error of ErrInvalidUTF8
+	UTF8Error
+	// UTF8Replace each run of invalid bytes is replaced by utf8.RuneError(U+FFFD)
+	UTF8Replace
+)
+
+// SetUTF8Mode set how Decoder handles decoded strings which are not valid
+// UTF-8, UTF8Unchecked by default.
+// It works for strings of MessagePack/CBOR format too, but not for map keys
+// of byte strings decoded to interface{}.
+func (decoder *Decoder) SetUTF8Mode(mode UTF8Mode) {
+	decoder.utf8Mode = mode
+}
+
+// validString returns decoded string s validated by UTF-8 mode of decoder.
+// It will panic if s is invalid in UTF8Error mode.
+func (decoder *Decoder) validString(s string) string {
+	if decoder.utf8Mode == UTF8Unchecked || utf8.ValidString(s) {
+		return s
+	}
+	if decoder.utf8Mode == UTF8Error {
+		panic(ErrInvalidUTF8)
+	}
+	return strings.ToValidUTF8(s, string(utf8.RuneError))
+}
@@ -25,7 +25,6 @@ package binary
 // format incompatible with a varint encoding for larger numbers (say 128-bit).
 
 import (
-	"errors"
 	"io"
 )
 
@@ -54,15 +53,18 @@ func PutUvarint(buf []byte, x uint64) int {
 // and the number of bytes n is <= 0 meaning:
 //
 //	n == 0: buf too small
-//	n  < 0: value larger than 64 bits (overflow)
-//              and -n is the number of bytes read
+//	n  < 0: value larger than 64 bits (overflow), or not terminated in
+//	        MaxVarintLen64 bytes, and -n is the number of bytes read
 //
 func Uvarint(buf []byte) (uint64, int) {
 	var x uint64
 	var s uint
 	for i, b := range buf {
+		if i == MaxVarintLen64 { // non-terminating
+			return 0, -(i + 1) // overflow
+		}
 		if b < 0x80 {
-			if i > 9 || i == 9 && b > 1 {
+			if i == MaxVarintLen64-1 && b > 1 {
 				return 0, -(i + 1) // overflow
 			}
 			return x | uint64(b)<<s, i + 1
@@ -92,19 +94,21 @@ func Varint(buf []byte) (int64, int) {
 	return ToVarint(ux), n
 }
 
-var errOverflow = errors.New("binary: varint overflows a 64-bit integer")
+var errOverflow = errorf(ErrOverflow, "binary: varint overflows a 64-bit integer")
 
 // ReadUvarint reads an encoded unsigned integer from r and returns it as a uint64.
+// It reads at most MaxVarintLen64 bytes, and returns error of ErrOverflow if
+// the value is larger than 64 bits.
 func ReadUvarint(r io.ByteReader) (uint64, error) {
 	var x uint64
 	var s uint
-	for i := 0; ; i++ {
+	for i := 0; i < MaxVarintLen64; i++ {
 		b, err := r.ReadByte()
 		if err != nil {
 			return x, err
 		}
 		if b < 0x80 {
-			if i > 9 || i == 9 && b > 1 {
+			if i == MaxVarintLen64-1 && b > 1 {
 				return x, errOverflow
 			}
 			return x | uint64(b)<<s, nil
@@ -112,6 +116,7 @@ func ReadUvarint(r io.ByteReader) (uint64, error) {
 		x |= uint64(b&0x7f) << s
 		s += 7
 	}
+	return x, errOverflow
 }
 
 // ReadVarint reads an encoded signed integer from r and returns it as an int64.
@@ -0,0 +1,113 @@
+// varint formats of other systems, to read and write their blobs natively.
+
+package binary
+
+import (
+	"fmt"
+	"math"
+)
+
+// VarintFormat is the format of varints encoded/decoded by Encoder/Decoder.
+// Signed varints are zigzag encoded in any format.
+type VarintFormat int
+
+const (
+	// VarintLEB128 is little-endian base 128 of 1~10 bytes, as encoding/binary and protobuf.
+	VarintLEB128 VarintFormat = iota
+	// VarintSQLite is big-endian base 128 of 1~9 bytes, and the 9th byte holds 8 bits,
+	// as varints of SQLite.
+	VarintSQLite
+	// VarintGit is big-endian base 128 of 1~10 bytes, and each continuation byte adds
+	// 1 to the value before shifting, as offsets of git packs.
+	VarintGit
+)
+
+func (f VarintFormat) String() string {
+	switch f {
+	case VarintLEB128:
+		return "LEB128"
+	case VarintSQLite:
+		return "SQLite"
+	case VarintGit:
+		return "Git"
+	}
+	return fmt.Sprintf("VarintFormat(%d)", int(f))
+}
+
+// SetVarintFormat set format of varints of Encoder, VarintLEB128 by default.
+// Varints of other formats are no longer than LEB128,
+// so that Sizeof is enough as buffer size.
+func (encoder *Encoder) SetVarintFormat(f VarintFormat) {
+	encoder.varint = f
+}
+
+// SetVarintFormat set format of varints of Decoder, VarintLEB128 by default.
+func (decoder *Decoder) SetVarintFormat(f VarintFormat) {
+	decoder.varint = f
+}
+
+// sqliteUvarint encode x as SQLite varint.
+func (encoder *Encoder) sqliteUvarint(x uint64) int {
+	if x>>56 != 0 { //9 bytes
+		b := encoder.reserve(9)
+		b[8] = byte(x)
+		x >>= 8
+		for i := 7; i >= 0; i-- {
+			b[i] = byte(x&0x7f) | 0x80
+			x >>= 7
+		}
+		return 9
+	}
+	var buf [8]byte
+	pos := len(buf) - 1
+	buf[pos] = byte(x & 0x7f)
+	for x >>= 7; x != 0; x >>= 7 {
+		pos--
+		buf[pos] = byte(x&0x7f) | 0x80
+	}
+	copy(encoder.reserve(len(buf)-pos), buf[pos:])
+	return len(buf) - pos
+}
+
+// gitUvarint encode x as git varint.
+func (encoder *Encoder) gitUvarint(x uint64) int {
+	var buf [MaxVarintLen64]byte
+	pos := len(buf) - 1
+	buf[pos] = byte(x & 0x7f)
+	for x >>= 7; x != 0; x >>= 7 {
+		x--
+		pos--
+		buf[pos] = byte(x&0x7f) | 0x80
+	}
+	copy(encoder.reserve(len(buf)-pos), buf[pos:])
+	return len(buf) - pos
+}
+
+// sqliteUvarint decode a SQLite varint.
+func (decoder *Decoder) sqliteUvarint() (uint64, int) {
+	var x uint64
+	for i := 0; i < 8; i++ {
+		b := decoder.Uint8()
+		x = x<<7 | uint64(b&0x7f)
+		if b < 0x80 {
+			return x, i + 1
+		}
+	}
+	return x<<8 | uint64(decoder.Uint8()), 9
+}
+
+// gitUvarint decode a git varint.
+func (decoder *Decoder) gitUvarint() (uint64, int) {
+	b := decoder.Uint8()
+	x := uint64(b & 0x7f)
+	n := 1
+	for b >= 0x80 {
+		if x >= math.MaxUint64>>7 {
+			panic(errorf(ErrOverflow, "binary.Decoder.Uvarint: overflow 64-bits value(pos:%d/%d)", decoder.Len(), decoder.Cap()))
+		}
+		b = decoder.Uint8()
+		x = (x+1)<<7 | uint64(b&0x7f)
+		n++
+	}
+	return x, n
+}
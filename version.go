@@ -0,0 +1,145 @@
+// decode old encodings of versioned structs into new struct definitions, for
+// field tag `binary:"version=N"`.
+// A versioned struct is encoded with its version as uvarint before its fields,
+// so encodings of other versions are migrated by registed functions instead
+// of being misparsed when fields are added.
+
+package binary
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var tError = reflect.TypeOf((*error)(nil)).Elem()
+
+// migration convert old version of struct to the newer one.
+type migration struct {
+	old     reflect.Type  //struct type of old version
+	version int           //version of old struct
+	fn      reflect.Value //func(*Old, *New) error
+}
+
+// RegMigration regist migration function fn, as func(old *Old, new *New) error,
+// to decode encodings of struct Old into struct New.
+// Old and New must be versioned by field tag `binary:"version=N"`, as
+//
+//	type New struct {
+//		_ struct{} `binary:"version=2"`
+//		...
+//	}
+//
+// and version of Old must be less than New. They are registed if not.
+// Encoding of version v is decoded to New by the migration from the lowest
+// version not less than v, of which Old is decoded by its migrations likewise
+// if its version is not v.
+// Versions are encoded in the default format only, and not encoded for
+// elements of field tag `binary:"columnar"`.
+func RegMigration(fn interface{}) error {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func || f.IsNil() {
+		return fmt.Errorf("binary.RegMigration: %T is not func(*Old, *New) error", fn)
+	}
+	t := f.Type()
+	if t.NumIn() != 2 || t.NumOut() != 1 || t.Out(0) != tError ||
+		t.In(0).Kind() != reflect.Ptr || t.In(0).Elem().Kind() != reflect.Struct ||
+		t.In(1).Kind() != reflect.Ptr || t.In(1).Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("binary.RegMigration: %T is not func(*Old, *New) error", fn)
+	}
+	oldInfo, err := regStructInfo(t.In(0).Elem())
+	if err != nil {
+		return err
+	}
+	newInfo, err := regStructInfo(t.In(1).Elem())
+	if err != nil {
+		return err
+	}
+	if oldInfo.version <= 0 || oldInfo.version >= newInfo.version {
+		return fmt.Errorf("binary.RegMigration: invalid migration from %s version %d to %s version %d",
+			oldInfo.identify, oldInfo.version, newInfo.identify, newInfo.version)
+	}
+	for _, m := range newInfo.migrations {
+		if m.version == oldInfo.version {
+			return fmt.Errorf("binary.RegMigration: duplicate migration of %s from version %d",
+				newInfo.identify, oldInfo.version)
+		}
+	}
+	newInfo.migrations = append(newInfo.migrations, &migration{old: t.In(0).Elem(), version: oldInfo.version, fn: f})
+	sort.Slice(newInfo.migrations, func(i, j int) bool {
+		return newInfo.migrations[i].version < newInfo.migrations[j].version
+	})
+	return nil
+}
+
+// regStructInfo returns info of struct t, regist it if not.
+func regStructInfo(t reflect.Type) (*structInfo, error) {
+	if info := queryStruct(t); info != nil {
+		return info, nil
+	}
+	if err := _structInfoMgr.regist(t); err != nil {
+		return nil, err
+	}
+	return queryStruct(t), nil
+}
+
+// versionOf returns version of the struct, 0 means not versioned.
+func (info *structInfo) versionOf() int {
+	if info != nil {
+		return info.version
+	}
+	return 0
+}
+
+// migration returns the migration from the lowest version not less than version,
+// or nil if not found.
+func (info *structInfo) migration(version int) *migration {
+	for _, m := range info.migrations {
+		if m.version >= version {
+			return m
+		}
+	}
+	return nil
+}
+
+// migrate decode struct v of which encoding is version from start by migrations.
+func (info *structInfo) migrate(decoder *Decoder, v reflect.Value, version, start int) error {
+	m := info.migration(version)
+	if m == nil {
+		return fmt.Errorf("binary: %s has no migration from version %d", info.identify, version)
+	}
+	old := reflect.New(m.old)
+	if err := queryStruct(m.old).decodeVersion(decoder, old.Elem(), version, start); err != nil {
+		return err
+	}
+	p := reflect.New(v.Type())
+	info.setDefaults(p.Elem(), nil) //fields not set by migration
+	if err := m.fn.Call([]reflect.Value{old, p})[0].Interface(); err != nil {
+		return err.(error)
+	}
+	v.Set(p.Elem())
+	return nil
+}
+
+// skipVersion skip struct of type t of which encoding is version from start,
+// and returns bytes skiped.
+// It will panic if no migration is found.
+func (info *structInfo) skipVersion(decoder *Decoder, t reflect.Type, version, start int) int {
+	if version == info.versionOf() {
+		return info.skipFields(decoder, t, start)
+	}
+	m := info.migration(version)
+	if m == nil {
+		panic(fmt.Errorf("binary: %s has no migration from version %d", info.identify, version))
+	}
+	return queryStruct(m.old).skipVersion(decoder, m.old, version, start)
+}
+
+// version decode version of versioned struct, and returns it with bytes decoded.
+func (decoder *Decoder) version() (int, int) {
+	x, n := decoder.Uvarint()
+	if n <= 0 || x > uint64(maxInt) {
+		panic(fmt.Errorf("binary: invalid struct version %d", x))
+	}
+	return int(x), n
+}